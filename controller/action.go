@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+)
+
+// Action is a custom action on the model loaded by the id in the path,
+// e.g. cancelling an order. It runs in the transaction tx: returning an
+// error rolls it back.
+//
+// The result is responded as the model of a success response, or the model
+// itself if the result is nil. The action may also respond by itself (e.g.
+// ResponseError with its own code), and then nothing more is responded.
+type Action[T any] func(c *gin.Context, tx *gorm.DB, model *T) (result any, err error)
+
+// ActionHandler handles
+//
+//	METHOD /T/:idParam/action
+//
+// It loads the model T with the given id, and applies the action to it
+// in a transaction. See router.Action.
+//
+// Response:
+//   - 200 OK: { T: {...} }  // or the result of the action
+//   - 400 Bad Request: { error: "missing id" }
+//   - 404 Not Found: { error: "record with id not found" }
+//   - 422 Unprocessable Entity: { error: "action failed" }
+func ActionHandler[T orm.Model](idParam string, action Action[T], opt *enum.ActionOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ActionHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+
+		model, err := getModelByID[T](c, idParam, options...)
+		if errors.Is(err, ErrMissingID) {
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ActionHandler: getModelByID failed")
+			ResponseError(c, CodeNotFound, err)
+			return
+		}
+
+		var result any
+		err = service.Transaction(c, func(tx *gorm.DB) (err error) {
+			result, err = action(c, tx, model)
+			return err
+		})
+		if c.Writer.Written() {
+			return
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ActionHandler: action failed")
+			ResponseError(c, getErrorCode(err), err)
+			return
+		}
+		if result == nil {
+			result = model
+		}
+		ResponseSuccess(c, result)
+	}
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/pkg/cache"
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+)
+
+// cachedHeaders are the headers of the responses stored with the bodies.
+var cachedHeaders = []string{"Content-Type", "Content-Range", "Accept-Ranges", "Last-Modified", "Warning", "Link"}
+
+// cachedResponse is a response stored in the cache.
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// withCache wraps the handler of the model T by the cache of the opt (if
+// any): the success responses are stored by the request (see cacheKey),
+// and the hits are responded without calling the handler.
+func withCache[T any](opt *enum.CacheOption, handler gin.HandlerFunc) gin.HandlerFunc {
+	if opt == nil || opt.Cache == nil {
+		return handler
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		panic(fmt.Sprintf("withCache: %v", err))
+	}
+	table := s.Table
+	registerCacheInvalidation(table, opt.Cache)
+
+	return func(c *gin.Context) {
+		if bypassCache(c) {
+			c.Header("X-Cache", "BYPASS")
+			handler(c)
+			return
+		}
+		key, err := cacheKey(c, opt, table)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("withCache: cacheKey failed")
+			handler(c)
+			return
+		}
+		value, ok, err := opt.Cache.Get(c, key)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("withCache: Get failed")
+		}
+		var entry cachedResponse
+		if ok && json.Unmarshal(value, &entry) == nil {
+			for name, values := range entry.Header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header("X-Cache", "HIT")
+			c.Data(entry.Status, entry.Header.Get("Content-Type"), entry.Body)
+			return
+		}
+
+		c.Header("X-Cache", "MISS")
+		recorder := &cacheRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		handler(c)
+		c.Writer = recorder.ResponseWriter
+
+		if status := recorder.Status(); status != http.StatusOK && status != http.StatusPartialContent {
+			return
+		}
+		entry = cachedResponse{Status: recorder.Status(), Header: http.Header{}, Body: recorder.body.Bytes()}
+		for _, name := range cachedHeaders {
+			if values := recorder.Header().Values(name); len(values) > 0 {
+				entry.Header[name] = values
+			}
+		}
+		value, err = json.Marshal(entry)
+		if err == nil {
+			err = opt.Cache.Set(c, key, value, opt.TTL)
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("withCache: Set failed")
+		}
+	}
+}
+
+// bypassCache reports whether the request bypasses the cache: with
+// Cache-Control: no-cache or no-store, or a conditional request.
+func bypassCache(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store":
+			return true
+		}
+	}
+	return c.GetHeader("If-None-Match") != "" || c.GetHeader("If-Modified-Since") != ""
+}
+
+// cacheKey returns the key of the request in the cache: of the table,
+// its current generation (see invalidateCaches), and the hash of the
+// path, the normalized (sorted) query, the Accept and Range headers, the
+// user, tenant and roles of the request (see reqctx), and the Key of the
+// opt.
+func cacheKey(c *gin.Context, opt *enum.CacheOption, table string) (string, error) {
+	generation, ok, err := opt.Cache.Get(c, generationKey(table))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		// a new one, not "0": the generation may be evicted from the
+		// cache before the entries of the old ones
+		generation = newGeneration()
+		if err := opt.Cache.Set(c, generationKey(table), generation, 0); err != nil {
+			return "", err
+		}
+	}
+	userID, _ := reqctx.UserID(c)
+	tenantID, _ := reqctx.TenantID(c)
+	hash := sha256.New()
+	for _, part := range []string{
+		c.Request.URL.Path, c.Request.URL.Query().Encode(),
+		c.GetHeader("Accept"), c.GetHeader("Range"),
+		fmt.Sprint(userID), fmt.Sprint(tenantID), strings.Join(reqctx.Roles(c), ","),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	if opt.Key != nil {
+		hash.Write([]byte(opt.Key(c)))
+	}
+	return fmt.Sprintf("crud:%s:%s:%s", table, generation, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// newGeneration returns a new generation of the entries of a table.
+func newGeneration() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+// generationKey is the key of the generation of the entries of the table,
+// which is changed to invalidate them all.
+func generationKey(table string) string {
+	return "crud:generation:" + table
+}
+
+// cacheInvalidation is the caches of the tables, invalidated by the
+// mutations of the tables (see orm.OnMutation).
+var cacheInvalidation struct {
+	sync.Mutex
+	once   sync.Once
+	caches map[string][]cache.Cache
+}
+
+func registerCacheInvalidation(table string, c cache.Cache) {
+	cacheInvalidation.once.Do(func() {
+		cacheInvalidation.caches = map[string][]cache.Cache{}
+		orm.OnMutation(invalidateCaches)
+	})
+	cacheInvalidation.Lock()
+	defer cacheInvalidation.Unlock()
+	cacheInvalidation.caches[table] = append(cacheInvalidation.caches[table], c)
+}
+
+// invalidateCaches invalidates the entries of the table, by changing its
+// generation: the entries of the old ones are not reached anymore, and
+// expire by their TTLs, or are evicted (e.g. by cache.Memory.MaxEntries).
+func invalidateCaches(db *gorm.DB, table string) {
+	cacheInvalidation.Lock()
+	caches := cacheInvalidation.caches[table]
+	cacheInvalidation.Unlock()
+
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	generation := newGeneration()
+	for _, c := range caches {
+		if err := c.Set(ctx, generationKey(table), generation, 0); err != nil {
+			logger.WithContext(ctx).WithError(err).WithField("table", table).
+				Warn("invalidateCaches: Set failed")
+		}
+	}
+}
+
+// cacheRecorder is a gin.ResponseWriter keeping a copy of the body.
+type cacheRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *cacheRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/pkg/cache"
+	"github.com/tqrj/cd/reqctx"
+	"github.com/tqrj/cd/service"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+type memo struct {
+	orm.BasicModel
+	Owner string `json:"owner"`
+	Text  string `json:"text"`
+}
+
+// ownerScope scopes the memos to the user of the request.
+func ownerScope(c *gin.Context, _ enum.GetRequestOptions) enum.QueryOption {
+	userID, _ := reqctx.UserID(c)
+	return service.FilterBy("owner", userID)
+}
+
+func TestGetListHandler_Cache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &memo{})
+	for _, m := range []memo{{Owner: "ann", Text: "a"}, {Owner: "bob", Text: "b"}} {
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			reqctx.SetUserID(c, user)
+		}
+	})
+	r.GET("/memos", GetListHandler[memo](&enum.ListOption{
+		LimitMax:           10,
+		QueryOptionClosure: ownerScope,
+		Cache:              &enum.CacheOption{Cache: cache.NewMemory()},
+	}))
+	r.GET("/expiring", GetListHandler[memo](&enum.ListOption{
+		LimitMax: 10,
+		Cache:    &enum.CacheOption{Cache: cache.NewMemory(), TTL: 30 * time.Millisecond},
+	}))
+
+	get := func(url, user, wantCache string, wantTexts ...string) {
+		t.Helper()
+		w := serve(r, http.MethodGet, url, "", "X-User", user)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s as %s: code = %d: %s", url, user, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Cache"); got != wantCache {
+			t.Errorf("GET %s as %s: X-Cache = %s, want %s", url, user, got, wantCache)
+		}
+		var body struct {
+			Memos []memo `json:"memos"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		var texts []string
+		for _, m := range body.Memos {
+			texts = append(texts, m.Text)
+		}
+		if len(texts) != len(wantTexts) {
+			t.Fatalf("GET %s as %s: texts = %v, want %v", url, user, texts, wantTexts)
+		}
+		for i := range texts {
+			if texts[i] != wantTexts[i] {
+				t.Errorf("GET %s as %s: texts = %v, want %v", url, user, texts, wantTexts)
+			}
+		}
+	}
+
+	get("/memos", "ann", "MISS", "a")
+	get("/memos", "ann", "HIT", "a")
+	get("/memos", "bob", "MISS", "b") // by user: not the response of ann
+	get("/memos", "bob", "HIT", "b")
+
+	if err := db.Create(&memo{Owner: "ann", Text: "c"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	get("/memos", "ann", "MISS", "a", "c") // invalidated by the write
+	get("/memos", "ann", "HIT", "a", "c")
+	get("/memos", "bob", "MISS", "b")
+
+	get("/expiring", "", "MISS", "a", "b", "c")
+	get("/expiring", "", "HIT", "a", "b", "c")
+	time.Sleep(40 * time.Millisecond)
+	get("/expiring", "", "MISS", "a", "b", "c")
+}
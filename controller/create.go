@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
 	"github.com/tqrj/cd/service"
+	"path"
 	"reflect"
 )
 
@@ -15,19 +18,28 @@ import (
 // creates a new model T, responds with the created model T if successful.
 //
 // Request body:
-//   - {...}  // fields of the model T
+//   - {...}  // fields of the model T, with the nested associations to create (see CreateOption.FullSaveAssociations)
 //
 // Response:
-//   - 200 OK: { T: {...} }
+//   - 200 OK: { T: {...}, meta: { id: 1, rows_affected: 1 } }  // the nested associations with their ids and foreign keys
+//   - 200 OK: { dry_run_sql: [{ sql: "INSERT ...", vars: [...] }] }  // for ?dry_run_sql=true, see CreateOption.AllowDryRunSQL
+//   - 204 No Content: for "Prefer: return=minimal", with a Location header
 //   - 400 Bad Request: { error: "request band failed" }
-//   - 422 Unprocessable Entity: { error: "create process failed" }
+//   - 409 Conflict: { error: "duplicate record: by email", T: {...}, duplicate: {...} }  // the existing model (if in the scope), see withDuplicate
+//   - 422 Unprocessable Entity: { error: "validation or create process failed" }  // validation: {...} of an orm.TxValidator, see withValidation
 func CreateHandler[T any](opt *enum.CreateOption) gin.HandlerFunc {
+	for _, column := range opt.UniqueBy {
+		if _, err := orm.LookUpField(new(T), column); err != nil {
+			panic(fmt.Sprintf("CreateHandler: UniqueBy: %v", err))
+		}
+	}
+	mustUniqueKeys[T]("CreateHandler")
 	return func(c *gin.Context) {
 		var model T
-		if err := c.ShouldBindJSON(&model); err != nil {
+		if err := bindJSON(c, &model, opt.DisallowUnknownFields); err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("CreateHandler: Bind failed")
-			ResponseError(c, CodeBadRequest, err)
+			ResponseError(c, getBindErrorCode(err), err)
 			return
 		}
 		if opt.Pretreat != nil {
@@ -40,15 +52,105 @@ func CreateHandler[T any](opt *enum.CreateOption) gin.HandlerFunc {
 			}
 			model = res.(T)
 		}
+		session, dryRun, err := dryRunSQL(c, opt.AllowDryRunSQL, opt.Session)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("CreateHandler: dryRunSQL failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		createOpt := *opt
+		createOpt.Session = session
 		logger.WithContext(c).Tracef("CreateHandler: Create %#v", model)
-		err := service.Create(c, &model, opt, service.IfNotExist())
+		err = service.Create(c, &model, &createOpt, service.IfNotExist())
+		if errors.Is(err, service.ErrDuplicate) {
+			logger.WithContext(c).WithError(err).
+				Warn("CreateHandler: duplicate")
+			ResponseError(c, CodeConflict, withDuplicate[T](c, err, opt.QueryOptionClosure))
+			return
+		}
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("CreateHandler: Create failed")
-			ResponseError(c, CodeProcessFailed, err)
+			ResponseError(c, CodeProcessFailed, withValidation(err))
+			return
+		}
+		if dryRun != nil {
+			responseDryRun(c, dryRun)
+			return
+		}
+		if preferReturnMinimal(c) {
+			var location string
+			if id, ok := identityOf(model); ok {
+				location = path.Join(c.Request.URL.Path, fmt.Sprint(id))
+			}
+			responseMinimal(c, location)
 			return
 		}
-		c.JSON(200, SuccessResponseBody(model))
+		meta := new(Meta).SetRowsAffected(1)
+		if id, ok := identityOf(model); ok {
+			meta.SetID(id)
+		}
+		ResponseSuccess(c, model, meta.H())
+	}
+}
+
+// withDuplicate wraps the *service.DuplicateError (if err is one) with the
+// existing model and the conflicting key of the error response body:
+//
+//	{
+//	    error: "duplicate record: by tenant_id, sku",
+//	    Product: {...},  // the existing model
+//	    duplicate: { columns: ["tenant_id", "sku"], values: { tenant_id: 1, sku: "A-1" } },
+//	}
+//
+// The keys are the CreateOption.UniqueBy columns, or the ones of the
+// orm.UniqueKeyer of the model. The existing model is looked up again
+// under the scope (the QueryOptionClosure of the route, if any), and is
+// only responded if found: the unique keys are checked over all the rows,
+// whose ones out of the scope (e.g. of other tenants) are not disclosed.
+func withDuplicate[T any](c *gin.Context, err error, scope enum.QueryOptionClosure) error {
+	var duplicate *service.DuplicateError
+	if !errors.As(err, &duplicate) {
+		return err
+	}
+	body := gin.H{"duplicate": gin.H{"columns": duplicate.Columns, "values": duplicate.Values}}
+	if scope != nil {
+		options := []enum.QueryOption{scope(c, enum.GetRequestOptions{})}
+		for column, value := range duplicate.Values {
+			options = append(options, service.FilterBy(column, value))
+		}
+		if lookupErr := service.Get[T](c, new(T), options...); lookupErr != nil {
+			logger.WithContext(c).WithError(lookupErr).
+				Debug("withDuplicate: existing model out of scope, not responded")
+			return withResponseBody(err, body)
+		}
+	}
+	existing := inTimeLocation(limitDepth(duplicate.Existing))
+	body[getResponseModelName(existing)] = existing
+	return withResponseBody(err, body)
+}
+
+// withValidation wraps the *orm.ValidationError (if err is one) of an
+// orm.TxValidator with the field and message to respond:
+//
+//	{
+//	    error: "validation failed: email: already used by another active account",
+//	    validation: { field: "email", message: "already used by another active account" },
+//	}
+func withValidation(err error) error {
+	var validation *orm.ValidationError
+	if !errors.As(err, &validation) {
+		return err
+	}
+	return withResponseBody(err, gin.H{"validation": validation})
+}
+
+// mustUniqueKeys panics for the invalid unique keys (see orm.UniqueKeyer)
+// of the model T, at the route setup of the handler.
+func mustUniqueKeys[T any](handler string) {
+	if _, err := orm.UniqueKeys(new(T)); err != nil {
+		panic(fmt.Sprintf("%s: UniqueKeys: %v", handler, err))
 	}
 }
 
@@ -67,10 +169,12 @@ func CreateHandler[T any](opt *enum.CreateOption) gin.HandlerFunc {
 //   - {...}  // fields of the child model T
 //
 // Response:
-//   - 200 OK: { P: {...} }
+//   - 200 OK: { P: {...}, meta: { id: 1, rows_affected: 1 } }  // id of the child
 //   - 400 Bad Request: { error: "request band failed" }
-//   - 422 Unprocessable Entity: { error: "create process failed" }
+//   - 422 Unprocessable Entity: { error: "validation or create process failed" }
 func CreateNestedHandler[P orm.Model, T orm.Model](parentIDRouteParam string, field string, opt *enum.CreateOption) gin.HandlerFunc {
+	field = mustAssociation(field, *new(P))
+
 	return func(c *gin.Context) {
 		parentID := c.Param(parentIDRouteParam)
 		if parentID == "" {
@@ -79,10 +183,10 @@ func CreateNestedHandler[P orm.Model, T orm.Model](parentIDRouteParam string, fi
 		}
 
 		var child T
-		if err := c.ShouldBindJSON(&child); err != nil {
+		if err := bindJSON(c, &child, opt.DisallowUnknownFields); err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("CreateNestedHandler: Bind failed")
-			ResponseError(c, CodeBadRequest, err)
+			ResponseError(c, getBindErrorCode(err), err)
 			return
 		}
 
@@ -110,16 +214,90 @@ func CreateNestedHandler[P orm.Model, T orm.Model](parentIDRouteParam string, fi
 		logger.WithContext(c).
 			Tracef("CreateNestedHandler: Create %#v, parent=%#v", child, parent)
 
-		//field := strings.ToUpper(field)[:1] + field[1:]
-		field := nameToField(field, parent)
-
-		err := service.Create(c, &child, opt, service.NestInto(&parent, field, nil))
+		err := service.Create(c, &child, opt, service.NestInto(&parent, field, opt))
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("CreateNestedHandler: CreateNest failed")
 			ResponseError(c, CodeProcessFailed, err)
 			return
 		}
-		ResponseSuccess(c, parent)
+		_, childID := child.Identity()
+		ResponseSuccess(c, parent, new(Meta).SetRowsAffected(1).SetID(childID).H())
+	}
+}
+
+// GetOrCreateManyHandler handles
+//
+//	POST /T/get_or_create
+//
+// ensures the models T in the body exist by their natural keys (opt.Keys),
+// creating the missing ones. See service.GetOrCreateMany.
+//
+// Request body:
+//   - [{...}, ...]  // models T
+//
+// Response:
+//   - 200 OK: { Ts: [{...}, ...], meta: { rows_affected: 1 } }  // all the models, the number created
+//   - 400 Bad Request: { error: "request band failed or too many models" }
+//   - 422 Unprocessable Entity: { error: "validation or create process failed" }
+func GetOrCreateManyHandler[T any](opt *enum.GetOrCreateOption) gin.HandlerFunc {
+	if len(opt.Keys) == 0 {
+		panic("GetOrCreateManyHandler: no Keys")
+	}
+	for _, key := range opt.Keys {
+		if _, err := orm.LookUpField(new(T), key); err != nil {
+			panic(fmt.Sprintf("GetOrCreateManyHandler: %v", err))
+		}
+	}
+
+	return func(c *gin.Context) {
+		var body []T
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetOrCreateManyHandler: Bind failed")
+			ResponseError(c, getBindErrorCode(err), err)
+			return
+		}
+		if opt.LimitMax > 0 && len(body) > opt.LimitMax {
+			err := fmt.Errorf("%w: %d > %d", ErrTooManyModels, len(body), opt.LimitMax)
+			logger.WithContext(c).WithError(err).
+				Warn("GetOrCreateManyHandler: too many models")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		models := make([]*T, len(body))
+		for i := range body {
+			if opt.Pretreat != nil {
+				res, err := opt.Pretreat(c, body[i])
+				if err != nil {
+					logger.WithContext(c).WithError(err).
+						Warn("GetOrCreateManyHandler: Pretreat err")
+					ResponseError(c, CodeBadRequest, err)
+					return
+				}
+				pretreated, ok := res.(T)
+				if !ok {
+					logger.WithContext(c).WithField("result", fmt.Sprintf("%T", res)).
+						Warn("GetOrCreateManyHandler: Pretreat result is not a T")
+					ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %T, want %T", ErrInvalidPretreat, res, body[i]))
+					return
+				}
+				body[i] = pretreated
+			}
+			models[i] = &body[i]
+		}
+
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, enum.GetRequestOptions{}))
+		}
+		result, created, err := service.GetOrCreateMany(c, models, opt.Keys, opt, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetOrCreateManyHandler: GetOrCreateMany failed")
+			ResponseError(c, CodeProcessFailed, err)
+			return
+		}
+		ResponseSuccess(c, nil, gin.H{getResponseModelName(result): result}, new(Meta).SetRowsAffected(created).H())
 	}
 }
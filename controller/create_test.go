@@ -0,0 +1,386 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
+	"github.com/tqrj/cd/service"
+	"github.com/tqrj/cd/service/servicetest"
+	"gorm.io/gorm"
+)
+
+type ticket struct {
+	orm.BasicModel
+	Title  string `json:"title"`
+	Status string `json:"status"`
+}
+
+func (ticket) AllowedValues() map[string][]string {
+	return map[string][]string{"status": {"open", "closed"}}
+}
+
+func TestCreateHandler_AllowedValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/tickets", CreateHandler[ticket](&enum.CreateOption{Enable: true}))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"allowed", `{"title": "a", "status": "open"}`, http.StatusOK, `"status":"open"`},
+		{"zero value unchecked", `{"title": "b"}`, http.StatusOK, `"title":"b"`},
+		{"not allowed", `{"title": "c", "status": "pending"}`, http.StatusUnprocessableEntity, `allowed values: open, closed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/tickets", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want containing %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	var count int64
+	orm.DB.Model(&ticket{}).Where("status = ?", "pending").Count(&count)
+	if count != 0 {
+		t.Errorf("created %d tickets with a not allowed status", count)
+	}
+}
+
+type post struct {
+	orm.BasicModel
+	Title     string `json:"title"`
+	CreatedBy string `json:"created_by"`
+}
+
+func (post) CreateDefaults() map[string]func(ctx context.Context) any {
+	return map[string]func(ctx context.Context) any{
+		"created_by": func(ctx context.Context) any {
+			userID, _ := reqctx.UserID(ctx)
+			return userID
+		},
+	}
+}
+
+func TestCreateHandler_CreateDefaults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&post{}); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/posts", func(c *gin.Context) {
+		reqctx.SetUserID(c, "alice")
+	}, CreateHandler[post](&enum.CreateOption{Enable: true}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(`{"title": "a", "created_by": "mallory"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"created_by":"alice"`) {
+		t.Errorf("body = %s, want created_by overwritten by alice", w.Body.String())
+	}
+	var created post
+	if err := orm.DB.Where("title = ?", "a").First(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if created.CreatedBy != "alice" {
+		t.Errorf("created_by = %q, want %q", created.CreatedBy, "alice")
+	}
+}
+
+type invoice struct {
+	orm.BasicModel
+	Number string        `json:"number"`
+	Lines  []invoiceLine `json:"lines"`
+}
+
+type invoiceLine struct {
+	orm.BasicModel
+	InvoiceID uint         `json:"invoice_id"`
+	Product   string       `json:"product"`
+	Taxes     []invoiceTax `json:"taxes"`
+}
+
+type invoiceTax struct {
+	orm.BasicModel
+	InvoiceLineID uint    `json:"invoice_line_id"`
+	Rate          float64 `json:"rate"`
+}
+
+func TestCreateHandler_NestedAssociations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&invoice{}, &invoiceLine{}, &invoiceTax{}); err != nil {
+		t.Fatal(err)
+	}
+	existing := invoiceLine{Product: "old"}
+	if err := orm.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/invoices", CreateHandler[invoice](&enum.CreateOption{Enable: true}))
+	r.POST("/invoices/full", CreateHandler[invoice](&enum.CreateOption{Enable: true, FullSaveAssociations: true}))
+
+	post := func(path string, body string) invoice {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp struct {
+			Invoice invoice `json:"invoice"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Invoice
+	}
+
+	created := post("/invoices", `{"number": "A1", "lines": [
+		{"product": "apple", "taxes": [{"rate": 0.1}, {"rate": 0.2}]},
+		{"product": "pear"}
+	]}`)
+	if created.ID == 0 || len(created.Lines) != 2 {
+		t.Fatalf("created = %+v, want an id and 2 lines", created)
+	}
+	for _, line := range created.Lines {
+		if line.ID == 0 || line.InvoiceID != created.ID {
+			t.Errorf("line = %+v, want an id and invoice_id %d", line, created.ID)
+		}
+		for _, tax := range line.Taxes {
+			if tax.ID == 0 || tax.InvoiceLineID != line.ID {
+				t.Errorf("tax = %+v, want an id and invoice_line_id %d", tax, line.ID)
+			}
+		}
+	}
+	var taxes int64
+	orm.DB.Model(&invoiceTax{}).Where("invoice_line_id = ?", created.Lines[0].ID).Count(&taxes)
+	if taxes != 2 {
+		t.Errorf("created %d taxes of the first line, want 2", taxes)
+	}
+
+	body := fmt.Sprintf(`{"number": "A2", "lines": [{"ID": %d, "product": "renamed"}]}`, existing.ID)
+	for _, tt := range []struct {
+		path    string
+		product string
+	}{
+		{"/invoices", "old"},
+		{"/invoices/full", "renamed"},
+	} {
+		created := post(tt.path, body)
+		var line invoiceLine
+		if err := orm.DB.First(&line, existing.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if line.Product != tt.product || line.InvoiceID != created.ID {
+			t.Errorf("%s: line = (%q, invoice %d), want (%q, invoice %d)",
+				tt.path, line.Product, line.InvoiceID, tt.product, created.ID)
+		}
+	}
+}
+
+type shelf struct {
+	orm.BasicModel
+	Books []book `json:"books"`
+}
+
+type book struct {
+	orm.BasicModel
+	ShelfID uint   `json:"shelf_id"`
+	Title   string `json:"title"`
+}
+
+func TestCreateNestedHandler_Session(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &shelf{}, &book{})
+	if err := db.Create(&shelf{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/shelves/:id/books", CreateNestedHandler[shelf, book]("id", "Books", &enum.CreateOption{}))
+	r.POST("/dry/shelves/:id/books", CreateNestedHandler[shelf, book]("id", "Books", &enum.CreateOption{
+		Session: &gorm.Session{DryRun: true},
+	}))
+
+	if w := serve(r, http.MethodPost, "/dry/shelves/1/books", `{"title": "dry"}`); w.Code != http.StatusOK {
+		t.Fatalf("dry run: code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, http.MethodPost, "/shelves/1/books", `{"title": "wet"}`); w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var titles []string
+	if err := db.Model(&book{}).Pluck("title", &titles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 || titles[0] != "wet" {
+		t.Errorf("books = %v, want [wet]: the dry run session of the option is not applied", titles)
+	}
+}
+
+func TestCreateHandler_DisallowUnknownFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	servicetest.Open(t, &gadget{})
+	r := gin.New()
+	r.POST("/strict", CreateHandler[gadget](&enum.CreateOption{DisallowUnknownFields: true}))
+	r.POST("/lenient", CreateHandler[gadget](&enum.CreateOption{}))
+	r.PUT("/strict/:id", UpdateHandler[gadget]("id", &enum.UpdateOption{DisallowUnknownFields: true}))
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"known", http.MethodPost, "/strict", `{"name": "a"}`, http.StatusOK, `"name":"a"`},
+		{"case insensitive as encoding/json", http.MethodPost, "/strict", `{"Name": "b"}`, http.StatusOK, `"name":"b"`},
+		{"all unknown listed", http.MethodPost, "/strict", `{"nme": "c", "colour": "red"}`, http.StatusBadRequest, `unknown fields: \"colour\", \"nme\"`},
+		{"ignored if not strict", http.MethodPost, "/lenient", `{"name": "d", "colour": "red"}`, http.StatusOK, `"name":"d"`},
+		{"update", http.MethodPut, "/strict/1", `{"name": "e", "colour": "red"}`, http.StatusBadRequest, `unknown fields: \"colour\"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.url, tt.body)
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want containing %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+type country struct {
+	orm.BasicModel
+	Code string `json:"code" gorm:"uniqueIndex"`
+	Name string `json:"name"`
+}
+
+func TestGetOrCreateManyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &country{})
+	if err := db.Create(&country{Code: "fr", Name: "France"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/countries/get_or_create", GetOrCreateManyHandler[country](&enum.GetOrCreateOption{Keys: []string{"code"}}))
+	r.POST("/pretreated/get_or_create", GetOrCreateManyHandler[country](&enum.GetOrCreateOption{
+		Keys: []string{"code"},
+		Pretreat: func(c *gin.Context, model any) (any, error) {
+			return &country{}, nil // not a country
+		},
+	}))
+
+	w := serve(r, http.MethodPost, "/countries/get_or_create", `[{"code": "fr", "name": "ignored"}, {"code": "de", "name": "Germany"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"name":"France"`) || !strings.Contains(w.Body.String(), `"rows_affected":1`) {
+		t.Errorf("body = %s, want the existing France and 1 created", w.Body.String())
+	}
+
+	w = serve(r, http.MethodPost, "/pretreated/get_or_create", `[{"code": "it", "name": "Italy"}]`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Pretreat not returning a T: code = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&country{}).Count(&count)
+	if count != 2 {
+		t.Errorf("countries = %d, want 2", count)
+	}
+}
+
+type product struct {
+	orm.BasicModel
+	Tenant uint   `json:"tenant"`
+	SKU    string `json:"sku" gorm:"uniqueIndex"`
+}
+
+func (product) UniqueKeys() [][]string { return [][]string{{"sku"}} }
+
+// tenantScope scopes the products to the tenant of the X-Tenant header.
+func tenantScope(c *gin.Context, _ enum.GetRequestOptions) enum.QueryOption {
+	return service.FilterBy("tenant", c.GetHeader("X-Tenant"))
+}
+
+func TestCreateHandler_Duplicate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &product{})
+	if err := db.Create(&product{Tenant: 1, SKU: "A-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/products", CreateHandler[product](&enum.CreateOption{Enable: true, UniqueBy: []string{"sku"}}))
+	r.POST("/scoped", CreateHandler[product](&enum.CreateOption{Enable: true, UniqueBy: []string{"sku"}, QueryOptionClosure: tenantScope}))
+
+	tests := []struct {
+		name, url, tenant string
+		existing          bool
+	}{
+		{"not scoped", "/products", "", true},
+		{"in the scope", "/scoped", "1", true},
+		{"out of the scope", "/scoped", "2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, tt.url, `{"tenant": 2, "sku": "A-1"}`, "X-Tenant", tt.tenant)
+			if w.Code != http.StatusConflict {
+				t.Fatalf("code = %d, want 409: %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				Product   *product `json:"product"`
+				Duplicate struct {
+					Columns []string       `json:"columns"`
+					Values  map[string]any `json:"values"`
+				} `json:"duplicate"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := body.Product != nil; got != tt.existing {
+				t.Errorf("existing responded = %v, want %v: %s", got, tt.existing, w.Body.String())
+			}
+			if len(body.Duplicate.Columns) != 1 || body.Duplicate.Values["sku"] != "A-1" {
+				t.Errorf("duplicate = %+v, want the sku A-1", body.Duplicate)
+			}
+		})
+	}
+}
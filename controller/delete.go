@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
 	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+	"net/http"
 )
 
 // DeleteHandler handles
@@ -17,8 +21,12 @@ import (
 // Request body: none
 //
 // Response:
-//   - 200 OK: { deleted: true }
+//   - 200 OK: { deleted: true, meta: { rows_affected: 1 } }
+//   - 200 OK: { T: {...}, deleted: true, meta: { rows_affected: 1 } }  // see enum.DeleteResponseModel
+//   - 200 OK: { dry_run_sql: [...] }  // for ?dry_run_sql=true, see DelOption.AllowDryRunSQL
+//   - 204 No Content: if the id is not found and opt.Idempotent, or see enum.DeleteResponseNoContent
 //   - 400 Bad Request: { error: "missing id" }
+//   - 404 Not Found: { error: "record not found" }
 //   - 422 Unprocessable Entity: { error: "delete process failed" }
 func DeleteHandler[T orm.Model](idParam string, opt *enum.DelOption) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -49,12 +57,196 @@ func DeleteHandler[T orm.Model](idParam string, opt *enum.DelOption) gin.Handler
 				return
 			}
 		}
-		_, err := service.DeleteByID[T](c, id, opt)
+		session, dryRun, err := dryRunSQL(c, opt.AllowDryRunSQL, opt.Session)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("DeleteHandler: dryRunSQL failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		delOpt := *opt
+		delOpt.Session = session
+		var model T
+		if opt.QueryOptionClosure != nil || opt.Response == enum.DeleteResponseModel {
+			var options []enum.QueryOption
+			if opt.QueryOptionClosure != nil { // not in scope => not found
+				options = append(options, opt.QueryOptionClosure(c, enum.GetRequestOptions{}))
+			}
+			err = service.GetByID[T](c, id, &model, options...)
+		}
+		var rowsAffected int64
+		if err == nil {
+			rowsAffected, err = service.DeleteByID[T](c, id, &delOpt)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if opt.Idempotent {
+				c.Status(http.StatusNoContent)
+				return
+			}
+			ResponseError(c, CodeNotFound, err)
+			return
+		}
 		if err != nil {
 			ResponseError(c, CodeProcessFailed, err)
 			return
 		}
-		ResponseSuccess(c, nil, gin.H{"deleted": true})
+		if dryRun != nil {
+			responseDryRun(c, dryRun)
+			return
+		}
+		switch opt.Response {
+		case enum.DeleteResponseNoContent:
+			c.Status(http.StatusNoContent)
+		case enum.DeleteResponseModel:
+			var deleted T // with the deleted_at of a soft delete
+			if err := service.GetByID[T](c, id, &deleted, service.Unscoped()); err == nil {
+				model = deleted
+			}
+			ResponseSuccess(c, &model, gin.H{"deleted": true}, new(Meta).SetRowsAffected(rowsAffected).H())
+		default:
+			ResponseSuccess(c, nil, gin.H{"deleted": true}, new(Meta).SetRowsAffected(rowsAffected).H())
+		}
+	}
+}
+
+// RestoreHandler handles
+//
+//	POST /T/restore?filters[column]=value&deleted_between=from&deleted_between=to
+//
+// Restores all soft-deleted models T matching the filters, which are
+// required to bound the operation. The deleted_between param filters on
+// the time range of deletion. See service.RestoreMany.
+//
+// Request body: none
+//
+// Response:
+//   - 200 OK: { meta: { rows_affected: 3 } }  // and affected_ids: [...] by report=ids, see ReportIDs
+//   - 400 Bad Request: { error: "bind failed, no filter or invalid report" }
+//   - 422 Unprocessable Entity: { error: "restore process failed" }
+func RestoreHandler[T any](opt *enum.RestoreOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("RestoreHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		options, err := filterOptions(request, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("RestoreHandler: filterOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if between := c.QueryArray("deleted_between"); len(between) == 2 {
+			options = append(options, service.DeletedBetween(parseTimeParam(between[0]), parseTimeParam(between[1])))
+		}
+		if len(options) == 0 {
+			logger.WithContext(c).
+				Warn("RestoreHandler: no filter to bound the operation")
+			ResponseError(c, CodeBadRequest, service.ErrNoFilter)
+			return
+		}
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+		affected, err := reportAffected(c, request)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("RestoreHandler: reportAffected failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		rowsAffected, err := service.RestoreMany[T](c, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("RestoreHandler: RestoreMany failed")
+			ResponseError(c, CodeProcessFailed, err)
+			return
+		}
+		ResponseSuccess(c, nil, affectedMeta(rowsAffected, affected).H())
+	}
+}
+
+// ArchiveHandler handles
+//
+//	POST /T/archive?filters[column]=value
+//
+// Soft-deletes all models T matching the filters, which are required to
+// bound the operation, recording the reason in the body and the actor of
+// the request. See service.ArchiveMany.
+//
+// Request body: (See enum.ArchiveRequest for more details)
+//   - {"reason": "duplicate accounts merged"}
+//
+// Response:
+//   - 200 OK: { meta: { rows_affected: 3 } }  // and affected_ids: [...] by report=ids, see ReportIDs
+//   - 400 Bad Request: { error: "bind failed, no filter or invalid report" }
+//   - 422 Unprocessable Entity: { error: "no reason, or archive process failed" }
+func ArchiveHandler[T any](opt *enum.ArchiveOption) gin.HandlerFunc {
+	for _, column := range []string{opt.ReasonColumn, opt.ActorColumn} {
+		if column == "" {
+			continue
+		}
+		if _, err := orm.LookUpField(new(T), column); err != nil {
+			panic(fmt.Sprintf("ArchiveHandler: %v", err))
+		}
+	}
+	if _, audited := any(new(T)).(orm.Audited); !audited && opt.ReasonColumn == "" {
+		panic(fmt.Sprintf("ArchiveHandler: %T is not orm.Audited and no ReasonColumn to record the reason", *new(T)))
+	}
+
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ArchiveHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		var body enum.ArchiveRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ArchiveHandler: Bind failed")
+			ResponseError(c, getBindErrorCode(err), err)
+			return
+		}
+
+		options, err := filterOptions(request, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ArchiveHandler: filterOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if len(options) == 0 {
+			logger.WithContext(c).
+				Warn("ArchiveHandler: no filter to bound the operation")
+			ResponseError(c, CodeBadRequest, service.ErrNoFilter)
+			return
+		}
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+		affected, err := reportAffected(c, request)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ArchiveHandler: reportAffected failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		rowsAffected, err := service.ArchiveMany[T](c, body.Reason, opt, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ArchiveHandler: ArchiveMany failed")
+			ResponseError(c, CodeProcessFailed, err)
+			return
+		}
+		ResponseSuccess(c, nil, affectedMeta(rowsAffected, affected).H())
 	}
 }
 
@@ -75,6 +267,8 @@ func DeleteHandler[T orm.Model](idParam string, opt *enum.DelOption) gin.Handler
 //   - 400 Bad Request: { error: "missing id" }
 //   - 422 Unprocessable Entity: { error: "delete process failed" }
 func DeleteNestedHandler[P orm.Model, T orm.Model](parentIdParam string, field string, childIdParam string) gin.HandlerFunc {
+	field = mustAssociation(field, *new(P))
+
 	return func(c *gin.Context) {
 		parentId := c.Param(parentIdParam)
 		if parentId == "" {
@@ -92,9 +286,6 @@ func DeleteNestedHandler[P orm.Model, T orm.Model](parentIdParam string, field s
 			ResponseError(c, CodeBadRequest, ErrMissingID)
 			return
 		}
-		//field := strings.ToUpper(field)[:1] + field[1:]
-		field := nameToField(field, new(P))
-
 		logger.WithContext(c).
 			Tracef("DeleteNestedHandler: Delete %v of %v, parentId=%v, field=%v, childId=%v", *new(T), *new(P), parentId, field, childId)
 
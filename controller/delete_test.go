@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/service/servicetest"
+	"gorm.io/gorm"
+)
+
+// token is a model without soft delete.
+type token struct {
+	ID   uint   `gorm:"primarykey" json:"id"`
+	Name string `json:"name"`
+}
+
+func (t token) Identity() (fieldName string, value any) {
+	return "ID", t.ID
+}
+
+func TestDeleteHandler_Response(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{}, &token{})
+	for _, name := range []string{"a", "b", "c"} {
+		if err := db.Create(&item{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&token{Name: "t"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.DELETE("/items/:id", DeleteHandler[item]("id", &enum.DelOption{}))
+	r.DELETE("/no-content/:id", DeleteHandler[item]("id", &enum.DelOption{Response: enum.DeleteResponseNoContent}))
+	r.DELETE("/model/:id", DeleteHandler[item]("id", &enum.DelOption{Response: enum.DeleteResponseModel}))
+	r.DELETE("/idempotent/:id", DeleteHandler[item]("id", &enum.DelOption{Response: enum.DeleteResponseNoContent, Idempotent: true}))
+	r.DELETE("/tokens/:id", DeleteHandler[token]("id", &enum.DelOption{Response: enum.DeleteResponseModel}))
+
+	t.Run("deleted", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/items/1", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Deleted bool            `json:"deleted"`
+			Item    json.RawMessage `json:"item"`
+			Meta    struct {
+				RowsAffected int64 `json:"rows_affected"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if !body.Deleted || body.Meta.RowsAffected != 1 || body.Item != nil {
+			t.Errorf("body = %s, want deleted without the model", w.Body.String())
+		}
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/no-content/2", "")
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("code = %d, body = %q, want 204 without a body", w.Code, w.Body.String())
+		}
+		if err := db.First(new(item), 2).Error; err != gorm.ErrRecordNotFound {
+			t.Errorf("First = %v, want deleted", err)
+		}
+	})
+
+	t.Run("model", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/model/3", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Deleted bool `json:"deleted"`
+			Item    item `json:"item"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if !body.Deleted || body.Item.ID != 3 || body.Item.Name != "c" {
+			t.Errorf("body = %s, want the deleted item 3", w.Body.String())
+		}
+		if !body.Item.DeletedAt.Valid {
+			t.Errorf("deleted_at = null, want the time of the soft delete: %s", w.Body.String())
+		}
+	})
+
+	t.Run("model hard deleted", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/tokens/1", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Token token `json:"token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Token.ID != 1 || body.Token.Name != "t" {
+			t.Errorf("body = %s, want the token loaded before the delete", w.Body.String())
+		}
+		if err := db.Unscoped().First(new(token), 1).Error; err != gorm.ErrRecordNotFound {
+			t.Errorf("First = %v, want deleted", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for url, code := range map[string]int{
+			"/model/3":      http.StatusNotFound, // already deleted
+			"/items/9":      http.StatusNotFound,
+			"/idempotent/9": http.StatusNoContent,
+		} {
+			if w := serve(r, http.MethodDelete, url, ""); w.Code != code {
+				t.Errorf("DELETE %s: code = %d, want %d: %s", url, w.Code, code, w.Body.String())
+			}
+		}
+	})
+}
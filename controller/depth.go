@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/tqrj/cd/orm"
+)
+
+// MaxAssociationDepth limits the nesting of the associations in the
+// responses, against the payload explosions of circular associations
+// preloaded together (e.g. preload=Orders.User.Orders). The associated
+// models nested deeper than it are replaced by references: the models
+// with only their primary keys set.
+//
+//	MaxAssociationDepth = 1
+//	// GET /user/1?preload=Orders.User
+//	// => { ID: 1, Orders: [{ ID: 2, User: { ID: 1, Name: "", ... } }] }
+//
+// A model (pointer) referencing itself in its own associations (a cycle
+// of pointers) is replaced by the reference as well, at any depth.
+//
+// 0 (default) means unlimited, with the cycles still broken.
+var MaxAssociationDepth int
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// limitDepth returns a copy of model with the associations limited by
+// MaxAssociationDepth and the cycles broken. The models which can not be
+// limited are returned as they are, uncopied: the ones without
+// associations, and without MaxAssociationDepth, the ones without
+// associations by pointers (which can not cycle).
+func limitDepth(model any) any {
+	if model == nil {
+		return model
+	}
+	associations, pointers := associationsOf(reflect.TypeOf(model))
+	if !associations || MaxAssociationDepth <= 0 && !pointers {
+		return model
+	}
+	guard := &depthGuard{path: map[uintptr]bool{}}
+	return guard.copy(reflect.ValueOf(model), 0).Interface()
+}
+
+type depthGuard struct {
+	path map[uintptr]bool // the pointers being copied
+}
+
+func (g *depthGuard) copy(v reflect.Value, depth int) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType || v.Type().Implements(jsonMarshalerType) {
+			return v
+		}
+		s, err := orm.ParseSchema(reflect.New(v.Type()).Interface())
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			fieldDepth := depth
+			if err == nil && s.Relationships.Relations[v.Type().Field(i).Name] != nil {
+				fieldDepth++
+			}
+			if MaxAssociationDepth > 0 && fieldDepth > MaxAssociationDepth {
+				copied.Field(i).Set(references(v.Field(i)))
+				continue
+			}
+			copied.Field(i).Set(g.copy(v.Field(i), fieldDepth))
+		}
+		return copied
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if g.path[v.Pointer()] {
+			return references(v)
+		}
+		g.path[v.Pointer()] = true
+		defer delete(g.path, v.Pointer())
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(g.copy(v.Elem(), depth))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(g.copy(v.Elem(), depth))
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(g.copy(v.Index(i), depth))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(g.copy(v.Index(i), depth))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), g.copy(iter.Value(), depth))
+		}
+		return copied
+	}
+	return v
+}
+
+// associationKinds caches the associationsOf the types.
+var associationKinds sync.Map // reflect.Type => [2]bool
+
+// associationsOf reports whether the models in t (a model, or pointers,
+// slices, arrays or maps of them) have associations, in their associated
+// models as well, and whether any of them is by pointer (e.g. *User or
+// []*Order).
+func associationsOf(t reflect.Type) (associations, pointers bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false, false
+	}
+	if kinds, ok := associationKinds.Load(t); ok {
+		return kinds.([2]bool)[0], kinds.([2]bool)[1]
+	}
+
+	seen := map[reflect.Type]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		s, err := orm.ParseSchema(reflect.New(t).Interface())
+		if err != nil {
+			return
+		}
+		for _, rel := range s.Relationships.Relations {
+			associations = true
+			ft := rel.Field.FieldType
+			if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Ptr {
+				pointers = true
+			}
+			if rel.FieldSchema != nil {
+				walk(rel.FieldSchema.ModelType)
+			}
+		}
+	}
+	walk(t)
+	associationKinds.Store(t, [2]bool{associations, pointers})
+	return associations, pointers
+}
+
+// references replaces the models in v (a model, a pointer to it, or a
+// slice of them) by the models with only the primary keys. The models
+// without primary keys (e.g. not loaded) are dropped: the pointers are
+// nil, and they are removed from the slices.
+func references(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		ref, _ := reference(v)
+		return ref
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return reflect.Zero(v.Type())
+		}
+		ref, ok := reference(v.Elem())
+		if !ok {
+			return reflect.Zero(v.Type())
+		}
+		ptr := reflect.New(v.Type().Elem())
+		ptr.Elem().Set(ref)
+		return ptr
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		refs := reflect.MakeSlice(v.Type(), 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if ref := references(v.Index(i)); !ref.IsZero() {
+				refs = reflect.Append(refs, ref)
+			}
+		}
+		return refs
+	}
+	return reflect.Zero(v.Type())
+}
+
+// reference returns the model v (a struct) with only its primary keys,
+// and whether they are set.
+func reference(v reflect.Value) (reflect.Value, bool) {
+	ref := reflect.New(v.Type()).Elem()
+	s, err := orm.ParseSchema(reflect.New(v.Type()).Interface())
+	if err != nil || len(s.PrimaryFields) == 0 {
+		return ref, false
+	}
+	for _, field := range s.PrimaryFields {
+		value, zero := field.ValueOf(context.Background(), v)
+		if zero {
+			return reflect.Zero(v.Type()), false
+		}
+		_ = field.Set(context.Background(), ref, value)
+	}
+	return ref, true
+}
+
+// depthPreloads returns the preloads of all the associations of model
+// within the depth, by its schema (e.g. Items, Items.Product, User for
+// depth 2), in a stable order. An association back to a model type on its
+// path (e.g. Items.Order of an Order) is not preloaded, against the cycles.
+func depthPreloads(model any, depth int) []string {
+	var preloads []string
+	var walk func(model any, prefix string, depth int, path map[reflect.Type]bool)
+	walk = func(model any, prefix string, depth int, path map[reflect.Type]bool) {
+		s, err := orm.ParseSchema(model)
+		if err != nil || depth <= 0 {
+			return
+		}
+		path[s.ModelType] = true
+		defer delete(path, s.ModelType)
+
+		names := make([]string, 0, len(s.Relationships.Relations))
+		for name := range s.Relationships.Relations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rel := s.Relationships.Relations[name]
+			if rel.FieldSchema == nil || path[rel.FieldSchema.ModelType] {
+				continue
+			}
+			preloads = append(preloads, prefix+name)
+			walk(reflect.New(rel.FieldSchema.ModelType).Interface(), prefix+name+".", depth-1, path)
+		}
+	}
+	walk(model, "", depth, map[reflect.Type]bool{})
+	return preloads
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tqrj/cd/orm"
+)
+
+type customer struct {
+	orm.BasicModel
+	Name      string      `json:"name"`
+	Purchases []*purchase `json:"purchases"`
+}
+
+type purchase struct {
+	orm.BasicModel
+	CustomerID uint      `json:"customer_id"`
+	Customer   *customer `json:"customer"`
+}
+
+type address struct {
+	orm.BasicModel
+	City string `json:"city"`
+}
+
+type branch struct {
+	orm.BasicModel
+	AddressID uint    `json:"address_id"`
+	Address   address `json:"address"` // by value: no cycle
+}
+
+func TestLimitDepth(t *testing.T) {
+	defer func(depth int) { MaxAssociationDepth = depth }(MaxAssociationDepth)
+
+	newCustomer := func() *customer {
+		c := &customer{Name: "ann"}
+		c.ID = 1
+		p := &purchase{CustomerID: 1, Customer: &customer{Name: "ann again", Purchases: []*purchase{{}}}}
+		p.ID = 2
+		p.Customer.ID = 1
+		c.Purchases = []*purchase{p, {}} // the second one is not loaded: without id
+		return c
+	}
+
+	t.Run("depth", func(t *testing.T) {
+		MaxAssociationDepth = 1
+		c := newCustomer()
+		got := limitDepth(c).(*customer)
+		if got == c || got.Purchases[0] == c.Purchases[0] {
+			t.Fatal("not copied")
+		}
+		if len(got.Purchases) != 2 {
+			t.Fatalf("purchases = %d, want 2 (within the depth)", len(got.Purchases))
+		}
+		ref := got.Purchases[0].Customer
+		if ref == nil || ref.ID != 1 || ref.Name != "" || ref.Purchases != nil {
+			t.Errorf("customer of purchase = %+v, want the reference {ID: 1}", ref)
+		}
+		if c.Purchases[0].Customer.Name != "ann again" {
+			t.Error("the model is modified")
+		}
+	})
+
+	t.Run("references without ids dropped", func(t *testing.T) {
+		MaxAssociationDepth = 0
+		v := references(reflect.ValueOf(newCustomer().Purchases))
+		if purchases := v.Interface().([]*purchase); len(purchases) != 1 || purchases[0].ID != 2 || purchases[0].Customer != nil {
+			t.Errorf("references = %+v, want [{ID: 2}]", purchases)
+		}
+		if ptr := references(reflect.ValueOf(&customer{})); !ptr.IsNil() {
+			t.Errorf("reference without id = %v, want nil", ptr.Interface())
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		MaxAssociationDepth = 0
+		c := newCustomer()
+		c.Purchases[0].Customer = c
+		got := limitDepth(c).(*customer)
+		if ref := got.Purchases[0].Customer; ref == nil || ref == got || ref.ID != 1 || ref.Purchases != nil {
+			t.Errorf("customer of purchase = %+v, want the reference {ID: 1}", ref)
+		}
+	})
+
+	t.Run("not limited", func(t *testing.T) {
+		MaxAssociationDepth = 0
+		c := newCustomer()
+		if got := limitDepth(c); got == any(c) {
+			t.Error("associations by pointers: as is, want copied against the cycles")
+		}
+		b := &branch{Address: address{City: "Paris"}}
+		if got := limitDepth(b); got != any(b) {
+			t.Error("associations by values only: copied, want as is")
+		}
+		a := &address{City: "Paris"}
+		MaxAssociationDepth = 1
+		if got := limitDepth(a); got != any(a) {
+			t.Error("no associations: copied, want as is")
+		}
+	})
+}
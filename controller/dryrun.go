@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+)
+
+// dryRunSQL returns the DryRun session (see service.DryRunSession) of the
+// write routes, and its recorder, for requests with
+//
+//	?dry_run_sql=true
+//
+// if they are allowed (the AllowDryRunSQL of the route option). The
+// recorder is nil for the other requests.
+func dryRunSQL(c *gin.Context, allowed bool, session *gorm.Session) (*gorm.Session, *service.SQLRecorder, error) {
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run_sql")); !dryRun {
+		return session, nil, nil
+	}
+	if !allowed {
+		return session, nil, ErrDryRunNotAllowed
+	}
+	recorder := new(service.SQLRecorder)
+	return service.DryRunSession(session, recorder), recorder, nil
+}
+
+// responseDryRun responds the statements recorded by the dry run:
+//
+//	{ dry_run_sql: [{ sql: "UPDATE ... WHERE `id` = ?", vars: [...] }] }
+//
+// The vars (which may be sensitive data) are only responded in the gin
+// debug mode.
+func responseDryRun(c *gin.Context, recorder *service.SQLRecorder) {
+	statements := recorder.Statements()
+	if !gin.IsDebugging() {
+		for i := range statements {
+			statements[i].Vars = nil
+		}
+	}
+	ResponseSuccess(c, nil, gin.H{"dry_run_sql": statements})
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Encoder writes a response body in a format, e.g. XMLEncoder.
+type Encoder func(c *gin.Context, code int, body any)
+
+// Encoders are the response formats by media type, negotiated with the
+// Accept header of the requests. JSON is the default (for no Accept,
+// */*, or no acceptable format), and the others are to be enabled:
+//
+//	controller.Encoders["application/xml"] = controller.XMLEncoder
+//	controller.Encoders["application/msgpack"] = controller.MsgPackEncoder
+//
+// Custom formats can be added as well. Encoders should be set up before
+// serving, it is not safe to be modified concurrently.
+var Encoders = map[string]Encoder{}
+
+// respond writes the response body in the format negotiated by Encoders.
+func respond(c *gin.Context, code int, body any) {
+	if encoder := negotiateEncoder(c); encoder != nil {
+		encoder(c, code, body)
+		return
+	}
+	c.JSON(code, body)
+}
+
+// negotiateEncoder returns the encoder accepted by the request, or nil for
+// JSON.
+func negotiateEncoder(c *gin.Context) Encoder {
+	if len(Encoders) == 0 || c.Request == nil {
+		return nil
+	}
+	offers := []string{binding.MIMEJSON}
+	for mediaType := range Encoders {
+		offers = append(offers, mediaType)
+	}
+	sort.Strings(offers[1:])
+	return Encoders[c.NegotiateFormat(offers...)]
+}
+
+// genericBody converts the body into the generic values (maps, slices,
+// strings, numbers, bools and nils) of its JSON: the formats share the
+// json tags and marshalers of the models (e.g. gorm.DeletedAt as null).
+// Integers are kept as int64.
+func genericBody(body any) (any, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(generic), nil
+}
+
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeNumbers(value)
+		}
+	}
+	return v
+}
+
+// MsgPackEncoder writes the body in MessagePack (application/msgpack).
+func MsgPackEncoder(c *gin.Context, code int, body any) {
+	generic, err := genericBody(body)
+	if err != nil {
+		_ = c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Render(code, render.MsgPack{Data: generic})
+}
+
+// XMLEncoder writes the body in XML (application/xml), converted from its
+// JSON: objects are elements by the keys, array items are <item>s.
+//
+//	{ code: 200, Users: [{ name: "John" }] }
+//	// => <response><code>200</code><Users><item><name>John</name></item></Users></response>
+func XMLEncoder(c *gin.Context, code int, body any) {
+	generic, err := genericBody(body)
+	if err != nil {
+		_ = c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := encodeXML(encoder, "response", generic); err == nil {
+		err = encoder.Flush()
+	}
+	if err != nil {
+		_ = c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(code, "application/xml; charset=utf-8", buf.Bytes())
+}
+
+// encodeXML encodes the generic value v as the element name.
+func encodeXML(encoder *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := encodeXML(encoder, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXML(encoder, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(jsonScalar(v))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// jsonScalar formats a generic scalar like in JSON (without quotes).
+func jsonScalar(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// xmlName makes a valid XML element name of key, replacing the invalid
+// characters with '_'.
+func xmlName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.')) {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+func TestEncoders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(encoders map[string]Encoder) { Encoders = encoders }(Encoders)
+	Encoders = map[string]Encoder{
+		"application/xml":     XMLEncoder,
+		"application/msgpack": MsgPackEncoder,
+	}
+	r := gin.New()
+	r.GET("/success", func(c *gin.Context) {
+		ResponseSuccess(c, nil, gin.H{"users": []gin.H{{"name": "John", "age": 42, "1st key": true}}})
+	})
+	r.GET("/error", func(c *gin.Context) { ResponseError(c, CodeBadRequest, ErrMissingID) })
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+		want        string // contained in the body
+	}{
+		{"json by default", "/success", "", "application/json", `"users":[{"1st key":true,"age":42,"name":"John"}]`},
+		{"json for */*", "/success", "*/*", "application/json", `"users":`},
+		{"json for not acceptable", "/success", "text/csv", "application/json", `"users":`},
+		{"xml", "/success", "application/xml", "application/xml",
+			`<response><code>200</code><msg>success</msg><users><item><_st_key>true</_st_key><age>42</age><name>John</name></item></users></response>`},
+		{"first acceptable", "/success", "text/csv, application/xml, application/json", "application/xml", `<users>`},
+		{"xml error", "/error", "application/xml", "application/xml", `<response><code>400</code><msg>missing id</msg></response>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.accept != "" {
+				headers = []string{"Accept", tt.accept}
+			}
+			w := serve(r, http.MethodGet, tt.url, "", headers...)
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %s, want containing %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+
+	w := serve(r, http.MethodGet, "/success", "", "Accept", "application/msgpack")
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/msgpack") {
+		t.Errorf("msgpack: Content-Type = %q", got)
+	}
+	var got map[string]any
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	if err := codec.NewDecoderBytes(w.Body.Bytes(), handle).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := got["users"].([]any)
+	if len(users) != 1 {
+		t.Fatalf("msgpack: users = %v", got["users"])
+	}
+	user, _ := users[0].(map[any]any)
+	if want := (map[any]any{"name": "John", "age": int64(42), "1st key": true}); !reflect.DeepEqual(user, want) {
+		t.Errorf("msgpack: user = %#v, want %v", user, want)
+	}
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/pkg/xlsx"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm/schema"
+)
+
+// defaultExportBatchSize is the ExportOption.BatchSize by default.
+const defaultExportBatchSize = 500
+
+// ExportHandler handles
+//
+//	GET /T/export?filter_by=status&filter_value=open
+//	GET /T/export?format=xlsx&select=id,name,created_at
+//
+// It streams all the models T under the filters of GetListHandler, one
+// JSON per line (NDJSON), for exporting a large table without paging
+// through it. The models are queried in batches of keyset pagination on
+// the primary key, with the consistency of ExportOption.Snapshot.
+//
+// With format=xlsx, the models are streamed into an Excel worksheet
+// instead: a header row of the column names, and a row of typed cells
+// (numbers, bools, dates and strings, by the types of the fields) for
+// each model. The columns are the ones of select (in its order) if any,
+// else all the columns of T.
+//
+// The filter struct (ExportOption.Filter) and TypedFiltersOnly apply as in
+// the list, for both formats.
+//
+// Response:
+//   - 200 OK: {...}\n{...}\n...  // application/x-ndjson, the models T
+//   - 200 OK: the xlsx file      // for format=xlsx, as an attachment
+//   - 400 Bad Request: { error: "request band failed, unknown format or select column, or generic filters disabled" }
+//   - 422 Unprocessable Entity: { error: "export process failed" }  // before the first batch
+//
+// The errors after the first batch can not be responded: the stream is
+// cut short instead (and logged).
+func ExportHandler[T any](opt *enum.ExportOption) gin.HandlerFunc {
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultExportBatchSize
+	}
+	var filterFields []filterStructField
+	if opt.Filter != nil {
+		filterFields = parseFilterStruct(opt.Filter, *new(T))
+	}
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ExportHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if opt.TypedFiltersOnly {
+			if err := checkGenericFilters(request); err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("ExportHandler: generic filters disabled")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+		}
+		var export exporter[T]
+		switch format := strings.ToLower(request.Format); format {
+		case "", "ndjson":
+			export = &ndjsonExporter[T]{c: c}
+		case "xlsx":
+			columns, err := exportColumns[T](splitValues(request.Select))
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("ExportHandler: exportColumns failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			export = &xlsxExporter[T]{c: c, columns: columns}
+		default:
+			err := fmt.Errorf("%w: %q", ErrInvalidExportFormat, format)
+			logger.WithContext(c).WithError(err).
+				Warn("ExportHandler: unknown format")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		options, err := filterOptions(request, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ExportHandler: filterOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		options = append(options, service.WithSession(opt.Session))
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+		if opt.Filter != nil {
+			filter, err := bindFilterStruct(c, opt.Filter, filterFields)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("ExportHandler: bind filter failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			if filter != nil {
+				options = append(options, filter)
+			}
+		}
+
+		started := false
+		_, err = service.Export[T](c, batchSize, opt.Snapshot, func(batch []*T) error {
+			if !started {
+				started = true
+				if err := export.start(); err != nil {
+					return err
+				}
+			}
+			return export.write(batch)
+		}, options...)
+		if err == nil && !started { // no models
+			started = true
+			err = export.start()
+		}
+		if err == nil {
+			err = export.close()
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ExportHandler: Export failed")
+			if !started {
+				ResponseError(c, getErrorCode(err), err)
+			}
+		}
+	}
+}
+
+// exporter writes the models of ExportHandler in a format: start is
+// called before the first batch (or for no models), and close after the
+// last one.
+type exporter[T any] interface {
+	start() error
+	write(batch []*T) error
+	close() error
+}
+
+// ndjsonExporter writes the models as NDJSON.
+type ndjsonExporter[T any] struct {
+	c       *gin.Context
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExporter[T]) start() error {
+	e.c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	e.c.Status(CodeSuccess)
+	e.encoder = json.NewEncoder(e.c.Writer)
+	return nil
+}
+
+func (e *ndjsonExporter[T]) write(batch []*T) error {
+	for _, model := range batch {
+		if err := e.encoder.Encode(inTimeLocation(limitDepth(model))); err != nil {
+			return err
+		}
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+func (e *ndjsonExporter[T]) close() error { return nil }
+
+// xlsxExporter writes the columns of the models into an xlsx worksheet.
+type xlsxExporter[T any] struct {
+	c       *gin.Context
+	columns []*schema.Field
+	sheet   *xlsx.Writer
+}
+
+func (e *xlsxExporter[T]) start() error {
+	name := "export"
+	if s, err := orm.ParseSchema(new(T)); err == nil {
+		name = s.Table
+	}
+	e.c.Header("Content-Type", xlsx.ContentType)
+	e.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+	e.c.Status(CodeSuccess)
+
+	var err error
+	if e.sheet, err = xlsx.NewWriter(e.c.Writer, name); err != nil {
+		return err
+	}
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.DBName
+	}
+	return e.sheet.WriteHeader(header...)
+}
+
+func (e *xlsxExporter[T]) write(batch []*T) error {
+	row := make([]any, len(e.columns))
+	for _, model := range batch {
+		rv := reflect.ValueOf(model).Elem()
+		for i, column := range e.columns {
+			value, _ := column.ValueOf(e.c, rv)
+			row[i] = inTimeLocation(value)
+		}
+		if err := e.sheet.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+func (e *xlsxExporter[T]) close() error {
+	return e.sheet.Close()
+}
+
+// exportColumns returns the column fields of T to export: the selected
+// ones, or all of them if none.
+func exportColumns[T any](selects []string) ([]*schema.Field, error) {
+	if len(selects) == 0 {
+		s, err := orm.ParseSchema(new(T))
+		if err != nil {
+			return nil, err
+		}
+		var columns []*schema.Field
+		for _, field := range s.Fields {
+			if field.DBName != "" && field.Readable {
+				columns = append(columns, field)
+			}
+		}
+		return columns, nil
+	}
+	columns := make([]*schema.Field, 0, len(selects))
+	for _, name := range selects {
+		field, err := orm.LookUpField(new(T), name)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, field)
+	}
+	return columns, nil
+}
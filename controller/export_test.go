@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+func TestExportHandler_Filter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &lead{})
+	leads := []*lead{{Status: "open", Region: "eu"}, {Status: "won", Region: "eu"}, {Status: "open", Region: "us"}}
+	if err := db.Create(leads).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/leads/export", ExportHandler[lead](&enum.ExportOption{Filter: leadFilter{}, BatchSize: 1}))
+	r.GET("/typed/export", ExportHandler[lead](&enum.ExportOption{Filter: leadFilter{}, TypedFiltersOnly: true}))
+
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		want     []uint // the ids exported
+	}{
+		{"typed filter", "/leads/export?region=eu", http.StatusOK, []uint{1, 2}},
+		{"typed and generic filters", "/leads/export?region=eu&filters[status]=open", http.StatusOK, []uint{1}},
+		{"typed only", "/typed/export?status=open", http.StatusOK, []uint{1, 3}},
+		{"generic filter rejected", "/typed/export?filters[status]=open", http.StatusBadRequest, nil},
+		{"generic filter rejected for xlsx", "/typed/export?format=xlsx&filter_by=status&filter_value=open", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var ids []uint
+			for scanner := bufio.NewScanner(w.Body); scanner.Scan(); {
+				var l lead
+				if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, l.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("exported = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
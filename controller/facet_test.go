@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+type lead struct {
+	orm.BasicModel
+	Status string `json:"status"`
+	Region string `json:"region"`
+}
+
+type leadFilter struct {
+	Status *string `form:"status" filter:"status"`
+	Region *string `form:"region" filter:"region"`
+}
+
+func TestFacetHandler_Filter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &lead{})
+	leads := []*lead{
+		{Status: "open", Region: "eu"}, {Status: "open", Region: "eu"},
+		{Status: "won", Region: "eu"}, {Status: "open", Region: "us"},
+	}
+	if err := db.Create(leads).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/leads/facets", FacetHandler[lead](&enum.FacetOption{Filter: leadFilter{}}))
+	r.GET("/typed/facets", FacetHandler[lead](&enum.FacetOption{Filter: leadFilter{}, TypedFiltersOnly: true}))
+
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		want     string
+	}{
+		{"typed filter", "/leads/facets?group_by=status&region=eu", http.StatusOK,
+			`"facets":[{"value":"open","count":2},{"value":"won","count":1}]`},
+		{"typed filter on the group_by column ignored", "/leads/facets?group_by=status&region=eu&status=won", http.StatusOK,
+			`"facets":[{"value":"open","count":2},{"value":"won","count":1}]`},
+		{"generic filter", "/leads/facets?group_by=status&filters[region]=us", http.StatusOK,
+			`"facets":[{"value":"open","count":1}]`},
+		{"typed only", "/typed/facets?group_by=region&status=open", http.StatusOK,
+			`"facets":[{"value":"eu","count":2},{"value":"us","count":1}]`},
+		{"generic filter rejected", "/typed/facets?group_by=status&filters[region]=us", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %s, want containing %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
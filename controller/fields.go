@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm/schema"
+)
+
+// fieldSelection is a node of the fields param (a partial response):
+//
+//	fields=id,name,orders{id,total,items{id}}
+//
+// Columns have no children, associations have the selection of the
+// associated model as children.
+type fieldSelection struct {
+	Name     string            // as requested, e.g. orders
+	Field    string            // the struct field, e.g. Orders (resolved by fieldsOptions)
+	Children []*fieldSelection // nil for columns
+}
+
+// parseFields parses the fields param into the selection tree.
+// An empty param selects nothing (i.e. the whole models).
+func parseFields(fields string) ([]*fieldSelection, error) {
+	if strings.TrimSpace(fields) == "" {
+		return nil, nil
+	}
+	nodes, i, err := parseFieldList(fields, 0)
+	if err != nil {
+		return nil, err
+	}
+	if i < len(fields) {
+		return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFields, fields[i], i)
+	}
+	return nodes, nil
+}
+
+// parseFieldList parses a comma separated list of fields starting at i,
+// returning the position after the list.
+func parseFieldList(fields string, i int) ([]*fieldSelection, int, error) {
+	var nodes []*fieldSelection
+	for {
+		j := i
+		for j < len(fields) && !strings.ContainsRune(",{}", rune(fields[j])) {
+			j++
+		}
+		node := &fieldSelection{Name: strings.TrimSpace(fields[i:j])}
+		if node.Name == "" {
+			return nil, j, fmt.Errorf("%w: empty field at %d", ErrInvalidFields, j)
+		}
+		i = j
+		if i < len(fields) && fields[i] == '{' {
+			children, k, err := parseFieldList(fields, i+1)
+			if err != nil {
+				return nil, k, err
+			}
+			if k >= len(fields) || fields[k] != '}' {
+				return nil, k, fmt.Errorf("%w: unclosed { of %q", ErrInvalidFields, node.Name)
+			}
+			node.Children = children
+			i = k + 1
+		}
+		nodes = append(nodes, node)
+		if i >= len(fields) || fields[i] != ',' {
+			return nodes, i, nil
+		}
+		i++
+	}
+}
+
+// fieldsPreloads returns the (dot separated) associations in the
+// selection, which are preloaded, for checkPreloads.
+func fieldsPreloads(nodes []*fieldSelection, prefix string) []string {
+	var preloads []string
+	for _, node := range nodes {
+		if node.Children != nil {
+			preloads = append(preloads, prefix+node.Name)
+			preloads = append(preloads, fieldsPreloads(node.Children, prefix+node.Name+".")...)
+		}
+	}
+	return preloads
+}
+
+// fieldsOptions resolves the selection against model, and builds the
+// Select of the selected columns and the Preloads (with their Selects)
+// of the selected associations:
+//
+//	fields=name,orders{total}
+//	// => Select("id", "name"), Preload("Orders", Select("id", "user_id", "total"))
+//
+// The primary keys and the keys of the associations are always selected,
+// for gorm to assign the associated models. They are pruned from the
+// response by pruneFields unless requested.
+func fieldsOptions(nodes []*fieldSelection, model any) ([]enum.QueryOption, error) {
+	columns, preloads, err := resolveFields(nodes, model, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return append([]enum.QueryOption{service.Select(columns...)}, preloads...), nil
+}
+
+// resolveFields resolves the selection of model (associated by parent
+// if not nil) into the columns to select and the preloads under prefix.
+func resolveFields(nodes []*fieldSelection, model any, parent *schema.Relationship, prefix string) ([]string, []enum.QueryOption, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected := map[string]bool{}
+	var columns []string
+	add := func(column string) {
+		if !selected[column] {
+			selected[column] = true
+			columns = append(columns, column)
+		}
+	}
+	addKeys := func(rel *schema.Relationship) { // the keys of rel on the side of s
+		for _, ref := range rel.References {
+			if ref.PrimaryKey != nil && ref.PrimaryKey.Schema == s {
+				add(ref.PrimaryKey.DBName)
+			}
+			if ref.ForeignKey != nil && ref.ForeignKey.Schema == s {
+				add(ref.ForeignKey.DBName)
+			}
+		}
+	}
+	for _, column := range s.PrimaryFieldDBNames {
+		add(column)
+	}
+	if parent != nil {
+		addKeys(parent)
+	}
+
+	var preloads []enum.QueryOption
+	for _, node := range nodes {
+		if node.Field, err = NameToField(node.Name, model); err != nil {
+			return nil, nil, err
+		}
+		rel, isAssociation := s.Relationships.Relations[node.Field]
+		if node.Children == nil {
+			if isAssociation {
+				return nil, nil, fmt.Errorf("%w: %q is an association, select its fields by %s{...}", ErrInvalidFields, node.Name, node.Name)
+			}
+			f := s.LookUpField(node.Field)
+			if f == nil || f.DBName == "" {
+				return nil, nil, fmt.Errorf("%w: %q of %s", orm.ErrUnknownColumn, node.Name, s.Name)
+			}
+			add(f.DBName)
+			continue
+		}
+		if !isAssociation {
+			return nil, nil, fmt.Errorf("%w: %q is not an association", ErrInvalidFields, node.Name)
+		}
+		addKeys(rel)
+		childModel := reflect.New(rel.FieldSchema.ModelType).Interface()
+		childColumns, childPreloads, err := resolveFields(node.Children, childModel, rel, prefix+node.Field+".")
+		if err != nil {
+			return nil, nil, err
+		}
+		preloads = append(preloads, service.Preload(prefix+node.Field, service.Select(childColumns...)))
+		preloads = append(preloads, childPreloads...)
+	}
+	return columns, preloads, nil
+}
+
+// pruneFields removes the fields of the struct type t not in the
+// selection from m (a model by toMap), recursively in the selected
+// associations. Keys which are not fields of t (e.g. "orders_count" of
+// with_counts) are kept.
+func pruneFields(m map[string]any, nodes []*fieldSelection, t reflect.Type) {
+	selected := map[string]*fieldSelection{}
+	for _, node := range nodes {
+		selected[node.Field] = node
+	}
+	for key, field := range jsonKeys(t) {
+		value, ok := m[key]
+		if !ok {
+			continue
+		}
+		node, ok := selected[field]
+		if !ok {
+			delete(m, key)
+			continue
+		}
+		if node.Children == nil {
+			continue
+		}
+		childType := fieldType(t, field)
+		switch value := value.(type) {
+		case map[string]any:
+			pruneFields(value, node.Children, childType)
+		case []any:
+			for _, item := range value {
+				if item, ok := item.(map[string]any); ok {
+					pruneFields(item, node.Children, childType)
+				}
+			}
+		}
+	}
+}
+
+// jsonKeys maps the JSON keys of the struct type t to its fields.
+func jsonKeys(t reflect.Type) map[string]string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	keys := map[string]string{}
+	for _, field := range reflect.VisibleFields(t) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch key {
+		case "-":
+			continue
+		case "":
+			key = field.Name
+		}
+		keys[key] = field.Name
+	}
+	return keys
+}
+
+// selectedModels converts the models into maps pruned by the selection.
+func selectedModels[T any](models []*T, nodes []*fieldSelection) ([]map[string]any, error) {
+	maps := make([]map[string]any, len(models))
+	for i, model := range models {
+		m, err := toMap(model)
+		if err != nil {
+			return nil, err
+		}
+		pruneFields(m, nodes, reflect.TypeOf(model))
+		maps[i] = m
+	}
+	return maps, nil
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+func TestParseFields(t *testing.T) {
+	column := func(name string) *fieldSelection { return &fieldSelection{Name: name} }
+	tests := []struct {
+		fields  string
+		want    []*fieldSelection
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"id, name", []*fieldSelection{column("id"), column("name")}, false},
+		{"name,orders{total,items{id}},age", []*fieldSelection{
+			column("name"),
+			{Name: "orders", Children: []*fieldSelection{
+				column("total"),
+				{Name: "items", Children: []*fieldSelection{column("id")}},
+			}},
+			column("age"),
+		}, false},
+		{"name,", nil, true},
+		{"orders{id", nil, true},
+		{"id}", nil, true},
+		{"orders{}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fields, func(t *testing.T) {
+			got, err := parseFields(tt.fields)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFields) {
+					t.Errorf("err = %v, want ErrInvalidFields", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFields = %s, want %s", dumpFields(got), dumpFields(tt.want))
+			}
+		})
+	}
+}
+
+func dumpFields(nodes []*fieldSelection) string {
+	b, _ := json.Marshal(nodes)
+	return string(b)
+}
+
+type writer struct {
+	orm.BasicModel
+	Name     string     `json:"name"`
+	Email    string     `json:"email"`
+	Chapters []*chapter `json:"chapters"`
+}
+
+type chapter struct {
+	orm.BasicModel
+	WriterID uint   `json:"writer_id"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+}
+
+func TestGetListHandler_Fields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &writer{}, &chapter{})
+	w := writer{Name: "ann", Email: "ann@example.com", Chapters: []*chapter{{Title: "one", Body: "..."}}}
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/writers", GetListHandler[writer](&enum.ListOption{LimitMax: 10}))
+	r.GET("/writers/:id", GetByIDHandler[writer]("id", &enum.GetOption{}))
+
+	for _, url := range []string{"/writers?fields=name,chapters{title}", "/writers/1?fields=name,chapters{title}"} {
+		resp := serve(r, http.MethodGet, url, "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: code = %d, want 200: %s", url, resp.Code, resp.Body.String())
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		var got any
+		if data, ok := body["writers"]; ok {
+			var list []any
+			if err := json.Unmarshal(data, &list); err != nil || len(list) != 1 {
+				t.Fatalf("GET %s: writers = %s", url, data)
+			}
+			got = list[0]
+		} else if err := json.Unmarshal(body["writer"], &got); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{"name": "ann", "chapters": []any{map[string]any{"title": "one"}}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GET %s: writer = %v, want %v", url, got, want)
+		}
+	}
+
+	for _, url := range []string{"/writers?fields=chapters", "/writers?fields=name{id}", "/writers?fields=nope"} {
+		if resp := serve(r, http.MethodGet, url, ""); resp.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: code = %d, want 400: %s", url, resp.Code, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter operators (filter_ops[column]=op, or filter_op=op):
+//   - FilterOpEq:  column = value (default)
+//   - FilterOpIn:  column IN (values...), values are comma separated
+//   - FilterOpAll: for a to-many association column (like tags, or
+//     tags.name to compare on the name column of associated tags),
+//     the model is associated with ALL the comma separated values.
+//     Which is different from the IN semantics: having any of the values.
+//   - FilterOpContains, FilterOpStartsWith, FilterOpEndsWith: column LIKE
+//     %value%, value% or %value, where the value is literal: its % and _
+//     are escaped instead of being wildcards.
+//   - FilterOpHas: for a native array column (like a PostgreSQL text[]
+//     tags), the array has any of the comma separated values, i.e.
+//     'gold' = ANY(tags). Only on PostgreSQL, see service.FilterHas.
+//
+// The operators allowed on a column can be restricted by the model, see
+// orm.FilterOperatorer.
+const (
+	FilterOpEq         = "eq"
+	FilterOpIn         = "in"
+	FilterOpAll        = "all"
+	FilterOpContains   = "contains"
+	FilterOpStartsWith = "startswith"
+	FilterOpEndsWith   = "endswith"
+	FilterOpHas        = "has"
+)
+
+// filterComparisons are the SQL operators of the comparison operators of
+// the filter struct tags (see enum.ListOption.Filter).
+var filterComparisons = map[string]string{
+	FilterOpEq: "=",
+	"ne":       "<>",
+	"gt":       ">",
+	"gte":      ">=",
+	"lt":       "<",
+	"lte":      "<=",
+}
+
+// filterLikes are the query options of the LIKE FilterOps.
+var filterLikes = map[string]func(field string, value string) enum.QueryOption{
+	FilterOpContains:   service.FilterContains,
+	FilterOpStartsWith: service.FilterStartsWith,
+	FilterOpEndsWith:   service.FilterEndsWith,
+}
+
+// bindGetRequest binds GetRequestOptions from the query params, including
+// these maps and the single filter shorthand:
+//
+//	filters[column]=value&filter_ops[column]=op
+//	filter_by=column&filter_value=value&filter_op=op
+//
+// The params are read from the URL of the request as is (instead of the
+// query cache of gin), which may be rewritten by QueryHandler.
+func bindGetRequest(c *gin.Context) (enum.GetRequestOptions, error) {
+	var request enum.GetRequestOptions
+	// binding.Form for any method: never consumes a JSON request body.
+	if err := c.ShouldBindWith(&request, binding.Form); err != nil {
+		return request, err
+	}
+	query := c.Request.URL.Query()
+	request.Filters = queryMap(query, "filters")
+	request.FilterOps = queryMap(query, "filter_ops")
+	if err := bindPagination(query, &request); err != nil {
+		return request, err
+	}
+	if err := bindTotal(c, query, &request); err != nil {
+		return request, err
+	}
+
+	if request.FilterBy != "" {
+		request.Filters[request.FilterBy] = request.FilterValue
+		if request.FilterOp != "" {
+			request.FilterOps[request.FilterBy] = request.FilterOp
+		}
+	}
+	return request, nil
+}
+
+// queryMap returns the map of the key in the query values, as gin's
+// QueryMap: key[k]=v => k: v.
+func queryMap(query url.Values, key string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range query {
+		if i := strings.IndexByte(k, '['); i >= 1 && k[:i] == key {
+			if j := strings.IndexByte(k[i+1:], ']'); j >= 1 {
+				m[k[i+1:][:j]] = v[0]
+			}
+		}
+	}
+	return m
+}
+
+// bindTotal binds the total param: total=true (or exact) for the exact
+// count, or total=estimate for an estimate (see service.EstimateCount).
+func bindTotal(c *gin.Context, query url.Values, request *enum.GetRequestOptions) error {
+	value, ok := query.Get("total"), query.Has("total")
+	if !ok {
+		value, ok = c.GetPostForm("total")
+	}
+	if !ok || value == "" {
+		return nil
+	}
+	switch strings.ToLower(value) {
+	case "exact":
+		request.Total = true
+	case "estimate":
+		request.Total, request.TotalEstimate = true, true
+	default:
+		total, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: total=%s", ErrInvalidTotal, value)
+		}
+		request.Total = total
+	}
+	return nil
+}
+
+// PaginationStyle is the names of the pagination query params, see
+// PaginationParams.
+type PaginationStyle struct {
+	Limit  string // the page size
+	Offset string // the number of models to skip, ignored if Page is set
+	// Page is the page number (from 1) of the page-based pagination, which
+	// is translated into the offset: (page - 1) * the effective limit.
+	Page string
+}
+
+// PaginationParams are the names of the pagination query params of the
+// requests, to fit into an existing API convention, e.g. the page-based
+//
+//	controller.PaginationParams = controller.PaginationStyle{Limit: "per_page", Page: "page"}
+//	// GET /users?page=3&per_page=20  =>  LIMIT 20 OFFSET 40
+//
+// Defaults to the offset-based limit=10&offset=20. The responses are not
+// affected: the meta.pagination is the effective limit and offset.
+var PaginationParams = PaginationStyle{Limit: "limit", Offset: "offset"}
+
+// bindPagination binds the pagination params of PaginationParams into the
+// Limit and Offset (or Page) of the request, if they are not the default
+// limit and offset (bound by the form tags).
+func bindPagination(query url.Values, request *enum.GetRequestOptions) error {
+	style := PaginationParams
+	if style.Page == "" && style.Limit == "limit" && style.Offset == "offset" {
+		return nil
+	}
+	param := func(name string) (int, error) {
+		value := query.Get(name)
+		if name == "" || value == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s=%q is not an integer", ErrInvalidPagination, name, value)
+		}
+		return n, nil
+	}
+	var err error
+	if request.Limit, err = param(style.Limit); err != nil {
+		return err
+	}
+	if style.Page == "" {
+		request.Offset, err = param(style.Offset)
+		return err
+	}
+	request.Offset = 0
+	if request.Page, err = param(style.Page); err != nil {
+		return err
+	}
+	if request.Page < 1 && query.Get(style.Page) != "" {
+		return fmt.Errorf("%w: %s=%d is less than 1", ErrInvalidPagination, style.Page, request.Page)
+	}
+	return nil
+}
+
+// pageOffset returns the request with the Offset of its Page (if any) of
+// the effective limit: LimitMax if not requested or exceeding it.
+func pageOffset(request enum.GetRequestOptions, LimitMax int) enum.GetRequestOptions {
+	if request.Page > 1 {
+		request.Offset = (request.Page - 1) * pageLimit(request.Limit, LimitMax)
+	}
+	return request
+}
+
+// filterOptions builds the WHERE conditions of the model from the filters,
+// filter_ops, filters_at, created_within and updated_within request params.
+func filterOptions(request enum.GetRequestOptions, model any) ([]enum.QueryOption, error) {
+	var options []enum.QueryOption
+	for filterBy, filterValue := range request.Filters {
+		if filterBy == "" || filterValue == "" {
+			continue
+		}
+		option, err := filterOption(filterBy, request.FilterOps[filterBy], filterValue, model)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	if len(request.FiltersAt) == 2 {
+		options = append(options, service.FilterAt(request.FiltersAt))
+	}
+	for _, within := range []struct {
+		param, value string
+		timeType     func(field *schema.Field) schema.TimeType
+	}{
+		{"created_within", request.CreatedWithin, func(field *schema.Field) schema.TimeType { return field.AutoCreateTime }},
+		{"updated_within", request.UpdatedWithin, func(field *schema.Field) schema.TimeType { return field.AutoUpdateTime }},
+	} {
+		if within.value == "" {
+			continue
+		}
+		option, err := withinOption(within.param, within.value, within.timeType, model)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// withinOption builds the WHERE condition of a relative time window param
+// (created_within or updated_within): the time field of the model (the
+// auto create or update time of the timeType, e.g. CreatedAt) >= now - the
+// duration, in the unix time of the field for the int ones (e.g.
+// `autoCreateTime:milli`). The now is the one of the server, not of the
+// clients.
+func withinOption(param string, value string, timeType func(field *schema.Field) schema.TimeType, model any) (enum.QueryOption, error) {
+	duration, err := ParseWithin(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFilter, param, err)
+	}
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range s.Fields {
+		if field.DBName == "" || timeType(field) == 0 {
+			continue
+		}
+		if err := checkQueryable(field.Name, model); err != nil {
+			return nil, err
+		}
+		since := time.Now().Add(-duration)
+		var bound any = since
+		switch timeType(field) {
+		case schema.UnixSecond:
+			bound = since.Unix()
+		case schema.UnixMillisecond:
+			bound = since.UnixMilli()
+		case schema.UnixNanosecond:
+			bound = since.UnixNano()
+		}
+		return service.FilterCompare(field.DBName, ">=", bound), nil
+	}
+	return nil, fmt.Errorf("%w: %s: no such time field of %s", ErrInvalidFilter, param, s.Name)
+}
+
+// withinUnits are the units of ParseWithin beyond the ones of
+// time.ParseDuration, by their order in the values.
+var withinUnits = []struct {
+	unit     string
+	duration time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// ParseWithin parses the duration of a relative time window param (e.g.
+// created_within=7d): a Go duration (see time.ParseDuration, e.g. 24h or
+// 90m), optionally led by weeks (w) and days (d), e.g. 2w, 7d, 1d12h or
+// 1.5d. The duration must be positive, and each of its parts, and not
+// overflow a time.Duration (about 292 years).
+func ParseWithin(value string) (time.Duration, error) {
+	var duration time.Duration
+	add := func(d time.Duration) bool {
+		if d < 0 || duration > math.MaxInt64-d {
+			return false
+		}
+		duration += d
+		return true
+	}
+	rest := strings.TrimSpace(value)
+	for _, u := range withinUnits {
+		number, after, found := strings.Cut(rest, u.unit)
+		if !found {
+			continue
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil || math.IsNaN(n) || n < 0 || n*float64(u.duration) >= math.MaxInt64 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		if !add(time.Duration(n * float64(u.duration))) {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		rest = after
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || !add(d) {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q: not positive", value)
+	}
+	return duration, nil
+}
+
+// filterOption builds a WHERE condition: column op value. The column must
+// not be blacklisted by the orm.FilterBlacklister of the model, and the op
+// must be one of the allowed ones of the column, if restricted by the
+// orm.FilterOperatorer of the model.
+func filterOption(column string, op string, value string, model any) (enum.QueryOption, error) {
+	if err := checkQueryable(column, model); err != nil {
+		return nil, err
+	}
+	if err := checkFilterOperator(column, op, model); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(op) {
+	case "", FilterOpEq:
+		v, err := coerceFilterValue(column, value, model)
+		if err != nil {
+			return nil, err
+		}
+		return service.FilterBy(column, v), nil
+	case FilterOpIn:
+		values := splitValues([]string{value})
+		coerced := make([]any, 0, len(values))
+		for _, value := range values {
+			v, err := coerceFilterValue(column, value, model)
+			if err != nil {
+				return nil, err
+			}
+			coerced = append(coerced, v)
+		}
+		return service.FilterIn(column, coerced), nil
+	case FilterOpAll:
+		association, associatedColumn, _ := strings.Cut(column, ".")
+		field, err := NameToField(association, model)
+		if err != nil {
+			return nil, err
+		}
+		s, err := orm.ParseSchema(model)
+		if err != nil {
+			return nil, err
+		}
+		rel, ok := s.Relationships.Relations[field]
+		if !ok || (rel.Type != schema.HasMany && rel.Type != schema.Many2Many) {
+			return nil, fmt.Errorf("%w: %q is not a to-many association", ErrInvalidFilter, association)
+		}
+		if associatedColumn != "" {
+			if _, err := orm.LookUpField(reflect.New(rel.FieldSchema.ModelType).Interface(), associatedColumn); err != nil {
+				return nil, err
+			}
+		}
+		values := splitValues([]string{value})
+		return service.FilterAll(field, associatedColumn, values), nil
+	case FilterOpContains, FilterOpStartsWith, FilterOpEndsWith:
+		return filterLikes[strings.ToLower(op)](column, value), nil
+	case FilterOpHas:
+		field, err := orm.LookUpField(model, column)
+		if err != nil {
+			return nil, err
+		}
+		if !service.IsArrayField(field) {
+			return nil, fmt.Errorf("%w: %q is not an array column", ErrInvalidFilter, column)
+		}
+		return service.FilterHas(field.DBName, splitValues([]string{value})), nil
+	}
+	return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, op)
+}
+
+// filterBools are the accepted (case-insensitive) values of bool filters.
+var filterBools = map[string]bool{
+	"true": true, "t": true, "1": true, "yes": true, "y": true, "on": true,
+	"false": false, "f": false, "0": false, "no": false, "n": false, "off": false,
+}
+
+// CheckFilterAllowedValues rejects (with a 400) the filter values of the
+// columns restricted by the orm.AllowedValuer of the model, which are not
+// in the allowed values. By default, such filters just match nothing.
+var CheckFilterAllowedValues = false
+
+// checkQueryable checks the column (or the association of a dotted one,
+// e.g. tags.name) is not blacklisted by the orm.FilterBlacklister of the
+// model, i.e. it can be filtered and ordered by.
+func checkQueryable(column string, model any) error {
+	association, _, _ := strings.Cut(column, ".")
+	if orm.FilterBlacklisted(model, column) || orm.FilterBlacklisted(model, association) {
+		return fmt.Errorf("%w: %q can not be filtered or ordered by", ErrColumnNotQueryable, column)
+	}
+	return nil
+}
+
+// checkFilterOperator checks the op ("" for FilterOpEq) is allowed for the
+// column by the orm.FilterOperatorer of the model.
+func checkFilterOperator(column string, op string, model any) error {
+	allowed, ok := orm.FilterOperators(model, column)
+	if !ok {
+		return nil
+	}
+	op = strings.ToLower(op)
+	if op == "" {
+		op = FilterOpEq
+	}
+	for _, a := range allowed {
+		if strings.ToLower(a) == op {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q on %q, allowed operators: %s",
+		ErrFilterOpNotAllowed, op, column, strings.Join(allowed, ", "))
+}
+
+// coerceFilterValue converts the filter value (a string from the query)
+// to the type of the model's column: bool, int, uint, float or time, or
+// the custom scalar type of the field (see isCustomScalar).
+// So that filter_by=active&filter_value=yes compares to `true`
+// instead of the string "yes", which means different things on different
+// databases.
+//
+// Values of unknown columns and other types are returned as is.
+// A value that can not be converted is an ErrInvalidFilter.
+func coerceFilterValue(column string, value string, model any) (any, error) {
+	field, err := orm.LookUpField(model, column)
+	if err != nil {
+		return value, nil
+	}
+	if v, ok := scalarFilterValue(field, value); ok {
+		if CheckFilterAllowedValues {
+			if err := orm.CheckAllowedValue(model, column, value); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+			}
+		}
+		return v, nil
+	}
+
+	var v any
+	switch field.DataType {
+	case schema.Bool:
+		b, ok := filterBools[strings.ToLower(strings.TrimSpace(value))]
+		if !ok {
+			err = strconv.ErrSyntax
+		}
+		v = b
+	case schema.Int:
+		v, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case schema.Uint:
+		v, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	case schema.Float:
+		v, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case schema.Time:
+		v = parseTimeParam(strings.TrimSpace(value))
+		if _, ok := v.(time.Time); !ok {
+			err = strconv.ErrSyntax
+		}
+	default:
+		if CheckFilterAllowedValues {
+			if err := orm.CheckAllowedValue(model, column, value); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+			}
+		}
+		return value, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a valid %s value for %q",
+			ErrInvalidFilter, value, field.DataType, column)
+	}
+	return v, nil
+}
+
+// filterStructField is a field of a filter struct (see ListOption.Filter)
+// with its `filter:"column,op"` tag resolved.
+type filterStructField struct {
+	index  []int
+	column string
+	op     string
+}
+
+// parseFilterStruct resolves the filter tags of the filter struct against
+// the model. It panics on invalid tags (unknown columns or operators):
+// which are programming errors, to be found at startup.
+func parseFilterStruct(filter any, model any) []filterStructField {
+	var fields []filterStructField
+	for _, f := range reflect.VisibleFields(reflect.TypeOf(filter)) {
+		tag, ok := f.Tag.Lookup("filter")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+		column, op, _ := strings.Cut(tag, ",")
+		if column == "" {
+			column = f.Name
+		}
+		field, err := orm.LookUpField(model, column)
+		if err != nil {
+			panic(fmt.Sprintf("filter struct %T: field %s: %v", filter, f.Name, err))
+		}
+		op = strings.ToLower(op)
+		if _, ok := filterComparisons[op]; !ok && op != "" && op != FilterOpIn && filterLikes[op] == nil {
+			panic(fmt.Sprintf("filter struct %T: field %s: %v %q", filter, f.Name, service.ErrUnknownOperator, op))
+		}
+		fields = append(fields, filterStructField{index: f.Index, column: field.DBName, op: op})
+	}
+	return fields
+}
+
+// bindFilterStruct binds the query params into a new filter struct (of the
+// type of filter), and builds the WHERE conditions of its non-zero fields.
+func bindFilterStruct(c *gin.Context, filter any, fields []filterStructField) (enum.QueryOption, error) {
+	ptr := reflect.New(reflect.TypeOf(filter))
+	if err := c.ShouldBindWith(ptr.Interface(), binding.Query); err != nil {
+		return nil, err
+	}
+
+	var options []enum.QueryOption
+	for _, f := range fields {
+		v := ptr.Elem().FieldByIndex(f.index)
+		if v.IsZero() {
+			continue
+		}
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		switch {
+		case v.Kind() == reflect.Slice:
+			options = append(options, service.FilterIn(f.column, toAnySlice(v)))
+		case f.op == FilterOpIn:
+			options = append(options, service.FilterIn(f.column, []any{v.Interface()}))
+		case f.op == "":
+			options = append(options, service.FilterCompare(f.column, "=", v.Interface()))
+		case filterLikes[f.op] != nil:
+			options = append(options, filterLikes[f.op](f.column, fmt.Sprint(v.Interface())))
+		default:
+			options = append(options, service.FilterCompare(f.column, filterComparisons[f.op], v.Interface()))
+		}
+	}
+	return chainOptions(options...), nil
+}
+
+// toAnySlice converts a reflect slice value into []any.
+func toAnySlice(v reflect.Value) []any {
+	values := make([]any, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+// chainOptions combines the options (nil ones are skipped) into one,
+// which is nil if there is no option.
+func chainOptions(options ...enum.QueryOption) enum.QueryOption {
+	var chain []enum.QueryOption
+	for _, option := range options {
+		if option != nil {
+			chain = append(chain, option)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return func(tx *gorm.DB) *gorm.DB {
+		for _, option := range chain {
+			tx = option(tx)
+		}
+		return tx
+	}
+}
@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+type member struct {
+	orm.BasicModel
+	Name     string    `json:"name"`
+	Active   bool      `json:"active"`
+	Age      int       `json:"age"`
+	Score    float64   `json:"score"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// listNames runs the list request, and returns the names of the members
+// listed, or nil if the request failed with the code.
+func listNames(t *testing.T, r *gin.Engine, url string) ([]string, int) {
+	t.Helper()
+	w := serve(r, http.MethodGet, url, "")
+	if w.Code != http.StatusOK {
+		return nil, w.Code
+	}
+	var resp struct {
+		Members []member `json:"members"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, m := range resp.Members {
+		names = append(names, m.Name)
+	}
+	return names, w.Code
+}
+
+func TestGetListHandler_CoerceFilterValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &member{})
+	day := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	members := []*member{
+		{Name: "ann", Active: true, Age: 30, Score: 1.5, JoinedAt: day},
+		{Name: "bob", Active: false, Age: 20, Score: 2, JoinedAt: day.AddDate(0, 0, 1)},
+	}
+	if err := db.Create(members).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/members", GetListHandler[member](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"filter_by=active&filter_value=yes", http.StatusOK, []string{"ann"}},
+		{"filter_by=active&filter_value=0", http.StatusOK, []string{"bob"}},
+		{"filters[active]=TRUE", http.StatusOK, []string{"ann"}},
+		{"filters[age]=20", http.StatusOK, []string{"bob"}},
+		{"filters[score]=1.5", http.StatusOK, []string{"ann"}},
+		{"filters[joined_at]=2023-01-11T00:00:00Z", http.StatusOK, []string{"bob"}},
+		{"filter_by=active&filter_value=maybe", http.StatusBadRequest, nil},
+		{"filters[age]=twenty", http.StatusBadRequest, nil},
+		{"filters[joined_at]=yesterday", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, code := listNames(t, r, "/members?"+tt.query)
+			if code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK && fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_TimeLocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(loc *time.Location) { TimeLocation = loc }(TimeLocation)
+	TimeLocation = time.FixedZone("UTC+8", 8*60*60)
+	db := servicetest.Open(t, &member{})
+	day := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	members := []*member{{Name: "ann", JoinedAt: day}, {Name: "bob", JoinedAt: day.AddDate(0, 0, 1)}}
+	if err := db.Create(members).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/members", GetListHandler[member](&enum.ListOption{LimitMax: 10}))
+
+	w := serve(r, http.MethodGet, "/members?filters[name]=ann", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Members []map[string]any `json:"members"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Members) != 1 || resp.Members[0]["name"] != "ann" {
+		t.Fatalf("members = %v, want ann", resp.Members)
+	}
+	if got, want := resp.Members[0]["joined_at"], "2023-01-10T08:00:00+08:00"; got != want {
+		t.Errorf("joined_at = %v, want %v", got, want)
+	}
+
+	// the time params without zones are in TimeLocation
+	if got, ok := parseTimeParam("2023-01-10 08:00:00").(time.Time); !ok || !got.Equal(day) {
+		t.Errorf("parseTimeParam = %v, want %v", got, day)
+	}
+	if got, ok := parseTimeParam("2023-01-10T00:00:00Z").(time.Time); !ok || !got.Equal(day) {
+		t.Errorf("parseTimeParam with zone = %v, want %v", got, day)
+	}
+}
+
+func TestParseWithin(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * day, false},
+		{"2w", 14 * day, false},
+		{"2w3d", 17 * day, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"24h", day, false},
+		{"90m", 90 * time.Minute, false},
+		{" 7d ", 7 * day, false},
+		{"3d2w", 0, true}, // the weeks first
+		{"1d2d", 0, true},
+		{"0", 0, true},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"-1d48h", 0, true},
+		{"1d-2h", 0, true},
+		{"NaNd", 0, true},
+		{"Infd", 0, true},
+		{"1e300w", 0, true},
+		{"16000w", 0, true},
+		{"15000w3000d", 0, true},
+		{"15000w2000000h", 0, true},
+		{"7days", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWithin(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWithin(%q) = %v, %v, want %v (err %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// event has unix time fields.
+type event struct {
+	ID        uint   `gorm:"primarykey" json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	UpdatedAt int64  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (e event) Identity() (fieldName string, value any) {
+	return "ID", e.ID
+}
+
+func TestGetListHandler_Within(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &member{}, &event{})
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	for _, m := range []*member{{Name: "new"}, {Name: "old"}} {
+		if err := db.Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&member{}).Where("name = ?", "old").UpdateColumns(map[string]any{"created_at": old, "updated_at": old}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*event{{Name: "new"}, {Name: "old"}} {
+		if err := db.Create(e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&event{}).Where("name = ?", "old").UpdateColumns(map[string]any{"created_at": old.UnixMilli(), "updated_at": old.Unix()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/members", GetListHandler[member](&enum.ListOption{LimitMax: 10}))
+	r.GET("/events", GetListHandler[event](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     string
+	}{
+		{"/members?created_within=7d", http.StatusOK, "[new]"},
+		{"/members?created_within=2w", http.StatusOK, "[new old]"},
+		{"/members?updated_within=1w", http.StatusOK, "[new]"},
+		{"/events?created_within=7d", http.StatusOK, "[new]"},
+		{"/events?created_within=2w", http.StatusOK, "[new old]"},
+		{"/events?updated_within=1d", http.StatusOK, "[new]"},
+		{"/members?created_within=-1d", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Members []member `json:"members"`
+				Events  []event  `json:"events"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, m := range resp.Members {
+				names = append(names, m.Name)
+			}
+			for _, e := range resp.Events {
+				names = append(names, e.Name)
+			}
+			if got := fmt.Sprint(names); got != tt.want {
+				t.Errorf("names = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type article struct {
+	orm.BasicModel
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (article) FilterBlacklist() []string {
+	return []string{"Body"}
+}
+
+func TestGetListHandler_FilterBlacklist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &article{})
+	if err := db.Create(&article{Title: "a", Body: "b"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/articles", GetListHandler[article](&enum.ListOption{LimitMax: 10}))
+	r.GET("/articles/facets", FacetHandler[article](&enum.FacetOption{}))
+
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+	}{
+		{"filter_by", "/articles?filter_by=body&filter_value=b", http.StatusBadRequest},
+		{"filter_by field name", "/articles?filter_by=Body&filter_value=b", http.StatusBadRequest},
+		{"filters", "/articles?filters[body]=b", http.StatusBadRequest},
+		{"order_by", "/articles?order_by=body", http.StatusBadRequest},
+		{"order_by nulls last", "/articles?order_by=body%20nulls%20last", http.StatusBadRequest},
+		{"order_by with a direction", "/articles?order_by=body%20desc", http.StatusBadRequest},
+		{"order_by an expression", "/articles?order_by=LOWER(body)", http.StatusBadRequest},
+		{"order_by quoted", "/articles?order_by=%60body%60", http.StatusBadRequest},
+		{"order_by qualified", "/articles?order_by=articles.body", http.StatusBadRequest},
+		{"distinct", "/articles?distinct=body", http.StatusBadRequest},
+		{"facet group_by", "/articles/facets?group_by=body", http.StatusBadRequest},
+		{"other column", "/articles?filter_by=title&filter_value=a&order_by=title&distinct=title", http.StatusOK},
+		{"facet of another column", "/articles/facets?group_by=title", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, http.MethodGet, tt.url, ""); w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+// listed runs the list request, and returns the code and the "name" of
+// each model of the list under the key.
+func listed(t *testing.T, r *gin.Engine, url string, key string) (int, []string) {
+	t.Helper()
+	w := serve(r, http.MethodGet, url, "")
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var models []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body[key], &models); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return w.Code, names
+}
+
+func TestGetListHandler_FilterAll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &crew{}, &skill{}, &customer{}, &purchase{})
+	skills := map[string]*skill{}
+	for _, name := range []string{"go", "sql", "css"} {
+		skills[name] = &skill{Name: name}
+		if err := db.Create(skills[name]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, skillNames := range map[string][]string{"a": {"go", "sql"}, "b": {"go"}, "c": {"sql", "go", "css"}} {
+		c := crew{Name: name}
+		for _, s := range skillNames {
+			c.Skills = append(c.Skills, skills[s])
+		}
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the customer x with the purchases 1 and 2, y with 3
+	for name, purchases := range map[string]int{"x": 2, "y": 1} {
+		c := customer{Name: name}
+		for i := 0; i < purchases; i++ {
+			c.Purchases = append(c.Purchases, &purchase{})
+		}
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var x customer
+	if err := db.Preload("Purchases").Where("name = ?", "x").Take(&x).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/crews", GetListHandler[crew](&enum.ListOption{LimitMax: 10}))
+	r.GET("/customers", GetListHandler[customer](&enum.ListOption{LimitMax: 10}))
+
+	skillIDs := fmt.Sprintf("%d,%d", skills["go"].ID, skills["sql"].ID)
+	purchaseIDs := fmt.Sprintf("%d,%d", x.Purchases[0].ID, x.Purchases[1].ID)
+	tests := []struct {
+		name     string
+		url      string
+		key      string
+		wantCode int
+		want     []string
+	}{
+		{"many2many by the column", "/crews?order_by=name&filters[skills.name]=go,sql&filter_ops[skills.name]=all", "crews", http.StatusOK, []string{"a", "c"}},
+		{"many2many by one value", "/crews?order_by=name&filters[skills.name]=css&filter_ops[skills.name]=all", "crews", http.StatusOK, []string{"c"}},
+		{"many2many by the primary key", "/crews?order_by=name&filters[skills]=" + skillIDs + "&filter_ops[skills]=all", "crews", http.StatusOK, []string{"a", "c"}},
+		{"many2many none", "/crews?filters[skills.name]=go,rust&filter_ops[skills.name]=all", "crews", http.StatusOK, nil},
+		{"has many", "/customers?filters[purchases]=" + purchaseIDs + "&filter_ops[purchases]=all", "customers", http.StatusOK, []string{"x"}},
+		{"has many of another owner", fmt.Sprintf("/customers?filters[purchases]=%d,%d&filter_ops[purchases]=all", x.Purchases[0].ID, x.Purchases[1].ID+1), "customers", http.StatusOK, nil},
+		{"not an association", "/crews?filters[name]=a&filter_ops[name]=all", "crews", http.StatusBadRequest, nil},
+		{"unknown column of the association", "/crews?filters[skills.level]=1&filter_ops[skills.level]=all", "crews", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, names := listed(t, r, tt.url, tt.key)
+			if code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", code, tt.wantCode)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_FilterHas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &profile{})
+	if err := db.Create(&profile{Name: "a", Tags: []string{"gold"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/profiles", GetListHandler[profile](&enum.ListOption{LimitMax: 10}))
+
+	for _, url := range []string{
+		"/profiles?filters[name]=a&filter_ops[name]=has",
+		"/profiles?filters[tags]=gold&filter_ops[tags]=has", // serializer:json, not an array
+		"/profiles?filters[missing]=gold&filter_ops[missing]=has",
+	} {
+		if code, _ := listed(t, r, url, "profiles"); code != http.StatusBadRequest {
+			t.Errorf("GET %s: code = %d, want 400", url, code)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
 	"github.com/tqrj/cd/service"
+	"gorm.io/gorm/schema"
+	"net/http"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 // GetListHandler handles
@@ -17,25 +25,69 @@ import (
 //
 // QueryOptions (See GetRequestOptions for more details):
 //
-//	limit, offset, order_by, desc, filter_by, filter_value, preload, total.
+//	limit, offset, order_by, desc, filter_by, filter_value, preload, fields, total, explain,
+//	distinct, ids, q (the search of ListOption.SearchFields).
+//
+// total=true (or exact) counts the total exactly, and total=estimate
+// estimates it cheaply (see service.EstimateCount), which is reported by
+// the meta.total_kind: "exact" or "estimate". distinct=customer_id counts
+// the distinct values of the column among the filtered models (see
+// service.CountDistinct) into meta.distinct: { customer_id: 12 }.
+//
+// ids=3,1,2 lists the models of the primary keys, in the order of the ids
+// (e.g. of a cached list of ids) unless ordered by order_by. The ordered
+// lists are paginated over the ids, see pageIDs.
+//
+// ids_only=true responds only the primary keys of the filtered and ordered
+// page, by a SELECT of the primary key (see service.PluckIDs), e.g. to get
+// the id set of a bulk operation: { ids: [3, 1, 2], meta: {...} }. The
+// fields, preloads, with_counts and the Mapper do not apply.
 //
 // Response:
-//   - 200 OK: { Ts: [{...}, ...] }
+//   - 200 OK: { Ts: [{...}, ...], meta: { pagination: {...}, total: 42 } }
+//   - 200 OK: { ids: [1, 2, ...], meta: {...} }  // if ids_only=true
+//   - 206 Partial Content: { Ts: [...] }, with Content-Range: items 0-24/42  // for Range: items=0-24, see RangeUnit
+//   - 200 OK: { explain: [{...}, ...], sql: "SELECT ..." }  // if explain=true
+//   - 304 Not Modified  // if If-Modified-Since, see ListOption.LastModified
 //   - 400 Bad Request: { error: "request band failed" }
+//   - 400 Bad Request: { error: "offset too large / beyond total" }  // See ListOption.MaxOffset
+//   - 416 Range Not Satisfiable: { error: "range not satisfiable" }  // a Range beyond the models
 //   - 422 Unprocessable Entity: { error: "get process failed" }
 func GetListHandler[T any](opt *enum.ListOption) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var request enum.GetRequestOptions
-		if err := c.ShouldBind(&request); err != nil {
+	var filterFields []filterStructField
+	if opt.Filter != nil {
+		filterFields = parseFilterStruct(opt.Filter, *new(T))
+	}
+	mustPreloads[T]("GetListHandler: DefaultPreloads", opt.DefaultPreloads)
+	mustConditionalPreloads[T]("GetListHandler", opt.ConditionalPreloads)
+	searchFields := mustSearchFields[T](opt.SearchFields)
+	mapper := mustMapper[T]("GetListHandler", opt.Mapper)
+
+	return withCache[T](opt.Cache, withLargeBodyWarning(opt.WarnBytes, func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetListHandler: bind request failed")
 			ResponseError(c, CodeBadRequest, err)
 			return
 		}
-		request.Filters = c.QueryMap("filters")
+		if err := bindRange(c, &request); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: bind range failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		request = pageOffset(request, opt.LimitMax)
+		if opt.TypedFiltersOnly {
+			if err := checkTypedFiltersOnly(request, opt, filterFields, *new(T)); err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: generic filters disabled")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+		}
 
 		if opt.Pretreat != nil {
-			var err error
 			request, err = opt.Pretreat(c, request)
 			if err != nil {
 				logger.WithContext(c).WithError(err).
@@ -44,81 +96,674 @@ func GetListHandler[T any](opt *enum.ListOption) gin.HandlerFunc {
 				return
 			}
 		}
-		options := buildQueryOptions(request, opt.LimitMax, opt.Omit)
+		var orderOpt enum.QueryOption
+		if orderExpr, ok := opt.OrderExprs[request.OrderBy]; ok && orderExpr != nil {
+			orderOpt, err = orderExprOption(c, orderExpr, request.Descending)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: OrderExpr failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			request.OrderBy = "" // ordered by orderOpt instead
+		}
+		idField, ids, err := listIDs[T](request)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: invalid ids")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		byIDs := len(ids) > 0 && orderOpt == nil && request.OrderBy == ""
+		search := request.Q != "" && len(searchFields) > 0
+		if search && orderOpt == nil && request.OrderBy == "" && !byIDs {
+			orderOpt = service.OrderBySearch(request.Q, searchFields)
+		}
+		selection, err := parseFields(request.Fields)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: parseFields failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		preloads := append(fieldsPreloads(selection, ""), request.Preload...)
+		if err := checkPreloads(preloads, opt.MaxPreloads, opt.MaxPreloadDepth); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: checkPreloads failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if len(preloads) == 0 && selection == nil {
+			request.Preload = opt.DefaultPreloads
+		}
+		if selection == nil {
+			request.Preload = conditionalPreloads(c, request.Preload, opt.ConditionalPreloads)
+		}
+		if request.IDsOnly { // nothing to load but the ids
+			selection, request.Preload = nil, nil
+		}
+		if len(request.PreloadWithDeleted) > 0 && !opt.AllowPreloadWithDeleted {
+			logger.WithContext(c).Warn("GetListHandler: preload_with_deleted not allowed")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: not allowed", ErrPreloadWithDeleted))
+			return
+		}
+		pageRequest := request
+		if byIDs { // paginated over the ids, see pageIDs
+			pageRequest.Offset = 0
+		}
+		options, err := buildQueryOptions(pageRequest, opt.LimitMax, opt.Omit, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: buildQueryOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if selection != nil {
+			fieldsOpts, err := fieldsOptions(selection, *new(T))
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: fieldsOptions failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			options = append(options, fieldsOpts...)
+		}
+		if orderOpt != nil {
+			options = append(options, orderOpt)
+		}
+		if opt.Session != nil {
+			options = append(options, service.WithSession(opt.Session))
+		}
 		var queryOpt enum.QueryOption
 		if opt.QueryOptionClosure != nil {
 			queryOpt = opt.QueryOptionClosure(c, request)
+		}
+		if opt.Filter != nil {
+			filter, err := bindFilterStruct(c, opt.Filter, filterFields)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: bind filter failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			queryOpt = chainOptions(queryOpt, filter)
+		}
+		if search {
+			queryOpt = chainOptions(queryOpt, service.Search(request.Q, searchFields))
+		}
+		if len(ids) > 0 {
+			queryOpt = chainOptions(queryOpt, service.FilterIn(idField, ids))
+		}
+		if queryOpt != nil {
 			options = append(options, queryOpt)
 		}
+		if byIDs {
+			page := pageIDs(ids, pageLimit(request.Limit, opt.LimitMax), request.Offset)
+			options = append(options, service.FilterIn(idField, page))
+		}
+		if opt.MaxOffset > 0 && request.Offset > opt.MaxOffset {
+			err := fmt.Errorf("%w: offset %d > %d", ErrOffsetTooLarge, request.Offset, opt.MaxOffset)
+			logger.WithContext(c).WithError(err).
+				Warn("GetListHandler: offset too large")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if request.Explain { // of the queries the route runs only
+			explainList[T](c, opt, options)
+			return
+		}
+
+		meta := new(Meta).SetPagination(pageLimit(request.Limit, opt.LimitMax), request.Offset)
+		var counted *int64 // the total, if counted
+		exactTotal := request.Range || (opt.RejectOffsetBeyondTotal && request.Offset > 0)
+		if request.TotalEstimate && !exactTotal {
+			total, exact, err := getEstimatedCount[T](c, request, queryOpt)
+			switch {
+			case err != nil:
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: getEstimatedCount failed")
+				meta.AddError("total", err)
+			case exact:
+				counted = &total
+				meta.SetTotal(total)
+			default:
+				meta.SetEstimatedTotal(total)
+			}
+		} else if request.Total || exactTotal {
+			total, err := getCount[T](c, request, queryOpt)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: getCount failed")
+				if opt.RejectOffsetBeyondTotal && request.Offset > 0 {
+					// the offset can not be checked: not served unchecked
+					ResponseError(c, CodeProcessFailed, err)
+					return
+				}
+				meta.AddError("total", err)
+			} else if opt.RejectOffsetBeyondTotal && request.Offset > 0 && int64(request.Offset) >= total {
+				err := fmt.Errorf("%w: offset %d >= total %d", ErrOffsetBeyondTotal, request.Offset, total)
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: offset beyond total")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			} else {
+				counted = &total
+				if request.Total {
+					meta.SetTotal(total)
+				}
+			}
+		}
+
+		for _, column := range splitValues(request.Distinct) {
+			if err := checkDistinctColumn(column, *new(T)); err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: invalid distinct column")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			count, err := getDistinctCount[T](c, column, request, queryOpt)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: getDistinctCount failed")
+				meta.AddError("distinct", err)
+				continue
+			}
+			meta.SetDistinct(column, count)
+		}
+
+		if opt.LastModified {
+			lastModified, err := getLastModified[T](c, request, queryOpt)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: getLastModified failed")
+			} else if notModified(c, lastModified) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+
+		if request.IDsOnly {
+			listIDsOnly[T](c, options, byIDs, ids, meta)
+			return
+		}
+
 		var dest []*T
-		err := service.GetMany[T](c, &dest, options...)
+		err = service.GetMany[T](c, &dest, options...)
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetListHandler: GetMany failed")
 			ResponseError(c, CodeProcessFailed, err)
 			return
 		}
+		if byIDs {
+			orderByIDs(c, dest, ids)
+		}
+		meta.SetHasNext(len(dest))
+		warnLargeResponse(c, dest, opt.WarnRows)
+		code := CodeSuccess
+		if request.Range {
+			if code, err = contentRange(c, request.Offset, len(dest), counted); err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: range not satisfiable")
+				ResponseError(c, CodeRangeNotSatisfiable, err)
+				return
+			}
+		}
 
-		var addition []gin.H
-		if request.Total {
-			total, err := getCount[T](c, request.Filters, request.FiltersAt, queryOpt)
+		if mapper != nil {
+			if opt.BatchLoads {
+				primeLoaders(c, dest)
+			}
+			responseSuccess(c, code, nil, gin.H{getResponseModelName(dest): mapModels(c, dest, mapper)}, meta.H())
+			return
+		}
+		if withCounts := splitValues(request.WithCounts); len(withCounts) > 0 {
+			models, err := withAssociationCounts[T](c, dest, withCounts)
 			if err != nil {
 				logger.WithContext(c).WithError(err).
-					Warn("GetListHandler: getCount failed")
-				addition = append(addition, gin.H{"totalError": err.Error()})
-			} else {
-				addition = append(addition, gin.H{"total": total})
+					Warn("GetListHandler: withAssociationCounts failed")
+				ResponseError(c, getErrorCode(err), err)
+				return
+			}
+			if selection != nil {
+				for _, model := range models {
+					pruneFields(model, selection, reflect.TypeOf(dest).Elem())
+				}
+			}
+			responseSuccess(c, code, nil, gin.H{getResponseModelName(dest): models}, meta.H())
+			return
+		}
+		if selection != nil {
+			models, err := selectedModels(dest, selection)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetListHandler: selectedModels failed")
+				ResponseError(c, CodeProcessFailed, err)
+				return
 			}
+			responseSuccess(c, code, nil, gin.H{getResponseModelName(dest): models}, meta.H())
+			return
+		}
+		responseSuccess(c, code, dest, meta.H())
+	}))
+}
+
+// warnLargeResponse sets the Warning header if the models are more than
+// maxRows (if > 0), see ListOption.WarnRows.
+func warnLargeResponse[T any](c *gin.Context, models []*T, maxRows int) {
+	if maxRows > 0 && len(models) > maxRows {
+		warnLarge(c, fmt.Sprintf("%d rows", len(models)))
+	}
+}
+
+func warnLarge(c *gin.Context, size string) {
+	c.Header("Warning", fmt.Sprintf(`199 - "large response (%s), please paginate with limit and offset"`, size))
+}
+
+// withLargeBodyWarning wraps the handler to set the Warning header of the
+// success responses with bodies larger than maxBytes (if > 0), unless
+// warned already, see ListOption.WarnBytes. The body is buffered to be
+// measured, as written by the handler, before it is sent.
+func withLargeBodyWarning(maxBytes int, handler gin.HandlerFunc) gin.HandlerFunc {
+	if maxBytes <= 0 {
+		return handler
+	}
+	return func(c *gin.Context) {
+		buffer := &bodyBuffer{ResponseWriter: c.Writer}
+		c.Writer = buffer
+		handler(c)
+		c.Writer = buffer.ResponseWriter
+
+		status := c.Writer.Status()
+		if size := buffer.body.Len(); size > maxBytes && status >= 200 && status < 300 && c.Writer.Header().Get("Warning") == "" {
+			warnLarge(c, fmt.Sprintf("%d bytes", size))
+		}
+		if buffer.body.Len() > 0 {
+			_, _ = c.Writer.Write(buffer.body.Bytes())
+		}
+	}
+}
+
+// bodyBuffer is a gin.ResponseWriter holding the body, which is written
+// by its owner.
+type bodyBuffer struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyBuffer) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bodyBuffer) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// checkTypedFiltersOnly rejects the generic filters, orders and distinct
+// counts of the request, see ListOption.TypedFiltersOnly. The distinct
+// columns allowed are the DistinctColumns and the columns of the filter
+// struct (of the filterFields).
+func checkTypedFiltersOnly(request enum.GetRequestOptions, opt *enum.ListOption, filterFields []filterStructField, model any) error {
+	if err := checkGenericFilters(request); err != nil {
+		return err
+	}
+	if column, _ := splitNulls(request.OrderBy); column != "" && !Contains(opt.OrderColumns, column) {
+		if _, ok := opt.OrderExprs[request.OrderBy]; !ok {
+			return fmt.Errorf("%w: order_by %q", ErrGenericFilterDisabled, request.OrderBy)
+		}
+	}
+	for _, column := range splitValues(request.Distinct) {
+		if !Contains(opt.DistinctColumns, column) && !isFilterColumn(filterFields, column, model) {
+			return fmt.Errorf("%w: distinct %q", ErrGenericFilterDisabled, column)
+		}
+	}
+	return nil
+}
+
+// isFilterColumn reports whether the column (or field) of the model is
+// filtered by a field of the filter struct.
+func isFilterColumn(filterFields []filterStructField, column string, model any) bool {
+	field, err := orm.LookUpField(model, column)
+	if err != nil {
+		return false
+	}
+	for _, f := range filterFields {
+		if f.column == field.DBName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGenericFilters rejects the generic filters of the request, for the
+// routes filtering as the list with TypedFiltersOnly.
+func checkGenericFilters(request enum.GetRequestOptions) error {
+	if request.FilterBy != "" || len(request.Filters) > 0 ||
+		len(request.FilterOps) > 0 || len(request.FiltersAt) > 0 {
+		return fmt.Errorf("%w: filter_by, filters, filter_ops, filters_at", ErrGenericFilterDisabled)
+	}
+	return nil
+}
+
+// listIDsOnly responds the primary keys of the list (of the options), for
+// ids_only=true:
+//
+//	{ ids: [3, 1, 2], meta: { pagination: {...} } }
+func listIDsOnly[T any](c *gin.Context, options []enum.QueryOption, byIDs bool, ids []any, meta *Meta) {
+	plucked, err := service.PluckIDs[T](c, options...)
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("GetListHandler: PluckIDs failed")
+		ResponseError(c, CodeProcessFailed, err)
+		return
+	}
+	if byIDs {
+		orderIDs(plucked, ids)
+	}
+	meta.SetHasNext(reflect.ValueOf(plucked).Len())
+	ResponseSuccess(c, nil, gin.H{"ids": plucked}, meta.H())
+}
+
+// listIDs returns the column of the primary key of T and the ids of the
+// request (see GetRequestOptions.IDs), converted to its type, without
+// duplicates.
+func listIDs[T any](request enum.GetRequestOptions) (column string, ids []any, err error) {
+	values := splitValues(request.IDs)
+	if len(values) == 0 {
+		return "", nil, nil
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return "", nil, err
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return "", nil, service.ErrNoIdentityField
+	}
+	pk := s.PrioritizedPrimaryField
+	seen := map[string]bool{}
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		id, err := coerceFilterValue(pk.Name, value, *new(T))
+		if err != nil {
+			return "", nil, err
+		}
+		ids = append(ids, id)
+	}
+	return pk.DBName, ids, nil
+}
+
+// pageIDs returns the ids of the page of the limit and offset.
+//
+// The lists ordered by the ids are paginated over the ids (instead of the
+// LIMIT / OFFSET of the query): the query gets the ids of the page, and
+// the models are ordered in Go by orderByIDs. It is portable to all the
+// dialects (instead of the FIELD() of MySQL, or a CASE of the ids as long
+// as the list), but a page is short of the ids filtered out or not found.
+func pageIDs(ids []any, limit int, offset int) []any {
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	end := len(ids)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return ids[offset:end]
+}
+
+// orderByIDs sorts the models in the order of the ids.
+func orderByIDs[T any](c *gin.Context, models []*T, ids []any) {
+	s, err := orm.ParseSchema(new(T))
+	if err != nil || s.PrioritizedPrimaryField == nil {
+		return
+	}
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[fmt.Sprint(id)] = i
+	}
+	position := func(model *T) int {
+		id := s.PrioritizedPrimaryField.ReflectValueOf(c, reflect.ValueOf(model).Elem())
+		return index[fmt.Sprint(id.Interface())]
+	}
+	sort.SliceStable(models, func(i, j int) bool {
+		return position(models[i]) < position(models[j])
+	})
+}
+
+// orderIDs sorts the plucked (slice of) primary keys in the order of the
+// ids, as orderByIDs.
+func orderIDs(plucked any, ids []any) {
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[fmt.Sprint(id)] = i
+	}
+	v := reflect.ValueOf(plucked)
+	sort.SliceStable(plucked, func(i, j int) bool {
+		return index[fmt.Sprint(v.Index(i).Interface())] < index[fmt.Sprint(v.Index(j).Interface())]
+	})
+}
+
+// modelIDs returns the primary keys of the models, in order.
+func modelIDs[T any](c *gin.Context, models []*T) ([]any, error) {
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return nil, err
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return nil, service.ErrNoIdentityField
+	}
+	ids := make([]any, 0, len(models))
+	for _, model := range models {
+		id := s.PrioritizedPrimaryField.ReflectValueOf(c, reflect.ValueOf(model).Elem())
+		ids = append(ids, id.Interface())
+	}
+	return ids, nil
+}
+
+// primeLoaders sets the service.Loaders of the request, primed with the
+// primary keys of the models, for ListOption.BatchLoads: the per-model
+// loads of the Mapper (e.g. by service.CountLoader) are coalesced into one
+// query per loader.
+func primeLoaders[T any](c *gin.Context, models []*T) {
+	ids, err := modelIDs(c, models)
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("GetListHandler: primeLoaders failed")
+		return
+	}
+	reqctx.Set(c, service.KeyLoaders, service.NewLoaders(ids))
+}
+
+// withAssociationCounts counts the associations (fields) of each model in
+// dest, and attaches the counts to the model as "<field>_count":
+//
+//	withAssociationCounts(c, users, []string{"Orders"})
+//	// => [{"ID": 1, ..., "orders_count": 3}, ...]
+func withAssociationCounts[T any](c *gin.Context, dest []*T, fields []string) ([]map[string]any, error) {
+	ids, err := modelIDs(c, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]map[string]any, len(dest))
+	for i, model := range dest {
+		if models[i], err = toMap(model); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range fields {
+		field, err := NameToField(name, *new(T))
+		if err != nil {
+			return nil, err
+		}
+		counts, err := service.CountAssociationsIn[T](c, field, ids)
+		if err != nil {
+			return nil, err
+		}
+		key := orm.DB.NamingStrategy.ColumnName("", field) + "_count"
+		for i := range models {
+			models[i][key] = counts[fmt.Sprint(ids[i])]
 		}
-		ResponseSuccess(c, dest, addition...)
 	}
+	return models, nil
+}
+
+// explainList responds the query plan of the list query built by options.
+func explainList[T any](c *gin.Context, opt *enum.ListOption, options []enum.QueryOption) {
+	if !opt.AllowExplain {
+		logger.WithContext(c).Warn("GetListHandler: explain is not allowed")
+		ResponseError(c, CodeBadRequest, ErrExplainNotAllowed)
+		return
+	}
+	plan, sql, err := service.Explain[T](c, options...)
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("GetListHandler: Explain failed")
+		ResponseError(c, CodeProcessFailed, err)
+		return
+	}
+	ResponseSuccess(c, nil, gin.H{"explain": plan, "sql": sql})
 }
 
 // GetByIDHandler handles
 //
 //	GET /T/:idParam
 //
-// QueryOptions (See GetRequestOptions for more details): preload
+// QueryOptions (See GetRequestOptions for more details): preload, fields,
+// depth (see GetOption.MaxDepth)
+//
+// The model is looked up by the GetOption.LookupColumn (e.g. a slug) if it
+// is set, instead of the primary key.
 //
 // Response:
 //   - 200 OK: { T: {...} }
 //   - 400 Bad Request: { error: "request band failed" }
 //   - 422 Unprocessable Entity: { error: "get process failed" }
 func GetByIDHandler[T orm.Model](idParam string, opt *enum.GetOption) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var request enum.GetRequestOptions
-		if err := c.ShouldBind(&request); err != nil {
+	var lookupColumn string
+	if opt.LookupColumn != "" {
+		field, err := orm.LookUpUniqueField(new(T), opt.LookupColumn)
+		if err != nil {
+			panic(fmt.Sprintf("GetByIDHandler: LookupColumn: %v", err))
+		}
+		lookupColumn = field.DBName
+	}
+	mustPreloads[T]("GetByIDHandler: DefaultPreloads", opt.DefaultPreloads)
+	mustConditionalPreloads[T]("GetByIDHandler", opt.ConditionalPreloads)
+	mapper := mustMapper[T]("GetByIDHandler", opt.Mapper)
+	byDepth := make([][]string, opt.MaxDepth+1) // the depthPreloads, by depth
+	for depth := 1; depth <= opt.MaxDepth; depth++ {
+		byDepth[depth] = depthPreloads(new(T), depth)
+	}
+
+	return withCache[T](opt.Cache, func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetByIDHandler: bind request failed")
 			ResponseError(c, CodeBadRequest, err)
 			return
 		}
-		request.Filters = c.QueryMap("filters")
 		if opt.Pretreat != nil {
-			var err error
 			request, err = opt.Pretreat(c, request)
 			if err != nil {
 				logger.WithContext(c).WithError(err).
-					Warn("GetListHandler:Pretreat err")
+					Warn("GetByIDHandler: Pretreat failed")
 				ResponseError(c, CodeBadRequest, err)
 				return
 			}
 		}
-		options := buildQueryOptions(request, 1, opt.Omit)
+		selection, err := parseFields(request.Fields)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetByIDHandler: parseFields failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		preloads := append(fieldsPreloads(selection, ""), request.Preload...)
+		if err := checkPreloads(preloads, opt.MaxPreloads, opt.MaxPreloadDepth); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetByIDHandler: checkPreloads failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if request.Depth < 0 || request.Depth > opt.MaxDepth {
+			err := fmt.Errorf("%w: %d, allowed up to %d", ErrInvalidDepth, request.Depth, opt.MaxDepth)
+			logger.WithContext(c).WithError(err).
+				Warn("GetByIDHandler: invalid depth")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if len(preloads) == 0 && selection == nil && request.Depth == 0 {
+			request.Preload = opt.DefaultPreloads
+		}
+		if selection == nil {
+			request.Preload = conditionalPreloads(c, request.Preload, opt.ConditionalPreloads)
+			request.Preload = appendPreloads(request.Preload, byDepth[request.Depth])
+		}
+		if len(request.PreloadWithDeleted) > 0 && !opt.AllowPreloadWithDeleted {
+			logger.WithContext(c).Warn("GetByIDHandler: preload_with_deleted not allowed")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: not allowed", ErrPreloadWithDeleted))
+			return
+		}
+		options, err := buildQueryOptions(request, 1, opt.Omit, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetByIDHandler: buildQueryOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if selection != nil {
+			fieldsOpts, err := fieldsOptions(selection, *new(T))
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetByIDHandler: fieldsOptions failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			options = append(options, fieldsOpts...)
+		}
+		if opt.Session != nil {
+			options = append(options, service.WithSession(opt.Session))
+		}
 		var queryOpt enum.QueryOption
 		if opt.QueryOptionClosure != nil {
 			queryOpt = opt.QueryOptionClosure(c, request)
 			options = append(options, queryOpt)
 		}
-		dest, err := getModelByID[T](c, idParam, options...)
+		var dest *T
+		if lookupColumn != "" {
+			dest, err = getModelByColumn[T](c, idParam, lookupColumn, options...)
+		} else {
+			dest, err = getModelByID[T](c, idParam, options...)
+		}
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetByIDHandler: getModelByID failed")
 			ResponseError(c, CodeProcessFailed, err)
 			return
 		}
+		if mapper != nil {
+			ResponseSuccess(c, nil, gin.H{getResponseModelName(dest): mapper(c, dest)})
+			return
+		}
+		if selection != nil {
+			model, err := toMap(dest)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetByIDHandler: toMap failed")
+				ResponseError(c, CodeProcessFailed, err)
+				return
+			}
+			pruneFields(model, selection, reflect.TypeOf(dest))
+			ResponseSuccess(c, nil, gin.H{getResponseModelName(dest): model})
+			return
+		}
 		ResponseSuccess(c, dest)
-	}
+	})
 }
 
 // GetFieldHandler handles
@@ -127,7 +772,8 @@ func GetByIDHandler[T orm.Model](idParam string, opt *enum.GetOption) gin.Handle
 //
 // QueryOptions (See GetRequestOptions for more details):
 //
-//	limit, offset, order_by, desc, filter_by, filter_value, preload, total.
+//	limit, offset, order_by, desc, filter_by, filter_value, preload, total,
+//	select (columns of the field models, with their keys always selected).
 //
 // Notice, all GetRequestOptions will be conditions for the field, for example:
 //
@@ -135,29 +781,77 @@ func GetByIDHandler[T orm.Model](idParam string, opt *enum.GetOption) gin.Handle
 //
 // Preloads User.Order.Product instead of User.Product.
 //
+// Polymorphic associations are supported: the field models are the ones
+// of the type of T, e.g. GET /post/1/comments and GET /photo/1/comments
+// respond the comments of the post 1 and of the photo 1 respectively.
+//
+// The rows of the join table of a many-to-many field are nested in the
+// field models by GetOption.JoinTable, e.g. the roles of the user's teams.
+//
 // Response:
-//   - 200 OK: { Fs: [{...}, ...] }  // field models
+//   - 200 OK: { Fs: [{...}, ...], meta: { total: 42, pagination: {...} } }  // field models, paginated like GetListHandler
 //   - 400 Bad Request: { error: "request band failed" }
 //   - 422 Unprocessable Entity: { error: "get process failed" }
 func GetFieldHandler[T orm.Model](idParam string, field string, opt *enum.GetOption) gin.HandlerFunc {
-	field = nameToField(field, *new(T))
+	field = mustAssociation(field, *new(T))
+	fieldModel := reflect.New(fieldType(reflect.TypeOf(*new(T)), field)).Elem().Interface()
+	if opt.JoinTable != "" {
+		if _, err := service.LookUpJoinModel(new(T), field); err != nil {
+			panic(fmt.Sprintf("GetFieldHandler: JoinTable: %v", err))
+		}
+	}
+	limitMax := 1
+	if opt.FieldLimitMax > 0 {
+		limitMax = opt.FieldLimitMax
+	}
 
 	return func(c *gin.Context) {
-		var request enum.GetRequestOptions
-		if err := c.ShouldBind(&request); err != nil {
+		request, err := bindGetRequest(c)
+		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetFieldHandler: bind request failed")
 			ResponseError(c, CodeBadRequest, err)
 			return
 		}
-		request.Filters = c.QueryMap("filters")
-		options := buildQueryOptions(request, 1, opt.Omit)
+		request = pageOffset(request, limitMax)
+		if err := checkPreloads(request.Preload, opt.MaxPreloads, opt.MaxPreloadDepth); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetFieldHandler: checkPreloads failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if len(request.PreloadWithDeleted) > 0 && !opt.AllowPreloadWithDeleted {
+			logger.WithContext(c).Warn("GetFieldHandler: preload_with_deleted not allowed")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: not allowed", ErrPreloadWithDeleted))
+			return
+		}
+		options, err := buildQueryOptions(request, limitMax, opt.Omit, fieldModel)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("GetFieldHandler: buildQueryOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if selects := splitValues(request.Select); len(selects) > 0 {
+			selectOpt, err := service.SelectAssociation(new(T), field, selects)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("GetFieldHandler: SelectAssociation failed")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			options = append(options, selectOpt)
+		}
 		var queryOpt enum.QueryOption
 		if opt.QueryOptionClosure != nil {
 			queryOpt = opt.QueryOptionClosure(c, request)
 			options = append(options, queryOpt)
 		}
-		model, err := getModelByID[T](c, idParam, service.Preload(field, options...))
+		modelOptions := []enum.QueryOption{service.Preload(field, options...)}
+		if opt.Session != nil {
+			modelOptions = append(modelOptions, service.WithSession(opt.Session))
+		}
+		model, err := getModelByID[T](c, idParam, modelOptions...)
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("GetFieldHandler: getModelByID failed")
@@ -169,56 +863,333 @@ func GetFieldHandler[T orm.Model](idParam string, field string, opt *enum.GetOpt
 			Elem(). // because model is a pointer
 			FieldByName(field)
 
-		var addition []gin.H
-		if request.Total && fieldValue.Kind() == reflect.Slice {
-			total, err := getAssociationCount(c, model, field, request.Filters, request.FiltersAt, queryOpt)
+		var meta *Meta
+		if fieldValue.Kind() == reflect.Slice {
+			meta = new(Meta).SetPagination(pageLimit(request.Limit, limitMax), request.Offset)
+			if request.Total {
+				total, err := getAssociationCount(c, model, field, request, fieldModel, queryOpt)
+				if err != nil {
+					logger.WithContext(c).WithError(err).
+						Warn("GetFieldHandler: getAssociationCount failed")
+					meta.AddError("total", err)
+				} else {
+					meta.SetTotal(total)
+				}
+			}
+			meta.SetHasNext(fieldValue.Len())
+		}
+
+		if opt.JoinTable != "" {
+			models, err := withJoinRows(c, model, field, fieldValue.Interface(), opt.JoinTable)
 			if err != nil {
 				logger.WithContext(c).WithError(err).
-					Warn("GetFieldHandler: getAssociationCount failed")
-				addition = append(addition, gin.H{"totalError": err.Error()})
-			} else {
-				addition = append(addition, gin.H{"total": total})
+					Warn("GetFieldHandler: withJoinRows failed")
+				ResponseError(c, CodeProcessFailed, err)
+				return
 			}
+			ResponseSuccess(c, nil, meta.H(), gin.H{getResponseModelName(fieldValue.Interface()): models})
+			return
 		}
+		ResponseSuccess(c, fieldValue.Interface(), meta.H())
+	}
+}
 
-		ResponseSuccess(c, fieldValue.Interface(), addition...)
+// withJoinRows attaches the rows of the join table of the many-to-many
+// field of model to the associated models (see GetOption.JoinTable), as
+// the key of each one.
+func withJoinRows(ctx context.Context, model any, field string, associated any, key string) ([]map[string]any, error) {
+	rows, err := service.JoinRows(ctx, model, field, associated)
+	if err != nil {
+		return nil, err
 	}
+	v := reflect.ValueOf(associated)
+	models := make([]map[string]any, v.Len())
+	for i := range models {
+		if models[i], err = toMap(v.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+		if rows[i] == nil {
+			models[i][key] = nil
+			continue
+		}
+		if models[i][key], err = toMap(rows[i]); err != nil {
+			return nil, err
+		}
+	}
+	return models, nil
 }
 
-func buildQueryOptions(request enum.GetRequestOptions, LimitMax int, omit []string) []enum.QueryOption {
-	var options []enum.QueryOption
-	if request.Limit > 0 && request.Limit <= LimitMax {
-		options = append(options, service.WithPage(request.Limit, request.Offset))
-	} else {
-		options = append(options, service.WithPage(LimitMax, request.Offset))
+// orderExprOption builds the ORDER BY option of the named expression.
+func orderExprOption(c *gin.Context, orderExpr enum.OrderExpr, descending bool) (enum.QueryOption, error) {
+	expr, args, err := orderExpr(c)
+	if err != nil {
+		return nil, err
 	}
+	if descending {
+		expr = "(" + expr + ") DESC"
+	}
+	return service.OrderByExpr(expr, args...), nil
+}
+
+// orderOption builds the ORDER BY option of the order_by param, which is
+// a column optionally followed by "nulls first" or "nulls last".
+func orderOption(orderBy string, descending bool) enum.QueryOption {
+	column, nulls := splitNulls(orderBy)
+	switch nulls {
+	case "first":
+		return service.OrderByNulls(column, descending, true)
+	case "last":
+		return service.OrderByNulls(column, descending, false)
+	}
+	return service.OrderBy(orderBy, descending)
+}
+
+// splitNulls splits the "nulls first|last" suffix of the order_by param:
+//
+//	splitNulls("due_at nulls last")  // => "due_at", "last"
+func splitNulls(orderBy string) (column string, nulls string) {
+	lower := strings.ToLower(orderBy)
+	for _, nulls := range []string{"first", "last"} {
+		if strings.HasSuffix(lower, " nulls "+nulls) {
+			return strings.TrimSpace(orderBy[:len(orderBy)-len(" nulls ")-len(nulls)]), nulls
+		}
+	}
+	return orderBy, ""
+}
+
+// buildQueryOptions builds the QueryOptions from the request params.
+// The model is the one (or the pointer to it) being queried, to which the
+// preload field names are resolved by NameToField.
+func buildQueryOptions(request enum.GetRequestOptions, LimitMax int, omit []string, model any) ([]enum.QueryOption, error) {
+	var options []enum.QueryOption
+	options = append(options, service.WithPage(pageLimit(request.Limit, LimitMax), request.Offset))
 	if omit != nil && len(omit) != 0 {
 		options = append(options, service.Omit(omit))
 	}
 
 	if request.OrderBy != "" {
-		options = append(options, service.OrderBy(request.OrderBy, request.Descending))
+		column, _ := splitNulls(request.OrderBy)
+		if err := checkQueryable(column, model); err != nil {
+			return nil, err
+		}
+		options = append(options, orderOption(request.OrderBy, request.Descending))
 	}
 
-	for FilterBy, FilterValue := range request.Filters {
-		if FilterBy != "" && FilterValue != "" {
-			options = append(options, service.FilterBy(FilterBy, FilterValue))
-		}
+	filters, err := filterOptions(request, model)
+	if err != nil {
+		return nil, err
 	}
+	options = append(options, filters...)
 
-	if len(request.FiltersAt) == 2 {
-		options = append(options, service.FilterAt(request.FiltersAt))
+	preloadOrders, err := parsePreloadOrders(request.PreloadOrder, model)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range splitValues(request.Join) {
+		field, err := joinField(name, model)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, service.Joins(field))
 	}
 
+	withDeleted := map[string]bool{}
+	for _, field := range splitValues(request.PreloadWithDeleted) {
+		field, err := nestedNameToField(field, model)
+		if err != nil {
+			return nil, err
+		}
+		withDeleted[field] = true
+	}
 	for _, field := range request.Preload {
 		// logger.WithField("field", field).Debug("Preload field")
 		if field == "" {
 			continue
 		}
+		field, err := nestedNameToField(field, model)
+		if err != nil {
+			return nil, err
+		}
+		preloadOptions := preloadOrders[field]
+		if withDeleted[field] {
+			preloadOptions = append(preloadOptions, service.Unscoped())
+		}
+		options = append(options, service.Preload(field, preloadOptions...))
+		delete(preloadOrders, field)
+		delete(withDeleted, field)
+	}
+	for field := range preloadOrders { // ordering fields not preloaded
+		return nil, fmt.Errorf("%w: %q is not preloaded", ErrInvalidPreloadOrder, field)
+	}
+	for field := range withDeleted {
+		return nil, fmt.Errorf("%w: %q is not preloaded", ErrPreloadWithDeleted, field)
+	}
+	return options, nil
+}
+
+// joinField resolves the name of a to-one (belongs-to or has-one)
+// association of model to join. To-many associations are rejected: the
+// rows fanned out by the JOIN would break the pagination.
+func joinField(name string, model any) (string, error) {
+	field, err := NameToField(name, model)
+	if err != nil {
+		return "", err
+	}
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return "", err
+	}
+	rel, ok := s.Relationships.Relations[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %q is not an association", ErrInvalidJoin, name)
+	}
+	if rel.Type != schema.BelongsTo && rel.Type != schema.HasOne {
+		return "", fmt.Errorf("%w: %q is a to-many association, use preload instead", ErrInvalidJoin, name)
+	}
+	return field, nil
+}
+
+// mustMapper returns the Mapper option of the handler as a func(*T) any,
+// or nil for none. It panics for the mappers of other types.
+func mustMapper[T any](handler string, mapper any) func(*gin.Context, *T) any {
+	switch m := mapper.(type) {
+	case nil:
+		return nil
+	case func(*T) any:
+		return func(_ *gin.Context, model *T) any { return m(model) }
+	case func(*gin.Context, *T) any:
+		return m
+	}
+	panic(fmt.Sprintf("%s: Mapper: %T is not a func(*%T) any, nor a func(*gin.Context, *%T) any",
+		handler, mapper, *new(T), *new(T)))
+}
+
+// mapModels maps each of the models by the mapper, in order.
+func mapModels[T any](c *gin.Context, models []*T, mapper func(*gin.Context, *T) any) []any {
+	mapped := make([]any, len(models))
+	for i, model := range models {
+		mapped[i] = mapper(c, model)
+	}
+	return mapped
+}
+
+// mustPreloads panics if any of the preloads (of the option) is not a
+// (nested) association of T, at the route setup.
+func mustPreloads[T any](option string, preloads []string) {
+	for _, preload := range preloads {
+		if _, err := nestedNameToField(preload, *new(T)); err != nil {
+			panic(fmt.Sprintf("%s: %v", option, err))
+		}
+	}
+}
+
+// mustConditionalPreloads is mustPreloads of the ConditionalPreloads of the
+// handler, which panics for a rule without When as well.
+func mustConditionalPreloads[T any](handler string, rules []enum.ConditionalPreload) {
+	for i, rule := range rules {
+		if rule.When == nil {
+			panic(fmt.Sprintf("%s: ConditionalPreloads[%d]: When is nil", handler, i))
+		}
+		mustPreloads[T](fmt.Sprintf("%s: ConditionalPreloads[%d]", handler, i), rule.Preloads)
+	}
+}
+
+// conditionalPreloads returns the preloads with the ones of the rules
+// (see ListOption.ConditionalPreloads) of the request added, if missing.
+func conditionalPreloads(c *gin.Context, preloads []string, rules []enum.ConditionalPreload) []string {
+	for _, rule := range rules {
+		if rule.When(c) {
+			preloads = appendPreloads(preloads, rule.Preloads)
+		}
+	}
+	return preloads
+}
+
+// appendPreloads appends the preloads not in preloads yet, without
+// modifying the backing array of preloads (e.g. of the DefaultPreloads).
+func appendPreloads(preloads []string, more []string) []string {
+	for _, preload := range more {
+		if !Contains(preloads, preload) {
+			preloads = append(preloads[:len(preloads):len(preloads)], preload)
+		}
+	}
+	return preloads
+}
+
+// mustSearchFields returns the SearchFields (see ListOption.SearchFields)
+// with their columns resolved into the column names of T. It panics on an
+// unknown column or match, at the route setup.
+func mustSearchFields[T any](fields []enum.SearchField) []enum.SearchField {
+	resolved := make([]enum.SearchField, 0, len(fields))
+	for _, field := range fields {
+		f, err := orm.LookUpField(new(T), field.Column)
+		if err != nil {
+			panic(fmt.Sprintf("GetListHandler: SearchFields: %v", err))
+		}
+		if field.Match < enum.SearchContains || field.Match > enum.SearchExact {
+			panic(fmt.Sprintf("GetListHandler: SearchFields: unknown match %d of %q", field.Match, field.Column))
+		}
+		field.Column = f.DBName
+		resolved = append(resolved, field)
+	}
+	return resolved
+}
+
+// checkPreloads checks the number (if maxPreloads > 0) and the depth
+// (if maxDepth > 0) of the preload params.
+func checkPreloads(preloads []string, maxPreloads int, maxDepth int) error {
+	var count int
+	for _, preload := range preloads {
+		if preload == "" {
+			continue
+		}
+		count++
+		if depth := strings.Count(preload, ".") + 1; maxDepth > 0 && depth > maxDepth {
+			return fmt.Errorf("%w: %q is of depth %d > %d", ErrPreloadTooDeep, preload, depth, maxDepth)
+		}
+	}
+	if maxPreloads > 0 && count > maxPreloads {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyPreloads, count, maxPreloads)
+	}
+	return nil
+}
+
+// parsePreloadOrders parses the preload_order params:
+//
+//	preload_order=Orders:created_at desc,Orders:id&preload_order=Tags:name
+//
+// into the OrderBy options of the preload fields (resolved by
+// nestedNameToField). The columns are checked against the associated models.
+func parsePreloadOrders(preloadOrders []string, model any) (map[string][]enum.QueryOption, error) {
+	orders := map[string][]enum.QueryOption{}
+	for _, preloadOrder := range splitValues(preloadOrders) {
+		name, order, ok := strings.Cut(preloadOrder, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, expecting field:column [asc|desc]", ErrInvalidPreloadOrder, preloadOrder)
+		}
+		field, err := nestedNameToField(name, model)
+		if err != nil {
+			return nil, err
+		}
+
+		column, direction, _ := strings.Cut(strings.TrimSpace(order), " ")
+		var descending bool
+		switch strings.ToLower(strings.TrimSpace(direction)) {
+		case "", "asc":
+		case "desc":
+			descending = true
+		default:
+			return nil, fmt.Errorf("%w: unknown direction %q", ErrInvalidPreloadOrder, direction)
+		}
 
-		options = append(options, service.Preload(field))
+		associated := reflect.New(nestedFieldType(reflect.TypeOf(model), field)).Interface()
+		f, err := orm.LookUpField(associated, column)
+		if err != nil {
+			return nil, err
+		}
+		orders[field] = append(orders[field], service.OrderBy(f.DBName, descending))
 	}
-	return options
+	return orders, nil
 }
 
 // getModelByID gets idParam from url and get model from database
@@ -236,15 +1207,27 @@ func getModelByID[T orm.Model](c *gin.Context, idParam string, options ...enum.Q
 	return &model, err
 }
 
-func getCount[T any](ctx context.Context, filters map[string]string, filterAt []string, option enum.QueryOption) (total int64, err error) {
-	var options []enum.QueryOption
-	for filterBy, filterValue := range filters {
-		if filterBy != "" && filterValue != "" {
-			options = append(options, service.FilterBy(filterBy, filterValue))
-		}
+// getModelByColumn gets the param from url and gets the model whose
+// (unique) column equals it from database.
+func getModelByColumn[T any](c *gin.Context, param string, column string, options ...enum.QueryOption) (*T, error) {
+	var model T
+
+	value := c.Param(param)
+	if value == "" {
+		logger.WithContext(c).WithField("param", param).
+			Warn("getModelByColumn: param is empty")
+		return &model, ErrMissingID
 	}
-	if len(filterAt) == 2 {
-		options = append(options, service.FilterAt(filterAt))
+
+	options = append(options, service.FilterBy(column, value))
+	err := service.Get[T](c, &model, options...)
+	return &model, err
+}
+
+func getCount[T any](ctx context.Context, request enum.GetRequestOptions, option enum.QueryOption) (total int64, err error) {
+	options, err := filterOptions(request, *new(T))
+	if err != nil {
+		return 0, err
 	}
 	if option != nil {
 		options = append(options, option)
@@ -253,17 +1236,71 @@ func getCount[T any](ctx context.Context, filters map[string]string, filterAt []
 	return total, err
 }
 
-func getAssociationCount(ctx context.Context, model any, field string, filters map[string]string, filterAt []string, option enum.QueryOption) (total int64, err error) {
-	var options []enum.QueryOption
+// getDistinctCount is getCount of the distinct values of the column, by
+// service.CountDistinct.
+func getDistinctCount[T any](ctx context.Context, column string, request enum.GetRequestOptions, option enum.QueryOption) (count int64, err error) {
+	options, err := filterOptions(request, *new(T))
+	if err != nil {
+		return 0, err
+	}
+	if option != nil {
+		options = append(options, option)
+	}
+	return service.CountDistinct[T](ctx, column, options...)
+}
 
-	for filterBy, filterValue := range filters {
-		if filterBy != "" && filterValue != "" {
-			options = append(options, service.FilterBy(filterBy, filterValue))
-		}
+// checkDistinctColumn checks the distinct param is a queryable column of
+// the model.
+func checkDistinctColumn(column string, model any) error {
+	if _, err := orm.LookUpField(model, column); err != nil {
+		return err
 	}
+	return checkQueryable(column, model)
+}
 
-	if len(filterAt) == 2 {
-		options = append(options, service.FilterAt(filterAt))
+// getEstimatedCount is getCount by service.EstimateCount.
+func getEstimatedCount[T any](ctx context.Context, request enum.GetRequestOptions, option enum.QueryOption) (total int64, exact bool, err error) {
+	options, err := filterOptions(request, *new(T))
+	if err != nil {
+		return 0, false, err
+	}
+	if option != nil {
+		options = append(options, option)
+	}
+	return service.EstimateCount[T](ctx, options...)
+}
+
+// getLastModified returns the latest update time of the models T filtered
+// by the request (without pagination).
+func getLastModified[T any](ctx context.Context, request enum.GetRequestOptions, option enum.QueryOption) (time.Time, error) {
+	options, err := filterOptions(request, *new(T))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if option != nil {
+		options = append(options, option)
+	}
+	return service.LastModified[T](ctx, options...)
+}
+
+// notModified sets the Last-Modified header (if lastModified is not zero),
+// and reports whether the If-Modified-Since of the request is not before it.
+// HTTP dates are in seconds, so is the comparison.
+func notModified(c *gin.Context, lastModified time.Time) bool {
+	if lastModified.IsZero() {
+		return false
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
+
+func getAssociationCount(ctx context.Context, model any, field string, request enum.GetRequestOptions, fieldModel any, option enum.QueryOption) (total int64, err error) {
+	options, err := filterOptions(request, fieldModel)
+	if err != nil {
+		return 0, err
 	}
 	if option != nil {
 		options = append(options, option)
@@ -271,3 +1308,12 @@ func getAssociationCount(ctx context.Context, model any, field string, filters m
 	count, err := service.CountAssociations(ctx, model, field, options...)
 	return count, err
 }
+
+// pageLimit returns the effective limit of the requested one:
+// LimitMax if not requested or exceeding it.
+func pageLimit(limit int, LimitMax int) int {
+	if limit > 0 && limit <= LimitMax {
+		return limit
+	}
+	return LimitMax
+}
@@ -0,0 +1,615 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"github.com/tqrj/cd/service/servicetest"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	orm.BasicModel
+	Name string `json:"name"`
+}
+
+func TestGetListHandler_Pagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 7; i++ {
+		if err := orm.DB.Create(&item{Name: fmt.Sprint(i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{Enable: true, LimitMax: 3}))
+
+	tests := []struct {
+		name     string
+		style    PaginationStyle
+		query    string
+		wantCode int
+		wantIDs  []uint
+	}{
+		{"offset", PaginationParams, "limit=2&offset=3", http.StatusOK, []uint{4, 5}},
+		{"offset limited", PaginationParams, "limit=10&offset=5", http.StatusOK, []uint{6, 7}},
+		{"offset renamed", PaginationStyle{Limit: "size", Offset: "skip"}, "size=2&skip=1&limit=5", http.StatusOK, []uint{2, 3}},
+		{"page", PaginationStyle{Limit: "per_page", Page: "page"}, "page=2&per_page=2", http.StatusOK, []uint{3, 4}},
+		{"page default size", PaginationStyle{Limit: "per_page", Page: "page"}, "page=3", http.StatusOK, []uint{7}},
+		{"page size limited", PaginationStyle{Limit: "per_page", Page: "page"}, "page=2&per_page=100", http.StatusOK, []uint{4, 5, 6}},
+		{"first page", PaginationStyle{Limit: "per_page", Page: "page"}, "per_page=2&offset=4", http.StatusOK, []uint{1, 2}},
+		{"invalid page", PaginationStyle{Limit: "per_page", Page: "page"}, "page=0", http.StatusBadRequest, nil},
+		{"invalid per_page", PaginationStyle{Limit: "per_page", Page: "page"}, "page=1&per_page=x", http.StatusBadRequest, nil},
+	}
+	defer func(style PaginationStyle) { PaginationParams = style }(PaginationParams)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PaginationParams = tt.style
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?"+tt.query, nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Items []item `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var ids []uint
+			for _, item := range resp.Items {
+				ids = append(ids, item.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_RejectOffsetBeyondTotal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{})
+	for i := 1; i <= 3; i++ {
+		if err := db.Create(&item{Name: fmt.Sprint(i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{LimitMax: 10, RejectOffsetBeyondTotal: true}))
+
+	if w := serve(r, http.MethodGet, "/items?offset=2", ""); w.Code != http.StatusOK {
+		t.Errorf("offset within the total: code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, http.MethodGet, "/items?offset=3", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("offset beyond the total: code = %d, want 400: %s", w.Code, w.Body.String())
+	}
+
+	// the counts fail: the offset can not be checked
+	err := db.Callback().Query().Before("gorm:query").Register("test:fail_count", func(db *gorm.DB) {
+		if _, ok := db.Statement.Dest.(*int64); ok {
+			db.AddError(errors.New("count failed"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(r, http.MethodGet, "/items?offset=3", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("count failed: code = %d, want 422: %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, http.MethodGet, "/items?total=true", ""); w.Code != http.StatusOK {
+		t.Errorf("count failed without offset: code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetListHandler_WarnLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{})
+	for i := 0; i < 3; i++ {
+		if err := db.Create(&item{Name: fmt.Sprintf("item %d", i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/bytes", GetListHandler[item](&enum.ListOption{LimitMax: 10, WarnBytes: 300}))
+	r.GET("/rows", GetListHandler[item](&enum.ListOption{LimitMax: 10, WarnRows: 2, WarnBytes: 300}))
+
+	w := serve(r, http.MethodGet, "/bytes?limit=1", "")
+	if got := w.Header().Get("Warning"); got != "" || w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("small: code = %d, Warning = %q, body = %s", w.Code, got, w.Body.String())
+	}
+
+	w = serve(r, http.MethodGet, "/bytes", "")
+	want := fmt.Sprintf(`199 - "large response (%d bytes), please paginate with limit and offset"`, w.Body.Len())
+	if got := w.Header().Get("Warning"); got != want {
+		t.Errorf("large: Warning = %q, want %q (the bytes written)", got, want)
+	}
+	var resp struct {
+		Items []item `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Items) != 3 {
+		t.Errorf("large: body = %s, want the 3 items", w.Body.String())
+	}
+
+	w = serve(r, http.MethodGet, "/rows", "")
+	if got, want := w.Header().Get("Warning"), `199 - "large response (3 rows), please paginate with limit and offset"`; got != want {
+		t.Errorf("rows: Warning = %q, want %q", got, want)
+	}
+}
+
+func TestGetListHandler_TypedFiltersOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &lead{})
+	leads := []*lead{{Status: "open", Region: "eu"}, {Status: "won", Region: "eu"}, {Status: "open", Region: "us"}}
+	if err := db.Create(leads).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/leads", GetListHandler[lead](&enum.ListOption{
+		LimitMax:         10,
+		Filter:           leadFilter{},
+		TypedFiltersOnly: true,
+		OrderColumns:     []string{"region"},
+		DistinctColumns:  []string{"created_at"},
+	}))
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     string
+	}{
+		{"typed filter", "status=open", http.StatusOK, `"region":"us"`},
+		{"generic filter", "filters[status]=open", http.StatusBadRequest, ""},
+		{"order column", "order_by=region", http.StatusOK, ""},
+		{"order by any column", "order_by=status", http.StatusBadRequest, ""},
+		{"distinct of a typed column", "distinct=region", http.StatusOK, `"distinct":{"region":2}`},
+		{"distinct of a typed field", "distinct=Status", http.StatusOK, `"distinct":{"Status":2}`},
+		{"distinct of a whitelisted column", "distinct=created_at&status=won", http.StatusOK, `"distinct":{"created_at":1}`},
+		{"distinct of any column", "distinct=updated_at", http.StatusBadRequest, ""},
+		{"distinct of some other column", "distinct=region,deleted_at", http.StatusBadRequest, ""},
+		{"distinct of an unknown column", "distinct=secret", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/leads?"+tt.query, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.want)
+			}
+			if tt.wantCode == http.StatusBadRequest && !strings.Contains(w.Body.String(), ErrGenericFilterDisabled.Error()) {
+				t.Errorf("body = %s, want %q", w.Body.String(), ErrGenericFilterDisabled)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_IDsOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{})
+	for _, name := range []string{"e", "c", "a", "d", "b"} {
+		if err := db.Create(&item{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		name, query string
+		want        []uint
+	}{
+		{"all", "", []uint{1, 2, 3, 4, 5}},
+		{"filtered", "filters[name]=c,d&filter_ops[name]=in", []uint{2, 4}},
+		{"ordered", "order_by=name", []uint{3, 5, 2, 4, 1}},
+		{"ordered desc", "order_by=name&desc=true", []uint{1, 4, 2, 5, 3}},
+		{"paginated", "order_by=name&limit=2&offset=1", []uint{5, 2}},
+		{"by the ids order", "ids=4,1,2", []uint{4, 1, 2}},
+		{"by the ids filtered", "ids=4,1,2&filters[name]=e", []uint{1}},
+		{"none", "filters[name]=x", []uint{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/items?ids_only=true&"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				IDs   []uint          `json:"ids"`
+				Items json.RawMessage `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.IDs == nil || fmt.Sprint(body.IDs) != fmt.Sprint(tt.want) {
+				t.Errorf("ids = %v, want %v: %s", body.IDs, tt.want, w.Body.String())
+			}
+			if body.Items != nil {
+				t.Errorf("items responded: %s", body.Items)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_BatchLoads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &customer{}, &purchase{})
+	for i, purchases := range []int{2, 0, 1} {
+		c := customer{Name: fmt.Sprint("c", i)}
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < purchases; j++ {
+			if err := db.Create(&purchase{CustomerID: c.ID}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var loads int
+	mapper := func(c *gin.Context, cu *customer) any {
+		loader := service.RequestLoader(c, "purchases", func(ctx context.Context, ids []any) (map[string]int64, error) {
+			loads++
+			return service.CountAssociationsIn[customer](ctx, "Purchases", ids)
+		})
+		purchases, err := loader.Load(c, cu.ID)
+		if err != nil {
+			t.Error(err)
+		}
+		return gin.H{"name": cu.Name, "purchases": purchases}
+	}
+	r := gin.New()
+	r.GET("/batched", GetListHandler[customer](&enum.ListOption{LimitMax: 10, Mapper: mapper, BatchLoads: true}))
+	r.GET("/unbatched", GetListHandler[customer](&enum.ListOption{LimitMax: 10, Mapper: mapper}))
+
+	tests := []struct {
+		url       string
+		wantLoads int
+	}{
+		{"/batched", 1},
+		{"/unbatched", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			loads = 0
+			w := serve(r, http.MethodGet, tt.url+"?order_by=id", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d: %s", w.Code, w.Body.String())
+			}
+			if loads != tt.wantLoads {
+				t.Errorf("loads = %d, want %d", loads, tt.wantLoads)
+			}
+			var body struct {
+				Customers []struct {
+					Name      string `json:"name"`
+					Purchases int64  `json:"purchases"`
+				} `json:"customers"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			want := []int64{2, 0, 1}
+			if len(body.Customers) != len(want) {
+				t.Fatalf("customers = %+v", body.Customers)
+			}
+			for i, c := range body.Customers {
+				if c.Purchases != want[i] {
+					t.Errorf("%s: purchases = %d, want %d", c.Name, c.Purchases, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetListHandler_Explain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{})
+	if err := db.Create(&item{Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{LimitMax: 10, MaxOffset: 5, AllowExplain: true}))
+	r.GET("/unexplained", GetListHandler[item](&enum.ListOption{LimitMax: 10}))
+
+	w := serve(r, http.MethodGet, "/items?explain=true&filter_by=name&filter_value=a", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Explain []map[string]any `json:"explain"`
+		SQL     string           `json:"sql"`
+		Items   []item           `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Explain) == 0 {
+		t.Errorf("explain = %v, want the rows of the query plan", body.Explain)
+	}
+	for _, row := range body.Explain {
+		if _, ok := row["detail"]; !ok { // of EXPLAIN QUERY PLAN
+			t.Errorf("explain row = %v, want a detail", row)
+		}
+	}
+	if !strings.HasPrefix(body.SQL, "SELECT * FROM `items` WHERE") || !strings.Contains(body.SQL, `"a"`) {
+		t.Errorf("sql = %s, want the list query with its vars", body.SQL)
+	}
+	if body.Items != nil {
+		t.Errorf("items = %v, want the query not run", body.Items)
+	}
+
+	for _, url := range []string{"/items?explain=true&offset=6", "/unexplained?explain=true"} {
+		if w := serve(r, http.MethodGet, url, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: code = %d, want 400: %s", url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSplitNulls(t *testing.T) {
+	tests := []struct {
+		orderBy    string
+		wantColumn string
+		wantNulls  string
+	}{
+		{"note", "note", ""},
+		{"note nulls first", "note", "first"},
+		{"note NULLS LAST", "note", "last"},
+		{"note  nulls last", "note", "last"},
+		{"nulls", "nulls", ""},
+		{"note nulls", "note nulls", ""},
+	}
+	for _, tt := range tests {
+		column, nulls := splitNulls(tt.orderBy)
+		if column != tt.wantColumn || nulls != tt.wantNulls {
+			t.Errorf("splitNulls(%q) = %q, %q, want %q, %q", tt.orderBy, column, nulls, tt.wantColumn, tt.wantNulls)
+		}
+	}
+}
+
+func TestGetListHandler_OrderByNulls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &task{})
+	for _, title := range []string{"b", "none", "a"} {
+		tk := &task{Title: title}
+		if title != "none" {
+			tk.Note = &title
+		}
+		if err := db.Create(tk).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/tasks", GetListHandler[task](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/tasks?order_by=note+nulls+first", "[none a b]"},
+		{"/tasks?order_by=note+nulls+last", "[a b none]"},
+		{"/tasks?order_by=note+nulls+first&desc=true", "[none b a]"},
+		{"/tasks?order_by=note+nulls+last&desc=true", "[b a none]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				Tasks []task `json:"tasks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, tk := range body.Tasks {
+				titles = append(titles, tk.Title)
+			}
+			if got := fmt.Sprint(titles); got != tt.want {
+				t.Errorf("titles = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type spot struct {
+	orm.BasicModel
+	Name string `json:"name"`
+	X    int    `json:"x"`
+}
+
+func TestGetListHandler_OrderExprs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &spot{})
+	for i, name := range []string{"a", "b", "c", "d"} {
+		if err := db.Create(&spot{Name: name, X: i * 10}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	nearest := func(c *gin.Context) (string, []any, error) {
+		x, err := strconv.Atoi(c.Query("x"))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid x: %w", err)
+		}
+		return "abs(x - ?)", []any{x}, nil
+	}
+	orderExprs := map[string]enum.OrderExpr{"nearest": nearest}
+	r := gin.New()
+	r.GET("/spots", GetListHandler[spot](&enum.ListOption{LimitMax: 10, OrderExprs: orderExprs}))
+	r.GET("/typed", GetListHandler[spot](&enum.ListOption{LimitMax: 10, OrderExprs: orderExprs, TypedFiltersOnly: true}))
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     []string
+	}{
+		{"/spots?order_by=nearest&x=21", http.StatusOK, []string{"c", "d", "b", "a"}},
+		{"/spots?order_by=nearest&x=21&desc=true", http.StatusOK, []string{"a", "b", "d", "c"}},
+		{"/typed?order_by=nearest&x=2", http.StatusOK, []string{"a", "b", "c", "d"}},
+		{"/spots?order_by=nearest&x=abc", http.StatusBadRequest, nil},
+		{"/typed?order_by=farthest&x=2", http.StatusBadRequest, nil},
+		{"/spots?order_by=farthest&x=2", http.StatusUnprocessableEntity, nil}, // not a column either
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			code, names := listed(t, r, tt.url, "spots")
+			if code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", code, tt.wantCode)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListHandler_TotalEstimate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &item{})
+	for _, name := range []string{"a", "b", "b", "c", "c"} {
+		if err := db.Create(&item{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{LimitMax: 10}))
+	defer func(limit int64) { service.EstimateCountLimit = limit }(service.EstimateCountLimit)
+	service.EstimateCountLimit = 3
+
+	tests := []struct {
+		url      string
+		wantCode int
+		wantMeta string
+	}{
+		{"/items?total=estimate", http.StatusOK, `{"total":4,"total_kind":"estimate"}`}, // beyond the limit: a lower bound on sqlite
+		{"/items?total=estimate&filter_by=name&filter_value=c", http.StatusOK, `{"total":2,"total_kind":"exact"}`},
+		{"/items?total=exact", http.StatusOK, `{"total":5,"total_kind":"exact"}`},
+		{"/items?total=true&filter_by=name&filter_value=b", http.StatusOK, `{"total":2,"total_kind":"exact"}`},
+		{"/items?total=false", http.StatusOK, `{}`},
+		{"/items?total=maybe", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Meta struct {
+					Total     *int64 `json:"total,omitempty"`
+					TotalKind string `json:"total_kind,omitempty"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if meta, _ := json.Marshal(body.Meta); string(meta) != tt.wantMeta {
+				t.Errorf("meta = %s, want %s", meta, tt.wantMeta)
+			}
+		})
+	}
+}
+
+type player struct {
+	orm.BasicModel
+	Name  string  `json:"name"`
+	Teams []*team `json:"teams" gorm:"many2many:player_teams"`
+}
+
+type team struct {
+	orm.BasicModel
+	Name string `json:"name"`
+}
+
+type playerTeam struct {
+	PlayerID uint   `json:"player_id" gorm:"primaryKey"`
+	TeamID   uint   `json:"team_id" gorm:"primaryKey"`
+	Role     string `json:"role"`
+}
+
+func TestGetFieldHandler_JoinTable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t)
+	if err := db.SetupJoinTable(&player{}, "Teams", &playerTeam{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&player{}, &team{}); err != nil {
+		t.Fatal(err)
+	}
+	core, docs := &team{Name: "core"}, &team{Name: "docs"}
+	p := &player{Name: "p", Teams: []*team{core, docs}}
+	if err := db.Create(p).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&playerTeam{}).Where("team_id = ?", core.ID).Update("role", "admin").Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/players/:id/teams", GetFieldHandler[player]("id", "Teams", &enum.GetOption{FieldLimitMax: 10, JoinTable: "membership"}))
+
+	w := serve(r, http.MethodGet, fmt.Sprintf("/players/%d/teams?order_by=name", p.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Teams []struct {
+			Name       string      `json:"name"`
+			Membership *playerTeam `json:"membership"`
+		} `json:"teams"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Teams) != 2 {
+		t.Fatalf("teams = %+v, want core and docs", body.Teams)
+	}
+	for _, tt := range []struct {
+		name string
+		id   uint
+		role string
+	}{{"core", core.ID, "admin"}, {"docs", docs.ID, ""}} {
+		var got *playerTeam
+		for _, tm := range body.Teams {
+			if tm.Name == tt.name {
+				got = tm.Membership
+			}
+		}
+		want := playerTeam{PlayerID: p.ID, TeamID: tt.id, Role: tt.role}
+		if got == nil || *got != want {
+			t.Errorf("%s membership = %+v, want %+v", tt.name, got, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("JoinTable of a generated join table: want a panic")
+		}
+	}()
+	GetFieldHandler[crew]("id", "Skills", &enum.GetOption{JoinTable: "membership"})
+}
@@ -1,40 +1,304 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
+	"github.com/tqrj/cd/service"
+	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// nameToField converts name to the right field name in the structure.
+// NameNormalizer is the case conversion applied to both the name and the
+// candidates (field names, json and gorm column tags) in NameToField before
+// comparing them. By default, it lowercases the name and removes
+// " ", "-", "_", "/", so that "order_items", "order-items", "OrderItems"
+// all matches the OrderItems field.
+var NameNormalizer = func(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer(" ", "", "-", "", "_", "", "/", "").Replace(name)
+}
+
+// NameToField converts an API-friendly name (in url paths, preload params,
+// ...) to the right field name in the structure.
 // For example:
-//    type User struct {
-//        ID int
-//        Name string
-//    }
-//    fieldId   := NameToFieldOf[User]("id")   // fieldId   == "ID"
-//    fieldName := NameToFieldOf[User]("name") // fieldName == "Name"
-func nameToField(name string, structure any) string {
+//
+//	type User struct {
+//	    ID         int
+//	    Name       string
+//	    OrderItems []Item `json:"order_items"`
+//	}
+//	NameToField("id", User{})          // "ID"
+//	NameToField("name", User{})        // "Name"
+//	NameToField("order_items", User{}) // "OrderItems"
+//
+// The name matches a field (fields of embedded structs included) if it
+// equals to the field name, the json tag name or the gorm column tag, or
+// equals to one of them after NameNormalizer.
+//
+// An error wrapping ErrUnknownField is returned if no field matches.
+func NameToField(name string, structure any) (string, error) {
 	reflectType := reflect.TypeOf(structure)
-
-	if reflectType.Kind() == reflect.Ptr {
+	for reflectType != nil && (reflectType.Kind() == reflect.Ptr || reflectType.Kind() == reflect.Slice) {
 		reflectType = reflectType.Elem()
 	}
-	if reflectType.Kind() != reflect.Struct {
-		return name
+	if reflectType == nil || reflectType.Kind() != reflect.Struct {
+		return "", fmt.Errorf("%w: %q (not a struct)", ErrUnknownField, name)
 	}
 
-	name = strings.ToLower(name)
-	name = strings.Replace(name, " ", "", -1)
-	name = strings.Replace(name, "-", "", -1)
-	name = strings.Replace(name, "_", "", -1)
-	name = strings.Replace(name, "/", "", -1)
+	fields := reflect.VisibleFields(reflectType)
+	normalized := NameNormalizer(name)
+	for _, exact := range []bool{true, false} {
+		for _, field := range fields {
+			if field.Anonymous || !field.IsExported() {
+				continue
+			}
+			for _, candidate := range fieldNames(field) {
+				if exact && candidate == name ||
+					!exact && NameNormalizer(candidate) == normalized {
+					return field.Name, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %q of %s", ErrUnknownField, name, reflectType.Name())
+}
 
-	for i := 0; i < reflectType.NumField(); i++ {
-		fieldName := strings.ToLower(reflectType.Field(i).Name)
-		if name == fieldName {
-			return reflectType.Field(i).Name
+// fieldNames returns the names a struct field can be referred by:
+// the field name, the json tag name and the gorm column tag.
+func fieldNames(field reflect.StructField) []string {
+	names := []string{field.Name}
+	if json, _, _ := strings.Cut(field.Tag.Get("json"), ","); json != "" && json != "-" {
+		names = append(names, json)
+	}
+	for _, setting := range strings.Split(field.Tag.Get("gorm"), ";") {
+		key, value, _ := strings.Cut(setting, ":")
+		if strings.EqualFold(strings.TrimSpace(key), "column") && value != "" {
+			names = append(names, strings.TrimSpace(value))
 		}
 	}
+	return names
+}
+
+// nestedNameToField is NameToField for dot separated nested names (like
+// "order_items.product" => "OrderItems.Product"), resolving each part in
+// the type of the previous field.
+func nestedNameToField(name string, structure any) (string, error) {
+	reflectType := reflect.TypeOf(structure)
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		field, err := NameToField(part, reflect.Zero(reflectType).Interface())
+		if err != nil {
+			return "", err
+		}
+		parts[i] = field
+		reflectType = fieldType(reflectType, field)
+	}
+	return strings.Join(parts, "."), nil
+}
 
-	return name
+// nestedFieldType is fieldType for the nested field (like "Orders.Product")
+// resolved by nestedNameToField.
+func nestedFieldType(t reflect.Type, field string) reflect.Type {
+	for _, part := range strings.Split(field, ".") {
+		t = fieldType(t, part)
+	}
+	return t
+}
+
+// fieldType returns the type of the named field in structure type t, with
+// pointers and slices dereferenced: User.Orders []*Order => Order.
+func fieldType(t reflect.Type, field string) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	f, _ := t.FieldByName(field)
+	t = f.Type
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// mustNameToField is NameToField for route configurations, which panics if
+// the field is not found.
+func mustNameToField(name string, structure any) string {
+	field, err := NameToField(name, structure)
+	if err != nil {
+		panic(err)
+	}
+	return field
+}
+
+// mustAssociation is mustNameToField for the association fields of the
+// nested routes, which panics if the field is not a (valid) association,
+// see service.LookUpAssociation.
+func mustAssociation(name string, structure any) string {
+	field := mustNameToField(name, structure)
+	if _, err := service.LookUpAssociation(structure, field); err != nil {
+		panic(err)
+	}
+	return field
+}
+
+// preferReturnMinimal reports whether the client asks for an empty response
+// body with the RFC 7240 header:
+//
+//	Prefer: return=minimal
+//
+// Any other (or no) return preference means return=representation.
+func preferReturnMinimal(c *gin.Context) bool {
+	for _, header := range c.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			preference = strings.ReplaceAll(preference, " ", "")
+			if strings.EqualFold(preference, "return=minimal") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// responseMinimal responds 204 No Content for a Prefer: return=minimal
+// request, with a Location header if location is not empty.
+func responseMinimal(c *gin.Context, location string) {
+	c.Header("Preference-Applied", "return=minimal")
+	if location != "" {
+		c.Header("Location", location)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// identityOf returns the primary key value of model if it (or the pointer
+// to it) implements orm.Model.
+func identityOf(model any) (value any, ok bool) {
+	if m, ok := model.(orm.Model); ok {
+		_, value = m.Identity()
+		return value, true
+	}
+	return nil, false
+}
+
+// splitValues splits comma separated request param values:
+//
+//	?with_counts=Orders,Comments&with_counts=Tags
+//	// => []string{"Orders", "Comments", "Tags"}
+func splitValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// timeLayouts are the accepted layouts of time request params.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTimeParam parses a time request param in one of timeLayouts.
+// The value is returned as is if it's not in these layouts, to let the
+// database deal with it. Values without zones are in TimeLocation (UTC
+// if not set).
+func parseTimeParam(value string) any {
+	loc := TimeLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t
+		}
+	}
+	return value
+}
+
+// bindJSON binds the JSON body into obj, like c.ShouldBindJSON. If strict,
+// the body is decoded with DisallowUnknownFields, failing with an
+// ErrUnknownFields listing all the unknown (top-level) fields in the body.
+func bindJSON(c *gin.Context, obj any, strict bool) error {
+	if !strict {
+		return c.ShouldBindJSON(obj)
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		if !strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return err
+		}
+		unknown := unknownFields(body, reflect.TypeOf(obj).Elem())
+		if len(unknown) == 0 { // unknown fields in the nested objects
+			unknown = []string{strings.TrimPrefix(err.Error(), "json: unknown field ")}
+		}
+		return fmt.Errorf("%w: %s", ErrUnknownFields, strings.Join(unknown, ", "))
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// unknownFields returns the (quoted) keys of the JSON object body that are
+// unknown to the type t, matched the same way as encoding/json does.
+func unknownFields(body []byte, t reflect.Type) []string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil
+	}
+	var unknown []string
+	for key := range object {
+		probe, _ := json.Marshal(map[string]any{key: nil})
+		decoder := json.NewDecoder(bytes.NewReader(probe))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(reflect.New(t).Interface()); err != nil {
+			unknown = append(unknown, strconv.Quote(key))
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// ReportIDs is the report param of the batch operations by conditions
+// (replace, restore and archive) responding the primary keys of the models
+// written along with their count, at the cost of a query resolving them
+// (see service.AffectedIDs):
+//
+//	POST /users/restore?filters[team_id]=3&report=ids
+//	// => { meta: { rows_affected: 2, affected_ids: [5, 8] } }
+const ReportIDs = "ids"
+
+// reportAffected stashes a service.AffectedIDs into the request if its
+// report param asks for it (else nil).
+func reportAffected(c *gin.Context, request enum.GetRequestOptions) (*service.AffectedIDs, error) {
+	switch request.Report {
+	case "":
+		return nil, nil
+	case ReportIDs:
+		affected := new(service.AffectedIDs)
+		reqctx.Set(c, service.KeyAffectedIDs, affected)
+		return affected, nil
+	}
+	return nil, fmt.Errorf("%w: %q, expected %q", ErrInvalidReport, request.Report, ReportIDs)
+}
+
+// affectedMeta returns the meta of a batch operation: the rows affected,
+// and the affected ids if reported.
+func affectedMeta(rowsAffected int64, affected *service.AffectedIDs) *Meta {
+	meta := new(Meta).SetRowsAffected(rowsAffected)
+	if affected != nil {
+		meta.SetAffectedIDs(affected.IDs())
+	}
+	return meta
 }
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+)
+
+// Messages is the catalog of the localized error messages, by which
+// ResponseError translates the msg (or the detail of the problem details)
+// of the error responses into the languages preferred by the
+// Accept-Language of the request:
+//
+//	controller.Messages = controller.MapCatalog{
+//	    "de": {
+//	        "missing id":           "ID fehlt",
+//	        "column not queryable": "Spalte nicht abfragbar",
+//	        "validation.required":  "{field} ist erforderlich",
+//	    },
+//	}
+//	// GET /articles?filters[body]=x with Accept-Language: de-CH, en;q=0.5
+//	// => 400 { msg: "Spalte nicht abfragbar: ..." }, Content-Language: de
+//
+// The keys are the internal codes of the errors: the message of the error
+// wrapped (e.g. "missing id" of ErrMissingID), whose translation replaces
+// it in the msg, the rest of which (the details) is left as it is. The
+// field errors of the binding (the `binding` tags) are keyed by
+// "validation.<tag>", with the placeholders {field} and {param}, and the
+// messages of orm.ValidationError by the messages themselves.
+//
+// nil (default) leaves the messages in English, as are the ones missing
+// in the catalog.
+var Messages MessageCatalog
+
+// MessageCatalog is a pluggable catalog of messages, see Messages.
+type MessageCatalog interface {
+	// Message returns the message of the key in the locale (a language
+	// tag of the Accept-Language, e.g. "pt-BR" or "pt"), if translated.
+	Message(locale string, key string) (string, bool)
+}
+
+// MapCatalog is a MessageCatalog of the messages by key by locale.
+// The locales match case-insensitively.
+type MapCatalog map[string]map[string]string
+
+func (m MapCatalog) Message(locale string, key string) (string, bool) {
+	if messages, ok := m[locale]; ok {
+		msg, ok := messages[key]
+		return msg, ok
+	}
+	for l, messages := range m {
+		if strings.EqualFold(l, locale) {
+			msg, ok := messages[key]
+			return msg, ok
+		}
+	}
+	return "", false
+}
+
+// translator looks up the Messages in the locales preferred by a request,
+// in order.
+type translator []string
+
+func newTranslator(c *gin.Context) translator {
+	if Messages == nil || c.Request == nil {
+		return nil
+	}
+	return acceptLanguages(c.GetHeader("Accept-Language"))
+}
+
+// message returns the message of the key in the first locale having it.
+func (t translator) message(key string) (msg string, locale string, ok bool) {
+	for _, locale := range t {
+		if msg, ok := Messages.Message(locale, key); ok {
+			return msg, locale, true
+		}
+	}
+	return "", "", false
+}
+
+// errorMessage returns the localized message of err and its locale, if
+// translated.
+func (t translator) errorMessage(err error) (msg string, locale string, ok bool) {
+	if len(t) == 0 {
+		return "", "", false
+	}
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		messages := make([]string, len(fieldErrors))
+		for i, fieldError := range fieldErrors {
+			if m, l, translated := t.fieldMessage(fieldError); translated {
+				messages[i], locale, ok = m, l, true
+			} else {
+				messages[i] = fieldError.Error()
+			}
+		}
+		return strings.Join(messages, "\n"), locale, ok
+	}
+	var validation *orm.ValidationError
+	if errors.As(err, &validation) {
+		prefix, l, prefixed := t.message(orm.ErrValidation.Error())
+		if !prefixed {
+			prefix = orm.ErrValidation.Error()
+		}
+		message, ml, translated := t.message(validation.Message)
+		if translated {
+			l = ml
+		} else {
+			message = validation.Message
+		}
+		if !prefixed && !translated {
+			return "", "", false
+		}
+		if validation.Field != "" {
+			prefix += ": " + validation.Field
+		}
+		return prefix + ": " + message, l, true
+	}
+
+	key := rootError(err).Error()
+	translated, locale, ok := t.message(key)
+	if !ok {
+		return "", "", false
+	}
+	message := err.Error()
+	if strings.Contains(message, key) {
+		return strings.Replace(message, key, translated, 1), locale, true
+	}
+	return translated + ": " + message, locale, true
+}
+
+// fieldMessage returns the localized message of the field error of the
+// binding, by the key "validation.<tag>".
+func (t translator) fieldMessage(fieldError validator.FieldError) (msg string, locale string, ok bool) {
+	msg, locale, ok = t.message("validation." + fieldError.Tag())
+	if !ok {
+		return "", "", false
+	}
+	return strings.NewReplacer(
+		"{field}", fieldError.Field(),
+		"{param}", fieldError.Param(),
+	).Replace(msg), locale, true
+}
+
+// validation returns a copy of the orm.ValidationError with the message
+// localized, or the one given if not translated.
+func (t translator) validation(validation *orm.ValidationError) *orm.ValidationError {
+	msg, _, ok := t.message(validation.Message)
+	if !ok {
+		return validation
+	}
+	return &orm.ValidationError{Field: validation.Field, Message: msg}
+}
+
+// localizeResponseBody localizes the fields of the error response body
+// added by withResponseBody, i.e. the validation of withValidation.
+func (t translator) localizeResponseBody(body gin.H) {
+	if validation, ok := body["validation"].(*orm.ValidationError); ok && len(t) > 0 {
+		body["validation"] = t.validation(validation)
+	}
+}
+
+// sentinelErrors are the errors of crud keying the Messages, matched by
+// errors.Is: some errors match them without wrapping them, e.g. the
+// *service.DuplicateError is a service.ErrDuplicate.
+var sentinelErrors = []error{
+	ErrBindFailed, ErrMissingID, ErrMissingParentID, ErrUpdateID,
+	ErrColumnNotAllowed, ErrExplainNotAllowed, ErrUnknownField,
+	ErrInvalidFilter, ErrOffsetTooLarge, ErrOffsetBeyondTotal,
+	ErrRateLimited, ErrInvalidPreloadOrder, ErrTooManyPreloads,
+	ErrPreloadTooDeep, ErrPreloadWithDeleted, ErrInvalidChildren,
+	ErrUnknownFields, ErrInvalidJoin, ErrGenericFilterDisabled,
+	ErrInvalidFields, ErrInvalidFacet, ErrTooManyModels,
+	ErrDryRunNotAllowed, ErrFilterOpNotAllowed, ErrColumnNotQueryable,
+	ErrInvalidPagination, ErrInvalidExportFormat, ErrRangeNotSatisfiable,
+	ErrDuplicateIDs, ErrInvalidTotal, ErrInvalidDepth, ErrInvalidQuery,
+	ErrUnsupportedMediaType, ErrInvalidReport, ErrInvalidPretreat,
+
+	service.ErrNoIdentityField, service.ErrNilID,
+	service.ErrUnknownAssociation, service.ErrUnknownOperator,
+	service.ErrNotCountable, service.ErrInvalidPolymorphic,
+	service.ErrNotArray, service.ErrUnsupportedDialect,
+	service.ErrInvalidBatchSize, service.ErrNoJoinModel,
+	service.ErrNotSoftDeletable, service.ErrDuplicate, service.ErrNoKeys,
+	service.ErrNoRecord, service.ErrMultipleRecords, service.ErrNoFilter,
+	service.ErrConflict, service.ErrInvalidLastSeen, service.ErrNotToMany,
+	service.ErrNotTouchable, service.ErrMultipleParents,
+	service.ErrUnmatchedID, service.ErrLoaderType,
+
+	orm.ErrNotAllowedValue, orm.ErrUnknownColumn, orm.ErrNotUniqueColumn,
+	orm.ErrValidation,
+
+	gorm.ErrRecordNotFound,
+}
+
+// rootError returns the sentinel error err is (see sentinelErrors), else
+// the innermost error wrapped by err, e.g. ErrMissingID of
+// fmt.Errorf("%w: ...", ErrMissingID).
+func rootError(err error) error {
+	for _, sentinel := range sentinelErrors {
+		if errors.Is(err, sentinel) {
+			return sentinel
+		}
+	}
+	for {
+		wrapped := errors.Unwrap(err)
+		if wrapped == nil {
+			return err
+		}
+		err = wrapped
+	}
+}
+
+// acceptLanguages returns the language tags of the Accept-Language header
+// by their preference (q), each followed by its base language, e.g.
+// "de-CH, en;q=0.5" => de-CH, de, en. The wildcard and q=0 are skipped.
+func acceptLanguages(header string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if name == "" || name == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{name: name, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	var locales []string
+	for _, t := range tags {
+		locales = append(locales, t.name)
+		if base, _, ok := strings.Cut(t.name, "-"); ok {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
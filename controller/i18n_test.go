@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/tqrj/cd/service"
+)
+
+func TestTranslator_ErrorMessage(t *testing.T) {
+	defer func(messages MessageCatalog) { Messages = messages }(Messages)
+	Messages = MapCatalog{
+		"de": {
+			"missing id":       "ID fehlt",
+			"duplicate record": "doppelter Datensatz",
+		},
+	}
+	duplicate := &service.DuplicateError{Columns: []string{"sku"}}
+
+	tests := []struct {
+		name       string
+		locales    translator
+		err        error
+		want       string
+		wantLocale string
+		wantOK     bool
+	}{
+		{"sentinel", translator{"de"}, ErrMissingID, "ID fehlt", "de", true},
+		{"detail after", translator{"de"}, fmt.Errorf("%w: 5", ErrMissingID), "ID fehlt: 5", "de", true},
+		{"detail before", translator{"de"}, fmt.Errorf("get: %w", ErrMissingID), "get: ID fehlt", "de", true},
+		{"is without unwrap", translator{"de"}, duplicate, "doppelter Datensatz: by sku", "de", true},
+		{"wrapped is", translator{"de"}, fmt.Errorf("create: %w", duplicate), "create: doppelter Datensatz: by sku", "de", true},
+		{"preferred locale missing", translator{"fr", "de"}, ErrMissingID, "ID fehlt", "de", true},
+		{"not translated", translator{"de"}, ErrMissingParentID, "", "", false},
+		{"unknown error", translator{"de"}, errors.New("boom"), "", "", false},
+		{"no locales", nil, ErrMissingID, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, locale, ok := tt.locales.errorMessage(tt.err)
+			if got != tt.want || locale != tt.wantLocale || ok != tt.wantOK {
+				t.Errorf("errorMessage(%v) = %q, %q, %v, want %q, %q, %v",
+					tt.err, got, locale, ok, tt.want, tt.wantLocale, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRootError(t *testing.T) {
+	inner := errors.New("inner")
+	tests := []struct {
+		err, want error
+	}{
+		{ErrMissingID, ErrMissingID},
+		{fmt.Errorf("a: %w", fmt.Errorf("b: %w", ErrMissingID)), ErrMissingID},
+		{&service.DuplicateError{Columns: []string{"sku"}}, service.ErrDuplicate},
+		{fmt.Errorf("a: %w", inner), inner},
+		{inner, inner},
+	}
+	for _, tt := range tests {
+		if got := rootError(tt.err); got != tt.want {
+			t.Errorf("rootError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptLanguages(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"de-CH, en;q=0.5", []string{"de-CH", "de", "en"}},
+		{"en;q=0.2, fr;q=0.9, *;q=0.1, es;q=0", []string{"fr", "en"}},
+	}
+	for _, tt := range tests {
+		if got := acceptLanguages(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("acceptLanguages(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
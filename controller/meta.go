@@ -0,0 +1,184 @@
+package controller
+
+import "github.com/gin-gonic/gin"
+
+// Meta is the typed metadata of a success response. It is accumulated by
+// the handlers and serialized under the "meta" key of the response body:
+//
+//	{
+//	    code: 200, msg: "success",
+//	    Users: [...],
+//	    meta: { total: 42, pagination: { limit: 10, offset: 20, has_next: true } },
+//	}
+//
+// Zero fields are omitted.
+type Meta struct {
+	Total        *int64            `json:"total,omitempty"`
+	TotalKind    string            `json:"total_kind,omitempty"` // TotalExact or TotalEstimate
+	Pagination   *Pagination       `json:"pagination,omitempty"`
+	Counts       map[string]int64  `json:"counts,omitempty"`
+	Distinct     map[string]int64  `json:"distinct,omitempty"` // column => count of distinct values
+	RowsAffected *int64            `json:"rows_affected,omitempty"`
+	ID           any               `json:"id,omitempty"`           // of the created model
+	Changed      *[]string         `json:"changed,omitempty"`      // fields changed by the update
+	Unchanged    bool              `json:"unchanged,omitempty"`    // the update is skipped, see UpdateOption.SkipUnchanged
+	Created      bool              `json:"created,omitempty"`      // the update created the model, see UpdateOption.Missing
+	AffectedIDs  *[]any            `json:"affected_ids,omitempty"` // of the batch operation, by report=ids
+	Errors       map[string]string `json:"errors,omitempty"`       // e.g. total => count failed
+}
+
+// Pagination is the effective limit and offset of a list response, and
+// whether there are more models after the page (see Meta.SetHasNext).
+type Pagination struct {
+	Limit   int   `json:"limit"`
+	Offset  int   `json:"offset"`
+	HasNext *bool `json:"has_next,omitempty"`
+}
+
+// LegacyMetaFields keeps writing the metadata as top-level fields of the
+// response body as well, as it was before Meta:
+//
+//	{ code, msg, Users: [...], total: 42, totalError: "...", rowsAffected: 3 }
+//
+// It is a compatibility shim for the existing clients, and will be removed
+// (defaults to false) in a future version.
+var LegacyMetaFields = true
+
+// Kinds of the Meta.Total.
+const (
+	TotalExact    = "exact"
+	TotalEstimate = "estimate" // see service.EstimateCount
+)
+
+func (m *Meta) SetTotal(total int64) *Meta {
+	m.Total = &total
+	m.TotalKind = TotalExact
+	return m
+}
+
+// SetEstimatedTotal sets the total of an estimate, which is not used for
+// the has_next of the pagination.
+func (m *Meta) SetEstimatedTotal(total int64) *Meta {
+	m.Total = &total
+	m.TotalKind = TotalEstimate
+	return m
+}
+
+func (m *Meta) SetPagination(limit, offset int) *Meta {
+	m.Pagination = &Pagination{Limit: limit, Offset: offset}
+	return m
+}
+
+// SetHasNext sets the has_next of the pagination of a page of count models:
+// by the total if set, or false if the page is not full. It is unknown
+// (omitted) otherwise, or without a pagination.
+func (m *Meta) SetHasNext(count int) *Meta {
+	if m.Pagination == nil {
+		return m
+	}
+	var hasNext bool
+	switch {
+	case m.Total != nil && m.TotalKind != TotalEstimate:
+		hasNext = int64(m.Pagination.Offset+count) < *m.Total
+	case count < m.Pagination.Limit:
+		hasNext = false
+	default:
+		return m
+	}
+	m.Pagination.HasNext = &hasNext
+	return m
+}
+
+func (m *Meta) SetCount(key string, count int64) *Meta {
+	if m.Counts == nil {
+		m.Counts = map[string]int64{}
+	}
+	m.Counts[key] = count
+	return m
+}
+
+// SetDistinct sets the count of the distinct values of the column.
+func (m *Meta) SetDistinct(column string, count int64) *Meta {
+	if m.Distinct == nil {
+		m.Distinct = map[string]int64{}
+	}
+	m.Distinct[column] = count
+	return m
+}
+
+func (m *Meta) SetRowsAffected(rowsAffected int64) *Meta {
+	m.RowsAffected = &rowsAffected
+	return m
+}
+
+func (m *Meta) SetID(id any) *Meta {
+	m.ID = id
+	return m
+}
+
+// SetChanged sets the (JSON) names of the fields changed by an update,
+// which is [] for a no-op update.
+func (m *Meta) SetChanged(changed []string) *Meta {
+	if changed == nil {
+		changed = []string{}
+	}
+	m.Changed = &changed
+	return m
+}
+
+// SetUnchanged marks the update as skipped for changing nothing.
+func (m *Meta) SetUnchanged(unchanged bool) *Meta {
+	m.Unchanged = unchanged
+	return m
+}
+
+func (m *Meta) SetCreated(created bool) *Meta {
+	m.Created = created
+	return m
+}
+
+// SetAffectedIDs sets the primary keys of the models written by a batch
+// operation, which is [] if none.
+func (m *Meta) SetAffectedIDs(ids []any) *Meta {
+	if ids == nil {
+		ids = []any{}
+	}
+	m.AffectedIDs = &ids
+	return m
+}
+
+// AddError records a non-fatal error (the response is still a success)
+// of the key, e.g. AddError("total", err) if the count query failed.
+func (m *Meta) AddError(key string, err error) *Meta {
+	if m.Errors == nil {
+		m.Errors = map[string]string{}
+	}
+	m.Errors[key] = err.Error()
+	return m
+}
+
+// H returns the meta as an addition of ResponseSuccess:
+//
+//	ResponseSuccess(c, users, meta.H())
+//
+// Which is { meta: {...} }, with LegacyMetaFields if enabled.
+// A nil Meta returns nil.
+func (m *Meta) H() gin.H {
+	if m == nil {
+		return nil
+	}
+	h := gin.H{"meta": m}
+	if !LegacyMetaFields {
+		return h
+	}
+	if m.Total != nil {
+		h["total"] = *m.Total
+	}
+	if e, ok := m.Errors["total"]; ok {
+		h["totalError"] = e
+	}
+	if m.RowsAffected != nil {
+		h["rowsAffected"] = *m.RowsAffected
+	}
+	return h
+}
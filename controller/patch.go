@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm/schema"
+)
+
+// MergePatchContentType is the media type of the JSON Merge Patch (RFC 7386).
+const MergePatchContentType = "application/merge-patch+json"
+
+// MergePatchHandler handles
+//
+//	PATCH /T/:idParam
+//
+// Updates the model T with the given id by the JSON Merge Patch (RFC 7386)
+// of the body: the fields present are set, the ones set to null are
+// cleared (the columns set to NULL), and the absent ones are left as they
+// are. The objects of the JSON columns (e.g. of the serializer:json fields)
+// are merged recursively into their current values, by the same rules.
+// It is the UpdateHandler with opt.BindMap.
+//
+// Request body (Content-Type: application/merge-patch+json):
+//   - {"title": "new", "due_at": null, "settings": {"theme": "dark", "font": null}}
+//
+// Response:
+//   - as UpdateHandler
+//   - 415 Unsupported Media Type: { error: "unsupported media type" }  // with Accept-Patch: application/merge-patch+json
+func MergePatchHandler[T orm.Model](idParam string, opt *enum.UpdateOption) gin.HandlerFunc {
+	patchOpt := *opt
+	patchOpt.BindMap = true
+	update := updateHandler[T](idParam, &patchOpt, true)
+	return func(c *gin.Context) {
+		if contentType := c.ContentType(); contentType != MergePatchContentType {
+			logger.WithContext(c).WithField("contentType", contentType).
+				Warn("MergePatchHandler: unsupported media type")
+			c.Header("Accept-Patch", MergePatchContentType)
+			ResponseError(c, CodeUnsupportedMediaType, fmt.Errorf("%w: %q, expected %s",
+				ErrUnsupportedMediaType, contentType, MergePatchContentType))
+			return
+		}
+		update(c)
+	}
+}
+
+// mergePatchValue returns the value of the patch of the field of model: the
+// object patch (if it is one) merged into the current value of the field,
+// if the current value is an object as well, else the patch as is.
+func mergePatchValue(c *gin.Context, field *schema.Field, model any, patch any) (any, error) {
+	object, ok := patch.(map[string]any)
+	if !ok {
+		return patch, nil
+	}
+	current := field.ReflectValueOf(c, reflect.ValueOf(model).Elem()).Interface() // not the serializer of ValueOf
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBindFailed, field.Name, err)
+	}
+	var target any
+	if err := json.Unmarshal(data, &target); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBindFailed, field.Name, err)
+	}
+	return mergePatch(target, object), nil
+}
+
+// mergePatch applies the patch to the target by the MergePatch algorithm of
+// RFC 7386: objects are merged recursively, null members are removed, and
+// any other patch replaces the target.
+func mergePatch(target any, patch any) any {
+	object, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	merged, ok := target.(map[string]any)
+	if !ok {
+		merged = map[string]any{}
+	}
+	for key, value := range object {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = mergePatch(merged[key], value)
+	}
+	return merged
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+// TestMergePatch tests mergePatch by the examples of the appendix A of
+// RFC 7386.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch any
+		if err := json.Unmarshal([]byte(tt.target), &target); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(mergePatch(target, patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+type task struct {
+	orm.BasicModel
+	Title    string         `json:"title"`
+	Note     *string        `json:"note"`
+	Settings map[string]any `json:"settings" gorm:"serializer:json"`
+}
+
+func TestMergePatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &task{})
+	note := "draft"
+	if err := db.Create(&task{Title: "old", Note: &note, Settings: map[string]any{
+		"font": "mono", "lang": "en", "size": map[string]any{"w": 1},
+	}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PATCH("/tasks/:id", MergePatchHandler[task]("id", &enum.UpdateOption{}))
+
+	type stored struct {
+		Title    string
+		Note     *string
+		Settings string
+	}
+	load := func() stored {
+		t.Helper()
+		var s stored
+		if err := db.Table("tasks").Select("title, note, settings").Take(&s).Error; err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		wantCode     int
+		wantTitle    string
+		wantNote     string // "" for NULL
+		wantSettings string
+	}{
+		{"json body", "application/json", `{"title": "new"}`, http.StatusUnsupportedMediaType,
+			"old", "draft", `{"font":"mono","lang":"en","size":{"w":1}}`},
+		{"absent fields untouched", MergePatchContentType, `{"title": "new"}`, http.StatusOK,
+			"new", "draft", `{"font":"mono","lang":"en","size":{"w":1}}`},
+		{"null to NULL", MergePatchContentType, `{"note": null}`, http.StatusOK,
+			"new", "", `{"font":"mono","lang":"en","size":{"w":1}}`},
+		{"nested merge", MergePatchContentType, `{"settings": {"theme": "dark", "font": null, "size": {"h": 2}}}`, http.StatusOK,
+			"new", "", `{"lang":"en","size":{"h":2,"w":1},"theme":"dark"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPatch, "/tasks/1", tt.body, "Content-Type", tt.contentType)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode == http.StatusUnsupportedMediaType {
+				if got := w.Header().Get("Accept-Patch"); got != MergePatchContentType {
+					t.Errorf("Accept-Patch = %q, want %s", got, MergePatchContentType)
+				}
+			}
+			s := load()
+			if s.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", s.Title, tt.wantTitle)
+			}
+			if (s.Note == nil) != (tt.wantNote == "") || s.Note != nil && *s.Note != tt.wantNote {
+				t.Errorf("note = %v, want %q", s.Note, tt.wantNote)
+			}
+			if s.Settings != tt.wantSettings {
+				t.Errorf("settings = %s, want %s", s.Settings, tt.wantSettings)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	ginrequestid "github.com/tqrj/cd/pkg/gin-request-id"
+)
+
+// ProblemDetails makes ResponseError write the errors as RFC 7807 problem
+// details (application/problem+json), for the standards-based clients and
+// gateways, instead of the { code, msg } bodies:
+//
+//	{
+//	    type: "about:blank", title: "Unprocessable Entity", status: 422,
+//	    detail: "...", instance: "/users",
+//	    request_id: "...",  // if any
+//	    errors: [{ field: "Name", rule: "required", param: "" }],  // validation errors, if any
+//	}
+//
+// Defaults to false.
+var ProblemDetails = false
+
+// ProblemType returns the problem type URI of an error response with the
+// code, e.g. "https://example.com/problems/conflict" for CodeConflict.
+// Defaults to "about:blank" (the title is the status text of the code).
+var ProblemType = func(code int, err error) string {
+	return "about:blank"
+}
+
+// FieldProblem is a field-level validation error in the "errors"
+// extension member of problem details.
+type FieldProblem struct {
+	Field string `json:"field"` // the namespace of the field, e.g. User.Name
+	Rule  string `json:"rule"`  // the failed `binding` tag, e.g. required
+	Param string `json:"param"` // the param of the rule, e.g. 3 of min=3
+	// Message is the localized message of the error, if translated by
+	// Messages.
+	Message string `json:"message,omitempty"`
+}
+
+// ProblemResponseBody builds the problem details body of err, see
+// ProblemDetails.
+func ProblemResponseBody(c *gin.Context, code int, err error) gin.H {
+	body := gin.H{
+		"type":   ProblemType(code, err),
+		"title":  http.StatusText(code),
+		"status": code,
+		"detail": err.Error(),
+	}
+	if c.Request != nil {
+		body["instance"] = c.Request.URL.RequestURI()
+	}
+	if id := c.GetString(ginrequestid.ContextKey); id != "" {
+		body["request_id"] = id
+	}
+	t := newTranslator(c)
+	if msg, _, ok := t.errorMessage(err); ok {
+		body["detail"] = msg
+	}
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		problems := make([]FieldProblem, len(validationErrors))
+		for i, fieldError := range validationErrors {
+			problems[i] = FieldProblem{
+				Field: fieldError.Namespace(),
+				Rule:  fieldError.Tag(),
+				Param: fieldError.Param(),
+			}
+			problems[i].Message, _, _ = t.fieldMessage(fieldError)
+		}
+		body["errors"] = problems
+	}
+	return body
+}
+
+// responseProblem writes the problem details of err, in
+// application/problem+json unless another format is negotiated by
+// Encoders.
+func responseProblem(c *gin.Context, code int, err error) {
+	if negotiateEncoder(c) == nil {
+		c.Header("Content-Type", "application/problem+json; charset=utf-8")
+	}
+	body := ProblemResponseBody(c, code, err)
+	addResponseBody(body, err)
+	t := newTranslator(c)
+	if _, locale, ok := t.errorMessage(err); ok {
+		c.Header("Content-Language", locale)
+	}
+	t.localizeResponseBody(body)
+	respond(c, code, body)
+}
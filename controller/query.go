@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+)
+
+// QueryHandler handles
+//
+//	POST /T/query
+//
+// It is GetListHandler with the query in the request body (see
+// enum.QueryRequest) instead of the URL, for the rich queries beyond the
+// limits of the URL lengths, or hard to encode in them. The body is
+// translated into the query params of the list (over the ones of the URL,
+// if any), so that the query is bound, checked and responded as the list
+// by the ListOption.
+//
+// Request Body:
+//   - enum.QueryRequest: {"filters": [{"column": "age", "value": 18}], "limit": 20}
+//
+// Response:
+//   - as GetListHandler
+//   - 400 Bad Request: { error: "invalid query: ..." }  // malformed body, or not expressible params
+func QueryHandler[T any](opt *enum.ListOption) gin.HandlerFunc {
+	list := GetListHandler[T](opt)
+	return func(c *gin.Context) {
+		var request enum.QueryRequest
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.UseNumber()
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			logger.WithContext(c).WithError(err).
+				Warn("QueryHandler: decode body failed")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %v", ErrInvalidQuery, err))
+			return
+		}
+		query, err := queryParams(c.Request.URL.Query(), request)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("QueryHandler: queryParams failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		u := *c.Request.URL
+		u.RawQuery = query.Encode()
+		c.Request.URL = &u
+		c.Request.Form = nil // parsed again from the URL by the binding
+		list(c)
+	}
+}
+
+// queryParams translates the QueryRequest into the query params of the
+// list, set over the query.
+func queryParams(query url.Values, request enum.QueryRequest) (url.Values, error) {
+	for name, value := range request.Params {
+		values, err := queryParamValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: params.%s: %v", ErrInvalidQuery, name, err)
+		}
+		query[name] = values
+	}
+
+	columns := map[string]bool{}
+	for i, filter := range request.Filters {
+		if filter.Column == "" {
+			return nil, fmt.Errorf("%w: filters[%d]: missing column", ErrInvalidQuery, i)
+		}
+		if columns[filter.Column] {
+			return nil, fmt.Errorf("%w: filters[%d]: duplicate filter on %q", ErrInvalidQuery, i, filter.Column)
+		}
+		columns[filter.Column] = true
+		value, err := queryFilterValue(filter.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filters[%d]: %v", ErrInvalidQuery, i, err)
+		}
+		query.Set("filters["+filter.Column+"]", value)
+		if filter.Op != "" {
+			query.Set("filter_ops["+filter.Column+"]", filter.Op)
+		}
+	}
+	if len(request.FiltersAt) > 0 {
+		query["filters_at"] = request.FiltersAt
+	}
+	if len(request.IDs) > 0 {
+		ids, err := queryParamValues(request.IDs)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ids: %v", ErrInvalidQuery, err)
+		}
+		query["ids"] = ids
+	}
+	if request.IDsOnly {
+		query.Set("ids_only", "true")
+	}
+
+	if request.OrderBy != "" {
+		query.Set("order_by", request.OrderBy)
+	}
+	if request.Desc {
+		query.Set("desc", "true")
+	}
+
+	style := PaginationParams
+	if request.Limit != 0 {
+		query.Set(style.Limit, strconv.Itoa(request.Limit))
+	}
+	if request.Offset != 0 && style.Offset != "" {
+		query.Set(style.Offset, strconv.Itoa(request.Offset))
+	}
+	if request.Page != 0 {
+		if style.Page == "" {
+			return nil, fmt.Errorf("%w: page: the page-based pagination is not enabled", ErrInvalidQuery)
+		}
+		query.Set(style.Page, strconv.Itoa(request.Page))
+	}
+	if request.Total != nil {
+		total, err := queryScalar(request.Total)
+		if err != nil {
+			return nil, fmt.Errorf("%w: total: %v", ErrInvalidQuery, err)
+		}
+		query.Set("total", total)
+	}
+
+	for name, values := range map[string][]string{
+		"preload":              request.Preload,
+		"preload_order":        request.PreloadOrder,
+		"preload_with_deleted": request.PreloadWithDeleted,
+		"join":                 request.Join,
+		"with_counts":          request.WithCounts,
+		"distinct":             request.Distinct,
+	} {
+		if len(values) > 0 {
+			query[name] = values
+		}
+	}
+	for name, value := range map[string]string{
+		"created_within": request.CreatedWithin,
+		"updated_within": request.UpdatedWithin,
+		"fields":         request.Fields,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if request.Q != "" {
+		query.Set("q", request.Q)
+	}
+	return query, nil
+}
+
+// queryFilterValue returns the filter param of the value: a scalar, or
+// the comma separated values of an array (for the in and all operators).
+func queryFilterValue(value any) (string, error) {
+	if value == nil {
+		return "", errors.New("missing value")
+	}
+	values, ok := value.([]any)
+	if !ok {
+		return queryScalar(value)
+	}
+	params := make([]string, len(values))
+	for i, v := range values {
+		param, err := queryScalar(v)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(param, ",") {
+			return "", fmt.Errorf("%q of the values contains a comma, which separates them", param)
+		}
+		params[i] = param
+	}
+	return strings.Join(params, ","), nil
+}
+
+// queryParamValues returns the values of a param: the scalar, or the
+// scalars of an array (as repeated params).
+func queryParamValues(value any) ([]string, error) {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	params := make([]string, len(values))
+	for i, v := range values {
+		param, err := queryScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = param
+	}
+	return params, nil
+}
+
+// queryScalar returns the param of a JSON string, number or bool.
+func queryScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("%v is not a string, number or bool", value)
+}
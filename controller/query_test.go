@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+type reading struct {
+	orm.BasicModel
+	Sensor string `json:"sensor"`
+	Value  int    `json:"value"`
+}
+
+func TestQueryHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &reading{})
+	for i, sensor := range []string{"a", "b", "a", "c", "a"} {
+		if err := db.Create(&reading{Sensor: sensor, Value: i * 10}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.POST("/readings/query", QueryHandler[reading](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		name, url, body string
+		code            int
+		wantValues      []int
+	}{
+		{"empty body", "/readings/query", "", http.StatusOK, []int{0, 10, 20, 30, 40}},
+		{"filter", "/readings/query", `{"filters": [{"column": "sensor", "value": "a"}]}`, http.StatusOK, []int{0, 20, 40}},
+		{"filter op", "/readings/query", `{"filters": [{"column": "sensor", "op": "startswith", "value": "c"}]}`, http.StatusOK, []int{30}},
+		{"filter in", "/readings/query", `{"filters": [{"column": "sensor", "op": "in", "value": ["b", "c"]}]}`, http.StatusOK, []int{10, 30}},
+		{"order and pagination", "/readings/query", `{"order_by": "value", "desc": true, "limit": 2, "offset": 1}`, http.StatusOK, []int{30, 20}},
+		{"ids", "/readings/query", `{"ids": [2, "4"]}`, http.StatusOK, []int{10, 30}},
+		{"over the url", "/readings/query?limit=1&order_by=id", `{"limit": 3}`, http.StatusOK, []int{0, 10, 20}},
+		{"params", "/readings/query", `{"params": {"filters[sensor]": "c"}}`, http.StatusOK, []int{30}},
+
+		{"malformed", "/readings/query", `{"filters": `, http.StatusBadRequest, nil},
+		{"unknown field", "/readings/query", `{"where": "1=1"}`, http.StatusBadRequest, nil},
+		{"missing column", "/readings/query", `{"filters": [{"value": 1}]}`, http.StatusBadRequest, nil},
+		{"duplicate column", "/readings/query", `{"filters": [{"column": "value", "value": 1}, {"column": "value", "value": 2}]}`, http.StatusBadRequest, nil},
+		{"missing value", "/readings/query", `{"filters": [{"column": "value"}]}`, http.StatusBadRequest, nil},
+		{"object value", "/readings/query", `{"filters": [{"column": "value", "value": {"a": 1}}]}`, http.StatusBadRequest, nil},
+		{"comma in values", "/readings/query", `{"filters": [{"column": "sensor", "op": "in", "value": ["a,b"]}]}`, http.StatusBadRequest, nil},
+		{"page not enabled", "/readings/query", `{"page": 2}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, tt.url, tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.code != http.StatusOK {
+				if want := ErrInvalidQuery.Error(); !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body = %s, want %q", w.Body.String(), want)
+				}
+				return
+			}
+			var body struct {
+				Readings []reading `json:"readings"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var values []int
+			for _, reading := range body.Readings {
+				values = append(values, reading.Value)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(tt.wantValues) {
+				t.Errorf("values = %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+)
+
+// RangeUnit enables the pagination of the lists by the Range header of
+// the unit, as an alternative to the limit and offset params, which is
+// the convention of some table UIs and admin frameworks:
+//
+//	controller.RangeUnit = "items"
+//	// GET /users with Range: items=0-24
+//	// => 206 Partial Content, Content-Range: items 0-24/500
+//
+// The range is translated into the limit and offset (limited by the
+// ListOption.LimitMax), and the Content-Range is of the models responded,
+// with the total (counted for the ranged requests). A range of all the
+// models is responded with 200 OK, and a range beyond them with 416 Range
+// Not Satisfiable. The lists advertise the unit by Accept-Ranges.
+//
+// "" (default) disables it: the Range headers are ignored.
+var RangeUnit = ""
+
+// bindRange binds the Range header of RangeUnit (if enabled) into the
+// Limit and Offset of the request, overriding the pagination params.
+// Ranges of other units are ignored.
+func bindRange(c *gin.Context, request *enum.GetRequestOptions) error {
+	if RangeUnit == "" {
+		return nil
+	}
+	c.Header("Accept-Ranges", RangeUnit)
+	header := strings.TrimSpace(c.GetHeader("Range"))
+	unit, spec, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), RangeUnit) {
+		return nil
+	}
+	invalid := fmt.Errorf("%w: Range: %s", ErrInvalidPagination, header)
+	from, to, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return invalid
+	}
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 0 {
+		return invalid
+	}
+	limit := 0 // the default one, for first-
+	if to != "" {
+		last, err := strconv.Atoi(to)
+		if err != nil || last < first {
+			return invalid
+		}
+		limit = last - first + 1
+	}
+	request.Limit, request.Offset, request.Page = limit, first, 0
+	request.Range = true
+	return nil
+}
+
+// contentRange sets the Content-Range of the count models responded from
+// the offset, of the total (nil for unknown), and returns the response
+// code: CodePartialContent, or CodeSuccess for all the models. It fails
+// with ErrRangeNotSatisfiable for a range beyond the models.
+func contentRange(c *gin.Context, offset int, count int, total *int64) (int, error) {
+	of := "*"
+	if total != nil {
+		of = strconv.FormatInt(*total, 10)
+	}
+	if count == 0 {
+		c.Header("Content-Range", fmt.Sprintf("%s */%s", RangeUnit, of))
+		if offset > 0 {
+			return 0, fmt.Errorf("%w: %s %d- of %s", ErrRangeNotSatisfiable, RangeUnit, offset, of)
+		}
+		return CodeSuccess, nil
+	}
+	c.Header("Content-Range", fmt.Sprintf("%s %d-%d/%s", RangeUnit, offset, offset+count-1, of))
+	if total != nil && offset == 0 && int64(count) == *total {
+		return CodeSuccess, nil
+	}
+	return CodePartialContent, nil
+}
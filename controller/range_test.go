@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
+func TestGetListHandler_Range(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	RangeUnit = "items"
+	defer func() { RangeUnit = "" }()
+	db := servicetest.Open(t, &item{})
+	for i := 0; i < 5; i++ {
+		if err := db.Create(&item{Name: fmt.Sprintf("item %d", i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/items", GetListHandler[item](&enum.ListOption{LimitMax: 10}))
+
+	tests := []struct {
+		name, rangeHeader string
+		code, items       int
+		contentRange      string
+	}{
+		{"partial", "items=0-1", http.StatusPartialContent, 2, "items 0-1/5"},
+		{"from the offset", "items=3-", http.StatusPartialContent, 2, "items 3-4/5"},
+		{"all", "items=0-9", http.StatusOK, 5, "items 0-4/5"},
+		{"beyond", "items=10-12", http.StatusRequestedRangeNotSatisfiable, 0, "items */5"},
+		{"invalid", "items=3-1", http.StatusBadRequest, 0, ""},
+		{"other unit", "bytes=0-1", http.StatusOK, 5, ""},
+		{"no range", "", http.StatusOK, 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/items", "", "Range", tt.rangeHeader)
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+			}
+			if got := w.Header().Get("Accept-Ranges"); got != "items" {
+				t.Errorf("Accept-Ranges = %q, want items", got)
+			}
+			if tt.code >= 300 {
+				return
+			}
+			var body struct {
+				Items []item `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Items) != tt.items {
+				t.Errorf("items = %d, want %d", len(body.Items), tt.items)
+			}
+		})
+	}
+}
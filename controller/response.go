@@ -1,11 +1,19 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/tqrj/cd/orm"
+	ginrequestid "github.com/tqrj/cd/pkg/gin-request-id"
+	"github.com/tqrj/cd/service"
+	"math"
 	"net/http"
 	"reflect"
+	"strconv"
+	"time"
 )
 
 // ErrorResponseBody builds the error response body:
@@ -45,6 +53,12 @@ func SuccessResponseBody(model any, addition ...gin.H) gin.H {
 	return res
 }
 
+// DataKey is the key of the models in the success responses, e.g. "data"
+// for { code, msg, data: [...] }, unless given by the orm.ResponseKeyer of
+// the model. "" (default) keys them by their type names: User for a model,
+// Users for a list.
+var DataKey = ""
+
 // get a human-readable model name
 func getResponseModelName(model any) string {
 	var reflectType = reflect.TypeOf(model)
@@ -53,18 +67,19 @@ func getResponseModelName(model any) string {
 	// and if model is a pointer or slice, try to get the element type.
 	switch reflectType.Kind() {
 	case reflect.Struct:
-		return reflectType.Name()
+		return responseKey(reflectType, false, reflectType.Name())
 	case reflect.Ptr:
 		return getResponseModelName(reflectValue.Elem().Interface())
 	case reflect.Slice, reflect.Array:
 		if reflectType.Elem().Kind() == reflect.Struct {
-			return reflectType.Elem().Name() + "s"
+			return responseKey(reflectType.Elem(), true, reflectType.Elem().Name()+"s")
 		}
 		if reflectType.Elem().Kind() == reflect.Ptr && reflectType.Elem().Elem().Kind() == reflect.Struct {
-			return reflectType.Elem().Elem().Name() + "s"
+			return responseKey(reflectType.Elem(), true, reflectType.Elem().Elem().Name()+"s")
 		}
 		if reflectValue.Len() > 0 {
-			return getResponseModelName(reflectValue.Index(0).Interface()) + "s"
+			first := reflectValue.Index(0).Interface()
+			return responseKey(reflect.TypeOf(first), true, getResponseModelName(first)+"s")
 		}
 		fallthrough
 	default:
@@ -74,26 +89,301 @@ func getResponseModelName(model any) string {
 	}
 }
 
-// ResponseError writes an error response to client in JSON.
+// ResponseKeys returns the keys of the models of the (struct) type in the
+// success responses: of a model (single) and of a list (plural), by its
+// orm.ResponseKeyer, the DataKey, or else the type name (User and Users).
+func ResponseKeys(t reflect.Type) (single, plural string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return responseKey(t, false, t.Name()), responseKey(t, true, t.Name()+"s")
+}
+
+// responseKey returns the key of the models of the (struct) type, single
+// or plural, by its orm.ResponseKeyer, the DataKey, or else the name.
+func responseKey(t reflect.Type, plural bool, name string) string {
+	if single, plurals, ok := orm.ResponseKeys(t); ok {
+		key := single
+		if plural {
+			key = plurals
+		}
+		if key != "" {
+			return key
+		}
+	}
+	if DataKey != "" {
+		return DataKey
+	}
+	return name
+}
+
+// toMap converts model into a map by its JSON representation,
+// so that extra fields can be attached to it.
+func toMap(model any) (map[string]any, error) {
+	data, err := json.Marshal(inTimeLocation(limitDepth(model)))
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// getErrorCode returns the response code for errors from the service:
+// CodeBadRequest for invalid requests that failed before touching the
+// database (e.g. unknown columns or associations), else CodeProcessFailed.
+func getErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownField),
+		errors.Is(err, orm.ErrUnknownColumn),
+		errors.Is(err, service.ErrUnknownAssociation),
+		errors.Is(err, service.ErrNotCountable),
+		errors.Is(err, service.ErrNotToMany),
+		errors.Is(err, service.ErrNotArray),
+		errors.Is(err, service.ErrUnsupportedDialect):
+		return CodeBadRequest
+	}
+	return CodeProcessFailed
+}
+
+// getBindErrorCode returns the response code for errors from binding the
+// request body: CodeUnprocessable if the body is well-formed but violates
+// the validation rules (the `binding` tags), else CodeBadRequest for
+// malformed bodies (e.g. invalid JSON).
+func getBindErrorCode(err error) int {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return CodeUnprocessable
+	}
+	return CodeBadRequest
+}
+
+// ResponseError writes an error response to client in JSON (or the format
+// negotiated by Encoders), with the request_id (see gin_request_id.RequestID)
+// if any, for the clients to report the errors with. The body is the RFC
+// 7807 problem details if ProblemDetails is enabled. The messages are
+// localized by the Messages catalog, if any.
+//
+// A Retry-After header (in seconds) is set for errors wrapped by
+// WithRetryAfter, or for CodeConflict responses if ConflictRetryAfter > 0.
 func ResponseError(c *gin.Context, code int, err error) {
-	c.JSON(code, ErrorResponseBody(err))
+	var retry *retryAfterError
+	if errors.As(err, &retry) {
+		setRetryAfter(c, retry.after)
+	} else if code == CodeConflict && ConflictRetryAfter > 0 {
+		setRetryAfter(c, ConflictRetryAfter)
+	}
+	if ProblemDetails {
+		responseProblem(c, code, err)
+		return
+	}
+	body := ErrorResponseBody(err)
+	if id := c.GetString(ginrequestid.ContextKey); id != "" {
+		body["request_id"] = id
+	}
+	addResponseBody(body, err)
+	t := newTranslator(c)
+	if msg, locale, ok := t.errorMessage(err); ok {
+		body["msg"] = msg
+		c.Header("Content-Language", locale)
+	}
+	t.localizeResponseBody(body)
+	respond(c, code, body)
+}
+
+// withResponseBody wraps err with the additional fields of its error
+// response body, added by ResponseError, e.g. the existing model of a
+// duplicate.
+func withResponseBody(err error, addition gin.H) error {
+	return &responseBodyError{err: err, addition: addition}
+}
+
+type responseBodyError struct {
+	err      error
+	addition gin.H
+}
+
+func (e *responseBodyError) Error() string { return e.err.Error() }
+func (e *responseBodyError) Unwrap() error { return e.err }
+
+// addResponseBody adds the fields of err wrapped by withResponseBody, if
+// any, into the body.
+func addResponseBody(body gin.H, err error) {
+	var withBody *responseBodyError
+	if errors.As(err, &withBody) {
+		for k, v := range withBody.addition {
+			body[k] = v
+		}
+	}
 }
 
-// ResponseSuccess writes a success response to client in JSON.
+// ConflictRetryAfter is the Retry-After of CodeConflict responses, for
+// the conflicts that are transient (e.g. locks). 0 (default) for none.
+var ConflictRetryAfter time.Duration
+
+// WithRetryAfter wraps err to tell the client to retry after d,
+// by the Retry-After header set by ResponseError:
+//
+//	ResponseError(c, CodeTooManyRequests, WithRetryAfter(ErrRateLimited, wait))
+func WithRetryAfter(err error, d time.Duration) error {
+	return &retryAfterError{err: err, after: d}
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// setRetryAfter sets the Retry-After header to d in seconds, rounded up.
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// ResponseSuccess writes a success response to client in JSON (or the
+// format negotiated by Encoders).
+// The times in the model are converted to TimeLocation if it is set, and
+// its associations are limited by MaxAssociationDepth.
 func ResponseSuccess(c *gin.Context, model any, addition ...gin.H) {
-	c.JSON(http.StatusOK, SuccessResponseBody(model, addition...))
+	responseSuccess(c, CodeSuccess, model, addition...)
+}
+
+// responseSuccess is ResponseSuccess with another success code, e.g.
+// CodePartialContent.
+func responseSuccess(c *gin.Context, code int, model any, addition ...gin.H) {
+	respond(c, code, SuccessResponseBody(inTimeLocation(limitDepth(model)), addition...))
+}
+
+// TimeLocation normalizes the time.Time values in the responses into the
+// location (e.g. time.UTC), so that clients get consistent timestamps
+// whatever the database returns. The time request params without zones
+// (e.g. filter_value=2023-01-02 15:04:05) are interpreted in it as well.
+//
+// nil (default) leaves the times as they are, and interprets the time
+// params without zones in UTC.
+var TimeLocation *time.Location
+
+// inTimeLocation returns a copy of model with all the time.Time values
+// (in nested structs, pointers, slices and maps) converted to TimeLocation.
+func inTimeLocation(model any) any {
+	if TimeLocation == nil || model == nil {
+		return model
+	}
+	return convertTimes(reflect.ValueOf(model), TimeLocation).Interface()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func convertTimes(v reflect.Value, loc *time.Location) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return reflect.ValueOf(v.Interface().(time.Time).In(loc))
+		}
+		converted := reflect.New(v.Type()).Elem()
+		converted.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				converted.Field(i).Set(convertTimes(v.Field(i), loc))
+			}
+		}
+		return converted
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		converted := reflect.New(v.Type().Elem())
+		converted.Elem().Set(convertTimes(v.Elem(), loc))
+		return converted
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		converted := reflect.New(v.Type()).Elem()
+		converted.Set(convertTimes(v.Elem(), loc))
+		return converted
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		converted := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			converted.Index(i).Set(convertTimes(v.Index(i), loc))
+		}
+		return converted
+	case reflect.Array:
+		converted := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			converted.Index(i).Set(convertTimes(v.Index(i), loc))
+		}
+		return converted
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		converted := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			converted.SetMapIndex(iter.Key(), convertTimes(iter.Value(), loc))
+		}
+		return converted
+	}
+	return v
 }
 
 const (
-	CodeSuccess       = http.StatusOK
-	CodeNotFound      = http.StatusNotFound
-	CodeBadRequest    = http.StatusBadRequest
-	CodeProcessFailed = http.StatusUnprocessableEntity
+	CodeSuccess              = http.StatusOK
+	CodeCreated              = http.StatusCreated        // upserts, see enum.UpdateMissingUpsert
+	CodePartialContent       = http.StatusPartialContent // ranged lists, see RangeUnit
+	CodeNotFound             = http.StatusNotFound
+	CodeBadRequest           = http.StatusBadRequest
+	CodeProcessFailed        = http.StatusUnprocessableEntity
+	CodeUnprocessable        = http.StatusUnprocessableEntity // well-formed but invalid request data
+	CodeConflict             = http.StatusConflict
+	CodeTooManyRequests      = http.StatusTooManyRequests
+	CodeRangeNotSatisfiable  = http.StatusRequestedRangeNotSatisfiable
+	CodeUnsupportedMediaType = http.StatusUnsupportedMediaType // see MergePatchHandler
 )
 
 var (
-	ErrBindFailed      = errors.New("bind failed")
-	ErrMissingID       = errors.New("missing id")
-	ErrMissingParentID = errors.New("missing parent id")
-	ErrUpdateID        = errors.New("id can not be updated")
+	ErrBindFailed            = errors.New("bind failed")
+	ErrMissingID             = errors.New("missing id")
+	ErrMissingParentID       = errors.New("missing parent id")
+	ErrUpdateID              = errors.New("id can not be updated")
+	ErrColumnNotAllowed      = errors.New("column not allowed")
+	ErrExplainNotAllowed     = errors.New("explain not allowed")
+	ErrUnknownField          = errors.New("unknown field")
+	ErrInvalidFilter         = errors.New("invalid filter")
+	ErrOffsetTooLarge        = errors.New("offset too large")
+	ErrOffsetBeyondTotal     = errors.New("offset beyond total")
+	ErrRateLimited           = errors.New("too many requests")
+	ErrInvalidPreloadOrder   = errors.New("invalid preload order")
+	ErrTooManyPreloads       = errors.New("too many preloads")
+	ErrPreloadTooDeep        = errors.New("preload too deep")
+	ErrPreloadWithDeleted    = errors.New("invalid preload_with_deleted")
+	ErrInvalidChildren       = errors.New("invalid children")
+	ErrUnknownFields         = errors.New("unknown fields")
+	ErrInvalidJoin           = errors.New("invalid join")
+	ErrGenericFilterDisabled = errors.New("generic filters disabled")
+	ErrInvalidFields         = errors.New("invalid fields")
+	ErrInvalidFacet          = errors.New("invalid facet")
+	ErrTooManyModels         = errors.New("too many models")
+	ErrDryRunNotAllowed      = errors.New("dry_run_sql not allowed")
+	ErrFilterOpNotAllowed    = errors.New("filter operator not allowed")
+	ErrColumnNotQueryable    = errors.New("column not queryable")
+	ErrInvalidPagination     = errors.New("invalid pagination")
+	ErrInvalidExportFormat   = errors.New("invalid export format")
+	ErrRangeNotSatisfiable   = errors.New("range not satisfiable")
+	ErrDuplicateIDs          = errors.New("duplicate ids")
+	ErrInvalidTotal          = errors.New("invalid total")
+	ErrInvalidDepth          = errors.New("invalid depth")
+	ErrInvalidQuery          = errors.New("invalid query")
+	ErrUnsupportedMediaType  = errors.New("unsupported media type")
+	ErrInvalidReport         = errors.New("invalid report")
+	ErrInvalidPretreat       = errors.New("invalid pretreat result")
 )
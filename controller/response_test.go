@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/orm"
+)
+
+func TestResponseError_RetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d time.Duration) { ConflictRetryAfter = d }(ConflictRetryAfter)
+
+	r := gin.New()
+	r.GET("/conflict", func(c *gin.Context) { ResponseError(c, CodeConflict, ErrDuplicateIDs) })
+	r.GET("/limited", func(c *gin.Context) {
+		ResponseError(c, CodeTooManyRequests, WithRetryAfter(ErrRateLimited, 300*time.Millisecond))
+	})
+	r.GET("/failed", func(c *gin.Context) { ResponseError(c, CodeProcessFailed, ErrDuplicateIDs) })
+
+	tests := []struct {
+		name     string
+		after    time.Duration // ConflictRetryAfter
+		url      string
+		wantCode int
+		want     string
+	}{
+		{"conflict without ConflictRetryAfter", 0, "/conflict", http.StatusConflict, ""},
+		{"conflict rounded up", 1500 * time.Millisecond, "/conflict", http.StatusConflict, "2"},
+		{"wrapped at least 1s", 0, "/limited", http.StatusTooManyRequests, "1"},
+		{"other code", time.Second, "/failed", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConflictRetryAfter = tt.after
+			w := serve(r, http.MethodGet, tt.url, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.want {
+				t.Errorf("Retry-After = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// keyedItem is responded under keys of its own, but the plural.
+type keyedItem struct {
+	orm.BasicModel
+}
+
+func (keyedItem) ResponseKeys() (single, plural string) {
+	return "entry", ""
+}
+
+func TestResponseKeys(t *testing.T) {
+	defer func(key string) { DataKey = key }(DataKey)
+
+	tests := []struct {
+		name       string
+		dataKey    string
+		model      any
+		wantSingle string
+		wantPlural string
+	}{
+		{"type names", "", item{}, "item", "items"},
+		{"pointer", "", &item{}, "item", "items"},
+		{"ResponseKeyer", "", keyedItem{}, "entry", "keyedItems"},
+		{"DataKey", "data", item{}, "data", "data"},
+		{"ResponseKeyer over DataKey", "data", &keyedItem{}, "entry", "data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DataKey = tt.dataKey
+			single, plural := ResponseKeys(reflect.TypeOf(tt.model))
+			if single != tt.wantSingle || plural != tt.wantPlural {
+				t.Errorf("ResponseKeys = %q, %q, want %q, %q", single, plural, tt.wantSingle, tt.wantPlural)
+			}
+
+			// the keys of the responses of the model and of a list of them
+			body := SuccessResponseBody(tt.model)
+			if _, ok := body[tt.wantSingle]; !ok {
+				t.Errorf("SuccessResponseBody(model) = %v, want the key %q", body, tt.wantSingle)
+			}
+			list := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(tt.model)), 0, 0).Interface()
+			if got := getResponseModelName(list); got != tt.wantPlural {
+				t.Errorf("getResponseModelName(list) = %q, want %q", got, tt.wantPlural)
+			}
+		})
+	}
+}
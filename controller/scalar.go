@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	valuerType          = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType         = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// isCustomScalar reports whether the field is of a custom scalar type:
+// one decoded by its json.Unmarshaler or encoding.TextUnmarshaler, or
+// persisted by its driver.Valuer and sql.Scanner, e.g. a duration field
+// bound from "1h30m", or an enum bound from and stored as its name.
+// Times and serialized fields are not: gorm handles them.
+func isCustomScalar(field *schema.Field) bool {
+	if field.FieldType == nil || field.DataType == schema.Time || field.Serializer != nil {
+		return false
+	}
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pt := reflect.PtrTo(t)
+	return pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) ||
+		t.Implements(valuerType) || pt.Implements(scannerType)
+}
+
+// columnValue converts the value of the field from a map body (see
+// UpdateOption.BindMap), as decoded from JSON, into the type of a custom
+// scalar field, by decoding it as the model's JSON does. So that the
+// column is written by the driver.Valuer of the field, instead of the raw
+// JSON value, e.g. "3s" into an int column of durations. Other values
+// and nil are returned as is.
+//
+// The values of the serialized fields (e.g. serializer:json) are decoded
+// as well, and returned as the serializer values of the fields, which gorm
+// does not do for the columns of a map.
+func columnValue(field *schema.Field, value any) (any, error) {
+	serialized := field.Serializer != nil && field.FieldType != nil
+	if value == nil || !(serialized || isCustomScalar(field)) {
+		return value, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(field.FieldType)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBindFailed, field.Name, err)
+	}
+	if !serialized {
+		return v.Elem().Interface(), nil
+	}
+	ctx := context.Background()
+	model := reflect.New(field.Schema.ModelType).Elem()
+	if err := field.Set(ctx, model, v.Elem().Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBindFailed, field.Name, err)
+	}
+	serializer, _ := field.ValueOf(ctx, model) // a driver.Valuer by the serializer
+	return serializer, nil
+}
+
+// scalarFilterValue decodes the filter value into the type of a custom
+// scalar field: by its encoding.TextUnmarshaler, or else as a JSON string
+// or a raw JSON value (e.g. a number) by its JSON decoding. ok is false
+// if the field is not a custom scalar, or the value can not be decoded.
+func scalarFilterValue(field *schema.Field, value string) (v any, ok bool) {
+	if !isCustomScalar(field) {
+		return nil, false
+	}
+	ptr := reflect.New(field.FieldType)
+	if u, isText := ptr.Interface().(encoding.TextUnmarshaler); isText {
+		if u.UnmarshalText([]byte(value)) == nil {
+			return ptr.Elem().Interface(), true
+		}
+		return nil, false
+	}
+	quoted, _ := json.Marshal(value)
+	if json.Unmarshal(quoted, ptr.Interface()) == nil {
+		return ptr.Elem().Interface(), true
+	}
+	ptr = reflect.New(field.FieldType)
+	if json.Unmarshal([]byte(value), ptr.Interface()) == nil {
+		return ptr.Elem().Interface(), true
+	}
+	return nil, false
+}
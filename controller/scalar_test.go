@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+)
+
+// timeout is a duration stored as nanoseconds, in JSON as "1m30s".
+type timeout time.Duration
+
+func (d timeout) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *timeout) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = timeout(v)
+	return err
+}
+
+// priority is an enum stored and in JSON as its name.
+type priority int
+
+var priorities = []string{"low", "high"}
+
+func parsePriority(v any) (priority, error) {
+	s := fmt.Sprint(v)
+	if b, ok := v.([]byte); ok {
+		s = string(b)
+	}
+	for i, name := range priorities {
+		if name == s {
+			return priority(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid priority %q", s)
+}
+
+func (p priority) MarshalJSON() ([]byte, error) { return json.Marshal(priorities[p]) }
+
+func (p *priority) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*p, err = parsePriority(s)
+	return err
+}
+
+func (p priority) Value() (driver.Value, error) { return priorities[p], nil }
+
+func (p *priority) Scan(v any) (err error) {
+	*p, err = parsePriority(v)
+	return err
+}
+
+type job struct {
+	orm.BasicModel
+	Timeout  timeout  `json:"timeout"`
+	Priority priority `json:"priority" gorm:"type:text"`
+}
+
+func TestHandlers_CustomScalars(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&job{}); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/jobs", CreateHandler[job](&enum.CreateOption{Enable: true}))
+	r.GET("/jobs", GetListHandler[job](&enum.ListOption{Enable: true, LimitMax: 10}))
+	r.GET("/jobs/:id", GetByIDHandler[job]("id", &enum.GetOption{Enable: true}))
+	r.PATCH("/jobs/:id", UpdateHandler[job]("id", &enum.UpdateOption{Enable: true, BindMap: true}))
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", http.MethodPost, "/jobs", `{"timeout": "1m30s", "priority": "high"}`, http.StatusOK, `"timeout":"1m30s","priority":"high"`},
+		{"get", http.MethodGet, "/jobs/1", ``, http.StatusOK, `"timeout":"1m30s","priority":"high"`},
+		{"update map", http.MethodPatch, "/jobs/1", `{"timeout": "3s", "priority": "low"}`, http.StatusOK, `"timeout":"3s","priority":"low"`},
+		{"get updated", http.MethodGet, "/jobs/1", ``, http.StatusOK, `"timeout":"3s","priority":"low"`},
+		{"update map invalid", http.MethodPatch, "/jobs/1", `{"priority": "urgent"}`, http.StatusBadRequest, `invalid priority`},
+		{"filter duration", http.MethodGet, "/jobs?filters[timeout]=3s", ``, http.StatusOK, `"timeout":"3s"`},
+		{"filter enum", http.MethodGet, "/jobs?filters[priority]=low", ``, http.StatusOK, `"priority":"low"`},
+		{"filter enum unmatched", http.MethodGet, "/jobs?filters[priority]=high", ``, http.StatusOK, `"jobs":[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want containing %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	var stored struct {
+		Timeout  int64
+		Priority string
+	}
+	if err := orm.DB.Table("jobs").Select("timeout, priority").Take(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Timeout != int64(3*time.Second) || stored.Priority != "low" {
+		t.Errorf("stored = %+v, want {Timeout:%d Priority:low}", stored, int64(3*time.Second))
+	}
+}
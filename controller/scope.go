@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+// ScopeByParams returns a copy of opt with all the operations on model T
+// scoped by the path params (param name => column of T), see
+// enum.CurdOption.ParamFilters:
+//   - list, get, count, facets, update, delete, replace, restore, touch and
+//     get-or-create are filtered by WHERE column = :param, via their
+//     QueryOptionClosure;
+//   - create (and update, get-or-create) sets the column of the model to
+//     :param, via their Pretreat: the model can not be moved out of the scope.
+//
+// It panics if a column is unknown to T.
+func ScopeByParams[T orm.Model](opt *enum.CurdOption, params map[string]string) *enum.CurdOption {
+	scoped := *opt
+	if len(params) == 0 {
+		return &scoped
+	}
+
+	fields := make(map[string]*schema.Field, len(params))
+	for param, column := range params {
+		field, err := orm.LookUpField(new(T), column)
+		if err != nil {
+			panic(fmt.Sprintf("ScopeByParams: param %s: %v", param, err))
+		}
+		fields[param] = field
+	}
+
+	filter := func(c *gin.Context) enum.QueryOption {
+		var options []enum.QueryOption
+		for param, field := range fields {
+			options = append(options, service.FilterBy(field.DBName, c.Param(param)))
+		}
+		return chainOptions(options...)
+	}
+	scope := func(closure enum.QueryOptionClosure) enum.QueryOptionClosure {
+		return func(c *gin.Context, request enum.GetRequestOptions) enum.QueryOption {
+			if closure == nil {
+				return filter(c)
+			}
+			return chainOptions(filter(c), closure(c, request))
+		}
+	}
+	// set always sets the fields of the model (T or map[string]any) to the
+	// params, before the original pretreat.
+	set := func(pretreat enum.Pretreat) enum.Pretreat {
+		return func(c *gin.Context, model any) (any, error) {
+			var err error
+			if model, err = setParamFields(c, model, fields); err != nil {
+				return nil, err
+			}
+			if pretreat == nil {
+				return model, nil
+			}
+			return pretreat(c, model)
+		}
+	}
+
+	scoped.ListOption.QueryOptionClosure = scope(opt.ListOption.QueryOptionClosure)
+	scoped.GetOption.QueryOptionClosure = scope(opt.GetOption.QueryOptionClosure)
+	scoped.UpdateOption.QueryOptionClosure = scope(opt.UpdateOption.QueryOptionClosure)
+	scoped.DelOption.QueryOptionClosure = scope(opt.DelOption.QueryOptionClosure)
+	scoped.ReplaceOption.QueryOptionClosure = scope(opt.ReplaceOption.QueryOptionClosure)
+	scoped.RestoreOption.QueryOptionClosure = scope(opt.RestoreOption.QueryOptionClosure)
+	scoped.ArchiveOption.QueryOptionClosure = scope(opt.ArchiveOption.QueryOptionClosure)
+	scoped.TouchOption.QueryOptionClosure = scope(opt.TouchOption.QueryOptionClosure)
+	scoped.ReorderOption.QueryOptionClosure = scope(opt.ReorderOption.QueryOptionClosure)
+	if opt.FacetOption.QueryOptionClosure != nil { // else defaults to the scoped ListOption's
+		scoped.FacetOption.QueryOptionClosure = scope(opt.FacetOption.QueryOptionClosure)
+	}
+	if opt.ExportOption.QueryOptionClosure != nil { // else defaults to the scoped ListOption's
+		scoped.ExportOption.QueryOptionClosure = scope(opt.ExportOption.QueryOptionClosure)
+	}
+	scoped.CreateOption.Pretreat = set(opt.CreateOption.Pretreat)
+	scoped.UpdateOption.Pretreat = set(opt.UpdateOption.Pretreat)
+	scoped.GetOrCreateOption.QueryOptionClosure = scope(opt.GetOrCreateOption.QueryOptionClosure)
+	scoped.GetOrCreateOption.Pretreat = set(opt.GetOrCreateOption.Pretreat)
+	return &scoped
+}
+
+// setParamFields sets the fields (by the param names) of the model,
+// which is a struct (not a pointer), or a map of column => value.
+func setParamFields(c *gin.Context, model any, fields map[string]*schema.Field) (any, error) {
+	if m, ok := model.(map[string]any); ok {
+		for param, field := range fields {
+			structure := reflect.New(field.Schema.ModelType).Elem().Interface()
+			for key := range m { // any name of the field: json, column, ...
+				if name, err := NameToField(key, structure); err == nil && name == field.Name {
+					delete(m, key)
+				}
+			}
+			m[field.DBName] = c.Param(param)
+		}
+		return m, nil
+	}
+
+	ptr := reflect.New(reflect.TypeOf(model))
+	ptr.Elem().Set(reflect.ValueOf(model))
+	for param, field := range fields {
+		// Field.Set converts the string param to the type of the field.
+		if err := field.Set(c, ptr.Elem(), c.Param(param)); err != nil {
+			return nil, fmt.Errorf("%w: path param %s: %v", gorm.ErrInvalidData, param, err)
+		}
+	}
+	return ptr.Elem().Interface(), nil
+}
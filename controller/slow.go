@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
+)
+
+// SlowOperation is a CRUD operation exceeding its slow threshold (see
+// CurdOption.SlowThreshold), as logged and given to OnSlowOperation.
+type SlowOperation struct {
+	Operation string        // e.g. list, get, create, see router.Resource
+	Model     string        // the model type, e.g. User
+	Method    string        // of the request, e.g. GET
+	Path      string        // of the request, e.g. /users
+	Status    int           // the response code
+	Duration  time.Duration // of the handler
+	Threshold time.Duration
+	Params    url.Values // the query params: the filters, orders, pagination...
+	// Queries are the statements of the operation, with their durations.
+	Queries []orm.TracedStatement
+}
+
+// OnSlowOperation is called (if not nil) for each SlowOperation, after it
+// is logged, e.g. to alert on it or to count it in metrics:
+//
+//	controller.OnSlowOperation = func(c *gin.Context, slow controller.SlowOperation) {
+//	    slowOperations.WithLabelValues(slow.Model, slow.Operation).Inc()
+//	}
+var OnSlowOperation func(c *gin.Context, slow SlowOperation)
+
+// SlowOperationLogger returns the middleware timing the rest of the
+// handlers of an operation of the model, which logs a warning with the
+// operation, the model, the duration, the params and the queries (with
+// their durations) if the threshold is exceeded.
+func SlowOperationLogger(operation string, model string, threshold time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trace := new(orm.QueryTrace)
+		reqctx.Set(c, orm.KeyQueryTrace, trace)
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		if elapsed < threshold {
+			return
+		}
+
+		slow := SlowOperation{
+			Operation: operation,
+			Model:     model,
+			Status:    c.Writer.Status(),
+			Duration:  elapsed,
+			Threshold: threshold,
+			Queries:   trace.Statements(),
+		}
+		if c.Request != nil {
+			slow.Method = c.Request.Method
+			slow.Path = c.Request.URL.Path
+			slow.Params = c.Request.URL.Query() // rewritten by QueryHandler, if any
+		}
+		logger.WithContext(c).
+			WithField("operation", slow.Operation).
+			WithField("model", slow.Model).
+			WithField("method", slow.Method).
+			WithField("path", slow.Path).
+			WithField("status", slow.Status).
+			WithField("duration", slow.Duration).
+			WithField("threshold", slow.Threshold).
+			WithField("params", slow.Params).
+			WithField("queries", slow.Queries).
+			Warn("SlowOperationLogger: slow operation")
+		if OnSlowOperation != nil {
+			OnSlowOperation(c, slow)
+		}
+	}
+}
@@ -1,12 +1,21 @@
 package controller
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/spf13/cast"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/log"
 	"github.com/tqrj/cd/orm"
 	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
 )
 
 // UpdateHandler handles
@@ -18,12 +27,30 @@ import (
 // Request body:
 //   - {"field": "new_value", ...}   // fields to update
 //
+// The body is bound onto the current record, which is saved with all its
+// columns. With opt.BindMap, only the fields in the body are written
+// (see updateColumns): e.g. to set a field to zero while others are
+// being updated concurrently.
+//
 // Response:
-//   - 200 OK: { updated: true }
+//   - 200 OK: { T: {...}, meta: { rows_affected: 1 } }
+//   - 200 OK: { T: {...}, meta: { rows_affected: 0, unchanged: true } }  // see UpdateOption.SkipUnchanged
+//   - 200 OK: { dry_run_sql: [...] }  // for ?dry_run_sql=true, see UpdateOption.AllowDryRunSQL
+//   - 201 Created: { T: {...}, meta: { rows_affected: 1, id: 1, created: true } }  // see enum.UpdateMissingUpsert
+//   - 204 No Content: for "Prefer: return=minimal"
 //   - 400 Bad Request: { error: "missing id or bind fields failed" }
-//   - 404 Not Found: { error: "record with id not found" }
-//   - 422 Unprocessable Entity: { error: "update process failed" }
+//   - 404 Not Found: { error: "record with id not found" }  // see UpdateOption.Missing
+//   - 409 Conflict: { error: "record has been modified since last seen" }  // see UpdateOption.CheckUpdatedAt
+//   - 409 Conflict: { error: "duplicate record: by ...", T: {...}, duplicate: {...} }  // see orm.UniqueKeyer
+//   - 422 Unprocessable Entity: { error: "validation or update process failed" }
 func UpdateHandler[T orm.Model](idParam string, opt *enum.UpdateOption) gin.HandlerFunc {
+	return updateHandler[T](idParam, opt, false)
+}
+
+// updateHandler is the UpdateHandler, or the MergePatchHandler with
+// mergePatch (and opt.BindMap).
+func updateHandler[T orm.Model](idParam string, opt *enum.UpdateOption, mergePatch bool) gin.HandlerFunc {
+	mustUniqueKeys[T]("UpdateHandler")
 	return func(c *gin.Context) {
 		var model T
 
@@ -41,18 +68,43 @@ func UpdateHandler[T orm.Model](idParam string, opt *enum.UpdateOption) gin.Hand
 			ResponseError(c, CodeBadRequest, ErrMissingID)
 			return
 		}
-		if err := service.GetByID[T](c, id, &model); err != nil {
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, enum.GetRequestOptions{}))
+		}
+		session, dryRun, err := dryRunSQL(c, opt.AllowDryRunSQL, opt.Session)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("UpdateHandler: dryRunSQL failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		err = service.GetByID[T](c, id, &model, options...)
+		updateOpt := *opt
+		updateOpt.Session = session
+		if errors.Is(err, gorm.ErrRecordNotFound) && upsertable[T](c, id, &updateOpt, options) {
+			upsertModel[T](c, id, &updateOpt, dryRun)
+			return
+		}
+		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("UpdateHandler: GetByID failed")
 			ResponseError(c, CodeNotFound, err)
 			return
 		}
+		opt := &updateOpt
+
+		if opt.BindMap {
+			updateColumns(c, &model, opt, dryRun, mergePatch)
+			return
+		}
 
-		var updatedModel = model
-		if err := c.ShouldBindJSON(&updatedModel); err != nil {
+		// bound onto a deep copy: the model loaded is kept for changedFields
+		var updatedModel = deepCopy(model)
+		if err := bindJSON(c, &updatedModel, opt.DisallowUnknownFields); err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("UpdateHandler: Bind failed")
-			ResponseError(c, CodeBadRequest, err)
+			ResponseError(c, getBindErrorCode(err), err)
 			return
 		}
 		if opt.Pretreat != nil {
@@ -79,13 +131,809 @@ func UpdateHandler[T orm.Model](idParam string, opt *enum.UpdateOption) gin.Hand
 			return
 		}
 
-		_, err := service.Update(c, &updatedModel, opt)
+		var rowsAffected int64
+		if opt.CheckUpdatedAt {
+			rowsAffected, err = service.UpdateIfUnmodified(c, &updatedModel, ifMatch(c), opt)
+		} else {
+			rowsAffected, err = service.Update(c, &updatedModel, opt)
+		}
 		if err != nil {
 			logger.WithContext(c).WithError(err).
 				Warn("UpdateHandler: Update failed")
+			ResponseError(c, updateErrorCode(err), withDuplicate[T](c, withValidation(err), opt.QueryOptionClosure))
+			return
+		}
+		if dryRun != nil {
+			responseDryRun(c, dryRun)
+			return
+		}
+		if preferReturnMinimal(c) {
+			responseMinimal(c, "")
+			return
+		}
+		meta := new(Meta).SetRowsAffected(rowsAffected).
+			SetChanged(changedFields(&model, &updatedModel)).
+			SetUnchanged(opt.SkipUnchanged && rowsAffected == 0)
+		ResponseSuccess(c, &updatedModel, meta.H())
+	}
+}
+
+// updateColumns is the UpdateHandler with opt.BindMap: it binds the body
+// into a map, resolves its keys (field names, json or column names) into
+// the columns of the model, and updates only these columns.
+// The dryRun recorder is not nil for the dry runs (see dryRunSQL). With
+// mergePatch, the objects of the body are merged into the current values
+// of their columns (see mergePatchValue).
+func updateColumns[T orm.Model](c *gin.Context, model *T, opt *enum.UpdateOption, dryRun *service.SQLRecorder, mergePatch bool) {
+	var body map[string]any
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: Bind map failed")
+		ResponseError(c, CodeBadRequest, err)
+		return
+	}
+	if opt.Pretreat != nil {
+		res, err := opt.Pretreat(c, body)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("UpdateHandler: Pretreat err")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		var ok bool
+		if body, ok = res.(map[string]any); !ok {
+			logger.WithContext(c).WithField("result", fmt.Sprintf("%T", res)).
+				Warn("UpdateHandler: Pretreat result is not a map")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %T, want map[string]any", ErrInvalidPretreat, res))
+			return
+		}
+	}
+
+	idField, id := (*model).Identity()
+	lastSeen := ifMatch(c)
+	columns := make(map[string]any, len(body))
+	for key, value := range body {
+		field, err := NameToField(key, *model)
+		if err != nil {
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if field == idField {
+			if cast.ToString(value) != cast.ToString(id) {
+				ResponseError(c, CodeBadRequest, ErrUpdateID)
+				return
+			}
+			continue
+		}
+		f, err := orm.LookUpField(model, field)
+		if err != nil {
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if Contains(opt.Omit, field) || Contains(opt.Omit, f.DBName) {
+			continue
+		}
+		if opt.CheckUpdatedAt && f.AutoUpdateTime > 0 { // the last seen, not to be written
+			if lastSeen == nil {
+				lastSeen = value
+			}
+			continue
+		}
+		if mergePatch {
+			if value, err = mergePatchValue(c, f, model, value); err != nil {
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+		}
+		if columns[f.DBName], err = columnValue(f, value); err != nil {
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+	}
+
+	before := deepCopy(*model)
+	var rowsAffected int64
+	var err error
+	if opt.CheckUpdatedAt {
+		rowsAffected, err = service.UpdateColumnsIfUnmodified(c, model, columns, lastSeen, opt)
+	} else {
+		rowsAffected, err = service.UpdateColumns(c, model, columns, opt)
+	}
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: UpdateColumns failed")
+		ResponseError(c, updateErrorCode(err), withDuplicate[T](c, withValidation(err), opt.QueryOptionClosure))
+		return
+	}
+	if dryRun != nil {
+		responseDryRun(c, dryRun)
+		return
+	}
+	if preferReturnMinimal(c) {
+		responseMinimal(c, "")
+		return
+	}
+
+	var updatedModel T
+	if err := service.GetByID[T](c, id, &updatedModel); err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: GetByID updated failed")
+		ResponseError(c, CodeProcessFailed, err)
+		return
+	}
+	meta := new(Meta).SetRowsAffected(rowsAffected).
+		SetChanged(changedFields(&before, &updatedModel)).
+		SetUnchanged(opt.SkipUnchanged && rowsAffected == 0)
+	ResponseSuccess(c, &updatedModel, meta.H())
+}
+
+// upsertable reports whether the missing id is to be created by the
+// update, see enum.UpdateMissingUpsert: not for the ids existing out of
+// the scope of the options, nor for the conditional updates.
+func upsertable[T orm.Model](c *gin.Context, id string, opt *enum.UpdateOption, options []enum.QueryOption) bool {
+	if opt.Missing != enum.UpdateMissingUpsert || ifMatch(c) != nil {
+		return false
+	}
+	if len(options) > 0 {
+		err := service.GetByID[T](c, id, new(T))
+		return errors.Is(err, gorm.ErrRecordNotFound)
+	}
+	return true
+}
+
+// upsertModel is the UpdateHandler of a missing id with
+// enum.UpdateMissingUpsert: it creates the model of the body with the id.
+func upsertModel[T orm.Model](c *gin.Context, id string, opt *enum.UpdateOption, dryRun *service.SQLRecorder) {
+	var model T
+	if opt.BindMap {
+		var body map[string]any
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("UpdateHandler: Bind map failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if opt.Pretreat != nil {
+			res, err := opt.Pretreat(c, body)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("UpdateHandler: Pretreat err")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			var ok bool
+			if body, ok = res.(map[string]any); !ok {
+				logger.WithContext(c).WithField("result", fmt.Sprintf("%T", res)).
+					Warn("UpdateHandler: Pretreat result is not a map")
+				ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %T, want map[string]any", ErrInvalidPretreat, res))
+				return
+			}
+		}
+		if err := bindMapModel(c, body, &model); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("UpdateHandler: Bind upsert failed")
+			ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %v", ErrBindFailed, err))
+			return
+		}
+	} else {
+		if err := bindJSON(c, &model, opt.DisallowUnknownFields); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("UpdateHandler: Bind failed")
+			ResponseError(c, getBindErrorCode(err), err)
+			return
+		}
+		if opt.Pretreat != nil {
+			res, err := opt.Pretreat(c, model)
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("UpdateHandler: Pretreat err")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			var ok bool
+			if model, ok = res.(T); !ok {
+				logger.WithContext(c).WithField("result", fmt.Sprintf("%T", res)).
+					Warn("UpdateHandler: Pretreat result is not a T")
+				ResponseError(c, CodeBadRequest, fmt.Errorf("%w: %T, want %T", ErrInvalidPretreat, res, model))
+				return
+			}
+		}
+	}
+
+	idField, bodyID := model.Identity()
+	value, err := coerceFilterValue(idField, id, model)
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: invalid id")
+		ResponseError(c, CodeBadRequest, err)
+		return
+	}
+	if !reflect.ValueOf(bodyID).IsZero() && cast.ToString(bodyID) != id {
+		logger.WithContext(c).WithField("id", id).
+			WithField("bodyID", bodyID).
+			Warn("UpdateHandler: id mismatch: cannot update id")
+		ResponseError(c, CodeBadRequest, ErrUpdateID)
+		return
+	}
+	field, err := orm.LookUpField(&model, idField)
+	if err == nil {
+		err = field.Set(c, reflect.ValueOf(&model).Elem(), value)
+	}
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: set id failed")
+		ResponseError(c, CodeBadRequest, err)
+		return
+	}
+
+	log.Logger.Tracef("UpdateHandler: Upsert %#v, id=%v", model, id)
+	createOpt := enum.CreateOption{Omit: opt.Omit, Session: opt.Session, UniqueBy: opt.UniqueBy, Retry: opt.Retry}
+	err = service.Create(c, &model, &createOpt, service.IfNotExist())
+	if errors.Is(err, service.ErrDuplicate) {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: upsert duplicate")
+		ResponseError(c, CodeConflict, withDuplicate[T](c, err, opt.QueryOptionClosure))
+		return
+	}
+	if err != nil {
+		logger.WithContext(c).WithError(err).
+			Warn("UpdateHandler: upsert Create failed")
+		ResponseError(c, CodeProcessFailed, withValidation(err))
+		return
+	}
+	if dryRun != nil {
+		responseDryRun(c, dryRun)
+		return
+	}
+	if preferReturnMinimal(c) {
+		responseMinimal(c, c.Request.URL.Path)
+		return
+	}
+	meta := new(Meta).SetRowsAffected(1).SetID(value).SetCreated(true)
+	responseSuccess(c, CodeCreated, &model, meta.H())
+}
+
+// bindMapModel binds the body map of a BindMap upsert onto the model. The
+// keys are any names of the fields (as of the updates of the columns,
+// e.g. the column names set by ScopeByParams), bound by the JSON names of
+// the fields, except the values of the fields out of the JSON and the
+// string values of the numeric or bool fields (e.g. the path params),
+// which are set (and converted) by the schema fields.
+func bindMapModel[T any](c *gin.Context, body map[string]any, model *T) error {
+	t := reflect.TypeOf(model).Elem()
+	byJSON := make(map[string]any, len(body))
+	bySchema := map[string]any{}
+	for key, value := range body {
+		name, err := NameToField(key, *model)
+		if err != nil {
+			byJSON[key] = value // unknown: ignored as by the JSON of T
+			continue
+		}
+		f, _ := t.FieldByName(name)
+		jsonName, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if _, isString := value.(string); jsonName == "-" || isString && isNumericOrBool(f.Type) {
+			bySchema[name] = value
+			continue
+		}
+		if jsonName == "" {
+			jsonName = name
+		}
+		byJSON[jsonName] = value
+	}
+
+	data, err := json.Marshal(byJSON)
+	if err == nil {
+		err = json.Unmarshal(data, model)
+	}
+	if err != nil {
+		return err
+	}
+	for name, value := range bySchema {
+		field, err := orm.LookUpField(model, name)
+		if err == nil {
+			err = field.Set(c, reflect.ValueOf(model).Elem(), value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// isNumericOrBool reports whether t (or the type it points to) is of a
+// numeric or bool kind.
+func isNumericOrBool(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// ifMatch returns the update time the client has last seen by the If-Match
+// header (e.g. If-Match: "2023-01-02T15:04:05.123Z"), or nil if there is
+// none, for UpdateOption.CheckUpdatedAt.
+func ifMatch(c *gin.Context) any {
+	tag := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/")
+	if tag = strings.Trim(tag, `"`); tag == "" || tag == "*" {
+		return nil
+	}
+	return tag
+}
+
+// updateErrorCode returns the response code for errors from the update
+// services: CodeConflict for the records modified since last seen, or
+// duplicating the unique keys of others.
+func updateErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConflict), errors.Is(err, service.ErrDuplicate):
+		return CodeConflict
+	case errors.Is(err, service.ErrInvalidLastSeen):
+		return CodeBadRequest
+	}
+	return CodeProcessFailed
+}
+
+// changedFields returns the JSON names of the column fields whose values
+// differ between the before and after (pointers to) models. The update
+// time fields (e.g. UpdatedAt), which are always changed, are excluded.
+func changedFields(before, after any) []string {
+	s, err := orm.ParseSchema(before)
+	if err != nil {
+		return nil
+	}
+	vBefore := reflect.ValueOf(before).Elem()
+	vAfter := reflect.ValueOf(after).Elem()
+
+	changed := []string{}
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.AutoUpdateTime > 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		a, _ := field.ValueOf(context.Background(), vBefore)
+		b, _ := field.ValueOf(context.Background(), vAfter)
+		if !service.EqualValues(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// deepCopy returns a copy of model sharing nothing with it through the
+// pointers, slices and maps of its exported fields, so that the writes
+// into the copy (e.g. by the JSON binding) leave model as it is.
+func deepCopy[T any](model T) T {
+	return copyValue(reflect.ValueOf(&model).Elem()).Interface().(T)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	copied := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				copied.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			copied.Set(reflect.New(v.Type().Elem()))
+			copied.Elem().Set(copyValue(v.Elem()))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			copied.Set(copyValue(v.Elem()))
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			copied.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				copied.Index(i).Set(copyValue(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(copyValue(v.Index(i)))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			copied.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			for iter := v.MapRange(); iter.Next(); {
+				copied.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+			}
+		}
+	default:
+		copied.Set(v)
+	}
+	return copied
+}
+
+// ReplaceHandler handles
+//
+//	POST /T/replace?filters[column]=value
+//
+// Replaces values of a column of all models T matching the filters, which
+// are required to bound the operation. See service.ReplaceColumn.
+//
+// Request body: (See enum.ReplaceRequest for more details)
+//   - {"column": "status", "from": "canceled", "to": "cancelled"}
+//
+// Response:
+//   - 200 OK: { meta: { rows_affected: 3 } }  // and affected_ids: [...] by report=ids, see ReportIDs
+//   - 400 Bad Request: { error: "bind failed, no filter or invalid report" }
+//   - 422 Unprocessable Entity: { error: "validation or replace process failed" }
+func ReplaceHandler[T any](opt *enum.ReplaceOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		var body enum.ReplaceRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceHandler: Bind failed")
+			ResponseError(c, getBindErrorCode(err), err)
+			return
+		}
+		if len(opt.Columns) > 0 && !Contains(opt.Columns, body.Column) {
+			logger.WithContext(c).WithField("column", body.Column).
+				Warn("ReplaceHandler: column not allowed")
+			ResponseError(c, CodeBadRequest, ErrColumnNotAllowed)
+			return
+		}
+
+		options, err := filterOptions(request, *new(T))
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceHandler: filterOptions failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if len(options) == 0 {
+			logger.WithContext(c).
+				Warn("ReplaceHandler: no filter to bound the operation")
+			ResponseError(c, CodeBadRequest, service.ErrNoFilter)
+			return
+		}
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+		affected, err := reportAffected(c, request)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceHandler: reportAffected failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		rowsAffected, err := service.ReplaceColumn[T](c, body.Column, body.From, body.To, body.Substring, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceHandler: ReplaceColumn failed")
 			ResponseError(c, CodeProcessFailed, err)
 			return
 		}
-		ResponseSuccess(c, &updatedModel)
+		ResponseSuccess(c, nil, affectedMeta(rowsAffected, affected).H())
+	}
+}
+
+// TouchHandler handles
+//
+//	POST /T/:idParam/touch
+//
+// Bumps the updated_at of the model T with the given id to now, without
+// changing any data (e.g. for cache invalidation). See service.Touch.
+//
+// Request body: none
+//
+// Response:
+//   - 200 OK: { T: {...}, meta: { rows_affected: 1 } }  // the touched model
+//   - 400 Bad Request: { error: "missing id or model has no updated_at" }
+//   - 404 Not Found: { error: "record with id not found" }
+//   - 422 Unprocessable Entity: { error: "touch process failed" }
+func TouchHandler[T orm.Model](idParam string, opt *enum.TouchOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("TouchHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+
+		model, err := getModelByID[T](c, idParam, options...)
+		if errors.Is(err, ErrMissingID) {
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("TouchHandler: getModelByID failed")
+			code := CodeProcessFailed
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				code = CodeNotFound
+			}
+			ResponseError(c, code, err)
+			return
+		}
+
+		rowsAffected, err := service.Touch(c, model)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("TouchHandler: Touch failed")
+			code := CodeProcessFailed
+			if errors.Is(err, service.ErrNotTouchable) {
+				code = CodeBadRequest
+			}
+			ResponseError(c, code, err)
+			return
+		}
+		ResponseSuccess(c, model, new(Meta).SetRowsAffected(rowsAffected).H())
+	}
+}
+
+// ReorderHandler handles
+//
+//	POST /T/reorder
+//
+// Sets the position column of the models T in the order of the ids, and
+// renumbers the list (of the ReorderOption.ParentColumn, if any) compactly
+// from 1. See service.Reorder.
+//
+// Request body: (See enum.ReorderRequest for more details)
+//   - {"ids": [3, 1, 2]}
+//
+// Response:
+//   - 200 OK: { meta: { rows_affected: 3 } }
+//   - 400 Bad Request: { error: "bind failed, duplicate ids or multiple parents" }
+//   - 404 Not Found: { error: "some of the ids not found" }
+//   - 422 Unprocessable Entity: { error: "reorder process failed" }
+func ReorderHandler[T orm.Model](opt *enum.ReorderOption) gin.HandlerFunc {
+	column := opt.Column
+	if column == "" {
+		column = "position"
+	}
+	for _, name := range []string{column, opt.ParentColumn} {
+		if name == "" {
+			continue
+		}
+		if _, err := orm.LookUpField(new(T), name); err != nil {
+			panic(fmt.Sprintf("ReorderHandler: %v", err))
+		}
+	}
+	idField, _ := (*new(T)).Identity()
+
+	return func(c *gin.Context) {
+		request, err := bindGetRequest(c)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReorderHandler: bind request failed")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+
+		var body enum.ReorderRequest
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.UseNumber() // large ids as is
+		if err = decoder.Decode(&body); err == nil {
+			err = binding.Validator.ValidateStruct(&body)
+		}
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReorderHandler: Bind failed")
+			ResponseError(c, getBindErrorCode(err), err)
+			return
+		}
+		if opt.LimitMax > 0 && len(body.IDs) > opt.LimitMax {
+			err := fmt.Errorf("%w: %d > %d", ErrTooManyModels, len(body.IDs), opt.LimitMax)
+			logger.WithContext(c).WithError(err).
+				Warn("ReorderHandler: too many ids")
+			ResponseError(c, CodeBadRequest, err)
+			return
+		}
+		ids := make([]any, 0, len(body.IDs))
+		seen := map[string]bool{}
+		for _, id := range body.IDs {
+			s := fmt.Sprint(id)
+			if seen[s] {
+				err := fmt.Errorf("%w: %s", ErrDuplicateIDs, s)
+				logger.WithContext(c).WithError(err).
+					Warn("ReorderHandler: duplicate id")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			seen[s] = true
+			v, err := coerceFilterValue(idField, s, *new(T))
+			if err != nil {
+				logger.WithContext(c).WithError(err).
+					Warn("ReorderHandler: invalid id")
+				ResponseError(c, CodeBadRequest, err)
+				return
+			}
+			ids = append(ids, v)
+		}
+
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, request))
+		}
+
+		rowsAffected, err := service.Reorder[T](c, column, opt.ParentColumn, ids, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReorderHandler: Reorder failed")
+			code := getErrorCode(err)
+			switch {
+			case errors.Is(err, service.ErrNoRecord):
+				code = CodeNotFound
+			case errors.Is(err, service.ErrMultipleParents):
+				code = CodeBadRequest
+			}
+			ResponseError(c, code, err)
+			return
+		}
+		ResponseSuccess(c, nil, new(Meta).SetRowsAffected(rowsAffected).H())
+	}
+}
+
+// ReplaceNestedHandler handles
+//
+//	PUT /P/:parentIdParam/field
+//
+// Replaces the to-many associations (field) of the parent model P with
+// exactly the children in the body (a full sync, unlike the POST and
+// DELETE of the nested routes), see service.ReplaceAssociations. The
+// parent and the children given by ids are looked up in the scope of the
+// opt.QueryOptionClosure: the ones out of it are not found.
+//
+// Request body: a list of ids and / or child models T:
+//   - [1, 2, 3]                      // existing children by id
+//   - [{"ID": 1}, {"name": "new"}]   // children with ids are linked (not updated), others are created
+//   - []                             // removes all
+//
+// Response:
+//   - 200 OK: { P: {...}, meta: { rows_affected: 3 } }  // with the replaced field, rows_affected: the children linked, created and unlinked
+//   - 400 Bad Request: { error: "missing id, bind failed or not a to-many association" }
+//   - 404 Not Found: { error: "parent or child not found" }
+//   - 422 Unprocessable Entity: { error: "validation or replace process failed" }
+func ReplaceNestedHandler[P orm.Model, T orm.Model](parentIdParam string, field string, opt *enum.UpdateOption) gin.HandlerFunc {
+	field = mustAssociation(field, *new(P))
+
+	return func(c *gin.Context) {
+		parentID := c.Param(parentIdParam)
+		if parentID == "" {
+			ResponseError(c, CodeBadRequest, ErrMissingParentID)
+			return
+		}
+
+		var options []enum.QueryOption
+		if opt.QueryOptionClosure != nil {
+			options = append(options, opt.QueryOptionClosure(c, enum.GetRequestOptions{}))
+		}
+
+		children, err := bindChildren[T](c, options...)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceNestedHandler: bind children failed")
+			code := getBindErrorCode(err)
+			if errors.Is(err, service.ErrNoRecord) {
+				code = CodeNotFound
+			}
+			ResponseError(c, code, err)
+			return
+		}
+
+		var parent P
+		if err := service.GetByID[P](c, parentID, &parent, options...); err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceNestedHandler: GetByID[Parent] failed")
+			code := CodeProcessFailed
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				code = CodeNotFound
+			}
+			ResponseError(c, code, err)
+			return
+		}
+
+		rowsAffected, err := service.ReplaceAssociations(c, &parent, field, children, opt)
+		if err != nil {
+			logger.WithContext(c).WithError(err).
+				Warn("ReplaceNestedHandler: ReplaceAssociations failed")
+			ResponseError(c, getErrorCode(err), err)
+			return
+		}
+		ResponseSuccess(c, parent, new(Meta).SetRowsAffected(rowsAffected).H())
+	}
+}
+
+// bindChildren binds the body of ids and / or models into the children:
+// the ones given by ids (or models with ids) are loaded from the database
+// (by the options, e.g. the scope of the route), and it fails with
+// service.ErrNoRecord if any of them is not found.
+func bindChildren[T orm.Model](c *gin.Context, options ...enum.QueryOption) ([]*T, error) {
+	var elements []json.RawMessage
+	if err := c.ShouldBindJSON(&elements); err != nil {
+		return nil, err
+	}
+	idField, _ := (*new(T)).Identity()
+
+	var children []*T
+	var ids []any
+	seen := map[string]bool{}
+	addID := func(id string) error {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		v, err := coerceFilterValue(idField, id, *new(T))
+		ids = append(ids, v)
+		return err
+	}
+	for _, element := range elements {
+		element = bytes.TrimSpace(element)
+		if len(element) > 0 && element[0] == '{' {
+			child := new(T)
+			if err := json.Unmarshal(element, child); err != nil {
+				return nil, err
+			}
+			if _, id := (*child).Identity(); !reflect.ValueOf(id).IsZero() {
+				if err := addID(fmt.Sprint(id)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := binding.Validator.ValidateStruct(child); err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+			continue
+		}
+		var id any
+		decoder := json.NewDecoder(bytes.NewReader(element))
+		decoder.UseNumber()
+		if err := decoder.Decode(&id); err != nil {
+			return nil, err
+		}
+		switch id.(type) {
+		case json.Number, string:
+		default:
+			return nil, fmt.Errorf("%w: invalid id %s", ErrInvalidChildren, element)
+		}
+		if err := addID(fmt.Sprint(id)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) > 0 {
+		var existing []*T
+		if err := service.GetMany[T](c, &existing, append(options, service.FilterIn(idField, ids))...); err != nil {
+			return nil, err
+		}
+		if len(existing) != len(ids) {
+			return nil, fmt.Errorf("%w: %d of %d children found", service.ErrNoRecord, len(existing), len(ids))
+		}
+		children = append(existing, children...)
 	}
+	return children, nil
 }
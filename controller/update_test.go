@@ -0,0 +1,464 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
+	"github.com/tqrj/cd/service/servicetest"
+	"gorm.io/gorm"
+)
+
+type gadget struct {
+	orm.BasicModel
+	Name string `json:"name"`
+}
+
+func TestTouchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &gadget{})
+	g := gadget{Name: "a"}
+	if err := db.Create(&g).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/gadgets/:id/touch", TouchHandler[gadget]("id", &enum.TouchOption{}))
+
+	if w := serve(r, http.MethodPost, "/gadgets/1/touch", ""); w.Code != http.StatusOK {
+		t.Errorf("touch: code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var touched gadget
+	if err := db.First(&touched, g.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !touched.UpdatedAt.After(g.UpdatedAt) {
+		t.Errorf("updated_at = %v, not bumped from %v", touched.UpdatedAt, g.UpdatedAt)
+	}
+	if w := serve(r, http.MethodPost, "/gadgets/9/touch", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing id: code = %d, want 404: %s", w.Code, w.Body.String())
+	}
+
+	err := db.Callback().Query().Before("gorm:query").Register("test:fail", func(db *gorm.DB) {
+		db.AddError(errors.New("connection lost"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(r, http.MethodPost, "/gadgets/1/touch", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("query failed: code = %d, want 422: %s", w.Code, w.Body.String())
+	}
+}
+
+type crew struct {
+	orm.BasicModel
+	Owner  string   `json:"owner"`
+	Name   string   `json:"name"`
+	Skills []*skill `json:"skills" gorm:"many2many:crew_skills"`
+}
+
+type skill struct {
+	orm.BasicModel
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+}
+
+func TestReplaceNestedHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &crew{}, &skill{})
+	c := crew{Name: "a", Skills: []*skill{{Name: "go"}, {Name: "sql"}, {Name: "css"}}}
+	if err := db.Create(&c).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/crews/:CrewId/skills", ReplaceNestedHandler[crew, skill]("CrewId", "Skills", &enum.UpdateOption{}))
+
+	skills := func() []string {
+		var names []string
+		var linked []*skill
+		if err := db.Model(&c).Association("Skills").Find(&linked); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range linked {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		wantCode int
+		want     []string // the skills linked after
+		wantRows int64    // linked, created and unlinked
+	}{
+		{"ids and new models", "/crews/1/skills", `[1, {"ID": 3}, {"name": "rust"}]`, http.StatusOK, []string{"go", "css", "rust"}, 2},
+		{"unchanged", "/crews/1/skills", `[1, 3, 4]`, http.StatusOK, []string{"go", "css", "rust"}, 0},
+		{"child not found", "/crews/1/skills", `[1, 99]`, http.StatusNotFound, []string{"go", "css", "rust"}, 0},
+		{"invalid id", "/crews/1/skills", `[true]`, http.StatusBadRequest, []string{"go", "css", "rust"}, 0},
+		{"parent not found", "/crews/9/skills", `[1]`, http.StatusNotFound, []string{"go", "css", "rust"}, 0},
+		{"removes all", "/crews/1/skills", `[]`, http.StatusOK, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPut, tt.url, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := skills(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("skills = %v, want %v", got, tt.want)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Meta struct {
+					RowsAffected int64 `json:"rows_affected"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Meta.RowsAffected != tt.wantRows {
+				t.Errorf("rows_affected = %d, want %d", resp.Meta.RowsAffected, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestReplaceNestedHandler_Scope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &crew{}, &skill{})
+	for _, owner := range []string{"ann", "bob"} {
+		c := crew{Owner: owner, Name: owner, Skills: []*skill{{Owner: owner, Name: owner + "'s"}}}
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { reqctx.SetUserID(c, c.GetHeader("X-User")) })
+	r.PUT("/crews/:CrewId/skills", ReplaceNestedHandler[crew, skill]("CrewId", "Skills", &enum.UpdateOption{
+		QueryOptionClosure: ownerScope,
+	}))
+
+	skills := func(crewID uint) string {
+		t.Helper()
+		var linked []*skill
+		if err := db.Model(&crew{BasicModel: orm.BasicModel{ID: crewID}}).Association("Skills").Find(&linked); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range linked {
+			names = append(names, s.Name)
+		}
+		return fmt.Sprint(names)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		wantCode int
+		wantAnn  string
+		wantBob  string
+	}{
+		{"parent and child out of scope", "/crews/2/skills", `[2]`, http.StatusNotFound, "[ann's]", "[bob's]"},
+		{"child out of scope", "/crews/1/skills", `[1, 2]`, http.StatusNotFound, "[ann's]", "[bob's]"},
+		{"parent out of scope", "/crews/2/skills", `[1]`, http.StatusNotFound, "[ann's]", "[bob's]"},
+		{"in scope", "/crews/1/skills", `[1, {"owner": "ann", "name": "new"}]`, http.StatusOK, "[ann's new]", "[bob's]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPut, tt.url, tt.body, "X-User", "ann")
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := skills(1); got != tt.wantAnn {
+				t.Errorf("skills of ann = %s, want %s", got, tt.wantAnn)
+			}
+			if got := skills(2); got != tt.wantBob {
+				t.Errorf("skills of bob = %s, want %s", got, tt.wantBob)
+			}
+		})
+	}
+}
+
+func TestUpdateHandler_BindMap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &member{})
+	if err := db.Create(&member{Name: "ann", Age: 30}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/members/:id", UpdateHandler[member]("id", &enum.UpdateOption{BindMap: true}))
+	r.PUT("/pretreated/:id", UpdateHandler[member]("id", &enum.UpdateOption{
+		BindMap: true,
+		Pretreat: func(c *gin.Context, model any) (any, error) {
+			return member{}, nil // not the map of the body
+		},
+	}))
+
+	if w := serve(r, http.MethodPut, "/members/1", `{"age": 0}`); w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var got member
+	if err := db.First(&got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "ann" || got.Age != 0 {
+		t.Errorf("updated = {name: %q, age: %d}, want {name: ann, age: 0}: only the zero age written", got.Name, got.Age)
+	}
+
+	w := serve(r, http.MethodPut, "/pretreated/1", `{"name": "bob"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Pretreat not returning the map: code = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	if err := db.First(&got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "ann" {
+		t.Errorf("name = %q, updated by a failed request", got.Name)
+	}
+}
+
+type profile struct {
+	orm.BasicModel
+	Name     string   `json:"name"`
+	Nickname *string  `json:"nickname"`
+	Tags     []string `json:"tags" gorm:"serializer:json"`
+}
+
+func TestUpdateHandler_Changed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &profile{})
+	nickname := "a"
+	if err := db.Create(&profile{Name: "ann", Nickname: &nickname, Tags: []string{"x"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/profiles/:id", UpdateHandler[profile]("id", &enum.UpdateOption{}))
+	r.PATCH("/profiles/:id", UpdateHandler[profile]("id", &enum.UpdateOption{BindMap: true}))
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   []string
+	}{
+		// bound into the pointer and the slice loaded: changed all the same
+		{"pointer and slice", http.MethodPut, `{"name": "ann", "nickname": "b", "tags": ["y"]}`, []string{"nickname", "tags"}},
+		{"none", http.MethodPut, `{"name": "ann"}`, []string{}},
+		{"map", http.MethodPatch, `{"nickname": "c"}`, []string{"nickname"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, "/profiles/1", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Meta struct {
+					Changed []string `json:"changed"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(resp.Meta.Changed) != fmt.Sprint(tt.want) {
+				t.Errorf("changed = %v, want %v", resp.Meta.Changed, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateHandler_Duplicate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &product{})
+	other, updated := &product{Tenant: 1, SKU: "A-1"}, &product{Tenant: 2, SKU: "B-1"}
+	if err := db.Create([]*product{other, updated}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/products/:id", UpdateHandler[product]("id", &enum.UpdateOption{}))
+	r.PUT("/scoped/:id", UpdateHandler[product]("id", &enum.UpdateOption{QueryOptionClosure: tenantScope}))
+	r.PUT("/columns/:id", UpdateHandler[product]("id", &enum.UpdateOption{BindMap: true, QueryOptionClosure: tenantScope}))
+
+	tests := []struct {
+		name, url, tenant string
+		existing          bool
+	}{
+		{"not scoped", "/products", "", true},
+		{"out of the scope", "/scoped", "2", false},
+		{"columns out of the scope", "/columns", "2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPut, fmt.Sprintf("%s/%d", tt.url, updated.ID), `{"tenant": 2, "sku": "A-1"}`, "X-Tenant", tt.tenant)
+			if w.Code != http.StatusConflict {
+				t.Fatalf("code = %d, want 409: %s", w.Code, w.Body.String())
+			}
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if _, got := body["product"]; got != tt.existing {
+				t.Errorf("existing responded = %v, want %v: %s", got, tt.existing, w.Body.String())
+			}
+			if _, ok := body["duplicate"]; !ok {
+				t.Errorf("no duplicate key responded: %s", w.Body.String())
+			}
+		})
+	}
+
+	var got product
+	if err := db.First(&got, updated.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.SKU != "B-1" {
+		t.Errorf("sku = %q, want B-1 unchanged", got.SKU)
+	}
+}
+
+type parcel struct {
+	orm.BasicModel
+	ShopID uint   `json:"shopId"`
+	Code   string `json:"code"`
+	Secret string `json:"-"`
+}
+
+func TestUpdateHandler_Upsert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &parcel{})
+	if err := db.Create(&parcel{ShopID: 1, Code: "taken"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	scoped := ScopeByParams[parcel](&enum.CurdOption{UpdateOption: enum.UpdateOption{
+		BindMap:  true,
+		Missing:  enum.UpdateMissingUpsert,
+		UniqueBy: []string{"code"},
+	}}, map[string]string{"shop": "shop_id"})
+	r := gin.New()
+	r.PUT("/shops/:shop/parcels/:id", UpdateHandler[parcel]("id", &scoped.UpdateOption))
+	r.PUT("/parcels/:id", UpdateHandler[parcel]("id", &enum.UpdateOption{
+		Missing:  enum.UpdateMissingUpsert,
+		UniqueBy: []string{"code"},
+	}))
+	r.PUT("/columns/:id", UpdateHandler[parcel]("id", &enum.UpdateOption{
+		BindMap: true,
+		Missing: enum.UpdateMissingUpsert,
+		Pretreat: func(c *gin.Context, model any) (any, error) {
+			body := model.(map[string]any)
+			body["secret"] = "s" // out of the JSON of parcel
+			return body, nil
+		},
+	}))
+	r.PUT("/pretreated/:id", UpdateHandler[parcel]("id", &enum.UpdateOption{
+		Missing: enum.UpdateMissingUpsert,
+		Pretreat: func(c *gin.Context, model any) (any, error) {
+			return map[string]any{}, nil // not a parcel
+		},
+	}))
+	r.PUT("/pretreated-columns/:id", UpdateHandler[parcel]("id", &enum.UpdateOption{
+		BindMap: true,
+		Missing: enum.UpdateMissingUpsert,
+		Pretreat: func(c *gin.Context, model any) (any, error) {
+			return parcel{}, nil // not the map of the body
+		},
+	}))
+
+	tests := []struct {
+		name, url, body string
+		code            int
+		want            *parcel
+	}{
+		{"scoped by the params", "/shops/7/parcels/10", `{"code": "a", "shopId": 9}`, http.StatusCreated, &parcel{ShopID: 7, Code: "a"}},
+		{"scoped duplicate", "/shops/7/parcels/11", `{"code": "taken"}`, http.StatusConflict, nil},
+		{"duplicate", "/parcels/12", `{"code": "taken"}`, http.StatusConflict, nil},
+		{"struct", "/parcels/13", `{"code": "b", "shopId": 2}`, http.StatusCreated, &parcel{ShopID: 2, Code: "b"}},
+		{"columns", "/columns/14", `{"shop_id": 3, "Code": "c"}`, http.StatusCreated, &parcel{ShopID: 3, Code: "c", Secret: "s"}},
+		{"id mismatch", "/columns/15", `{"id": 16, "code": "d"}`, http.StatusBadRequest, nil},
+		{"Pretreat not returning a parcel", "/pretreated/17", `{"code": "e"}`, http.StatusBadRequest, nil},
+		{"Pretreat not returning the map", "/pretreated-columns/18", `{"code": "f"}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPut, tt.url, tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.want == nil {
+				return
+			}
+			var got parcel
+			if err := db.Last(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.ShopID != tt.want.ShopID || got.Code != tt.want.Code || got.Secret != tt.want.Secret {
+				t.Errorf("created = %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+
+	var n int64
+	if err := db.Model(&parcel{}).Where("code = ?", "taken").Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("parcels of the code taken = %d, want 1: the duplicates not created", n)
+	}
+}
+
+func TestUpdateHandler_BindMapSerializer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &profile{}, &task{})
+	if err := db.Create(&profile{Name: "ann", Tags: []string{"x"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&task{Title: "a", Settings: map[string]any{"font": "mono"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.PUT("/profiles/:id", UpdateHandler[profile]("id", &enum.UpdateOption{BindMap: true}))
+	r.PUT("/tasks/:id", UpdateHandler[task]("id", &enum.UpdateOption{BindMap: true}))
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		wantCode int
+		table    string
+		column   string
+		want     string // "" for NULL
+	}{
+		{"slice serialized", "/profiles/1", `{"tags": ["y", "z"]}`, http.StatusOK, "profiles", "tags", `["y","z"]`},
+		{"invalid value", "/profiles/1", `{"tags": "y"}`, http.StatusBadRequest, "profiles", "tags", `["y","z"]`},
+		{"null", "/profiles/1", `{"tags": null}`, http.StatusOK, "profiles", "tags", ""},
+		// replaced as a whole: merged only by the MergePatchHandler
+		{"object replaced", "/tasks/1", `{"settings": {"theme": "dark"}}`, http.StatusOK, "tasks", "settings", `{"theme":"dark"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPut, tt.url, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			var value *string
+			if err := db.Table(tt.table).Select(tt.column).Row().Scan(&value); err != nil {
+				t.Fatal(err)
+			}
+			if (value == nil) != (tt.want == "") || value != nil && *value != tt.want {
+				got := "NULL"
+				if value != nil {
+					got = *value
+				}
+				t.Errorf("%s = %s, want %q", tt.column, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package enum
+
+// ArchiveRequest is the request body of the bulk soft-delete with a
+// reason (See ArchiveOption):
+//
+//	{"reason": "duplicate accounts merged, ticket #1234"}
+//
+// The models to delete are bounded by the filters and filters_at query
+// params (See GetRequestOptions), which are required.
+type ArchiveRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
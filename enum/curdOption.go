@@ -1,41 +1,319 @@
 package enum
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/pkg/cache"
+	"gorm.io/gorm"
 )
 
+// ListOption is options for the list route (GET /T).
+//
+// The fields of the same names in the other options (QueryOptionClosure,
+// Session, Middlewares, Filter, TypedFiltersOnly, MaxPreloads, Mapper,
+// Cache, ...) are documented here once, and do the same for their routes;
+// so do AllowDryRunSQL and Retry, documented on CreateOption.
 type ListOption struct {
 	Enable             bool
 	Omit               []string
 	LimitMax           int
 	QueryOptionClosure QueryOptionClosure
 	Pretreat           GetPretreat
+	// MaxOffset rejects requests with offset > MaxOffset (with a 400), 0 means unlimited.
+	MaxOffset int
+	// RejectOffsetBeyondTotal rejects requests with offset >= total (with a
+	// 400) instead of responding an empty list.
+	RejectOffsetBeyondTotal bool
+	// Filter is a struct binding typed query params into conditions by its `filter:"column,op"` tags.
+	Filter any
+	// SearchFields are the columns searched by the q param, ordered by relevance.
+	SearchFields []SearchField
+	// OrderExprs are the named ORDER BY expressions of order_by=name.
+	OrderExprs map[string]OrderExpr
+	// QueryByPost adds POST /T/query, the list with the query in the body (see QueryRequest).
+	QueryByPost bool
+	// AllowExplain allows explain=true to respond the query plan, for debugging only.
+	AllowExplain bool
+	// Session is the GORM session config of the queries of the route, see service.WithSession.
+	Session *gorm.Session
+	// Middlewares are installed before the handler of the route.
+	Middlewares []gin.HandlerFunc
+	// MaxPreloads and MaxPreloadDepth limit the preload params (with a 400), 0 means unlimited.
+	MaxPreloads     int
+	MaxPreloadDepth int
+	// AllowPreloadWithDeleted allows preload_with_deleted=Field to preload
+	// the soft-deleted models too.
+	AllowPreloadWithDeleted bool
+	// DefaultPreloads are the preloads of the requests without preload (or fields) params.
+	DefaultPreloads []string
+	// ConditionalPreloads are added to the preloads of the requests of their When.
+	ConditionalPreloads []ConditionalPreload
+	// TypedFiltersOnly rejects (with a 400) the generic filters, and the
+	// order_by and distinct beyond the Filter struct, OrderExprs,
+	// OrderColumns and DistinctColumns.
+	TypedFiltersOnly bool
+	// OrderColumns are the columns allowed for order_by if TypedFiltersOnly.
+	OrderColumns []string
+	// DistinctColumns are the columns allowed for distinct (beyond the
+	// Filter struct) if TypedFiltersOnly.
+	DistinctColumns []string
+	// LastModified responds a Last-Modified of the latest update time, and 304 for If-Modified-Since.
+	LastModified bool
+	// WarnRows and WarnBytes add a Warning header to the responses over them, 0 means no warning.
+	WarnRows  int
+	WarnBytes int
+	// Mapper is a func(*T) any (or func(*gin.Context, *T) any) reshaping
+	// each model responded, e.g. into a DTO.
+	Mapper any
+	// BatchLoads coalesces the service.Loader loads of the Mapper into one query per page.
+	BatchLoads bool
+	// Cache caches the responses of the route, nil (default) disables it.
+	Cache *CacheOption
 }
 
 type GetOption struct {
-	Enable             bool
-	Omit               []string
-	QueryOptionClosure QueryOptionClosure
-	Pretreat           GetPretreat
+	Enable                  bool
+	Omit                    []string
+	QueryOptionClosure      QueryOptionClosure
+	Pretreat                GetPretreat
+	Session                 *gorm.Session
+	Middlewares             []gin.HandlerFunc
+	MaxPreloads             int
+	MaxPreloadDepth         int
+	AllowPreloadWithDeleted bool
+	DefaultPreloads         []string
+	ConditionalPreloads     []ConditionalPreload
+	Mapper                  any
+	// MaxDepth enables depth=n (up to it) preloading all the associations n levels deep, 0 rejects it.
+	MaxDepth int
+	Cache    *CacheOption
+	// FieldLimitMax is the LimitMax of the slice fields of GET /:id/field, 0 means 1.
+	FieldLimitMax int
+	// JoinTable nests the join model (see gorm.DB.SetupJoinTable) of GET /:id/field under the key.
+	JoinTable string
+	// LookupColumn looks the model up by the unique column instead of the primary key, e.g. "slug".
+	LookupColumn string
 }
 
 type UpdateOption struct {
-	Enable   bool
-	Omit     []string
-	Pretreat Pretreat
-	LimitID  []int64
+	Enable      bool
+	Omit        []string
+	Pretreat    Pretreat
+	LimitID     []int64
+	Session     *gorm.Session
+	Middlewares []gin.HandlerFunc
+	// BindMap binds the body into a map, and writes only the fields in it by service.UpdateColumns.
+	BindMap bool
+	// QueryOptionClosure scopes the models can be updated: others are not found.
+	QueryOptionClosure    QueryOptionClosure
+	DisallowUnknownFields bool
+	// CheckUpdatedAt conditions the update on the update time of the
+	// If-Match header or the body (409 Conflict if modified since).
+	CheckUpdatedAt bool
+	// SkipUnchanged skips the writes of the updates changing nothing, see service.Unchanged.
+	SkipUnchanged  bool
+	AllowDryRunSQL bool
+	// Missing is the behavior of the updates of the ids not found.
+	Missing UpdateMissing
+	// UniqueBy is the CreateOption.UniqueBy of the creates of UpdateMissingUpsert.
+	UniqueBy []string
+	// MergePatch enables PATCH /T/:idParam, see controller.MergePatchHandler.
+	MergePatch bool
+	Retry      *RetryPolicy
 }
 
+// UpdateMissing is the behavior of an update of an id not found, see
+// UpdateOption.Missing.
+type UpdateMissing int
+
+const (
+	// UpdateMissingStrict responds 404 Not Found.
+	UpdateMissingStrict UpdateMissing = iota
+	// UpdateMissingUpsert creates the model of the body with the id of the path (201 Created).
+	UpdateMissingUpsert
+)
+
 type CreateOption struct {
-	Enable   bool
-	Omit     []string
-	Pretreat Pretreat
+	Enable      bool
+	Omit        []string
+	Pretreat    Pretreat
+	Session     *gorm.Session
+	Middlewares []gin.HandlerFunc
+	// DisallowUnknownFields rejects bodies with fields unknown to the model (with a 400).
+	DisallowUnknownFields bool
+	// FullSaveAssociations updates the existing nested associated models of the body as well.
+	FullSaveAssociations bool
+	// UniqueBy are the columns of the natural key: a duplicate is a 409
+	// Conflict with the existing model.
+	UniqueBy []string
+	// QueryOptionClosure scopes the existing models responded with the 409 Conflict.
+	QueryOptionClosure QueryOptionClosure
+	// AllowDryRunSQL allows dry_run_sql=true to respond the SQL of the write instead of executing it.
+	AllowDryRunSQL bool
+	// Retry retries the write on the transient errors of the database, see service.RetryTransaction.
+	Retry *RetryPolicy
 }
 
 type DelOption struct {
-	Enable   bool
-	Pretreat DeletePretreat
-	LimitID  []int64
+	Enable      bool
+	Pretreat    DeletePretreat
+	LimitID     []int64
+	Session     *gorm.Session
+	Retry       *RetryPolicy
+	Middlewares []gin.HandlerFunc
+	// Idempotent responds 204 No Content (instead of 404) for deleting an id that does not exist.
+	Idempotent         bool
+	QueryOptionClosure QueryOptionClosure
+	AllowDryRunSQL     bool
+	// Response is the response of the successful deletes.
+	Response DeleteResponse
+}
+
+// DeleteResponse is the response of a successful delete, see
+// DelOption.Response.
+type DeleteResponse int
+
+const (
+	// DeleteResponseDeleted responds 200 OK: { deleted: true, meta: { rows_affected: 1 } }.
+	DeleteResponseDeleted DeleteResponse = iota
+	// DeleteResponseNoContent responds 204 No Content, without a body.
+	DeleteResponseNoContent
+	// DeleteResponseModel responds 200 OK with the deleted model, loaded before the delete.
+	DeleteResponseModel
+)
+
+// ReplaceOption is options for the search-and-replace update
+// (POST /T/replace), which is an admin action disabled by default.
+type ReplaceOption struct {
+	Enable bool
+	// Columns allowed to be replaced. Empty means all columns of the model.
+	Columns            []string
+	QueryOptionClosure QueryOptionClosure
+}
+
+// RestoreOption is options for the bulk restore of soft-deleted models
+// (POST /T/restore), which is disabled by default.
+type RestoreOption struct {
+	Enable             bool
+	QueryOptionClosure QueryOptionClosure
+}
+
+// ArchiveOption is options for the bulk soft-delete of models with a
+// reason (POST /T/archive), which is disabled by default.
+type ArchiveOption struct {
+	Enable bool
+	// ReasonColumn and ActorColumn are the columns set to the reason and the actor, empty for none.
+	ReasonColumn       string
+	ActorColumn        string
+	QueryOptionClosure QueryOptionClosure
+	Middlewares        []gin.HandlerFunc
+}
+
+// TouchOption is options for bumping the update time of a model
+// (POST /T/:idParam/touch), which is disabled by default.
+type TouchOption struct {
+	Enable             bool
+	QueryOptionClosure QueryOptionClosure
+}
+
+// ReorderOption is options for setting the position column of the models
+// in the order of the ids of the body (POST /T/reorder), which is disabled
+// by default.
+type ReorderOption struct {
+	Enable bool
+	// Column is the position column. Defaults to "position".
+	Column string
+	// ParentColumn scopes the list to the models of the same parent, e.g. "board_id".
+	ParentColumn string
+	// LimitMax rejects bodies with more ids. 0 means no limit.
+	LimitMax           int
+	QueryOptionClosure QueryOptionClosure
+	Middlewares        []gin.HandlerFunc
+}
+
+// GetOrCreateOption is options for ensuring the models of the body exist
+// by their natural keys (POST /T/get_or_create), see
+// service.GetOrCreateMany.
+type GetOrCreateOption struct {
+	Enable bool
+	// Keys are the columns identifying the models (with a unique index on them). Required.
+	Keys []string
+	// LimitMax rejects bodies with more models. 0 means no limit.
+	LimitMax int
+	// Pretreat is called for each model in the body.
+	Pretreat           Pretreat
+	QueryOptionClosure QueryOptionClosure
+	Session            *gorm.Session
+	Retry              *RetryPolicy
+	Middlewares        []gin.HandlerFunc
+}
+
+// FacetOption is options for counting the models by the values of a
+// group_by column (GET /T/facets), under the filters of the list.
+type FacetOption struct {
+	Enable bool
+	// Columns allowed to group by. Empty means all columns of the model.
+	Columns []string
+	// LimitMax limits the number of values in the response. 0 means no limit.
+	LimitMax int
+	// QueryOptionClosure, Filter and TypedFiltersOnly default to the ListOption's.
+	QueryOptionClosure QueryOptionClosure
+	Filter             any
+	TypedFiltersOnly   bool
+	Middlewares        []gin.HandlerFunc
+}
+
+// ExportOption is options for streaming all the models (under the filters
+// of the list) as NDJSON (GET /T/export).
+type ExportOption struct {
+	Enable bool
+	// BatchSize is the number of models queried at a time. Defaults to 500.
+	BatchSize int
+	// Snapshot is the consistency of the exports of a mutating table. Defaults to SnapshotNone.
+	Snapshot Snapshot
+	// QueryOptionClosure, Filter and TypedFiltersOnly default to the ListOption's.
+	QueryOptionClosure QueryOptionClosure
+	Filter             any
+	TypedFiltersOnly   bool
+	Session            *gorm.Session
+	Middlewares        []gin.HandlerFunc
+}
+
+// Snapshot is the consistency of a multi-batch export, see service.Export.
+type Snapshot int
+
+const (
+	// SnapshotNone reads each batch as of its query.
+	SnapshotNone Snapshot = iota
+	// SnapshotBoundary exports the rows up to the max primary key at the start.
+	SnapshotBoundary
+	// SnapshotTransaction exports all the batches in one REPEATABLE READ transaction.
+	SnapshotTransaction
+)
+
+// CacheOption caches the success responses of a read route by the path
+// and the normalized query of the requests, for the TTL (0 means until
+// invalidated by the writes of the model through gorm).
+type CacheOption struct {
+	Cache cache.Cache
+	TTL   time.Duration
+	// Key is the part of the key beyond the path, query, Accept header and reqctx values, if any.
+	Key func(c *gin.Context) string
+}
+
+// ConditionalPreload is a preload rule of a route: the Preloads are added
+// for the requests When reports true for. See ListOption.ConditionalPreloads.
+type ConditionalPreload struct {
+	When     func(c *gin.Context) bool
+	Preloads []string
+}
+
+// ActionOption is options for a custom action on a model
+// (e.g. POST /T/:idParam/cancel), see router.Action.
+type ActionOption struct {
+	QueryOptionClosure QueryOptionClosure
+	Middlewares        []gin.HandlerFunc
 }
 
 // CrudGroup is options to construct the router group.
@@ -52,4 +330,16 @@ type CurdOption struct {
 	UpdateOption
 	CreateOption
 	DelOption
+	ReplaceOption
+	RestoreOption
+	ArchiveOption
+	TouchOption
+	ReorderOption
+	FacetOption
+	GetOrCreateOption
+	ExportOption
+	// ParamFilters maps the path params of the base route to the columns scoping all the CRUD routes.
+	ParamFilters map[string]string
+	// SlowThreshold logs a warning for the requests taking longer than it, 0 for none.
+	SlowThreshold time.Duration
 }
@@ -2,21 +2,65 @@ package enum
 
 // GetRequestOptions is the query options (?opt=val) for GET requests:
 //
-//	limit=10&offset=4&                 # pagination
+//	limit=10&offset=4&                 # pagination (or page=2&per_page=10, see controller.PaginationParams)
 //	order_by=id&desc=true&             # ordering
+//	order_by=due_at nulls last&        # ordering with NULLs first or last
+//	order_by=nearest&                  # ordering by a named expression (ListOption.OrderExprs)
 //	filter_by=name&filter_value=John&  # filtering
+//	filters[name]=John&filters[age]=10&  # filtering on multiple columns
+//	filter_ops[tags]=all&filters[tags]=1,2&  # filtering with an operator (eq, in, all, contains, startswith, endswith)
+//	ids=3,1,2&                         # fetching by primary keys, in the order of the ids (lists only)
+//	ids_only=true&                     # return only the primary keys of the models, as an ids array (lists only)
+//	created_within=7d&updated_within=24h&  # filtering on the create / update time within the duration until now
 //	total=true&                        # return total count (all available records under the filter, ignoring pagination)
+//	distinct=customer_id&              # return the count of distinct values of the columns under the filter (lists only)
 //	preload=Product&preload=Product.Manufacturer  # preloading: loads nested models as well
+//	preload=Orders&preload_order=Orders:created_at desc&  # ordering the preloaded models
+//	preload=Orders&preload_with_deleted=Orders&  # including soft-deleted preloads (if GetOption.AllowPreloadWithDeleted)
+//	join=Customer&                     # loading to-one associations by JOIN instead of preload queries
+//	select=id,total&                   # selecting columns of the field models (GetFieldHandler only), or of the xlsx exports
+//	fields=id,name,orders{id,total}&   # partial response: only the fields (and associations) in the tree
+//	with_counts=Orders,Comments&      # attaches orders_count, comments_count to each model
+//	group_by=status&                   # counts per value of the column (facets only)
+//	format=xlsx&                       # the format of the export (exports only)
+//	explain=true                       # responds the query plan instead of data (if ListOption.AllowExplain)
+//
+// Filter values are converted to the type of the column: e.g. for a bool
+// column, true/false, 1/0, yes/no, on/off are accepted.
 //
 // It is used in GetListHandler, GetByIDHandler and GetFieldHandler, to bind
 // the query parameters in the GET request url.
 type GetRequestOptions struct {
-	Limit      int               `form:"limit"`
-	Offset     int               `form:"offset"`
-	OrderBy    string            `form:"order_by"`
-	Descending bool              `form:"desc"`
-	Filters    map[string]string `form:"filters"`
-	FiltersAt  []string          `form:"filters_at"`
-	Preload    []string          `form:"preload"` // fields to preload
-	Total      bool              `form:"total"`   // return total count ?
+	Limit              int               `form:"limit"`
+	Offset             int               `form:"offset"`
+	OrderBy            string            `form:"order_by"`
+	Descending         bool              `form:"desc"`
+	FilterBy           string            `form:"filter_by"`
+	FilterValue        string            `form:"filter_value"`
+	FilterOp           string            `form:"filter_op"`
+	Filters            map[string]string `form:"filters"`
+	FilterOps          map[string]string `form:"filter_ops"` // filter column => operator
+	FiltersAt          []string          `form:"filters_at"`
+	CreatedWithin      string            `form:"created_within"`       // e.g. 7d: created in the last 7 days, see controller.ParseWithin
+	UpdatedWithin      string            `form:"updated_within"`       // e.g. 24h: updated in the last 24 hours
+	IDs                []string          `form:"ids"`                  // primary keys to list, ordered as given (unless order_by)
+	IDsOnly            bool              `form:"ids_only"`             // respond only the primary keys, see service.PluckIDs
+	Preload            []string          `form:"preload"`              // fields to preload
+	PreloadOrder       []string          `form:"preload_order"`        // field:column [desc] orders of preloads
+	PreloadWithDeleted []string          `form:"preload_with_deleted"` // preloads including soft-deleted ones
+	Join               []string          `form:"join"`                 // to-one associations to join
+	Select             []string          `form:"select"`               // columns to select (GetFieldHandler and xlsx exports only)
+	Fields             string            `form:"fields"`               // fields to respond, with nested {...} of associations
+	Total              bool              `form:"-"`                    // return total count ? total=true, exact or estimate
+	TotalEstimate      bool              `form:"-"`                    // total=estimate: an estimate is enough, see service.EstimateCount
+	Distinct           []string          `form:"distinct"`             // columns to count the distinct values of, see service.CountDistinct
+	Explain            bool              `form:"explain"`              // return query plan instead ?
+	WithCounts         []string          `form:"with_counts"`          // associations to count
+	GroupBy            string            `form:"group_by"`             // column to count by (facets only)
+	Format             string            `form:"format"`               // format of the export: ndjson (default) or xlsx (exports only)
+	Page               int               `form:"-"`                    // page number of the page-based pagination, see controller.PaginationParams
+	Q                  string            `form:"q"`                    // search query, see ListOption.SearchFields
+	Depth              int               `form:"depth"`                // preload all the associations within the depth, see GetOption.MaxDepth
+	Range              bool              `form:"-"`                    // paginated by the Range header, see controller.RangeUnit
+	Report             string            `form:"report"`               // ids: report the ids written by the batch operations, see service.AffectedIDs
 }
@@ -9,3 +9,15 @@ type QueryOptionClosure func(c *gin.Context, GetRequestOptions GetRequestOptions
 
 // QueryOption is a function that can be used to construct a query.
 type QueryOption func(tx *gorm.DB) *gorm.DB
+
+// OrderExpr builds a named ORDER BY expression (see ListOption.OrderExprs)
+// for the request, with the args from the request, e.g. the distance to
+// the ?lat=&lng= location:
+//
+//	func(c *gin.Context) (string, []any, error) {
+//	    lat, lng := c.Query("lat"), c.Query("lng")
+//	    return "(lat-?)*(lat-?)+(lng-?)*(lng-?)", []any{lat, lat, lng, lng}, nil
+//	}
+//
+// A non-nil error rejects the request with a 400.
+type OrderExpr func(c *gin.Context) (expr string, args []any, err error)
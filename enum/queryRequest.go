@@ -0,0 +1,63 @@
+package enum
+
+// QueryRequest is the request body of the query via POST (POST /T/query,
+// see ListOption.QueryByPost): a structured GetRequestOptions, for the
+// queries too long or too hard to encode in the URL:
+//
+//	{
+//	    "filters": [
+//	        {"column": "status", "op": "in", "value": ["open", "pending"]},
+//	        {"column": "age", "value": 18},
+//	        {"column": "name", "value": "John, Jr."}
+//	    ],
+//	    "filters_at": ["2023-01-01", "2023-02-01"],
+//	    "created_within": "7d", "updated_within": "24h",
+//	    "ids": [3, 1, 2], "ids_only": true,
+//	    "order_by": "created_at", "desc": true,
+//	    "limit": 20, "offset": 40,           // or "page": 3 (if enabled by controller.PaginationParams)
+//	    "total": "estimate",                 // true, "exact" or "estimate"
+//	    "distinct": ["customer_id"],
+//	    "preload": ["Orders"], "preload_order": ["Orders:created_at desc"],
+//	    "preload_with_deleted": ["Orders"], "join": ["Customer"],
+//	    "fields": "id,name,orders{id,total}",
+//	    "with_counts": ["Orders"],
+//	    "q": "john",
+//	    "params": {"min_age": 18}            // the other params, e.g. of ListOption.Filter
+//	}
+//
+// All the fields are optional, and mean what the params of the same names
+// mean for the list (see GetRequestOptions). The values of the filters are
+// strings, numbers, bools, or arrays of them for the in and all operators.
+// The unknown fields are rejected.
+type QueryRequest struct {
+	Filters            []QueryFilter  `json:"filters"`
+	FiltersAt          []string       `json:"filters_at"`
+	CreatedWithin      string         `json:"created_within"`
+	UpdatedWithin      string         `json:"updated_within"`
+	IDs                []any          `json:"ids"`
+	IDsOnly            bool           `json:"ids_only"`
+	OrderBy            string         `json:"order_by"`
+	Desc               bool           `json:"desc"`
+	Limit              int            `json:"limit"`
+	Offset             int            `json:"offset"`
+	Page               int            `json:"page"`
+	Total              any            `json:"total"`
+	Distinct           []string       `json:"distinct"`
+	Preload            []string       `json:"preload"`
+	PreloadOrder       []string       `json:"preload_order"`
+	PreloadWithDeleted []string       `json:"preload_with_deleted"`
+	Join               []string       `json:"join"`
+	Fields             string         `json:"fields"`
+	WithCounts         []string       `json:"with_counts"`
+	Q                  string         `json:"q"`
+	Params             map[string]any `json:"params"`
+}
+
+// QueryFilter is a filter of QueryRequest: column op value, as the
+// filters[column]=value&filter_ops[column]=op params. One filter per
+// column.
+type QueryFilter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"` // eq by default
+	Value  any    `json:"value"`
+}
@@ -0,0 +1,12 @@
+package enum
+
+// ReorderRequest is the request body of the reorder route: the ids of the
+// models in the desired order, e.g.
+//
+//	{"ids": [3, 1, 2]}
+//
+// They may be a part of the list (e.g. the models on a page), which keep
+// the positions they occupy in it. See ReorderOption.
+type ReorderRequest struct {
+	IDs []any `json:"ids" binding:"required"`
+}
@@ -0,0 +1,17 @@
+package enum
+
+// ReplaceRequest is the request body of a search-and-replace update:
+//
+//	{"column": "status", "from": "canceled", "to": "cancelled"}
+//
+// With substring=true, occurrences of from inside the column are replaced
+// instead of the whole value.
+//
+// The rows to update are bounded by the filters and filters_at query params
+// (See GetRequestOptions), which are required.
+type ReplaceRequest struct {
+	Column    string `json:"column" binding:"required"`
+	From      any    `json:"from"`
+	To        any    `json:"to"`
+	Substring bool   `json:"substring"`
+}
@@ -0,0 +1,21 @@
+package enum
+
+import "time"
+
+// RetryPolicy configures the retries of the writes on the transient errors
+// of the database (deadlocks, serialization failures, ...), each in a
+// fresh transaction, see service.RetryTransaction and the Retry of the
+// write options.
+type RetryPolicy struct {
+	// Attempts is the max number of attempts, including the first one.
+	// Values below 2 mean no retry.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled for each of the
+	// next ones, up to MaxBackoff (if > 0). A random half of each wait is
+	// jittered, so that the conflicting transactions do not retry in step.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// IsTransient reports whether an error is worth a retry.
+	// Defaults to service.IsTransientError.
+	IsTransient func(err error) bool
+}
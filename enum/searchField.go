@@ -0,0 +1,26 @@
+package enum
+
+// SearchField is a column searched by the q param of the list, see
+// ListOption.SearchFields.
+type SearchField struct {
+	Column string
+	Match  SearchMatch
+	// Weight is the relevance of a match on the column: the models are
+	// ordered by the sum of the weights of their matched columns, if any
+	// of the weights is > 0 (and no order_by is requested).
+	Weight int
+}
+
+// SearchMatch is how the q param matches a SearchField column, by LIKE
+// for SearchContains and SearchPrefix (with the wildcards of q escaped).
+type SearchMatch int
+
+const (
+	// SearchContains matches the columns containing q: LIKE %q%.
+	// It can not use the indexes of the column.
+	SearchContains SearchMatch = iota
+	// SearchPrefix matches the columns starting with q: LIKE q%.
+	SearchPrefix
+	// SearchExact matches the columns equal to q, e.g. codes or emails.
+	SearchExact
+)
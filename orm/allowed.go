@@ -0,0 +1,278 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// AllowedValuer is implemented by models restricting columns to fixed sets
+// of values (i.e. enums), for example:
+//
+//	func (Ticket) AllowedValues() map[string][]string {
+//	    return map[string][]string{"status": {"open", "closed"}}
+//	}
+//
+// The keys are column (or field) names. The values are checked by the
+// service on create and update (see CheckAllowedValues), instead of
+// relying on database constraints, which produce ugly errors.
+type AllowedValuer interface {
+	AllowedValues() map[string][]string
+}
+
+// NotAllowedValueError is the error of a value not in the allowed values
+// of the column. It matches ErrNotAllowedValue by errors.Is.
+type NotAllowedValueError struct {
+	Column  string
+	Value   string
+	Allowed []string
+}
+
+func (e *NotAllowedValueError) Error() string {
+	return fmt.Sprintf("%s: %q for %q, allowed values: %s",
+		ErrNotAllowedValue, e.Value, e.Column, strings.Join(e.Allowed, ", "))
+}
+
+func (e *NotAllowedValueError) Is(target error) bool {
+	return target == ErrNotAllowedValue
+}
+
+var ErrNotAllowedValue = errors.New("value not allowed")
+
+// allowedValues returns the allowed values of model by the column names.
+func allowedValues(model any) map[string][]string {
+	valuer, ok := model.(AllowedValuer)
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(model))
+		if !v.IsValid() {
+			return nil
+		}
+		if valuer, ok = v.Interface().(AllowedValuer); !ok {
+			return nil
+		}
+	}
+	allowed := map[string][]string{}
+	for name, values := range valuer.AllowedValues() {
+		field, err := LookUpField(model, name)
+		if err != nil {
+			continue
+		}
+		allowed[field.DBName] = values
+	}
+	return allowed
+}
+
+// AllowedValues returns the allowed values of the column of model, and
+// whether the column is restricted by the AllowedValuer of model.
+func AllowedValues(model any, column string) ([]string, bool) {
+	field, err := LookUpField(model, column)
+	if err != nil {
+		return nil, false
+	}
+	values, ok := allowedValues(model)[field.DBName]
+	return values, ok
+}
+
+// CheckAllowedValue checks the value of the column of model against the
+// allowed values if the column is restricted.
+func CheckAllowedValue(model any, column string, value any) error {
+	allowed, ok := AllowedValues(model, column)
+	if !ok {
+		return nil
+	}
+	return checkAllowed(column, value, allowed)
+}
+
+// CheckAllowedValues checks the values of the restricted columns of model
+// (a struct or a pointer to it). Zero values (e.g. "") are not checked,
+// for they are left to the defaults.
+func CheckAllowedValues(model any) error {
+	allowed := allowedValues(model)
+	if len(allowed) == 0 {
+		return nil
+	}
+	s, err := ParseSchema(model)
+	if err != nil {
+		return err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	for column, values := range allowed {
+		field := s.LookUpField(column)
+		value, zero := field.ValueOf(context.Background(), rv)
+		if zero {
+			continue
+		}
+		if err := checkAllowed(column, value, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckAllowedColumnValues checks the values (column name => value, e.g.
+// of an update map) of the restricted columns of model.
+func CheckAllowedColumnValues(model any, columns map[string]any) error {
+	for column, value := range columns {
+		if err := CheckAllowedValue(model, column, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAllowed checks the value (or the value it points to) is one of the
+// allowed values. Values of custom scalar types are compared by their
+// driver.Valuer, as they are stored.
+func checkAllowed(column string, value any, allowed []string) error {
+	if valuer, ok := value.(driver.Valuer); ok { // custom scalars, as stored
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		value = v
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	s := fmt.Sprint(rv.Interface())
+	for _, v := range allowed {
+		if s == v {
+			return nil
+		}
+	}
+	return &NotAllowedValueError{Column: column, Value: s, Allowed: allowed}
+}
+
+// FilterOperatorer is implemented by models restricting the filter
+// operators (see the FilterOp constants of the controller) of columns,
+// e.g. against the expensive LIKE scans on the columns not indexed for
+// them:
+//
+//	func (User) FilterOperators() map[string][]string {
+//	    return map[string][]string{"name": {"eq", "startswith"}, "status": {"eq", "in"}}
+//	}
+//
+// The keys are column (or field) names. The columns not in the map are not
+// restricted.
+type FilterOperatorer interface {
+	FilterOperators() map[string][]string
+}
+
+// FilterOperators returns the allowed filter operators of the column of
+// model, and whether the column is restricted by the FilterOperatorer of
+// model. A column which is not a field of model (e.g. tags.name) is
+// matched by its name as is.
+func FilterOperators(model any, column string) ([]string, bool) {
+	operatorer, ok := model.(FilterOperatorer)
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(model))
+		if !v.IsValid() {
+			return nil, false
+		}
+		if operatorer, ok = v.Interface().(FilterOperatorer); !ok {
+			return nil, false
+		}
+	}
+	target, err := LookUpField(model, column)
+	for name, operators := range operatorer.FilterOperators() {
+		if name == column {
+			return operators, true
+		}
+		if err != nil {
+			continue
+		}
+		if field, err := LookUpField(model, name); err == nil && field == target {
+			return operators, true
+		}
+	}
+	return nil, false
+}
+
+// FilterBlacklister is implemented by models protecting columns from the
+// filters and orders of the requests (filter_by, filters, order_by, and
+// the group_by of the facets), e.g. the large text columns which are not
+// indexed, against the full table scans:
+//
+//	func (Article) FilterBlacklist() []string {
+//	    return []string{"body", "raw_html"}
+//	}
+//
+// The columns (or field names) are still read and written as usual. The
+// raw SQL orders (e.g. order_by=LOWER(title)) of such models are rejected:
+// name them by ListOption.OrderExprs instead. It is the inverse of
+// ListOption.TypedFiltersOnly with OrderColumns, when most of the columns
+// are fine to query.
+type FilterBlacklister interface {
+	FilterBlacklist() []string
+}
+
+// FilterBlacklisted reports whether the column of model is blacklisted by
+// the FilterBlacklister of model. A column which is not a field of model
+// (e.g. tags.name) is matched by its name as is; one qualified by the
+// table of model (e.g. articles.body) by its field. A raw expression (e.g.
+// LOWER(body), or body desc) can not be checked: it is blacklisted as a
+// whole if any column is.
+func FilterBlacklisted(model any, column string) bool {
+	blacklister, ok := model.(FilterBlacklister)
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(model))
+		if !v.IsValid() {
+			return false
+		}
+		if blacklister, ok = v.Interface().(FilterBlacklister); !ok {
+			return false
+		}
+	}
+	blacklist := blacklister.FilterBlacklist()
+	if !isColumnName(column) {
+		return len(blacklist) > 0
+	}
+	if table, name, ok := strings.Cut(column, "."); ok {
+		if s, err := ParseSchema(model); err == nil && s.Table == table {
+			column = name // qualified by the table of model
+		}
+	}
+	target, err := LookUpField(model, column)
+	for _, name := range blacklist {
+		if name == column {
+			return true
+		}
+		if err != nil {
+			continue
+		}
+		if field, err := LookUpField(model, name); err == nil && field == target {
+			return true
+		}
+	}
+	return false
+}
+
+// isColumnName reports whether s is a column name, or a dotted one (e.g.
+// tags.name), not an expression.
+func isColumnName(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Audited is implemented by models whose mutations (create, update and
+// delete) are recorded into an audit sink (opt-in per model), e.g.
+//
+//	func (Invoice) AuditSink() orm.AuditSink { return orm.DBAuditSink{} }
+//
+// The records are written by gorm callbacks in the transaction of the
+// mutation, so the audit entries commit (or roll back) with the changes.
+// (Unless the gorm.Config SkipDefaultTransaction is set.)
+//
+// Updates and deletes are recorded for the models with primary keys (i.e.
+// the ones loaded); bulk operations by conditions are not.
+type Audited interface {
+	AuditSink() AuditSink
+}
+
+// AuditSink stores the audit records, by tx: the transaction of the
+// mutation.
+type AuditSink interface {
+	Record(tx *gorm.DB, record *AuditRecord) error
+}
+
+// AuditRecord is an entry of the audit trail.
+type AuditRecord struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Actor     string `gorm:"index"`           // see AuditActor
+	Model     string `gorm:"index:idx_audit"` // table name
+	ModelID   string `gorm:"index:idx_audit"` // primary key(s), comma separated
+	Operation string // AuditCreate, AuditUpdate or AuditDelete
+	Diff      string // JSON of the changed columns: {"column": [before, after], ...}
+	Reason    string // of the deletions by service.ArchiveMany
+}
+
+// Operations of AuditRecord.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// DBAuditSink writes the audit records into the table of AuditRecord,
+// which should be registered: RegisterModel(&orm.AuditRecord{}). The
+// Reason column is new to the tables created before service.ArchiveMany:
+// RegisterModel adds it (by AutoMigrate), else the migrations of the
+// application should, e.g.
+//
+//	ALTER TABLE audit_records ADD COLUMN reason text;
+type DBAuditSink struct{}
+
+func (DBAuditSink) Record(tx *gorm.DB, record *AuditRecord) error {
+	return tx.Create(record).Error
+}
+
+// AuditActor returns the actor of the mutation from ctx: the user id
+// stashed by reqctx.SetUserID by default.
+var AuditActor = func(ctx context.Context) string {
+	if userID, ok := reqctx.UserID(ctx); ok && userID != nil {
+		return fmt.Sprint(userID)
+	}
+	return ""
+}
+
+const auditBeforeKey = "crud:audit_before"
+
+// registerAuditCallbacks registers the gorm callbacks recording the
+// mutations of Audited models, once for the callbacks of db.
+func registerAuditCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	if callback.Create().Get("crud:audit") != nil {
+		return nil
+	}
+	// in the transaction: between the begin and the commit (or rollback)
+	const begin, commit = "gorm:begin_transaction", "gorm:commit_or_rollback_transaction"
+	for _, err := range []error{
+		callback.Create().After("gorm:create").Before(commit).Register("crud:audit", auditCreate),
+		callback.Update().After(begin).Before("gorm:update").Register("crud:audit_before", auditLoadBefore),
+		callback.Update().After("gorm:update").Before(commit).Register("crud:audit", auditUpdate),
+		callback.Delete().After(begin).Before("gorm:delete").Register("crud:audit_before", auditLoadBefore),
+		callback.Delete().After("gorm:delete").Before(commit).Register("crud:audit", auditDelete),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditedModels returns the models (struct values) of the statement which
+// are Audited.
+func auditedModels(db *gorm.DB) []reflect.Value {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	if _, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(Audited); !ok {
+		return nil
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{rv}
+	case reflect.Slice, reflect.Array:
+		models := make([]reflect.Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if model := reflect.Indirect(rv.Index(i)); model.Kind() == reflect.Struct {
+				models = append(models, model)
+			}
+		}
+		return models
+	}
+	return nil
+}
+
+// auditID returns the primary key values of the model, comma separated,
+// and whether they are all set.
+func auditID(db *gorm.DB, model reflect.Value) (string, bool) {
+	var ids []string
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		value, zero := field.ValueOf(db.Statement.Context, model)
+		if zero {
+			return "", false
+		}
+		ids = append(ids, fmt.Sprint(value))
+	}
+	return strings.Join(ids, ","), len(ids) > 0
+}
+
+// auditLoad loads the record of model (by its primary keys) from the
+// database, in the transaction of db.
+func auditLoad(db *gorm.DB, model reflect.Value) (reflect.Value, error) {
+	record := reflect.New(db.Statement.Schema.ModelType)
+	query := db.Session(&gorm.Session{NewDB: true}).Unscoped()
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		value, _ := field.ValueOf(db.Statement.Context, model)
+		query = query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+	}
+	err := query.Take(record.Interface()).Error
+	return record.Elem(), err
+}
+
+// auditLoadBefore loads the models to update or delete, for the diffs.
+func auditLoadBefore(db *gorm.DB) {
+	models := auditedModels(db)
+	if len(models) != 1 {
+		return
+	}
+	if _, ok := auditID(db, models[0]); !ok {
+		return
+	}
+	before, err := auditLoad(db, models[0])
+	if err != nil {
+		return // nothing to update or delete
+	}
+	db.InstanceSet(auditBeforeKey, before)
+}
+
+func auditCreate(db *gorm.DB) {
+	for _, model := range auditedModels(db) {
+		id, _ := auditID(db, model)
+		auditRecord(db, AuditCreate, id, reflect.Value{}, model)
+	}
+}
+
+func auditUpdate(db *gorm.DB) {
+	before, ok := auditBefore(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	model := auditedModels(db)[0]
+	after, err := auditLoad(db, model)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("audit: load updated: %w", err))
+		return
+	}
+	id, _ := auditID(db, model)
+	auditRecord(db, AuditUpdate, id, before, after)
+}
+
+func auditDelete(db *gorm.DB) {
+	before, ok := auditBefore(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	model := auditedModels(db)[0]
+	id, _ := auditID(db, model)
+	auditRecord(db, AuditDelete, id, before, reflect.Value{})
+}
+
+// auditBefore returns the model loaded by auditLoadBefore.
+func auditBefore(db *gorm.DB) (reflect.Value, bool) {
+	if db.Error != nil {
+		return reflect.Value{}, false
+	}
+	before, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return before.(reflect.Value), true
+}
+
+// auditRecord records the diff of the columns between before and after
+// (either can be invalid, for creates and deletes) into the sink of the
+// model type.
+func auditRecord(db *gorm.DB, operation, id string, before, after reflect.Value) {
+	ctx := db.Statement.Context
+	diff := map[string][2]any{}
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		var change [2]any
+		if before.IsValid() {
+			change[0], _ = field.ValueOf(ctx, before)
+		}
+		if after.IsValid() {
+			change[1], _ = field.ValueOf(ctx, after)
+		}
+		b, _ := json.Marshal(change[0])
+		a, _ := json.Marshal(change[1])
+		if string(b) != string(a) {
+			diff[field.DBName] = change
+		}
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("audit: marshal diff: %w", err))
+		return
+	}
+
+	sink := reflect.New(db.Statement.Schema.ModelType).Interface().(Audited).AuditSink()
+	if sink == nil {
+		return
+	}
+	record := &AuditRecord{
+		Actor:     AuditActor(ctx),
+		Model:     db.Statement.Schema.Table,
+		ModelID:   id,
+		Operation: operation,
+		Diff:      string(diffJSON),
+	}
+	if err := sink.Record(db.Session(&gorm.Session{NewDB: true}), record); err != nil {
+		_ = db.AddError(fmt.Errorf("audit: %w", err))
+	}
+}
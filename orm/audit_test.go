@@ -0,0 +1,111 @@
+package orm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+)
+
+type account struct {
+	BasicModel
+	Owner   string
+	Balance int
+}
+
+func (account) AuditSink() AuditSink { return DBAuditSink{} }
+
+type failingSink struct{}
+
+func (failingSink) Record(tx *gorm.DB, record *AuditRecord) error {
+	return errors.New("sink down")
+}
+
+type vault struct {
+	BasicModel
+	Balance int
+}
+
+func (vault) AuditSink() AuditSink { return failingSink{} }
+
+func auditRecords(t *testing.T, db *gorm.DB) []AuditRecord {
+	t.Helper()
+	var records []AuditRecord
+	if err := db.Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestAudited(t *testing.T) {
+	db := openDB(t, &account{}, &vault{}, &AuditRecord{})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/accounts", nil)
+	reqctx.SetUserID(c, 7)
+	ctx := c.Request.Context()
+
+	a := account{Owner: "ann", Balance: 10}
+	if err := db.WithContext(ctx).Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Model(&a).Update("balance", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	records := auditRecords(t, db)
+	want := []struct{ operation, diff string }{
+		{AuditCreate, ""},
+		{AuditUpdate, `"balance":[10,20]`},
+		{AuditDelete, ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %+v, want %d", records, len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Operation != w.operation || r.Model != "accounts" || r.ModelID != "1" || r.Actor != "7" {
+			t.Errorf("records[%d] = %+v, want %s of accounts 1 by 7", i, r, w.operation)
+		}
+		if w.diff != "" && !strings.Contains(r.Diff, w.diff) {
+			t.Errorf("records[%d].Diff = %s, want containing %s", i, r.Diff, w.diff)
+		}
+	}
+}
+
+func TestAudited_Transaction(t *testing.T) {
+	db := openDB(t, &account{}, &vault{}, &AuditRecord{})
+
+	// rolled back with the mutation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account{Owner: "bob"}).Error; err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("transaction: no error")
+	}
+	if records := auditRecords(t, db); len(records) != 0 {
+		t.Errorf("records = %+v, want none: rolled back", records)
+	}
+
+	// the mutation rolled back with a failed record
+	if err := db.Create(&vault{Balance: 1}).Error; err == nil {
+		t.Error("create with a failing sink: no error")
+	}
+	var count int64
+	if err := db.Model(&vault{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("vaults = %d, want 0: rolled back", count)
+	}
+}
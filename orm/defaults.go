@@ -0,0 +1,51 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// CreateDefaulter is implemented by models with columns stamped from the
+// request context on create (e.g. audit or tenant columns), for example:
+//
+//	func (Post) CreateDefaults() map[string]func(ctx context.Context) any {
+//	    return map[string]func(ctx context.Context) any{
+//	        "created_by": func(ctx context.Context) any {
+//	            userID, _ := reqctx.UserID(ctx)
+//	            return userID
+//	        },
+//	    }
+//	}
+//
+// The keys are column (or field) names. The values are set by the service
+// before inserting (see SetCreateDefaults), overriding the ones given by
+// the client.
+type CreateDefaulter interface {
+	CreateDefaults() map[string]func(ctx context.Context) any
+}
+
+// SetCreateDefaults sets the columns of model (a pointer to a struct) to
+// the values of its CreateDefaulter, if implemented, from ctx.
+func SetCreateDefaults(ctx context.Context, model any) error {
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+	defaulter, ok := model.(CreateDefaulter)
+	if !ok {
+		if defaulter, ok = rv.Elem().Interface().(CreateDefaulter); !ok {
+			return nil
+		}
+	}
+	for column, value := range defaulter.CreateDefaults() {
+		field, err := LookUpField(model, column)
+		if err != nil {
+			return err
+		}
+		if err := field.Set(ctx, rv.Elem(), value(ctx)); err != nil {
+			return fmt.Errorf("set create default of %q: %w", column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package orm
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// openDB opens an in-memory SQLite database of the models as the DB for
+// the test, as servicetest.Open (which imports orm) does.
+func openDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	previous := DB
+	db, err := ConnectDB(DBDriverSqlite, "file::memory:")
+	if err != nil {
+		DB = previous
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		DB = previous
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // an in-memory database is of its connection
+	t.Cleanup(func() {
+		DB = previous
+		_ = sqlDB.Close()
+	})
+	if err := RegisterModel(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
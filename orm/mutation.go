@@ -0,0 +1,189 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	mutationMu        sync.RWMutex
+	mutationListeners []func(db *gorm.DB, table string)
+)
+
+// OnMutation registers f to be called after each create, update or delete
+// statement (changing any row) of the connected DB, with the table of the
+// statement, e.g. to invalidate the caches of the table. It is called
+// after the commit of the statement, or of the transaction the statement
+// is a part of, once by table, and not if the transaction is rolled back.
+func OnMutation(f func(db *gorm.DB, table string)) {
+	mutationMu.Lock()
+	defer mutationMu.Unlock()
+	mutationListeners = append(mutationListeners, f)
+}
+
+// registerMutationCallbacks registers the gorm callbacks calling the
+// OnMutation listeners, once for the callbacks of db, and wraps the
+// connection pool of db to call them after the commits of the
+// transactions.
+func registerMutationCallbacks(db *gorm.DB) error {
+	wrapMutationPool(db)
+	callback := db.Callback()
+	if callback.Create().Get("crud:mutation") != nil {
+		return nil
+	}
+	const commit = "gorm:commit_or_rollback_transaction"
+	for _, err := range []error{
+		callback.Create().After(commit).Register("crud:mutation", notifyMutation),
+		callback.Update().After(commit).Register("crud:mutation", notifyMutation),
+		callback.Delete().After(commit).Register("crud:mutation", notifyMutation),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notifyMutation(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.Statement.RowsAffected == 0 {
+		return
+	}
+	table := db.Statement.Table
+	if table == "" && db.Statement.Schema != nil {
+		table = db.Statement.Schema.Table
+	}
+	if table == "" {
+		return
+	}
+	if tx := mutationTxOf(db.Statement.ConnPool); tx != nil {
+		tx.postpone(db, table) // in a transaction: after its commit
+		return
+	}
+	notifyListeners(db, table)
+}
+
+func notifyListeners(db *gorm.DB, table string) {
+	mutationMu.RLock()
+	listeners := mutationListeners
+	mutationMu.RUnlock()
+	for _, f := range listeners {
+		f(db, table)
+	}
+}
+
+// wrapMutationPool wraps the connection pool of db (if not a transaction,
+// nor wrapped yet) by a mutationPool.
+func wrapMutationPool(db *gorm.DB) {
+	switch db.ConnPool.(type) {
+	case *mutationPool, gorm.TxCommitter:
+		return
+	}
+	_, txBeginner := db.ConnPool.(gorm.TxBeginner)
+	_, poolBeginner := db.ConnPool.(gorm.ConnPoolBeginner)
+	if !txBeginner && !poolBeginner {
+		return
+	}
+	pool := &mutationPool{ConnPool: db.ConnPool}
+	if db.Statement.ConnPool == db.ConnPool {
+		db.Statement.ConnPool = pool
+	}
+	db.ConnPool = pool
+}
+
+// mutationPool is a connection pool whose transactions are mutationTxs.
+type mutationPool struct {
+	gorm.ConnPool
+}
+
+func (p *mutationPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &mutationTx{Tx: tx}, nil
+	case gorm.ConnPoolBeginner:
+		pool, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if tx, ok := pool.(gorm.Tx); ok {
+			return &mutationTx{Tx: tx}, nil
+		}
+		return pool, nil
+	}
+	return nil, gorm.ErrInvalidTransaction
+}
+
+// GetDBConn returns the *sql.DB of the pool, for gorm.DB.DB.
+func (p *mutationPool) GetDBConn() (*sql.DB, error) {
+	switch pool := p.ConnPool.(type) {
+	case *sql.DB:
+		return pool, nil
+	case gorm.GetDBConnector:
+		return pool.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// mutationTx is a transaction calling the OnMutation listeners of its
+// statements after its commit.
+type mutationTx struct {
+	gorm.Tx
+	mu      sync.Mutex
+	pending []pendingMutation
+}
+
+type pendingMutation struct {
+	db    *gorm.DB
+	table string
+}
+
+// mutationTxOf returns the mutationTx of the connection pool of a
+// statement, or nil if the statement is not in one.
+func mutationTxOf(pool gorm.ConnPool) *mutationTx {
+	switch pool := pool.(type) {
+	case *mutationTx:
+		return pool
+	case *gorm.PreparedStmtTX:
+		tx, _ := pool.Tx.(*mutationTx)
+		return tx
+	}
+	return nil
+}
+
+func (tx *mutationTx) postpone(db *gorm.DB, table string) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, m := range tx.pending {
+		if m.table == table {
+			return
+		}
+	}
+	tx.pending = append(tx.pending, pendingMutation{db: db, table: table})
+}
+
+func (tx *mutationTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	pending := tx.pending
+	tx.pending = nil
+	tx.mu.Unlock()
+	for _, m := range pending {
+		notifyListeners(m.db, m.table)
+	}
+	return nil
+}
+
+func (tx *mutationTx) Rollback() error {
+	tx.mu.Lock()
+	tx.pending = nil
+	tx.mu.Unlock()
+	return tx.Tx.Rollback()
+}
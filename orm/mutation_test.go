@@ -0,0 +1,106 @@
+package orm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type shipment struct {
+	BasicModel
+	Code string
+}
+
+// shipmentMutations counts the OnMutation calls of the shipments table (the
+// listeners are global: of all the tests).
+var shipmentMutations struct {
+	sync.Mutex
+	n int
+}
+
+func init() {
+	OnMutation(func(db *gorm.DB, table string) {
+		if table == "shipments" {
+			shipmentMutations.Lock()
+			shipmentMutations.n++
+			shipmentMutations.Unlock()
+		}
+	})
+}
+
+func TestOnMutation(t *testing.T) {
+	db := openDB(t, &shipment{})
+	mutations := func() int {
+		shipmentMutations.Lock()
+		defer shipmentMutations.Unlock()
+		n := shipmentMutations.n
+		shipmentMutations.n = 0
+		return n
+	}
+	mutations()
+
+	if err := db.Create(&shipment{Code: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := mutations(); n != 1 {
+		t.Errorf("create: mutations = %d, want 1", n)
+	}
+	if err := db.Model(&shipment{}).Where("code = ?", "none").Update("code", "b").Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := mutations(); n != 0 {
+		t.Errorf("update of no rows: mutations = %d, want 0", n)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&shipment{Code: "b"}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&shipment{}).Where("code = ?", "a").Update("code", "c").Error; err != nil {
+			return err
+		}
+		if n := mutations(); n != 0 {
+			t.Errorf("in the transaction: mutations = %d, want 0", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mutations(); n != 1 {
+		t.Errorf("committed: mutations = %d, want 1 (once by table)", n)
+	}
+
+	errRollback := errors.New("rollback")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("code = ?", "b").Delete(&shipment{}).Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("err = %v, want %v", err, errRollback)
+	}
+	if n := mutations(); n != 0 {
+		t.Errorf("rolled back: mutations = %d, want 0", n)
+	}
+
+	prepared := db.Session(&gorm.Session{PrepareStmt: true})
+	err = prepared.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&shipment{Code: "d"}).Error; err != nil {
+			return err
+		}
+		if n := mutations(); n != 0 {
+			t.Errorf("in the prepared transaction: mutations = %d, want 0", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mutations(); n != 1 {
+		t.Errorf("prepared committed: mutations = %d, want 1", n)
+	}
+}
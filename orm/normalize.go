@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Normalization is a set of normalizations of a string column, see
+// Normalizer.
+type Normalization int
+
+const (
+	// NormalizeTrim trims the leading and trailing white spaces.
+	NormalizeTrim Normalization = 1 << iota
+	// NormalizeLower lowercases the value.
+	NormalizeLower
+)
+
+// Normalizer is implemented by models normalizing string columns before
+// they are written, e.g. against the duplicate-looking rows and the failed
+// lookups of the values with stray white spaces:
+//
+//	func (User) Normalizations() map[string]orm.Normalization {
+//	    return map[string]orm.Normalization{
+//	        "name":  orm.NormalizeTrim,
+//	        "email": orm.NormalizeTrim | orm.NormalizeLower,
+//	    }
+//	}
+//
+// The keys are column (or field) names of string (or *string) fields. The
+// values are normalized by the service on create and update (see
+// NormalizeValues), before the allowed values and the unique keys are
+// checked.
+type Normalizer interface {
+	Normalizations() map[string]Normalization
+}
+
+// normalizations returns the Normalizations of model by the column names.
+func normalizations(model any) (map[string]Normalization, error) {
+	normalizer, ok := model.(Normalizer)
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(model))
+		if !v.IsValid() {
+			return nil, nil
+		}
+		if normalizer, ok = v.Interface().(Normalizer); !ok {
+			return nil, nil
+		}
+	}
+	normalizations := map[string]Normalization{}
+	for name, normalization := range normalizer.Normalizations() {
+		field, err := LookUpField(model, name)
+		if err != nil {
+			return nil, err
+		}
+		t := field.FieldType
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("normalize %q: not a string field", name)
+		}
+		normalizations[field.DBName] = normalization
+	}
+	return normalizations, nil
+}
+
+// normalize returns s normalized.
+func (n Normalization) normalize(s string) string {
+	if n&NormalizeTrim != 0 {
+		s = strings.TrimSpace(s)
+	}
+	if n&NormalizeLower != 0 {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// NormalizeValues normalizes the string columns of model (a pointer to a
+// struct) by its Normalizer, if implemented.
+func NormalizeValues(model any) error {
+	normalizations, err := normalizations(model)
+	if err != nil || len(normalizations) == 0 {
+		return err
+	}
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+	s, err := ParseSchema(model)
+	if err != nil {
+		return err
+	}
+	for column, normalization := range normalizations {
+		v := s.LookUpField(column).ReflectValueOf(context.Background(), rv.Elem())
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+		v.SetString(normalization.normalize(v.String()))
+	}
+	return nil
+}
+
+// NormalizeColumnValues normalizes the values (column name => value, e.g.
+// of an update map) of the string columns of model by its Normalizer, in
+// place. The values which are not strings (e.g. nil or gorm.Expr) are left
+// as they are.
+func NormalizeColumnValues(model any, columns map[string]any) error {
+	normalizations, err := normalizations(model)
+	if err != nil || len(normalizations) == 0 {
+		return err
+	}
+	for column, value := range columns {
+		field, err := LookUpField(model, column)
+		if err != nil {
+			continue
+		}
+		if normalization, ok := normalizations[field.DBName]; ok {
+			columns[column] = normalization.normalizeValue(value)
+		}
+	}
+	return nil
+}
+
+// NormalizeValue returns the value of the column of model normalized by
+// the Normalizer of model, if any.
+func NormalizeValue(model any, column string, value any) (any, error) {
+	normalizations, err := normalizations(model)
+	if err != nil || len(normalizations) == 0 {
+		return value, err
+	}
+	field, err := LookUpField(model, column)
+	if err != nil {
+		return value, nil
+	}
+	if normalization, ok := normalizations[field.DBName]; ok {
+		return normalization.normalizeValue(value), nil
+	}
+	return value, nil
+}
+
+// normalizeValue returns the value normalized if it is a string or a
+// non-nil *string (of any string type), else as is.
+func (n Normalization) normalizeValue(value any) any {
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.Kind() == reflect.String:
+		normalized := reflect.New(rv.Type()).Elem()
+		normalized.SetString(n.normalize(rv.String()))
+		return normalized.Interface()
+	case rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.String:
+		normalized := reflect.New(rv.Elem().Type())
+		normalized.Elem().SetString(n.normalize(rv.Elem().String()))
+		return normalized.Interface()
+	}
+	return value
+}
@@ -43,13 +43,41 @@ func ConnectDB(driver DBDriver, dsn string) (*gorm.DB, error) {
 	DB, err = gorm.Open(driverOpen(dsn), &gorm.Config{
 		Logger: log.Logger4Gorm,
 	})
+	if err == nil {
+		err = registerCallbacks(DB)
+	}
 	return DB, err
 }
 
+// UseDB sets the global crud.DB instance, registering the callbacks of
+// crud (e.g. the audit of Audited models) into it.
 func UseDB(db *gorm.DB) {
+	if err := registerCallbacks(db); err != nil {
+		logger.WithError(err).Error("UseDB: register callbacks failed")
+	}
 	DB = db
 }
 
+// registerCallbacks registers the gorm callbacks of crud into db: the
+// audit of Audited models, the ValidateTx of TxValidator models, the
+// QueryTrace of the requests, the GlobalScopes of the reads, and the
+// OnMutation listeners.
+func registerCallbacks(db *gorm.DB) error {
+	if err := registerAuditCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerValidateCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerTraceCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerScopeCallbacks(db); err != nil {
+		return err
+	}
+	return registerMutationCallbacks(db)
+}
+
 // region dbOpener
 
 // DBOpener opens a gorm Dialector.
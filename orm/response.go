@@ -0,0 +1,35 @@
+package orm
+
+import "reflect"
+
+// ResponseKeyer is implemented by models responded under keys of their
+// own, instead of their type names (User for a model, Users for a list),
+// e.g. to match the contracts of the existing clients:
+//
+//	func (User) ResponseKeys() (single, plural string) {
+//	    return "user", "users"
+//	}
+//	// GET /users     => { code, msg, users: [...], meta }
+//	// GET /users/1   => { code, msg, user: {...} }
+//
+// An empty key falls back to the default one.
+type ResponseKeyer interface {
+	ResponseKeys() (single, plural string)
+}
+
+// ResponseKeys returns the keys of the models of the type (a struct, or a
+// pointer to one) by its ResponseKeyer. ok is false if it has none.
+func ResponseKeys(t reflect.Type) (single, plural string, ok bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", "", false
+	}
+	keyer, ok := reflect.New(t).Interface().(ResponseKeyer)
+	if !ok {
+		return "", "", false
+	}
+	single, plural = keyer.ResponseKeys()
+	return single, plural, true
+}
@@ -0,0 +1,66 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"sync"
+)
+
+// schemaCache caches parsed schemas when there is no DB connected.
+var schemaCache = &sync.Map{}
+
+// ParseSchema parses the GORM schema (table, fields, relationships) of the
+// given model. Pass a model value or a pointer to it.
+//
+// The schema is parsed with the cache and naming strategy of the global DB,
+// so join tables set up by DB.SetupJoinTable are respected.
+func ParseSchema(model any) (*schema.Schema, error) {
+	if DB != nil {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		return stmt.Schema, nil
+	}
+	return schema.Parse(model, schemaCache, schema.NamingStrategy{})
+}
+
+// LookUpField finds the field of model by the column name (e.g. "user_id")
+// or the field name (e.g. "UserID").
+func LookUpField(model any, name string) (*schema.Field, error) {
+	s, err := ParseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	field := s.LookUpField(name)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%w: %q of %s", ErrUnknownColumn, name, s.Name)
+	}
+	return field, nil
+}
+
+// LookUpUniqueField is LookUpField for a column identifying the models:
+// the primary key, a `gorm:"unique"` column, or a column with a unique
+// index of its own (`gorm:"uniqueIndex"`).
+func LookUpUniqueField(model any, name string) (*schema.Field, error) {
+	field, err := LookUpField(model, name)
+	if err != nil {
+		return nil, err
+	}
+	if field.PrimaryKey || field.Unique {
+		return field, nil
+	}
+	for _, index := range field.Schema.ParseIndexes() {
+		if index.Class == "UNIQUE" && len(index.Fields) == 1 && index.Fields[0].Field == field {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q of %s", ErrNotUniqueColumn, name, field.Schema.Name)
+}
+
+var (
+	ErrUnknownColumn   = errors.New("unknown column")
+	ErrNotUniqueColumn = errors.New("not a unique column")
+)
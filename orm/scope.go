@@ -0,0 +1,165 @@
+package orm
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// GlobalScope returns the scope of the reads of a model (by its schema)
+// from the context of the query, or nil to leave them as they are, see
+// RegisterGlobalScope.
+type GlobalScope func(ctx context.Context, model *schema.Schema) func(db *gorm.DB) *gorm.DB
+
+type namedScope struct {
+	name  string
+	scope GlobalScope
+}
+
+var (
+	globalScopesMu sync.RWMutex
+	globalScopes   []namedScope
+)
+
+// RegisterGlobalScope registers the scope (by name, replacing the one of
+// the same name, which moves it last) into all the reads and the writes
+// by conditions of all the models of the connected DB, e.g. to hide the
+// internal rows to all but the admins:
+//
+//	orm.RegisterGlobalScope("internal", func(ctx context.Context, model *schema.Schema) func(db *gorm.DB) *gorm.DB {
+//	    if model.LookUpField("internal") == nil || isAdmin(reqctx.Roles(ctx)) {
+//	        return nil
+//	    }
+//	    return service.FilterBy(model.Table+".internal", false)
+//	})
+//
+// The reads are the queries of the models: find, first, count, pluck and
+// scan (the lists, gets, counts... of the service), and the preloads of
+// their associations, which are scoped by the models preloaded. The writes
+// by conditions are the updates and deletes with a WHERE (e.g.
+// service.ReplaceColumn, RestoreMany and ArchiveMany), which write only the
+// rows the scope lets be read. The writes of models by their primary keys
+// (e.g. Save, or Delete of a model loaded) are not scoped: the models are
+// read (by a scoped query) first. A scope is applied just before the
+// statement is run, after all the options of the query (the filters, the
+// QueryOptionClosure of the routes, the ownership filters of
+// ScopeByParams...), which its conditions are ANDed with, in the order of
+// the registrations. The raw queries and the joined associations are not
+// scoped: qualify the columns by the model.Table against the ambiguities
+// of the joins.
+//
+// A scope sees the context of the query, i.e. of the request for the
+// queries of the handlers, to bypass itself for the admins, as above. The
+// contexts without a request (e.g. of the background jobs) bypass the
+// scopes by WithoutGlobalScopes.
+func RegisterGlobalScope(name string, scope GlobalScope) {
+	globalScopesMu.Lock()
+	defer globalScopesMu.Unlock()
+	scopes := make([]namedScope, 0, len(globalScopes)+1) // copied: the callbacks read the previous ones
+	for _, s := range globalScopes {
+		if s.name != name {
+			scopes = append(scopes, s)
+		}
+	}
+	globalScopes = append(scopes, namedScope{name: name, scope: scope})
+}
+
+// UnregisterGlobalScope removes the GlobalScope of the name, if any.
+func UnregisterGlobalScope(name string) {
+	globalScopesMu.Lock()
+	defer globalScopesMu.Unlock()
+	var scopes []namedScope
+	for _, s := range globalScopes {
+		if s.name != name {
+			scopes = append(scopes, s)
+		}
+	}
+	globalScopes = scopes
+}
+
+type withoutGlobalScopesKey struct{}
+
+// WithoutGlobalScopes returns a copy of ctx whose queries bypass the
+// GlobalScopes of the names, or all of them if none, e.g. for the jobs
+// processing all the rows:
+//
+//	ctx := orm.WithoutGlobalScopes(context.Background(), "internal")
+//	service.EachBatch[User](ctx, 100, recompute)
+func WithoutGlobalScopes(ctx context.Context, names ...string) context.Context {
+	if names == nil {
+		names = []string{}
+	}
+	return context.WithValue(ctx, withoutGlobalScopesKey{}, names)
+}
+
+// bypassGlobalScope reports whether the queries of ctx bypass the
+// GlobalScope of the name.
+func bypassGlobalScope(ctx context.Context, name string) bool {
+	if ctx == nil {
+		return false
+	}
+	names, ok := ctx.Value(withoutGlobalScopesKey{}).([]string)
+	if !ok {
+		return false
+	}
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registerScopeCallbacks registers the gorm callbacks applying the
+// GlobalScopes to the queries and the writes by conditions, once for the
+// callbacks of db.
+func registerScopeCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	if callback.Query().Get("crud:global_scopes") != nil {
+		return nil
+	}
+	for _, err := range []error{
+		callback.Query().Before("gorm:query").Register("crud:global_scopes", applyGlobalScopes),
+		callback.Row().Before("gorm:row").Register("crud:global_scopes", applyGlobalScopes),
+		callback.Update().Before("gorm:update").Register("crud:global_scopes", applyWriteGlobalScopes),
+		callback.Delete().Before("gorm:delete").Register("crud:global_scopes", applyWriteGlobalScopes),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyGlobalScopes(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.SQL.Len() > 0 {
+		return
+	}
+	globalScopesMu.RLock()
+	scopes := globalScopes
+	globalScopesMu.RUnlock()
+	ctx := db.Statement.Context
+	for _, s := range scopes {
+		if bypassGlobalScope(ctx, s.name) {
+			continue
+		}
+		if scope := s.scope(ctx, db.Statement.Schema); scope != nil {
+			scope(db) // the conditions are added to the statement in place
+		}
+	}
+}
+
+// applyWriteGlobalScopes applies the GlobalScopes to the updates and the
+// deletes with conditions. The ones of the models by their primary keys
+// have no WHERE yet: gorm adds the keys in gorm:update and gorm:delete.
+func applyWriteGlobalScopes(db *gorm.DB) {
+	if _, ok := db.Statement.Clauses["WHERE"]; !ok {
+		return
+	}
+	applyGlobalScopes(db)
+}
@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type ticket struct {
+	BasicModel
+	Title    string
+	Internal bool
+	Comments []*comment
+}
+
+type comment struct {
+	BasicModel
+	TicketID uint
+	Internal bool
+}
+
+// seedTickets creates the tickets 1 (public) and 2 (internal), with a
+// public and an internal comment each.
+func seedTickets(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, internal := range []bool{false, true} {
+		tk := ticket{Title: "t", Internal: internal, Comments: []*comment{{}, {Internal: true}}}
+		if err := db.Create(&tk).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// registerInternalScope registers the GlobalScope "internal" hiding the
+// internal rows to all but the admins, for the test.
+func registerInternalScope(t *testing.T) {
+	t.Helper()
+	RegisterGlobalScope("internal", func(ctx context.Context, model *schema.Schema) func(db *gorm.DB) *gorm.DB {
+		if model.LookUpField("internal") == nil || reqctx.HasRole(ctx, "admin") {
+			return nil
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(model.Table+".internal = ?", false)
+		}
+	})
+	t.Cleanup(func() { UnregisterGlobalScope("internal") })
+}
+
+func TestGlobalScope_Reads(t *testing.T) {
+	db := openDB(t, &ticket{}, &comment{})
+	seedTickets(t, db)
+	registerInternalScope(t)
+
+	admin, _ := gin.CreateTestContext(httptest.NewRecorder())
+	admin.Request = httptest.NewRequest("GET", "/", nil)
+	reqctx.SetRoles(admin, "admin")
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantTickets  int
+		wantComments int // preloaded
+	}{
+		{"scoped", context.Background(), 1, 1},
+		{"admin", admin.Request.Context(), 2, 4},
+		{"without all the scopes", WithoutGlobalScopes(context.Background()), 2, 4},
+		{"without the scope", WithoutGlobalScopes(context.Background(), "internal"), 2, 4},
+		{"without another scope", WithoutGlobalScopes(context.Background(), "other"), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.WithContext(tt.ctx)
+
+			var tickets []*ticket
+			if err := tx.Preload("Comments").Order("id").Find(&tickets).Error; err != nil {
+				t.Fatal(err)
+			}
+			comments := 0
+			for _, tk := range tickets {
+				comments += len(tk.Comments)
+			}
+			if len(tickets) != tt.wantTickets || comments != tt.wantComments {
+				t.Errorf("list: tickets = %d, comments = %d, want %d, %d", len(tickets), comments, tt.wantTickets, tt.wantComments)
+			}
+
+			var count int64
+			if err := tx.Model(&ticket{}).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != int64(tt.wantTickets) {
+				t.Errorf("count = %d, want %d", count, tt.wantTickets)
+			}
+
+			var internal ticket
+			err := tx.First(&internal, 2).Error
+			if hidden := tt.wantTickets == 1; hidden != errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("get internal: err = %v, hidden = %v", err, hidden)
+			}
+		})
+	}
+}
+
+func TestGlobalScope_Writes(t *testing.T) {
+	db := openDB(t, &ticket{}, &comment{})
+	seedTickets(t, db)
+	registerInternalScope(t)
+	titles := func() map[uint]string {
+		t.Helper()
+		var tickets []ticket
+		if err := db.Unscoped().WithContext(WithoutGlobalScopes(context.Background())).Find(&tickets).Error; err != nil {
+			t.Fatal(err)
+		}
+		titles := map[uint]string{}
+		for _, tk := range tickets {
+			if tk.DeletedAt.Valid {
+				titles[tk.ID] = "deleted"
+			} else {
+				titles[tk.ID] = tk.Title
+			}
+		}
+		return titles
+	}
+
+	// by conditions: only the rows read by the scope
+	result := db.Model(&ticket{}).Where("title = ?", "t").Update("title", "updated")
+	if result.Error != nil || result.RowsAffected != 1 {
+		t.Errorf("update by conditions: rows = %d, err = %v, want 1 row", result.RowsAffected, result.Error)
+	}
+	if got := titles(); got[1] != "updated" || got[2] != "t" {
+		t.Errorf("titles = %v, want the public one updated", got)
+	}
+
+	// of a model by its primary key: not scoped
+	if err := db.Model(&ticket{BasicModel: BasicModel{ID: 2}}).Update("title", "by id").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(); got[2] != "by id" {
+		t.Errorf("titles = %v, want the internal one updated by its id", got)
+	}
+
+	result = db.Where("id > ?", 0).Delete(&ticket{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		t.Errorf("delete by conditions: rows = %d, err = %v, want 1 row", result.RowsAffected, result.Error)
+	}
+	if got := titles(); got[1] != "deleted" || got[2] != "by id" {
+		t.Errorf("titles = %v, want the public one deleted", got)
+	}
+
+	result = db.WithContext(WithoutGlobalScopes(context.Background())).Where("id > ?", 0).Delete(&ticket{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		t.Errorf("delete without the scopes: rows = %d, err = %v, want 1 row", result.RowsAffected, result.Error)
+	}
+	if got := titles(); got[2] != "deleted" {
+		t.Errorf("titles = %v, want the internal one deleted", got)
+	}
+}
@@ -0,0 +1,104 @@
+package orm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+)
+
+// KeyQueryTrace is the reqctx key of the QueryTrace of a request.
+const KeyQueryTrace = "crud/query_trace"
+
+// QueryTrace collects the statements run with the context of a request
+// (by the gorm callbacks), with their durations, e.g. to log the queries
+// of the slow requests:
+//
+//	trace := new(orm.QueryTrace)
+//	reqctx.Set(c, orm.KeyQueryTrace, trace)
+//	c.Next()
+//	trace.Statements()  // => [{SQL: "SELECT * FROM `users` WHERE `name` = ?", Duration: 1.2s}]
+type QueryTrace struct {
+	mu         sync.Mutex
+	statements []TracedStatement
+}
+
+// TracedStatement is a statement of a QueryTrace. The SQL keeps the
+// placeholders of the vars, which are not traced: the statements are
+// logged (see controller.SlowOperationLogger), and the vars of the writes
+// are passwords, tokens, personal data...
+type TracedStatement struct {
+	SQL          string        `json:"sql"`
+	Duration     time.Duration `json:"duration"`
+	RowsAffected int64         `json:"rows_affected"`
+}
+
+func (t *QueryTrace) Statements() []TracedStatement {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TracedStatement(nil), t.statements...)
+}
+
+// queryTrace returns the QueryTrace of the ctx (else nil).
+func queryTrace(ctx context.Context) *QueryTrace {
+	trace, _ := reqctx.Get[*QueryTrace](ctx, KeyQueryTrace)
+	return trace
+}
+
+const traceStartKey = "crud:trace_start"
+
+// registerTraceCallbacks registers the gorm callbacks recording the
+// statements into the QueryTrace of their contexts, once for the
+// callbacks of db.
+func registerTraceCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	if callback.Query().Get("crud:trace_start") != nil {
+		return nil
+	}
+	for _, err := range []error{
+		callback.Query().Before("gorm:query").Register("crud:trace_start", startTrace),
+		callback.Query().After("gorm:query").Register("crud:trace", endTrace),
+		callback.Row().Before("gorm:row").Register("crud:trace_start", startTrace),
+		callback.Row().After("gorm:row").Register("crud:trace", endTrace),
+		callback.Raw().Before("gorm:raw").Register("crud:trace_start", startTrace),
+		callback.Raw().After("gorm:raw").Register("crud:trace", endTrace),
+		callback.Create().Before("gorm:create").Register("crud:trace_start", startTrace),
+		callback.Create().After("gorm:create").Register("crud:trace", endTrace),
+		callback.Update().Before("gorm:update").Register("crud:trace_start", startTrace),
+		callback.Update().After("gorm:update").Register("crud:trace", endTrace),
+		callback.Delete().Before("gorm:delete").Register("crud:trace_start", startTrace),
+		callback.Delete().After("gorm:delete").Register("crud:trace", endTrace),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startTrace(db *gorm.DB) {
+	if queryTrace(db.Statement.Context) != nil {
+		db.InstanceSet(traceStartKey, time.Now())
+	}
+}
+
+func endTrace(db *gorm.DB) {
+	trace := queryTrace(db.Statement.Context)
+	if trace == nil || db.DryRun {
+		return
+	}
+	start, ok := db.InstanceGet(traceStartKey)
+	if !ok {
+		return
+	}
+	statement := TracedStatement{
+		SQL:          db.Statement.SQL.String(),
+		Duration:     time.Since(start.(time.Time)),
+		RowsAffected: db.Statement.RowsAffected,
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	trace.statements = append(trace.statements, statement)
+}
@@ -0,0 +1,48 @@
+package orm
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/reqctx"
+)
+
+func TestQueryTrace(t *testing.T) {
+	db := openDB(t, &shipment{})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	trace := new(QueryTrace)
+	reqctx.Set(c, KeyQueryTrace, trace)
+	tx := db.WithContext(c.Request.Context())
+
+	const secret = "s3cr3t-t0k3n"
+	if err := tx.Create(&shipment{Code: secret}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var found []shipment
+	if err := tx.Where("code = ?", secret).Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&shipment{Code: "untraced"}).Error; err != nil { // without the context
+		t.Fatal(err)
+	}
+
+	statements := trace.Statements()
+	if len(statements) != 2 {
+		t.Fatalf("statements = %+v, want the create and the find", statements)
+	}
+	for i, prefix := range []string{"INSERT INTO `shipments`", "SELECT * FROM `shipments`"} {
+		s := statements[i]
+		if !strings.HasPrefix(s.SQL, prefix) || !strings.Contains(s.SQL, "?") {
+			t.Errorf("statements[%d].SQL = %s, want %s... with placeholders", i, s.SQL, prefix)
+		}
+		if strings.Contains(s.SQL, secret) {
+			t.Errorf("statements[%d].SQL = %s, want the vars not traced", i, s.SQL)
+		}
+		if s.RowsAffected != 1 {
+			t.Errorf("statements[%d].RowsAffected = %d, want 1", i, s.RowsAffected)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UniqueKeyer is implemented by models with composite unique keys (e.g.
+// a unique index on several columns), for example:
+//
+//	func (Product) UniqueKeys() [][]string {
+//	    return [][]string{{"tenant_id", "sku"}}
+//	}
+//
+// The columns (or field names) of each key are checked by the service on
+// create and update, so that a violation is reported with the columns and
+// values of the key (see service.DuplicateError), instead of the raw
+// error of the database driver.
+type UniqueKeyer interface {
+	UniqueKeys() [][]string
+}
+
+// UniqueKeys returns the unique keys of the model by its UniqueKeyer, with
+// the columns resolved into column names. It fails with ErrUnknownColumn
+// for an unknown column, which is a programming error, to be found at
+// startup.
+func UniqueKeys(model any) ([][]string, error) {
+	keyer, ok := model.(UniqueKeyer)
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(model))
+		if !v.IsValid() {
+			return nil, nil
+		}
+		if keyer, ok = v.Interface().(UniqueKeyer); !ok {
+			return nil, nil
+		}
+	}
+	var keys [][]string
+	for _, key := range keyer.UniqueKeys() {
+		if len(key) == 0 {
+			continue
+		}
+		columns := make([]string, 0, len(key))
+		for _, name := range key {
+			field, err := LookUpField(model, name)
+			if err != nil {
+				return nil, fmt.Errorf("unique key %v: %w", key, err)
+			}
+			columns = append(columns, field.DBName)
+		}
+		keys = append(keys, columns)
+	}
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// TxValidator is implemented by models with validations querying the
+// database, which the binding tags can not express, nor the constraints of
+// the database. ValidateTx is called with tx, the transaction of the
+// create or update, before the write, and its error rolls it back. For
+// example, an email unique among the active accounts only, ignoring case:
+//
+//	func (a *Account) ValidateTx(tx *gorm.DB) error {
+//	    if !a.Active {
+//	        return nil
+//	    }
+//	    var n int64
+//	    err := tx.Model(&Account{}).
+//	        Where("LOWER(email) = LOWER(?) AND active AND id <> ?", a.Email, a.ID).
+//	        Count(&n).Error
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if n > 0 {
+//	        return &orm.ValidationError{Field: "email", Message: "already used by another active account"}
+//	    }
+//	    return nil
+//	}
+//
+// The ValidationError is responded as a 422 with the field and message.
+// The queries of tx see the rows of the transaction, and run on it: read
+// the rows to check under a lock (or a serializable transaction) if
+// concurrent writes might race the check.
+//
+// It is called by gorm callbacks (like the audit of Audited models) for
+// the models created and updated (with the columns of an update by a map
+// set): not for the bulk updates by conditions, nor under DryRun. Without
+// a transaction if the gorm.Config SkipDefaultTransaction is set.
+type TxValidator interface {
+	ValidateTx(tx *gorm.DB) error
+}
+
+// ValidationError is the error of a TxValidator rejecting the model, by
+// the Field (JSON name, or empty for the model) and a Message for the
+// clients. It matches ErrValidation by errors.Is.
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", ErrValidation, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrValidation, e.Field, e.Message)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+var ErrValidation = errors.New("validation failed")
+
+// registerValidateCallbacks registers the gorm callbacks calling the
+// ValidateTx of TxValidator models, once for the callbacks of db.
+func registerValidateCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	if callback.Create().Get("crud:validate") != nil {
+		return nil
+	}
+	// in the transaction, before the write
+	const begin = "gorm:begin_transaction"
+	for _, err := range []error{
+		callback.Create().After(begin).Before("gorm:create").Register("crud:validate", validateCreate),
+		callback.Update().After(begin).Before("gorm:update").Register("crud:validate", validateUpdate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCreate(db *gorm.DB) {
+	validate(db, false)
+}
+
+func validateUpdate(db *gorm.DB) {
+	validate(db, true)
+}
+
+// validate calls the ValidateTx of the models of the statement, which are
+// required to have primary keys (i.e. be loaded) for updates. The first
+// error is added to db, which fails (and rolls back) the write.
+func validate(db *gorm.DB, update bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.DryRun {
+		return
+	}
+	if _, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(TxValidator); !ok {
+		return
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	var models []reflect.Value
+	switch rv.Kind() {
+	case reflect.Struct:
+		if columns, ok := db.Statement.Dest.(map[string]any); ok && update {
+			rv = withColumns(db, rv, columns)
+		}
+		models = []reflect.Value{rv}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if model := reflect.Indirect(rv.Index(i)); model.Kind() == reflect.Struct {
+				models = append(models, model)
+			}
+		}
+	}
+	for _, model := range models {
+		if update {
+			if _, ok := auditID(db, model); !ok {
+				continue
+			}
+		}
+		if !model.CanAddr() {
+			continue
+		}
+		validator := model.Addr().Interface().(TxValidator)
+		if err := validator.ValidateTx(db.Session(&gorm.Session{NewDB: true})); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+	}
+}
+
+// withColumns returns a copy of the model with the columns of an update
+// (by column or field names) set, as the model is written.
+func withColumns(db *gorm.DB, model reflect.Value, columns map[string]any) reflect.Value {
+	updated := reflect.New(model.Type()).Elem()
+	updated.Set(model)
+	for name, value := range columns {
+		if field := db.Statement.Schema.LookUpField(name); field != nil {
+			_ = field.Set(db.Statement.Context, updated, value)
+		}
+	}
+	return updated
+}
@@ -0,0 +1,86 @@
+package orm
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type signup struct {
+	BasicModel
+	Email string
+}
+
+type signupLog struct {
+	ID    uint `gorm:"primarykey"`
+	Email string
+}
+
+// ValidateTx logs the signup (a write rolled back with a failed one), and
+// rejects the emails of other signups.
+func (s *signup) ValidateTx(tx *gorm.DB) error {
+	if err := tx.Create(&signupLog{Email: s.Email}).Error; err != nil {
+		return err
+	}
+	var n int64
+	if err := tx.Model(&signup{}).Where("email = ? AND id <> ?", s.Email, s.ID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return &ValidationError{Field: "email", Message: "already signed up"}
+	}
+	return nil
+}
+
+func TestValidateTx(t *testing.T) {
+	db := openDB(t, &signup{}, &signupLog{})
+	count := func(model any) (n int64) {
+		t.Helper()
+		if err := db.Model(model).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := db.Create(&signup{Email: "a@x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.Create(&signup{Email: "a@x"}).Error
+	var validation *ValidationError
+	if !errors.As(err, &validation) || !errors.Is(err, ErrValidation) || validation.Field != "email" {
+		t.Fatalf("create of a duplicate: err = %v, want the ValidationError of the email", err)
+	}
+	if signups, logs := count(&signup{}), count(&signupLog{}); signups != 1 || logs != 1 {
+		t.Errorf("signups, logs = %d, %d, want 1, 1: the failed create rolled back", signups, logs)
+	}
+
+	b := &signup{Email: "b@x"}
+	if err := db.Create(b).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(b).Updates(map[string]any{"email": "a@x"}).Error; !errors.Is(err, ErrValidation) {
+		t.Errorf("update to a duplicate: err = %v, want ErrValidation", err)
+	}
+	var got signup
+	if err := db.First(&got, b.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "b@x" || count(&signupLog{}) != 2 {
+		t.Errorf("email = %q, logs = %d, want b@x, 2: the failed update rolled back", got.Email, count(&signupLog{}))
+	}
+
+	// ValidateTx runs in the transaction of the write: it sees its rows.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&signup{Email: "c@x"}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&signup{Email: "c@x"}).Error
+	})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("duplicate in a transaction: err = %v, want ErrValidation", err)
+	}
+	if n := count(&signup{}); n != 2 {
+		t.Errorf("signups = %d, want 2: the transaction rolled back", n)
+	}
+}
@@ -0,0 +1,127 @@
+// Package cache is the pluggable cache of the responses of the read
+// routes (see enum.CacheOption), with an in-memory implementation.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores values by keys, with a TTL. It must be safe for concurrent
+// use. The misses are not errors: Get reports them by ok.
+//
+// Other stores are adapted by implementing it, e.g. Redis (by go-redis):
+//
+//	type Redis struct{ *redis.Client }
+//
+//	func (r Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//	    value, err := r.Client.Get(ctx, key).Bytes()
+//	    if err == redis.Nil {
+//	        return nil, false, nil
+//	    }
+//	    return value, err == nil, err
+//	}
+//
+//	func (r Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//	    return r.Client.Set(ctx, key, value, ttl).Err()
+//	}
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores the value of the key for ttl, or without expiration if
+	// ttl is 0.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Memory is a Cache in the memory of the process, e.g. for a single
+// instance, or tests. The expired entries are dropped from time to time,
+// and the least recently used ones beyond the MaxEntries: the entries
+// invalidated (e.g. of the old generations of enum.CacheOption) are not
+// kept forever, even without a TTL.
+type Memory struct {
+	// MaxEntries bounds the number of entries (0 for no bound).
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of the *entry in lru
+	lru     list.List                // the most recently used first
+	sets    int
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for never
+}
+
+// DefaultMaxEntries is the MaxEntries of the Memory caches of NewMemory.
+const DefaultMaxEntries = 10000
+
+// NewMemory returns an empty Memory cache of DefaultMaxEntries.
+func NewMemory() *Memory {
+	return &Memory{MaxEntries: DefaultMaxEntries, entries: map[string]*list.Element{}}
+}
+
+// cleanupEvery is the number of Set calls between cleanups.
+const cleanupEvery = 1024
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := element.Value.(*entry)
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		m.remove(element)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(element)
+	return e.value, true, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.entries == nil {
+		m.entries = map[string]*list.Element{}
+	}
+	now := time.Now()
+	e := &entry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	if element, ok := m.entries[key]; ok {
+		element.Value = e
+		m.lru.MoveToFront(element)
+	} else {
+		m.entries[key] = m.lru.PushFront(e)
+	}
+
+	m.sets++
+	if m.sets%cleanupEvery == 0 {
+		m.cleanup(now)
+	}
+	for m.MaxEntries > 0 && m.lru.Len() > m.MaxEntries {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// cleanup drops the expired entries.
+func (m *Memory) cleanup(now time.Time) {
+	for _, element := range m.entries {
+		if e := element.Value.(*entry); !e.expires.IsZero() && !now.Before(e.expires) {
+			m.remove(element)
+		}
+	}
+}
+
+func (m *Memory) remove(element *list.Element) {
+	m.lru.Remove(element)
+	delete(m.entries, element.Value.(*entry).key)
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	get := func(key string) string {
+		t.Helper()
+		value, ok, err := m.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return "<miss>"
+		}
+		return string(value)
+	}
+
+	if got := get("a"); got != "<miss>" {
+		t.Errorf("Get(a) = %s, want a miss", got)
+	}
+	if err := m.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(ctx, "b", []byte("2"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("a"); got != "1" {
+		t.Errorf("Get(a) = %s, want 1", got)
+	}
+	if got := get("b"); got != "2" {
+		t.Errorf("Get(b) = %s, want 2", got)
+	}
+	if err := m.Set(ctx, "a", []byte("3"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("a"); got != "3" {
+		t.Errorf("Get(a) = %s, want 3 (replaced)", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if got := get("b"); got != "<miss>" {
+		t.Errorf("Get(b) = %s, want a miss (expired)", got)
+	}
+	if got := get("a"); got != "3" {
+		t.Errorf("Get(a) = %s, want 3 (without TTL)", got)
+	}
+}
+
+func TestMemory_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	m := &Memory{MaxEntries: 3}
+	for i := 0; i < 3; i++ {
+		if err := m.Set(ctx, fmt.Sprint(i), []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := m.Get(ctx, "0"); !ok { // 0 used: 1 is the least recently
+		t.Fatal("Get(0): missed")
+	}
+	for i := 3; i < 5; i++ {
+		if err := m.Set(ctx, fmt.Sprint(i), []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, want := range map[string]bool{"0": true, "1": false, "2": false, "3": true, "4": true} {
+		if _, ok, _ := m.Get(ctx, key); ok != want {
+			t.Errorf("Get(%s): ok = %v, want %v", key, ok, want)
+		}
+	}
+	if n := m.lru.Len(); n != 3 || len(m.entries) != 3 {
+		t.Errorf("entries = %d (%d listed), want 3", len(m.entries), n)
+	}
+}
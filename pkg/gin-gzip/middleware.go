@@ -0,0 +1,148 @@
+package gin_gzip
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gzip is a middleware that compresses the response body with gzip,
+// if the client accepts it (the Accept-Encoding request header).
+//
+// level is the compression level, e.g. gzip.DefaultCompression.
+//
+// The response is NOT compressed (passed through as is) if:
+//   - it already has a Content-Encoding header (set by the handler),
+//   - its Content-Type is an already-compressed format (images, videos,
+//     archives, see compressedTypes) or a stream (text/event-stream),
+//   - it has no body (HEAD, 1xx, 204, 304).
+//
+// So it is safe to use it together with handlers that compress by themselves.
+func Gzip(level int) gin.HandlerFunc {
+	pool := &sync.Pool{
+		New: func() any {
+			w, err := gzip.NewWriterLevel(nil, level)
+			if err != nil { // invalid level
+				w = gzip.NewWriter(nil)
+			}
+			return w
+		},
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead ||
+			!acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer, pool: pool}
+		c.Writer = w
+		defer w.close()
+
+		c.Next()
+	}
+}
+
+// compressedTypes are Content-Type prefixes of already-compressed content.
+var compressedTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/gzip", "application/x-gzip", "application/zip",
+	"application/x-7z-compressed", "application/x-rar-compressed",
+	"application/x-bzip2", "application/x-xz", "application/zstd",
+	"application/pdf", "application/octet-stream",
+	"text/event-stream",
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value
+// allows gzip, e.g. "gzip, deflate, br" or "*;q=0.5" (but no "gzip;q=0").
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter decides whether to compress on the first write of the body,
+// when the status and headers are all set by the handler.
+type gzipWriter struct {
+	gin.ResponseWriter
+	pool *sync.Pool
+
+	decided bool
+	gz      *gzip.Writer // nil if not compressing
+}
+
+func (w *gzipWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+
+	status := w.Status()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		return
+	}
+	if header.Get("Content-Encoding") != "" {
+		return
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return
+		}
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+
+	w.gz = w.pool.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close flushes the compressed data and puts the gzip.Writer back.
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	_ = w.gz.Close()
+	w.gz.Reset(nil)
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
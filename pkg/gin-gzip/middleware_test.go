@@ -0,0 +1,71 @@
+package gin_gzip
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := strings.Repeat("hello ", 100)
+	r := gin.New()
+	r.Use(Gzip(gzip.BestSpeed))
+	r.GET("/text", func(c *gin.Context) { c.String(http.StatusOK, body) })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(body)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.String(http.StatusOK, body)
+	})
+	r.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"accepted", "/text", "gzip, deflate, br", true},
+		{"wildcard", "/text", "*;q=0.5", true},
+		{"not accepted", "/text", "br", false},
+		{"refused", "/text", "gzip;q=0, br", false},
+		{"compressed content type", "/image", "gzip", false},
+		{"encoded by the handler", "/encoded", "gzip", false},
+		{"no content", "/empty", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.wantGzip)
+			}
+			if !gzipped {
+				return
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", vary)
+			}
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("body = %q, want %q", got, body)
+			}
+		})
+	}
+}
@@ -7,6 +7,19 @@ import (
 	"time"
 )
 
+// ContextKey is the key of the request_id in the gin context.
+const ContextKey = "request_id"
+
+// Config is the configuration of the RequestIDWithConfig middleware.
+type Config struct {
+	// Header is the request header to get the request_id from, and the
+	// response header to echo it in. Defaults to "X-Request-Id".
+	Header string
+	// Generator generates the request_id, if not found in the request
+	// header (or invalid). Defaults to the UUIDv3 described in RequestID.
+	Generator func(c *gin.Context) string
+}
+
 // RequestID is a middleware that adds a `request_id` value to the context as
 // well as a `X-Request-ID` header to the response.
 //
@@ -22,6 +35,34 @@ import (
 // An early Use of this middleware is recommended to make sure the
 // request_id is set for other middlewares.
 func RequestID() gin.HandlerFunc {
+	return RequestIDWithConfig(Config{})
+}
+
+// RequestIDWithConfig is RequestID with the header and the generator
+// configured. Request ids from clients longer than 128 bytes, or with
+// characters other than printable ASCII, are ignored (and generated anew)
+// to protect the logs they are written to.
+func RequestIDWithConfig(config Config) gin.HandlerFunc {
+	if config.Header == "" {
+		config.Header = "X-Request-Id"
+	}
+	if config.Generator == nil {
+		config.Generator = uuidGenerator()
+	}
+
+	return func(c *gin.Context) {
+		id := c.Request.Header.Get(config.Header)
+		if !validRequestID(id) {
+			id = config.Generator(c)
+		}
+		c.Set(ContextKey, id)
+		c.Header(config.Header, id)
+		c.Next()
+	}
+}
+
+// uuidGenerator returns the default generator of UUIDv3s.
+func uuidGenerator() func(c *gin.Context) string {
 	uuidGen := uuid.NewGen()
 	ns, err := uuidGen.NewV4()
 	if err != nil {
@@ -29,26 +70,29 @@ func RequestID() gin.HandlerFunc {
 	}
 	fmt.Printf("RequestID middleware: namespace=%v\n", ns)
 
-	return func(c *gin.Context) {
-		id := c.Request.Header.Get("X-Request-Id")
-		if id == "" {
-			startTime := c.GetString("start_time")
-			if startTime == "" {
-				startTime = time.Now().String()
-			}
-			uid := uuidGen.NewV3(ns,
-				c.ClientIP()+
-					c.Request.Method+
-					c.Request.RequestURI+
-					startTime,
-			)
-			// get base64
-
-			uid.Bytes()
-			id = uid.String()
+	return func(c *gin.Context) string {
+		startTime := c.GetString("start_time")
+		if startTime == "" {
+			startTime = time.Now().String()
+		}
+		uid := uuidGen.NewV3(ns,
+			c.ClientIP()+
+				c.Request.Method+
+				c.Request.RequestURI+
+				startTime,
+		)
+		return uid.String()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
 		}
-		c.Set("request_id", id)
-		c.Header("X-Request-Id", id)
-		c.Next()
 	}
+	return true
 }
@@ -0,0 +1,85 @@
+// Package ratelimit implements a keyed token bucket rate limiter,
+// which tells how long to wait (for a Retry-After) when limited.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter limits the events of each key (e.g. a client IP) to rate per
+// second, with bursts of at most burst events.
+//
+// The buckets are kept in memory, and dropped when they are refilled
+// to full, i.e. idle for a while. It is safe for concurrent use.
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing rate events per second per key,
+// with bursts of at most burst (at least 1) events.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// cleanupEvery is the number of Allow calls between cleanups.
+const cleanupEvery = 1024
+
+// Allow reports whether an event of the key may happen now, and consumes
+// a token if so. If not, retryAfter is the time until the next token is
+// refilled: the time to wait before retrying.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	l.calls++
+	if l.calls%cleanupEvery == 0 {
+		l.cleanup(now)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// cleanup drops the buckets that would be refilled to full by now.
+func (l *Limiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
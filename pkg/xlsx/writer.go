@@ -0,0 +1,291 @@
+// Package xlsx implements a streaming writer of single-sheet xlsx (Office
+// Open XML) workbooks with typed cells, without buffering the rows.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql/driver"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of xlsx files.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Writer writes a workbook of one worksheet, row by row:
+//
+//	w, err := xlsx.NewWriter(out, "users")
+//	w.WriteHeader("id", "name", "created_at")
+//	w.WriteRow(1, "John", time.Now())
+//	w.Close()
+//
+// Numbers and bools are written as typed cells, time.Time as dates (in
+// the wall clock of their locations, Excel has no time zones), and the
+// others as strings. It is not safe for concurrent use.
+type Writer struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+	buf   bytes.Buffer
+}
+
+// Styles of the cells, by the indexes of the cellXfs of stylesXML.
+const (
+	styleDate   = 1
+	styleHeader = 2
+)
+
+// NewWriter starts a workbook written to w, with the worksheet named
+// sheetName. The workbook is complete after Close.
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", relsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(sanitizeSheetName(sheetName)))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, sheetHeadXML); err != nil {
+		return nil, err
+	}
+	return &Writer{zip: zw, sheet: sheet}, nil
+}
+
+// WriteHeader writes a row of the names in bold.
+func (w *Writer) WriteHeader(names ...string) error {
+	values := make([]any, len(names))
+	for i, name := range names {
+		values[i] = name
+	}
+	return w.writeRow(values, styleHeader)
+}
+
+// WriteRow writes a row of the values:
+//   - ints, uints and floats: numbers. The ones not exact in a float64
+//     (beyond 2^53, NaN, ±Inf) are written as strings.
+//   - bool: booleans
+//   - time.Time: dates, empty for the zero time
+//   - nil: empty cells
+//   - others: strings, by fmt.Sprint
+//
+// Pointers are written as the values they point to, and driver.Valuers
+// (e.g. sql.NullString) as their values.
+func (w *Writer) WriteRow(values ...any) error {
+	return w.writeRow(values, 0)
+}
+
+func (w *Writer) writeRow(values []any, style int) error {
+	w.rows++
+	w.buf.Reset()
+	fmt.Fprintf(&w.buf, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		w.writeCell(cellName(i, w.rows), value, style)
+	}
+	w.buf.WriteString(`</row>`)
+	_, err := w.sheet.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *Writer) writeCell(name string, value any, style int) {
+	var styleAttr string
+	if style != 0 {
+		styleAttr = fmt.Sprintf(` s="%d"`, style)
+	}
+	v := cellValue(value)
+	if !v.IsValid() {
+		return
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return
+		}
+		if style == 0 {
+			styleAttr = fmt.Sprintf(` s="%d"`, styleDate)
+		}
+		fmt.Fprintf(&w.buf, `<c r="%s"%s><v>%s</v></c>`, name, styleAttr,
+			strconv.FormatFloat(excelDate(t), 'f', -1, 64))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b := "0"
+		if v.Bool() {
+			b = "1"
+		}
+		fmt.Fprintf(&w.buf, `<c r="%s" t="b"%s><v>%s</v></c>`, name, styleAttr, b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := v.Int(); i <= 1<<53 && i >= -(1<<53) {
+			fmt.Fprintf(&w.buf, `<c r="%s"%s><v>%d</v></c>`, name, styleAttr, i)
+		} else {
+			w.writeString(name, styleAttr, strconv.FormatInt(i, 10))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u <= 1<<53 {
+			fmt.Fprintf(&w.buf, `<c r="%s"%s><v>%d</v></c>`, name, styleAttr, u)
+		} else {
+			w.writeString(name, styleAttr, strconv.FormatUint(u, 10))
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			fmt.Fprintf(&w.buf, `<c r="%s"%s><v>%s</v></c>`, name, styleAttr, strconv.FormatFloat(f, 'g', -1, 64))
+		} else {
+			w.writeString(name, styleAttr, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case reflect.String:
+		w.writeString(name, styleAttr, v.String())
+	default:
+		w.writeString(name, styleAttr, fmt.Sprint(v.Interface()))
+	}
+}
+
+// cellValue resolves the value of a cell: the values of the pointers and
+// the driver.Valuers (e.g. sql.NullString), invalid for nil.
+func cellValue(value any) reflect.Value {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return reflect.Value{}
+		}
+		v, err := valuer.Value()
+		if err != nil {
+			return reflect.ValueOf(err.Error())
+		}
+		value = v
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func (w *Writer) writeString(name, styleAttr, s string) {
+	fmt.Fprintf(&w.buf, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, name, styleAttr, escape(s))
+}
+
+// Flush flushes the rows written so far to the underlying writer, e.g.
+// after each batch of a streamed response.
+func (w *Writer) Flush() error {
+	return w.zip.Flush()
+}
+
+// Close completes the workbook. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if _, err := io.WriteString(w.sheet, sheetTailXML); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// cellName returns the A1-style name of the cell: column i (from 0), row
+// (from 1), e.g. cellName(27, 3) = "AB3".
+func cellName(i int, row int) string {
+	var column []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		column = append([]byte{byte('A' + (i-1)%26)}, column...)
+	}
+	return string(column) + strconv.Itoa(row)
+}
+
+// excelDate returns the serial date of t: the days (with the fraction of
+// the day) since 1899-12-30, in the wall clock of t.
+func excelDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return wall.Sub(epoch).Seconds() / (24 * 60 * 60)
+}
+
+// escape escapes s for XML text, dropping the characters not allowed in
+// XML (e.g. control characters).
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || r >= 0x20 && r != 0xFFFE && r != 0xFFFF {
+			return r
+		}
+		return -1
+	}, s)
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sanitizeSheetName makes a valid sheet name: at most 31 characters,
+// without any of []:*?/\.
+func sanitizeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const contentTypesXML = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const relsXML = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRelsXML = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+const stylesXML = xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`</styleSheet>`
+
+const sheetHeadXML = xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetTailXML = `</sheetData></worksheet>`
@@ -0,0 +1,176 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type sheetCell struct {
+	R   string `xml:"r,attr"`
+	T   string `xml:"t,attr"`
+	S   string `xml:"s,attr"`
+	V   string `xml:"v"`
+	IsT string `xml:"is>t"`
+}
+
+type sheetXML struct {
+	Rows []struct {
+		R     int         `xml:"r,attr"`
+		Cells []sheetCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readParts reads the parts of the workbook by their names.
+func readParts(t *testing.T, workbook []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = content
+	}
+	return parts
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, "users: a/b & <c>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "Ann"
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60))
+	if err := w.WriteHeader("id", "name", "created_at"); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		{1, &name, created},
+		{uint8(2), "a < b & \"c\"\x00\x1f", time.Time{}},
+		{int64(1) << 60, true, nil},
+		{1.5, math.NaN(), sql.NullString{String: "null", Valid: true}},
+		{(*int)(nil), sql.NullString{}, math.Inf(-1)},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := readParts(t, out.Bytes())
+	for _, name := range []string{
+		"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml",
+	} {
+		content, ok := parts[name]
+		if !ok {
+			t.Fatalf("part %s missing", name)
+		}
+		if err := xml.Unmarshal(content, new(struct{})); err != nil {
+			t.Errorf("part %s: invalid XML: %v", name, err)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "users_ a_b & <c>" {
+		t.Errorf("sheets = %+v, want the name sanitized", workbook.Sheets)
+	}
+
+	var sheet sheetXML
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	date := strconv.FormatFloat(excelDate(created), 'f', -1, 64)
+	want := [][]sheetCell{
+		{
+			{R: "A1", T: "inlineStr", S: "2", IsT: "id"},
+			{R: "B1", T: "inlineStr", S: "2", IsT: "name"},
+			{R: "C1", T: "inlineStr", S: "2", IsT: "created_at"},
+		},
+		{{R: "A2", V: "1"}, {R: "B2", T: "inlineStr", IsT: "Ann"}, {R: "C2", S: "1", V: date}},
+		{{R: "A3", V: "2"}, {R: "B3", T: "inlineStr", IsT: "a < b & \"c\""}},
+		{{R: "A4", T: "inlineStr", IsT: "1152921504606846976"}, {R: "B4", T: "b", V: "1"}},
+		{{R: "A5", V: "1.5"}, {R: "B5", T: "inlineStr", IsT: "NaN"}, {R: "C5", T: "inlineStr", IsT: "null"}},
+		{{R: "C6", T: "inlineStr", IsT: "-Inf"}},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("rows = %d, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if row.R != i+1 {
+			t.Errorf("row %d: r = %d", i+1, row.R)
+		}
+		if len(row.Cells) != len(want[i]) {
+			t.Errorf("row %d: cells = %+v, want %+v", i+1, row.Cells, want[i])
+			continue
+		}
+		for j, cell := range row.Cells {
+			if cell != want[i][j] {
+				t.Errorf("row %d: cell = %+v, want %+v", i+1, cell, want[i][j])
+			}
+		}
+	}
+}
+
+func TestCellName(t *testing.T) {
+	tests := []struct {
+		column, row int
+		want        string
+	}{
+		{0, 1, "A1"},
+		{25, 2, "Z2"},
+		{26, 3, "AA3"},
+		{27, 3, "AB3"},
+		{701, 10, "ZZ10"},
+		{702, 10, "AAA10"},
+	}
+	for _, tt := range tests {
+		if got := cellName(tt.column, tt.row); got != tt.want {
+			t.Errorf("cellName(%d, %d) = %q, want %q", tt.column, tt.row, got, tt.want)
+		}
+	}
+}
+
+func TestExcelDate(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), 45292.75},
+		// the wall clock of the location, not the instant
+		{time.Date(2024, 1, 1, 18, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60)), 45292.75},
+	}
+	for _, tt := range tests {
+		if got := excelDate(tt.t); got != tt.want {
+			t.Errorf("excelDate(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Package reqctx is the standard place for request-scoped values, like the
+// authenticated user, tenant and roles, to flow from middlewares into the
+// hooks (Pretreat, QueryOptionClosure, ...) and services of crud.
+//
+// An auth middleware stashes the values into the gin context:
+//
+//	func Auth(c *gin.Context) {
+//	    claims := verify(c.GetHeader("Authorization"))
+//	    reqctx.SetUserID(c, claims.UserID)
+//	    reqctx.SetTenantID(c, claims.TenantID)
+//	    reqctx.SetRoles(c, claims.Roles...)
+//	}
+//
+// And hooks read them, for example, an ownership scope for the list:
+//
+//	opt.ListOption.QueryOptionClosure = func(c *gin.Context, _ enum.GetRequestOptions) enum.QueryOption {
+//	    userID, _ := reqctx.UserID(c)
+//	    return service.FilterBy("owner_id", userID)
+//	}
+//
+// Values are readable from the *gin.Context as well as from the
+// context.Context of the http request (c.Request.Context()).
+package reqctx
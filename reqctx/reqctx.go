@@ -0,0 +1,80 @@
+package reqctx
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the values in the gin context (c.Get(key)) recognized by crud.
+const (
+	KeyUserID   = "crud/user_id"
+	KeyTenantID = "crud/tenant_id"
+	KeyRoles    = "crud/roles"
+)
+
+// contextKey is the key type of values in the request context.Context.
+type contextKey string
+
+// Set stashes a value into the gin context (c.Set(key, value)) as well as
+// the context.Context of the http request.
+func Set(c *gin.Context, key string, value any) {
+	c.Set(key, value)
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(
+			context.WithValue(c.Request.Context(), contextKey(key), value))
+	}
+}
+
+// Get reads the value of type V stashed by Set. ok is false if the value
+// is not found or is not a V.
+func Get[V any](ctx context.Context, key string) (value V, ok bool) {
+	if ctx == nil {
+		return value, false
+	}
+	if value, ok = ctx.Value(contextKey(key)).(V); ok {
+		return value, true
+	}
+	value, ok = ctx.Value(key).(V) // gin.Context: c.Get(key)
+	return value, ok
+}
+
+// SetUserID stashes the id of the authenticated user.
+func SetUserID(c *gin.Context, id any) {
+	Set(c, KeyUserID, id)
+}
+
+// UserID returns the id of the authenticated user stashed by SetUserID.
+func UserID(ctx context.Context) (id any, ok bool) {
+	return Get[any](ctx, KeyUserID)
+}
+
+// SetTenantID stashes the id of the tenant of the request.
+func SetTenantID(c *gin.Context, id any) {
+	Set(c, KeyTenantID, id)
+}
+
+// TenantID returns the id of the tenant stashed by SetTenantID.
+func TenantID(ctx context.Context) (id any, ok bool) {
+	return Get[any](ctx, KeyTenantID)
+}
+
+// SetRoles stashes the roles of the authenticated user.
+func SetRoles(c *gin.Context, roles ...string) {
+	Set(c, KeyRoles, roles)
+}
+
+// Roles returns the roles stashed by SetRoles.
+func Roles(ctx context.Context) []string {
+	roles, _ := Get[[]string](ctx, KeyRoles)
+	return roles
+}
+
+// HasRole reports whether role is one of the Roles.
+func HasRole(ctx context.Context, role string) bool {
+	for _, r := range Roles(ctx) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
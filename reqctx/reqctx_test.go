@@ -0,0 +1,89 @@
+package reqctx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	return c
+}
+
+func TestSet(t *testing.T) {
+	c := newContext()
+	SetUserID(c, uint(42))
+	SetTenantID(c, "acme")
+	SetRoles(c, "admin", "editor")
+
+	// both from the gin context and from the context of the request
+	for name, ctx := range map[string]context.Context{"gin": c, "request": c.Request.Context()} {
+		if id, ok := UserID(ctx); !ok || id != uint(42) {
+			t.Errorf("%s: UserID = %v, %v, want 42, true", name, id, ok)
+		}
+		if id, ok := TenantID(ctx); !ok || id != "acme" {
+			t.Errorf("%s: TenantID = %v, %v, want acme, true", name, id, ok)
+		}
+		if roles := Roles(ctx); fmt.Sprint(roles) != "[admin editor]" {
+			t.Errorf("%s: Roles = %v, want [admin editor]", name, roles)
+		}
+		if !HasRole(ctx, "editor") || HasRole(ctx, "owner") {
+			t.Errorf("%s: HasRole of %v = wrong", name, Roles(ctx))
+		}
+	}
+}
+
+func TestGet_Missing(t *testing.T) {
+	for name, ctx := range map[string]context.Context{
+		"gin":     newContext(),
+		"request": newContext().Request.Context(),
+		"nil":     nil,
+	} {
+		if id, ok := UserID(ctx); ok || id != nil {
+			t.Errorf("%s: UserID = %v, %v, want nil, false", name, id, ok)
+		}
+		if id, ok := TenantID(ctx); ok || id != nil {
+			t.Errorf("%s: TenantID = %v, %v, want nil, false", name, id, ok)
+		}
+		if roles := Roles(ctx); roles != nil {
+			t.Errorf("%s: Roles = %v, want nil", name, roles)
+		}
+		if HasRole(ctx, "admin") {
+			t.Errorf("%s: HasRole = true, want false", name)
+		}
+	}
+}
+
+func TestGet_WrongType(t *testing.T) {
+	c := newContext()
+	Set(c, KeyRoles, "admin") // not a []string
+	Set(c, "count", 3)
+
+	if roles := Roles(c); roles != nil {
+		t.Errorf("Roles = %v, want nil", roles)
+	}
+	if value, ok := Get[string](c, "count"); ok || value != "" {
+		t.Errorf("Get[string] = %q, %v, want \"\", false", value, ok)
+	}
+	if value, ok := Get[int](c.Request.Context(), "count"); !ok || value != 3 {
+		t.Errorf("Get[int] = %v, %v, want 3, true", value, ok)
+	}
+}
+
+func TestGet_GinOnly(t *testing.T) {
+	c := newContext()
+	c.Set(KeyUserID, "u1") // by c.Set, not by Set
+
+	if id, ok := UserID(c); !ok || id != "u1" {
+		t.Errorf("UserID = %v, %v, want u1, true", id, ok)
+	}
+	if _, ok := UserID(c.Request.Context()); ok {
+		t.Error("UserID of the request context: want not found")
+	}
+}
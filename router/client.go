@@ -0,0 +1,288 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/tqrj/cd/controller"
+)
+
+// GenerateClient writes the source of a Go package named packageName with
+// a typed client of the routes in the registry (i.e. added by Crud so far):
+//
+//	r := router.NewRouter()
+//	router.Crud[User](r, "/users", router.DefaultCrudOption())
+//	router.GenerateClient(file, "client")
+//
+// generates a client.Client with the methods:
+//
+//	ListUser(ctx, query url.Values) ([]models.User, error)
+//	GetUser(ctx, id uint) (*models.User, error)
+//	CreateUser(ctx, model *models.User) (*models.User, error)
+//	UpdateUser(ctx, id uint, model *models.User) (*models.User, error)
+//	DeleteUser(ctx, id uint) error
+//
+// for the enabled operations. Path params of the group (e.g. /users/:UserID/orders)
+// are prepended to the method parameters. A model added more than once
+// gets a numbered suffix: ListOrder, ListOrder2, ...
+//
+// The models are decoded from the keys of the responses by
+// controller.ResponseKeys, i.e. by their orm.ResponseKeyer or the
+// controller.DataKey (set it as the server does before the call).
+//
+// Call it after all the routes are added, e.g. in a go:generate program.
+func GenerateClient(w io.Writer, packageName string) error {
+	data := clientData{Package: packageName, imports: map[string]string{}}
+	names := map[string]int{}
+	for _, route := range Routes() {
+		names[route.Model.Name()]++
+		name := route.Model.Name()
+		if n := names[name]; n > 1 {
+			name += strconv.Itoa(n)
+		}
+		params, pathExpr := clientPath(route.Path)
+		single, plural := controller.ResponseKeys(route.Model)
+		data.Routes = append(data.Routes, clientRoute{
+			Route:     route,
+			Name:      name,
+			Type:      data.typeName(route.Model),
+			IdType:    clientIdType(route.IdType),
+			Params:    params,
+			PathExpr:  pathExpr,
+			SingleKey: strconv.Quote(single),
+			PluralKey: strconv.Quote(plural),
+		})
+	}
+	for pkgPath, alias := range data.imports {
+		data.Imports = append(data.Imports, fmt.Sprintf("%s %q", alias, pkgPath))
+	}
+	sort.Strings(data.Imports)
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("GenerateClient: format generated source: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+type clientData struct {
+	Package string
+	Imports []string
+	Routes  []clientRoute
+
+	imports map[string]string // pkgPath => alias
+}
+
+type clientRoute struct {
+	Route
+	Name     string // method name suffix, e.g. User
+	Type     string // qualified model type, e.g. models.User
+	IdType   string // e.g. uint
+	Params   string // path params of the method, e.g. "userID string, "
+	PathExpr string // expression of the path, e.g. "/users/" + pathEscape(userID) + "/orders"
+
+	SingleKey string // quoted response key of a model, e.g. "User"
+	PluralKey string // quoted response key of a list, e.g. "Users"
+}
+
+// typeName returns the model type qualified by an imported package alias.
+func (d *clientData) typeName(t reflect.Type) string {
+	alias, ok := d.imports[t.PkgPath()]
+	if !ok {
+		alias = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, path.Base(t.PkgPath()))
+		for i, base := 2, alias; d.hasAlias(alias); i++ {
+			alias = base + strconv.Itoa(i)
+		}
+		d.imports[t.PkgPath()] = alias
+	}
+	return alias + "." + t.Name()
+}
+
+func (d *clientData) hasAlias(alias string) bool {
+	switch alias { // the imports and identifiers of the generated source
+	case "bytes", "context", "json", "fmt", "http", "url", "pathEscape", "Client", "Error":
+		return true
+	}
+	for _, a := range d.imports {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIdType returns the id type in the generated source: builtin types
+// as is, and any for types that would need an import (e.g. uuid.UUID).
+func clientIdType(t reflect.Type) string {
+	if t == nil || t.PkgPath() != "" {
+		return "any"
+	}
+	return t.String()
+}
+
+// clientPath converts the path params in the group path into the method
+// parameters and builds the path expression:
+//
+//	clientPath("/users/:UserID/orders")
+//	// => `userID string, `, `"/users/" + pathEscape(userID) + "/orders"`
+func clientPath(routePath string) (params string, expr string) {
+	var parts []string
+	literal := ""
+	for _, segment := range strings.Split(routePath, "/") {
+		if segment == "" {
+			continue
+		}
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			literal += "/" + segment
+			continue
+		}
+		param := []rune(segment[1:])
+		param[0] = unicode.ToLower(param[0])
+		params += string(param) + " string, "
+		parts = append(parts, strconv.Quote(literal+"/"), "pathEscape("+string(param)+")")
+		literal = ""
+	}
+	if literal != "" || len(parts) == 0 {
+		parts = append(parts, strconv.Quote(literal))
+	}
+	return params, strings.Join(parts, " + ")
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by router.GenerateClient. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+{{range .Imports}}
+	{{.}}{{end}}
+)
+
+// Client is a typed client of the CRUD routes.
+type Client struct {
+	BaseURL    string       // e.g. http://localhost:8080
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// Error is an error response of the server.
+type Error struct {
+	StatusCode int
+	Msg        string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Msg)
+}
+
+// do sends the request and decodes the response field key into result, if
+// not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, key string, result any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, &reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var respBody map[string]json.RawMessage
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var msg string
+		_ = json.Unmarshal(respBody["msg"], &msg)
+		return &Error{StatusCode: resp.StatusCode, Msg: msg}
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	data, ok := respBody[key]
+	if !ok {
+		return fmt.Errorf("decode response: no %q field", key)
+	}
+	return json.Unmarshal(data, result)
+}
+
+func pathEscape(v any) string {
+	return url.PathEscape(fmt.Sprint(v))
+}
+{{range .Routes}}{{if .List}}
+// List{{.Name}}: GET {{.Path}}
+func (c *Client) List{{.Name}}(ctx context.Context, {{.Params}}query url.Values) ([]{{.Type}}, error) {
+	var result []{{.Type}}
+	err := c.do(ctx, http.MethodGet, {{.PathExpr}}, query, nil, {{.PluralKey}}, &result)
+	return result, err
+}
+{{end}}{{if .Get}}
+// Get{{.Name}}: GET {{.Path}}/:{{.IdParam}}
+func (c *Client) Get{{.Name}}(ctx context.Context, {{.Params}}id {{.IdType}}) (*{{.Type}}, error) {
+	var result {{.Type}}
+	err := c.do(ctx, http.MethodGet, {{.PathExpr}}+"/"+pathEscape(id), nil, nil, {{.SingleKey}}, &result)
+	return &result, err
+}
+{{end}}{{if .Create}}
+// Create{{.Name}}: POST {{.Path}}
+func (c *Client) Create{{.Name}}(ctx context.Context, {{.Params}}model *{{.Type}}) (*{{.Type}}, error) {
+	var result {{.Type}}
+	err := c.do(ctx, http.MethodPost, {{.PathExpr}}, nil, model, {{.SingleKey}}, &result)
+	return &result, err
+}
+{{end}}{{if .Update}}
+// Update{{.Name}}: PUT {{.Path}}/:{{.IdParam}}
+func (c *Client) Update{{.Name}}(ctx context.Context, {{.Params}}id {{.IdType}}, model *{{.Type}}) (*{{.Type}}, error) {
+	var result {{.Type}}
+	err := c.do(ctx, http.MethodPut, {{.PathExpr}}+"/"+pathEscape(id), nil, model, {{.SingleKey}}, &result)
+	return &result, err
+}
+{{end}}{{if .Delete}}
+// Delete{{.Name}}: DELETE {{.Path}}/:{{.IdParam}}
+func (c *Client) Delete{{.Name}}(ctx context.Context, {{.Params}}id {{.IdType}}) error {
+	return c.do(ctx, http.MethodDelete, {{.PathExpr}}+"/"+pathEscape(id), nil, nil, "", nil)
+}
+{{end}}{{end}}`))
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tqrj/cd/enum"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// Gadget and Part are the models of the generated client.
+type (
+	Gadget struct{}
+	Part   struct{}
+)
+
+// ResponseKeys keys a Part by "part", and a list by the default key.
+func (Part) ResponseKeys() (single, plural string) {
+	return "part", ""
+}
+
+func TestGenerateClient(t *testing.T) {
+	registry.Lock()
+	saved := registry.routes
+	registry.routes = nil
+	registry.Unlock()
+	defer func() {
+		registry.Lock()
+		registry.routes = saved
+		registry.Unlock()
+	}()
+
+	register(Route{
+		Model: reflect.TypeOf(Gadget{}), Path: "/gadgets", IdParam: "GadgetID", IdType: reflect.TypeOf(uint(0)),
+		List: true, Get: true, Create: true, Update: true, Delete: true,
+		Option: DefaultCrudOption(),
+	})
+	register(Route{
+		Model: reflect.TypeOf(Part{}), Path: "/gadgets/:GadgetID/parts", IdParam: "PartID", IdType: reflect.TypeOf(""),
+		List: true, Get: true,
+		Option: &enum.CurdOption{},
+	})
+	register(Route{ // added twice: numbered, with an id type of a package
+		Model: reflect.TypeOf(Part{}), Path: "/parts", IdParam: "PartID", IdType: reflect.TypeOf(time.Duration(0)),
+		Delete: true,
+		Option: &enum.CurdOption{},
+	})
+
+	var got bytes.Buffer
+	if err := GenerateClient(&got, "client"); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "client.go.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("GenerateClient differs from %s (go test -update to update it):\n%s", golden, got.String())
+	}
+}
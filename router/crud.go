@@ -37,6 +37,7 @@ import (
 //   - GetNested()    =>    GET /users/:UserId/friends
 //   - CreateNested() =>   POST /users/:UserId/friends
 //   - DeleteNested() => DELETE /users/:UserId/friends/:FriendId
+//   - ReplaceNested() =>  PUT /users/:UserId/friends
 func Crud[T orm.Model](base gin.IRouter, relativePath string, opt *enum.CurdOption, crudGroups ...enum.CrudGroup) gin.IRouter {
 	group := base.Group(relativePath)
 
@@ -47,6 +48,7 @@ func Crud[T orm.Model](base gin.IRouter, relativePath string, opt *enum.CurdOpti
 			Info("Crud: Adding CRUD routes for model")
 	}
 
+	register(newRoute[T](group.BasePath(), opt))
 	crudGroups = append(crudGroups, crud[T](opt))
 
 	for _, option := range crudGroups {
@@ -76,27 +78,102 @@ func DefaultCrudOption() *enum.CurdOption {
 // crud add CRUD routes for model T to the group:
 //
 //	   GET /
+//	  POST /query     # if ListOption.QueryByPost
 //	   GET /:idParam
 //	  POST /
 //	   PUT /:idParam
+//	 PATCH /:idParam  # if UpdateOption.MergePatch
 //	DELETE /:idParam
+//	  POST /replace   # if ReplaceOption.Enable
+//	  POST /restore   # if RestoreOption.Enable
+//	  POST /archive   # if ArchiveOption.Enable
+//	  POST /:idParam/touch  # if TouchOption.Enable
+//	  POST /reorder   # if ReorderOption.Enable
+//	   GET /facets    # if FacetOption.Enable
+//	  POST /get_or_create  # if GetOrCreateOption.Enable
+//	   GET /export    # if ExportOption.Enable
 func crud[T orm.Model](opt *enum.CurdOption) enum.CrudGroup {
+	if opt.ParamFilters != nil {
+		opt = controller.ScopeByParams[T](opt, opt.ParamFilters)
+	}
 	idParam := getIdParam[T]()
+	model := getTypeName[T]()
+	routeHandlers := func(operation string, middlewares []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+		if opt.SlowThreshold > 0 {
+			slow := controller.SlowOperationLogger(operation, model, opt.SlowThreshold)
+			middlewares = append([]gin.HandlerFunc{slow}, middlewares...)
+		}
+		return handlers(middlewares, handler)
+	}
 	return func(group *gin.RouterGroup) *gin.RouterGroup {
 		if opt.ListOption.Enable {
-			group.GET("", controller.GetListHandler[T](&opt.ListOption))
+			group.GET("", routeHandlers("list", opt.ListOption.Middlewares, controller.GetListHandler[T](&opt.ListOption))...)
+			if opt.ListOption.QueryByPost {
+				group.POST("/query", routeHandlers("query", opt.ListOption.Middlewares, controller.QueryHandler[T](&opt.ListOption))...)
+			}
 		}
 		if opt.GetOption.Enable {
-			group.GET(fmt.Sprintf("/:%s", idParam), controller.GetByIDHandler[T](idParam, &opt.GetOption))
+			group.GET(fmt.Sprintf("/:%s", idParam), routeHandlers("get", opt.GetOption.Middlewares, controller.GetByIDHandler[T](idParam, &opt.GetOption))...)
 		}
 		if opt.CreateOption.Enable {
-			group.POST("", controller.CreateHandler[T](&opt.CreateOption))
+			createOpt := opt.CreateOption
+			if createOpt.QueryOptionClosure == nil { // responds the duplicates which can be got
+				createOpt.QueryOptionClosure = opt.GetOption.QueryOptionClosure
+			}
+			group.POST("", routeHandlers("create", createOpt.Middlewares, controller.CreateHandler[T](&createOpt))...)
 		}
 		if opt.UpdateOption.Enable {
-			group.PUT(fmt.Sprintf("/:%s", idParam), controller.UpdateHandler[T](idParam, &opt.UpdateOption))
+			updateOpt := opt.UpdateOption
+			if updateOpt.UniqueBy == nil { // checks the keys of the creates by the upserts
+				updateOpt.UniqueBy = opt.CreateOption.UniqueBy
+			}
+			group.PUT(fmt.Sprintf("/:%s", idParam), routeHandlers("update", updateOpt.Middlewares, controller.UpdateHandler[T](idParam, &updateOpt))...)
+			if updateOpt.MergePatch {
+				group.PATCH(fmt.Sprintf("/:%s", idParam), routeHandlers("patch", updateOpt.Middlewares, controller.MergePatchHandler[T](idParam, &updateOpt))...)
+			}
 		}
 		if opt.DelOption.Enable {
-			group.DELETE(fmt.Sprintf("/:%s", idParam), controller.DeleteHandler[T](idParam, &opt.DelOption))
+			group.DELETE(fmt.Sprintf("/:%s", idParam), routeHandlers("delete", opt.DelOption.Middlewares, controller.DeleteHandler[T](idParam, &opt.DelOption))...)
+		}
+		if opt.ReplaceOption.Enable {
+			group.POST("/replace", routeHandlers("replace", nil, controller.ReplaceHandler[T](&opt.ReplaceOption))...)
+		}
+		if opt.RestoreOption.Enable {
+			group.POST("/restore", routeHandlers("restore", nil, controller.RestoreHandler[T](&opt.RestoreOption))...)
+		}
+		if opt.ArchiveOption.Enable {
+			group.POST("/archive", routeHandlers("archive", opt.ArchiveOption.Middlewares, controller.ArchiveHandler[T](&opt.ArchiveOption))...)
+		}
+		if opt.TouchOption.Enable {
+			group.POST(fmt.Sprintf("/:%s/touch", idParam), routeHandlers("touch", nil, controller.TouchHandler[T](idParam, &opt.TouchOption))...)
+		}
+		if opt.ReorderOption.Enable {
+			group.POST("/reorder", routeHandlers("reorder", opt.ReorderOption.Middlewares, controller.ReorderHandler[T](&opt.ReorderOption))...)
+		}
+		if opt.FacetOption.Enable {
+			facetOpt := opt.FacetOption
+			if facetOpt.QueryOptionClosure == nil { // counts the models listed
+				facetOpt.QueryOptionClosure = opt.ListOption.QueryOptionClosure
+			}
+			if facetOpt.Filter == nil {
+				facetOpt.Filter = opt.ListOption.Filter
+			}
+			facetOpt.TypedFiltersOnly = facetOpt.TypedFiltersOnly || opt.ListOption.TypedFiltersOnly
+			group.GET("/facets", routeHandlers("facets", facetOpt.Middlewares, controller.FacetHandler[T](&facetOpt))...)
+		}
+		if opt.GetOrCreateOption.Enable {
+			group.POST("/get_or_create", routeHandlers("get_or_create", opt.GetOrCreateOption.Middlewares, controller.GetOrCreateManyHandler[T](&opt.GetOrCreateOption))...)
+		}
+		if opt.ExportOption.Enable {
+			exportOpt := opt.ExportOption
+			if exportOpt.QueryOptionClosure == nil { // exports the models listed
+				exportOpt.QueryOptionClosure = opt.ListOption.QueryOptionClosure
+			}
+			if exportOpt.Filter == nil {
+				exportOpt.Filter = opt.ListOption.Filter
+			}
+			exportOpt.TypedFiltersOnly = exportOpt.TypedFiltersOnly || opt.ListOption.TypedFiltersOnly
+			group.GET("/export", routeHandlers("export", exportOpt.Middlewares, controller.ExportHandler[T](&exportOpt))...)
 		}
 
 		return group
@@ -118,9 +195,9 @@ func GetNested[P orm.Model, N orm.Model](field string, opt *enum.GetOption) enum
 				Info("Crud: Adding GET route for getting nested model")
 		}
 
-		group.GET(relativePath,
+		group.GET(relativePath, handlers(opt.Middlewares,
 			controller.GetFieldHandler[P](parentIdParam, field, opt),
-		)
+		)...)
 		// there is no GET /:parentIdParam/:field/:childIdParam,
 		// because it is equivalent to GET /:childModel/:childIdParam.
 		// So there is also no PUT /:parentIdParam/:field/:childIdParam.
@@ -144,9 +221,9 @@ func CreateNested[P orm.Model, N orm.Model](field string, opt *enum.CreateOption
 				Info("Crud: Adding POST route for creating nested model")
 		}
 
-		group.POST(relativePath,
+		group.POST(relativePath, handlers(opt.Middlewares,
 			controller.CreateNestedHandler[P, N](parentIdParam, field, opt),
-		)
+		)...)
 		return group
 	}
 }
@@ -174,7 +251,30 @@ func DeleteNested[P orm.Model, T orm.Model](field string) enum.CrudGroup {
 	}
 }
 
-// CrudNested = GetNested + CreateNested + DeleteNested
+// ReplaceNested add a PUT route to the group for replacing the nested
+// models (a to-many association) with exactly the ones in the body:
+//
+//	PUT /:parentIdParam/field
+func ReplaceNested[P orm.Model, T orm.Model](field string, opt *enum.UpdateOption) enum.CrudGroup {
+	parentIdParam := getIdParam[P]()
+	return func(group *gin.RouterGroup) *gin.RouterGroup {
+		relativePath := fmt.Sprintf("/:%s/%s", parentIdParam, field)
+
+		if !gin.IsDebugging() { // GIN_MODE == "release"
+			logger.WithField("parent", getTypeName[P]()).
+				WithField("child", getTypeName[T]()).
+				WithField("relativePath", relativePath).
+				Info("Crud: Adding PUT route for replacing nested models")
+		}
+
+		group.PUT(relativePath, handlers(opt.Middlewares,
+			controller.ReplaceNestedHandler[P, T](parentIdParam, field, opt),
+		)...)
+		return group
+	}
+}
+
+// CrudNested = GetNested + CreateNested + DeleteNested + ReplaceNested
 func CrudNested[P orm.Model, T orm.Model](field string, opt *enum.CurdOption) enum.CrudGroup {
 	return func(group *gin.RouterGroup) *gin.RouterGroup {
 
@@ -189,10 +289,47 @@ func CrudNested[P orm.Model, T orm.Model](field string, opt *enum.CurdOption) en
 		if opt.DelOption.Enable {
 			group = DeleteNested[P, T](field)(group)
 		}
+		if opt.UpdateOption.Enable {
+			group = ReplaceNested[P, T](field, &opt.UpdateOption)(group)
+		}
+		return group
+	}
+}
+
+// Action add a custom action route on model T to the group:
+//
+//	METHOD /:idParam/name
+//
+// The action gets the model loaded by the id, for example:
+//
+//	Crud[Order](r, "/orders", opt,
+//	    Action[Order](http.MethodPost, "cancel", cancelOrder, &enum.ActionOption{}))
+//
+// adds POST /orders/:OrderID/cancel. See controller.ActionHandler.
+func Action[T orm.Model](method string, name string, action controller.Action[T], opt *enum.ActionOption) enum.CrudGroup {
+	idParam := getIdParam[T]()
+	return func(group *gin.RouterGroup) *gin.RouterGroup {
+		relativePath := fmt.Sprintf("/:%s/%s", idParam, name)
+
+		if !gin.IsDebugging() { // GIN_MODE == "release"
+			logger.WithField("model", getTypeName[T]()).
+				WithField("method", method).
+				WithField("relativePath", relativePath).
+				Info("Crud: Adding action route")
+		}
+
+		group.Handle(method, relativePath, handlers(opt.Middlewares,
+			controller.ActionHandler[T](idParam, action, opt),
+		)...)
 		return group
 	}
 }
 
+// handlers returns the middlewares of the route followed by the handler.
+func handlers(middlewares []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+	return append(append([]gin.HandlerFunc{}, middlewares...), handler)
+}
+
 // getIdParam Model => "ModelID"
 func getIdParam[T orm.Model]() string {
 	model := *new(T)
@@ -203,6 +340,40 @@ func getIdParam[T orm.Model]() string {
 	return idParam
 }
 
+// newRoute describes the CRUD routes of model T on path for the registry.
+func newRoute[T orm.Model](path string, opt *enum.CurdOption) Route {
+	modelType := reflect.TypeOf(*new(T))
+	idField, _ := (*new(T)).Identity()
+	var idType reflect.Type
+	if field, ok := modelType.FieldByName(idField); ok {
+		idType = field.Type
+	}
+	return Route{
+		Model:   modelType,
+		Path:    path,
+		IdParam: getIdParam[T](),
+		IdType:  idType,
+		List:    opt.ListOption.Enable,
+		Get:     opt.GetOption.Enable,
+		Create:  opt.CreateOption.Enable,
+		Update:  opt.UpdateOption.Enable,
+		Delete:  opt.DelOption.Enable,
+
+		Query:       opt.ListOption.Enable && opt.ListOption.QueryByPost,
+		Patch:       opt.UpdateOption.Enable && opt.UpdateOption.MergePatch,
+		Replace:     opt.ReplaceOption.Enable,
+		Restore:     opt.RestoreOption.Enable,
+		Archive:     opt.ArchiveOption.Enable,
+		Touch:       opt.TouchOption.Enable,
+		Reorder:     opt.ReorderOption.Enable,
+		Facets:      opt.FacetOption.Enable,
+		GetOrCreate: opt.GetOrCreateOption.Enable,
+		Export:      opt.ExportOption.Enable,
+
+		Option: opt,
+	}
+}
+
 // getTypeName is a helper function to get the type name of a generic type T.
 func getTypeName[T any]() string {
 	model := *new(T)
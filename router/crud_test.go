@@ -1,3 +1,133 @@
 package router
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service/servicetest"
+)
+
 // TODO: test Crud
+
+type widget struct {
+	orm.BasicModel
+	Name string `json:"name"`
+}
+
+func TestCrud_Middlewares(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &widget{})
+	if err := db.Create(&widget{Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tag := func(value string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Writer.Header().Add("X-Middleware", value)
+		}
+	}
+	opt := DefaultCrudOption()
+	opt.ListOption.Middlewares = []gin.HandlerFunc{tag("list1"), tag("list2")}
+	opt.GetOption.Middlewares = []gin.HandlerFunc{tag("get")}
+	r := gin.New()
+	Crud[widget](r, "/widgets", opt)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/widgets", []string{"list1", "list2"}},
+		{"/widgets/1", []string{"get"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: code = %d, want 200: %s", tt.path, w.Code, w.Body.String())
+		}
+		got := w.Header().Values("X-Middleware")
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GET %s: middlewares = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+type stock struct {
+	orm.BasicModel
+	Shop uint   `json:"shop"`
+	Code string `json:"code" gorm:"uniqueIndex"`
+}
+
+func TestCrud_DuplicateInScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &stock{})
+	if err := db.Create(&stock{Shop: 1, Code: "X"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	opt := DefaultCrudOption()
+	opt.ParamFilters = map[string]string{"shop": "shop"}
+	opt.CreateOption.UniqueBy = []string{"code"}
+	r := gin.New()
+	Crud[stock](r, "/shops/:shop/stocks", opt)
+
+	tests := []struct {
+		path     string
+		existing bool
+	}{
+		{"/shops/1/stocks", true},
+		{"/shops/2/stocks", false}, // of another shop: not disclosed
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"code": "X"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("POST %s: code = %d, want 409: %s", tt.path, w.Code, w.Body.String())
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if _, got := body["stock"]; got != tt.existing {
+			t.Errorf("POST %s: existing responded = %v, want %v: %s", tt.path, got, tt.existing, w.Body.String())
+		}
+	}
+}
+
+func TestCrud_QueryByPost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := servicetest.Open(t, &stock{})
+	for _, s := range []stock{{Shop: 1, Code: "X1"}, {Shop: 1, Code: "Y1"}, {Shop: 2, Code: "X2"}} {
+		if err := db.Create(&s).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt := DefaultCrudOption()
+	opt.ParamFilters = map[string]string{"shop": "shop"}
+	opt.ListOption.QueryByPost = true
+	r := gin.New()
+	Crud[stock](r, "/shops/:shop/stocks", opt)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/shops/1/stocks/query", strings.NewReader(`{"filters": [{"column": "code", "op": "startswith", "value": "X"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Stocks []stock `json:"stocks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Stocks) != 1 || body.Stocks[0].Shop != 1 || body.Stocks[0].Code != "X1" {
+		t.Errorf("stocks = %+v, want the X1 of the shop 1", body.Stocks)
+	}
+}
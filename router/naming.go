@@ -0,0 +1,107 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/inflection"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy derives the route name of a model from its type name.
+//
+//	NamingStrategy{Plural: true, Separator: "-"}  // CPUStat => "cpu-stats"
+//	NamingStrategy{Plural: false, Separator: "_"} // CPUStat => "cpu_stat"
+//
+// Pluralization is done by github.com/jinzhu/inflection (the same one GORM
+// uses to name tables), so irregular nouns like Person => "people" work.
+// Use inflection.AddIrregular to teach it more.
+type NamingStrategy struct {
+	Plural    bool   // pluralize the last word
+	Separator string // "-" for kebab-case, "_" for snake_case
+}
+
+// Naming is the package-level NamingStrategy used by RouteName and
+// CrudResource. It defaults to plural kebab-case (CPUStat => "cpu-stats").
+var Naming = NamingStrategy{Plural: true, Separator: "-"}
+
+// RouteNamer is implemented by models to override the NamingStrategy:
+//
+//	func (Person) RouteName() string { return "folks" }
+type RouteNamer interface {
+	RouteName() string
+}
+
+// Name converts the type name into a route name.
+func (ns NamingStrategy) Name(typeName string) string {
+	words := splitWords(typeName)
+	if len(words) == 0 {
+		return ""
+	}
+	if ns.Plural {
+		words[len(words)-1] = inflection.Plural(words[len(words)-1])
+	}
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, ns.Separator)
+}
+
+// RouteName returns the resolved route name of model T: RouteNamer.RouteName
+// if T implements it, else Naming.Name of the type name of T.
+//
+// It is useful to build links to the resources added by CrudResource:
+//
+//	link := fmt.Sprintf("/%s/%v", router.RouteName[Person](), id)  // /people/1
+func RouteName[T any]() string {
+	if namer, ok := any(*new(T)).(RouteNamer); ok {
+		return namer.RouteName()
+	}
+	return Naming.Name(getTypeName[T]())
+}
+
+// CrudResource is Crud on the path resolved by RouteName:
+//
+//	CrudResource[Person](r, opt)  // == Crud[Person](r, "/people", opt)
+func CrudResource[T orm.Model](base gin.IRouter, opt *enum.CurdOption, crudGroups ...enum.CrudGroup) gin.IRouter {
+	return Crud[T](base, "/"+RouteName[T](), opt, crudGroups...)
+}
+
+// splitWords splits a CamelCase name into words, keeping acronyms together:
+//
+//	splitWords("CPUStat") // => []string{"CPU", "Stat"}
+func splitWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, curr := runes[i-1], runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		boundary := false
+		switch {
+		case curr == '_' || curr == '-' || curr == ' ':
+			boundary = true
+		case unicode.IsUpper(curr) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			boundary = true // userID => user|ID
+		case unicode.IsUpper(curr) && unicode.IsUpper(prev) && unicode.IsLower(next):
+			boundary = true // CPUStat => CPU|Stat
+		}
+		if boundary {
+			words = appendWord(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return appendWord(words, string(runes[start:]))
+}
+
+func appendWord(words []string, word string) []string {
+	word = strings.Trim(word, "_- ")
+	if word == "" {
+		return words
+	}
+	return append(words, word)
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/tqrj/cd/orm"
+)
+
+type Person struct{ orm.BasicModel }
+
+type CPUStat struct{ orm.BasicModel }
+
+type Override struct{ orm.BasicModel }
+
+func (Override) RouteName() string { return "overridden" }
+
+func TestNamingStrategy_Name(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy NamingStrategy
+		typeName string
+		want     string
+	}{
+		{"irregular plural", NamingStrategy{true, "-"}, "Person", "people"},
+		{"acronym kebab", NamingStrategy{true, "-"}, "CPUStat", "cpu-stats"},
+		{"acronym snake", NamingStrategy{true, "_"}, "CPUStat", "cpu_stats"},
+		{"singular", NamingStrategy{false, "-"}, "CPUStat", "cpu-stat"},
+		{"irregular child", NamingStrategy{true, "-"}, "GrandChild", "grand-children"},
+		{"y plural", NamingStrategy{true, "_"}, "ProductCategory", "product_categories"},
+		{"trailing acronym", NamingStrategy{true, "-"}, "UserID", "user-ids"},
+		{"uncountable", NamingStrategy{true, "-"}, "Equipment", "equipment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.strategy.Name(tt.typeName); got != tt.want {
+				t.Errorf("Name(%q) = %q, want %q", tt.typeName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteName(t *testing.T) {
+	if got := RouteName[Person](); got != "people" {
+		t.Errorf("RouteName[Person]() = %q, want %q", got, "people")
+	}
+	if got := RouteName[CPUStat](); got != "cpu-stats" {
+		t.Errorf("RouteName[CPUStat]() = %q, want %q", got, "cpu-stats")
+	}
+	if got := RouteName[Override](); got != "overridden" {
+		t.Errorf("RouteName[Override]() = %q, want %q", got, "overridden")
+	}
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/tqrj/cd/enum"
+)
+
+// Route describes a group of CRUD routes added by Crud. It is recorded
+// in the registry for code generation (see GenerateClient) and the
+// introspection (see Resources).
+type Route struct {
+	Model   reflect.Type // the model type, e.g. User
+	Path    string       // the full path of the group, e.g. /users
+	IdParam string       // the id param, e.g. UserID
+	IdType  reflect.Type // the type of the primary key, e.g. uint
+
+	List, Get, Create, Update, Delete bool // enabled operations
+
+	// the other enabled operations, see CurdOption
+	Query, Patch, Replace, Restore, Archive, Touch, Reorder, Facets, GetOrCreate, Export bool
+
+	Option *enum.CurdOption // the options of the routes
+}
+
+var registry struct {
+	sync.Mutex
+	routes []Route
+}
+
+// register adds a route to the registry.
+func register(route Route) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.routes = append(registry.routes, route)
+}
+
+// Routes returns the routes added by Crud so far, in order.
+func Routes() []Route {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]Route{}, registry.routes...)
+}
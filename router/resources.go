@@ -0,0 +1,169 @@
+package router
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/controller"
+	"github.com/tqrj/cd/orm"
+)
+
+// Resource is the metadata of a group of CRUD routes (a Route in the
+// registry) for the clients, e.g. an admin console:
+//
+//	{
+//	    model: "User", path: "/users", id_param: "UserID",
+//	    operations: ["list", "get", "create", "update", "delete"],
+//	    filters: {
+//	        generic: true,                          // filter_by, filters, ...
+//	        typed: ["status", "min_age"],           // the params of ListOption.Filter
+//	        operators: {"name": ["eq", "startswith"]},  // see orm.FilterOperatorer
+//	        blacklist: ["bio"],                     // see orm.FilterBlacklister
+//	        order_columns: [],
+//	        distinct_columns: [],
+//	        search: ["code", "name"],               // the columns of ListOption.SearchFields, by q
+//	    },
+//	    preloads: { associations: ["Orders", "Tags"], max: 0, max_depth: 0 },
+//	}
+type Resource struct {
+	Model      string           `json:"model"`
+	Path       string           `json:"path"`
+	IdParam    string           `json:"id_param"`
+	Operations []string         `json:"operations"`
+	Filters    ResourceFilters  `json:"filters"`
+	Preloads   ResourcePreloads `json:"preloads"`
+}
+
+// ResourceFilters are the filters allowed on the list of a Resource.
+type ResourceFilters struct {
+	Generic         bool                `json:"generic"` // not ListOption.TypedFiltersOnly
+	Typed           []string            `json:"typed"`
+	Operators       map[string][]string `json:"operators"` // the restricted columns only
+	Blacklist       []string            `json:"blacklist"` // the columns not queryable
+	OrderColumns    []string            `json:"order_columns"`
+	DistinctColumns []string            `json:"distinct_columns"`
+	Search          []string            `json:"search"`
+}
+
+// ResourcePreloads are the preloads allowed of a Resource.
+type ResourcePreloads struct {
+	Associations []string `json:"associations"`
+	Max          int      `json:"max"`       // 0 for unlimited
+	MaxDepth     int      `json:"max_depth"` // 0 for unlimited
+}
+
+// ResourcesPath is the path of the resources endpoint, see WithResources.
+const ResourcesPath = "/_crud/resources"
+
+// Resources returns the metadata of the routes added by Crud so far, in
+// order.
+func Resources() []Resource {
+	routes := Routes()
+	resources := make([]Resource, 0, len(routes))
+	for _, route := range routes {
+		resources = append(resources, newResource(route))
+	}
+	return resources
+}
+
+// WithResources adds the GET ResourcesPath endpoint, responding the
+// Resources (of the routes added by then):
+//
+//	{ code: 200, msg: "success", resources: [...] }
+//
+// It discloses the (filterable) columns and associations of the models:
+// add it to an authenticated router, e.g. the one of an admin console.
+func WithResources() RouterOption {
+	return func(router gin.IRouter) gin.IRouter {
+		router.GET(ResourcesPath, func(c *gin.Context) {
+			controller.ResponseSuccess(c, nil, gin.H{"resources": Resources()})
+		})
+		return router
+	}
+}
+
+func newResource(route Route) Resource {
+	resource := Resource{
+		Model:   route.Model.Name(),
+		Path:    route.Path,
+		IdParam: route.IdParam,
+	}
+	for _, operation := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"list", route.List}, {"get", route.Get}, {"create", route.Create},
+		{"update", route.Update}, {"delete", route.Delete}, {"query", route.Query}, {"patch", route.Patch},
+		{"replace", route.Replace}, {"restore", route.Restore}, {"archive", route.Archive},
+		{"touch", route.Touch}, {"reorder", route.Reorder},
+		{"facets", route.Facets}, {"get_or_create", route.GetOrCreate}, {"export", route.Export},
+	} {
+		if operation.enabled {
+			resource.Operations = append(resource.Operations, operation.name)
+		}
+	}
+
+	model := reflect.New(route.Model).Interface()
+	resource.Filters = ResourceFilters{
+		Generic:         !route.Option.ListOption.TypedFiltersOnly,
+		Typed:           typedFilterParams(route.Option.ListOption.Filter),
+		Operators:       map[string][]string{},
+		Blacklist:       []string{},
+		OrderColumns:    append([]string{}, route.Option.ListOption.OrderColumns...),
+		DistinctColumns: append([]string{}, route.Option.ListOption.DistinctColumns...),
+		Search:          []string{},
+	}
+	for _, field := range route.Option.ListOption.SearchFields {
+		resource.Filters.Search = append(resource.Filters.Search, field.Column)
+	}
+	resource.Preloads = ResourcePreloads{
+		Associations: []string{},
+		Max:          route.Option.ListOption.MaxPreloads,
+		MaxDepth:     route.Option.ListOption.MaxPreloadDepth,
+	}
+	if s, err := orm.ParseSchema(model); err == nil {
+		for _, field := range s.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if operators, ok := orm.FilterOperators(model, field.DBName); ok {
+				resource.Filters.Operators[field.DBName] = operators
+			}
+			if orm.FilterBlacklisted(model, field.DBName) {
+				resource.Filters.Blacklist = append(resource.Filters.Blacklist, field.DBName)
+			}
+		}
+		for name := range s.Relationships.Relations {
+			resource.Preloads.Associations = append(resource.Preloads.Associations, name)
+		}
+		sort.Strings(resource.Preloads.Associations)
+	}
+	return resource
+}
+
+// typedFilterParams returns the query params of the filter struct (see
+// enum.ListOption.Filter): the form names of its `filter` fields.
+func typedFilterParams(filter any) []string {
+	params := []string{}
+	t := reflect.TypeOf(filter)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return params
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tag, ok := field.Tag.Lookup("filter"); !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		params = append(params, name)
+	}
+	return params
+}
@@ -3,8 +3,11 @@ package router
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/controller"
 	"github.com/tqrj/cd/log"
+	gingzip "github.com/tqrj/cd/pkg/gin-gzip"
 	ginrequestid "github.com/tqrj/cd/pkg/gin-request-id"
+	"github.com/tqrj/cd/pkg/ratelimit"
 )
 
 var logger = log.ZoneLogger("crud/router")
@@ -15,7 +18,7 @@ var logger = log.ZoneLogger("crud/router")
 // and addon middlewares indicated by the options parameters.
 func NewRouter(options ...RouterOption) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Recovery(), log.Logger4Gin, ginrequestid.RequestID())
+	router.Use(gin.Recovery(), log.Logger4Gin, ginrequestid.RequestIDWithConfig(RequestIDConfig))
 
 	for _, option := range options {
 		router = option(router).(*gin.Engine)
@@ -24,6 +27,15 @@ func NewRouter(options ...RouterOption) *gin.Engine {
 	return router
 }
 
+// RequestIDConfig configures the request id middleware installed by
+// NewRouter (and WithRequestID), e.g. the header to read and echo it:
+//
+//	router.RequestIDConfig.Header = "X-Correlation-Id"
+//
+// The request_id is put in the context for the logs (log.RequestIDHook),
+// the SQL comments (service.RequestComment) and the error responses.
+var RequestIDConfig ginrequestid.Config
+
 // RouterOption is an option to construct the router.
 type RouterOption func(router gin.IRouter) gin.IRouter
 
@@ -42,7 +54,46 @@ func AllowAllCors() RouterOption {
 // And the request_id will be writen to the X-Request-Id response header.
 func WithRequestID() RouterOption {
 	return func(router gin.IRouter) gin.IRouter {
-		router.Use(ginrequestid.RequestID())
+		router.Use(ginrequestid.RequestIDWithConfig(RequestIDConfig))
+		return router
+	}
+}
+
+// WithGzip adds the gin_gzip.Gzip(level) middleware, which compresses the
+// responses with gzip for clients accepting it. level is one of the
+// compress/gzip levels, e.g. gzip.DefaultCompression.
+//
+// To compress only some of the routes (e.g. the lists), use the
+// Middlewares field of the enum.ListOption, ... instead.
+func WithGzip(level int) RouterOption {
+	return func(router gin.IRouter) gin.IRouter {
+		router.Use(gingzip.Gzip(level))
+		return router
+	}
+}
+
+// WithRateLimit adds a middleware limiting the requests per key (the
+// client IP if key is nil) by the limiter. Limited requests are responded
+// with a 429 Too Many Requests, and a Retry-After header telling when
+// the next request will be allowed:
+//
+//	NewRouter(WithRateLimit(ratelimit.NewLimiter(10, 20), nil))
+func WithRateLimit(limiter *ratelimit.Limiter, key func(c *gin.Context) string) RouterOption {
+	if key == nil {
+		key = (*gin.Context).ClientIP
+	}
+	return func(router gin.IRouter) gin.IRouter {
+		router.Use(func(c *gin.Context) {
+			if ok, retryAfter := limiter.Allow(key(c)); !ok {
+				logger.WithContext(c).WithField("retryAfter", retryAfter).
+					Warn("WithRateLimit: too many requests")
+				controller.ResponseError(c, controller.CodeTooManyRequests,
+					controller.WithRetryAfter(controller.ErrRateLimited, retryAfter))
+				c.Abort()
+				return
+			}
+			c.Next()
+		})
 		return router
 	}
 }
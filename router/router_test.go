@@ -0,0 +1,40 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/pkg/ratelimit"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(WithRateLimit(ratelimit.NewLimiter(0.5, 1), func(c *gin.Context) string {
+		return c.GetHeader("X-Client")
+	}))
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	get := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Client", client)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("a"); w.Code != http.StatusOK {
+		t.Fatalf("first request: code = %d, want 200", w.Code)
+	}
+	w := get("a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: code = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if w := get("b"); w.Code != http.StatusOK {
+		t.Errorf("other client: code = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/reqctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// KeyAffectedIDs is the reqctx key of the AffectedIDs of a request.
+const KeyAffectedIDs = "crud/affected_ids"
+
+// AffectedIDs collects the primary keys of the models written by the batch
+// operations by conditions (ReplaceColumn, RestoreMany and ArchiveMany)
+// run with the context of a request, e.g. for the audit or the undo of
+// them:
+//
+//	affected := new(service.AffectedIDs)
+//	reqctx.Set(c, service.KeyAffectedIDs, affected)
+//	service.RestoreMany[User](c, options...)
+//	affected.IDs()  // => [3, 5, 8]
+//
+// The ids are resolved by a query before the write, in its transaction,
+// which locks the rows matched (SELECT ... FOR UPDATE, but on SQLite,
+// whose transactions are serialized) until the write, and the write is
+// bounded by them, in batches of AffectedBatchSize ids. The ids are the
+// ones of the rows matched and written: the rowsAffected of the operation
+// may be fewer on MySQL, which counts only the rows changed by the write.
+// Without AffectedIDs in the context, the operations run a single
+// statement, as usual.
+//
+// Both are scoped by the orm.GlobalScopes of the context, as the writes by
+// conditions are.
+type AffectedIDs struct {
+	mu  sync.Mutex
+	ids []any
+}
+
+// IDs returns the primary keys collected, [] if none.
+func (a *AffectedIDs) IDs() []any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]any{}, a.ids...)
+}
+
+func (a *AffectedIDs) add(ids ...any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ids = append(a.ids, ids...)
+}
+
+// affectedIDs returns the AffectedIDs of the ctx (else nil).
+func affectedIDs(ctx context.Context) *AffectedIDs {
+	affected, _ := reqctx.Get[*AffectedIDs](ctx, KeyAffectedIDs)
+	return affected
+}
+
+// AffectedBatchSize is the max number of the ids bounding one write of
+// the batch operations with AffectedIDs, below the bind parameter limits
+// of the databases (e.g. 999 of the SQLite before 3.32). 0 bounds one
+// write by all the ids.
+var AffectedBatchSize = 500
+
+// writeAffected runs the write of the batch operation op on the models T
+// matched by query (built on the db given). With the AffectedIDs of ctx,
+// the primary keys of the models matched are resolved (and their rows
+// locked) first, and the write is bounded by them, in batches of
+// AffectedBatchSize ids, in a transaction. The ids are collected once the
+// writes are all done.
+func writeAffected[T any](ctx context.Context, op string, db *gorm.DB, query func(db *gorm.DB) *gorm.DB, write func(query *gorm.DB) *gorm.DB) (rowsAffected int64, err error) {
+	affected := affectedIDs(ctx)
+	if affected == nil {
+		result := write(query(db))
+		return result.RowsAffected, result.Error
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return 0, err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("%s: %w", op, ErrNoIdentityField)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		matched := query(tx)
+		if tx.Dialector.Name() != "sqlite" { // no FOR UPDATE in SQLite, which locks the database on write
+			matched = matched.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		ids := reflect.New(reflect.SliceOf(pk.FieldType))
+		if err := matched.Pluck(s.Table+"."+pk.DBName, ids.Interface()).Error; err != nil {
+			return err
+		}
+		values := make([]any, ids.Elem().Len())
+		for i := range values {
+			values[i] = ids.Elem().Index(i).Interface()
+		}
+		size := AffectedBatchSize
+		if size <= 0 {
+			size = len(values)
+		}
+		for start := 0; start < len(values); start += size {
+			end := start + size
+			if end > len(values) {
+				end = len(values)
+			}
+			result := write(query(tx).Where(clause.IN{
+				Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName},
+				Values: values[start:end],
+			}))
+			if result.Error != nil {
+				return result.Error
+			}
+			rowsAffected += result.RowsAffected
+		}
+		affected.add(values...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type badge struct {
+	ID       uint `gorm:"primaryKey"`
+	Color    string
+	Internal bool
+}
+
+func TestReplaceColumn_AffectedIDs(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&badge{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int) { AffectedBatchSize = size }(AffectedBatchSize)
+	AffectedBatchSize = 2
+
+	orm.RegisterGlobalScope("internal", func(ctx context.Context, model *schema.Schema) func(db *gorm.DB) *gorm.DB {
+		if model.LookUpField("internal") == nil {
+			return nil
+		}
+		return FilterBy(model.Table+".internal", false)
+	})
+	defer orm.UnregisterGlobalScope("internal")
+
+	var updates int
+	if err := orm.DB.Callback().Update().Before("gorm:update").Register("test:count_updates", func(*gorm.DB) { updates++ }); err != nil {
+		t.Fatal(err)
+	}
+	colors := func() string {
+		t.Helper()
+		var badges []badge
+		if err := orm.DB.WithContext(orm.WithoutGlobalScopes(context.Background())).Order("id").Find(&badges).Error; err != nil {
+			t.Fatal(err)
+		}
+		var colors []string
+		for _, b := range badges {
+			colors = append(colors, b.Color)
+		}
+		return fmt.Sprint(colors)
+	}
+
+	tests := []struct {
+		name        string
+		report      bool
+		wantRows    int64
+		wantIDs     string
+		wantUpdates int
+	}{
+		{"without AffectedIDs", false, 5, "", 1},
+		{"with AffectedIDs: in batches", true, 5, "[1 2 3 4 5]", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := orm.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&badge{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			badges := []*badge{{ID: 6, Color: "red", Internal: true}}
+			for id := uint(1); id <= 5; id++ {
+				badges = append(badges, &badge{ID: id, Color: "red"})
+			}
+			badges = append(badges, &badge{ID: 7, Color: "blue"})
+			if err := orm.DB.Create(badges).Error; err != nil {
+				t.Fatal(err)
+			}
+			updates = 0
+
+			ctx := context.Background()
+			affected := new(AffectedIDs)
+			if tt.report {
+				ctx = context.WithValue(ctx, KeyAffectedIDs, affected)
+			}
+			rows, err := ReplaceColumn[badge](ctx, "color", "red", "green", false, Where("id < ?", 7))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows != tt.wantRows || updates != tt.wantUpdates {
+				t.Errorf("rows = %d by %d updates, want %d by %d", rows, updates, tt.wantRows, tt.wantUpdates)
+			}
+			// the internal badge 6 is not read, and not written either
+			if got, want := colors(), "[green green green green green red blue]"; got != want {
+				t.Errorf("colors = %s, want %s", got, want)
+			}
+			if tt.report {
+				ids := affected.IDs()
+				sort.Slice(ids, func(i, j int) bool { return ids[i].(uint) < ids[j].(uint) })
+				if fmt.Sprint(ids) != tt.wantIDs {
+					t.Errorf("affected ids = %v, want %s", ids, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
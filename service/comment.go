@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/tqrj/cd/enum"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// SQLComment, if not nil, returns a comment to be prepended to the SQL of
+// all the queries issued by the service with the context ctx:
+//
+//	/* req_id=8c0d...,route=/users/:UserID */ SELECT * FROM `users` ...
+//
+// Which helps correlating the queries in the database logs (e.g. slow
+// queries) with the API calls. Returning "" means no comment.
+//
+// It is nil (disabled) by default. Enable it by:
+//
+//	service.SQLComment = service.RequestComment
+//
+// Notice that the comment makes the SQL different for every request,
+// which defeats the prepared statement cache (gorm.Session.PrepareStmt).
+// And INSERTs on sqlite are not commented: the driver builds the INSERT
+// clause by itself, ignoring the comment.
+var SQLComment func(ctx context.Context) string
+
+// RequestComment is a SQLComment with the request_id (set by the
+// gin_request_id.RequestID middleware) and the route of the request
+// (if ctx is a *gin.Context), e.g. "req_id=8c0d...,route=/users/:UserID".
+// The request_id, which may be given by the client, is limited to the
+// characters [A-Za-z0-9._:-].
+func RequestComment(ctx context.Context) string {
+	var tags []string
+	if id := ctx.Value("request_id"); id != nil {
+		if id := commentRequestID(fmt.Sprint(id)); id != "" {
+			tags = append(tags, "req_id="+id)
+		}
+	}
+	if c, ok := ctx.(interface{ FullPath() string }); ok && c.FullPath() != "" {
+		tags = append(tags, "route="+c.FullPath())
+	}
+	return strings.Join(tags, ",")
+}
+
+// commentRequestID returns the id without the characters other than
+// [A-Za-z0-9._:-].
+func commentRequestID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9',
+			r == '.', r == '_', r == ':', r == '-':
+			return r
+		}
+		return -1
+	}, id)
+}
+
+// Comment is a query option that prepends the comment /* comment */ to
+// the SQL of the query.
+func Comment(comment string) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return withComment(tx, comment)
+	}
+}
+
+// withComment prepends the comment to the SQL of db, if it is not empty.
+func withComment(db *gorm.DB, comment string) *gorm.DB {
+	if comment == "" {
+		return db
+	}
+	return db.Clauses(sqlComment(escapeComment(comment)))
+}
+
+// escapeComment makes s safe to be put in a /* */ comment: breaks all the
+// "/*" and "*/" in it, and removes the control characters and the
+// placeholders of the vars ("?", and "$" of postgres), into which the vars
+// would be written by the SQL logs (gorm's logger.ExplainSQL).
+func escapeComment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f || r == '?' || r == '$' {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.ReplaceAll(s, "/*", "/ *")
+	s = strings.ReplaceAll(s, "*/", "* /")
+	return s
+}
+
+// sqlComment is a gorm.StatementModifier that prepends the (escaped)
+// comment before the first clause of SELECT, INSERT, UPDATE and DELETE.
+type sqlComment string
+
+// commentedClauses are the leading clauses of the statements.
+var commentedClauses = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+
+func (comment sqlComment) ModifyStatement(stmt *gorm.Statement) {
+	for _, name := range commentedClauses {
+		c := stmt.Clauses[name]
+		c.BeforeExpression = clause.Expr{SQL: "/* " + string(comment) + " */"}
+		stmt.Clauses[name] = c
+	}
+}
+
+// Build implements clause.Expression, which is required by gorm.DB.Clauses.
+// The comment is written by ModifyStatement instead.
+func (comment sqlComment) Build(clause.Builder) {}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+)
+
+func TestEscapeComment(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"req_id=1,route=/users/:UserID", "req_id=1,route=/users/:UserID"},
+		{"a */ DROP TABLE users; /* b", "a * / DROP TABLE users; / * b"},
+		{"/files/*path", "/files/ *path"},
+		{"line\nbreak\x00\x7f", "linebreak"},
+		{"id = ? OR $1", "id =  OR 1"},
+	}
+	for _, tt := range tests {
+		if got := escapeComment(tt.s); got != tt.want {
+			t.Errorf("escapeComment(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestRequestComment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		requestID any
+		want      string
+	}{
+		{"request id", "8c0d-4f.1:a_b", "req_id=8c0d-4f.1:a_b,route=/users/:UserID"},
+		{"request id limited", "abc? */ $1 x", "req_id=abc1x,route=/users/:UserID"},
+		{"no request id", nil, "route=/users/:UserID"},
+		{"request id of no valid characters", "?*/", "route=/users/:UserID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			r := gin.New()
+			r.GET("/users/:UserID", func(c *gin.Context) {
+				if tt.requestID != nil {
+					c.Set("request_id", tt.requestID)
+				}
+				got = RequestComment(c)
+			})
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+			if got != tt.want {
+				t.Errorf("RequestComment = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := RequestComment(context.Background()); got != "" {
+		t.Errorf("RequestComment of no request = %q, want empty", got)
+	}
+}
+
+func TestSQLComment_ModifyStatement(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	comment := Comment("req_id=? */ x")
+	want := "/* req_id= * / x */ "
+
+	tests := []struct {
+		name   string
+		run    func(tx *gorm.DB) *gorm.DB
+		prefix string
+	}{
+		{"select", func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]note{}) }, "SELECT"},
+		{"update", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&note{}).Where("id = ?", 1).Update("body", "b")
+		}, "UPDATE"},
+		{"delete", func(tx *gorm.DB) *gorm.DB { return tx.Where("id = ?", 1).Delete(&note{}) }, "UPDATE"}, // soft delete
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.run(comment(orm.DB.Session(&gorm.Session{DryRun: true})))
+			if tx.Error != nil {
+				t.Fatal(tx.Error)
+			}
+			sql := tx.Statement.SQL.String()
+			if !strings.HasPrefix(sql, want+tt.prefix) {
+				t.Errorf("SQL = %s, want %s%s ...", sql, want, tt.prefix)
+			}
+			if strings.Count(sql, "?") != len(tx.Statement.Vars) {
+				t.Errorf("SQL = %s with %d vars: a placeholder in the comment", sql, len(tx.Statement.Vars))
+			}
+		})
+	}
+}
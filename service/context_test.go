@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/orm"
+)
+
+type note struct {
+	orm.BasicModel
+	Body string
+}
+
+func TestGetMany_CancelledContext(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&note{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/notes", nil).WithContext(cancelled)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"context", cancelled},
+		{"gin context of a cancelled request", c},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notes []*note
+			start := time.Now()
+			err := GetMany[note](tt.ctx, &notes)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("err = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("returned after %v, want promptly", elapsed)
+			}
+		})
+	}
+}
@@ -2,9 +2,16 @@ package service
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
 )
 
 // Create creates a model in the database.
@@ -22,8 +29,34 @@ import (
 //	group := GetByID[Group](123)
 //	Create(&user, NestInto(&group, "users"))
 //	// user is already in the database: just add it into group.users
+//
+// The columns of the orm.CreateDefaulter of the model are set from ctx,
+// the string columns of the orm.Normalizer normalized, and the values of
+// the columns restricted by the orm.AllowedValuer of the model checked,
+// before creating it.
 func Create(ctx context.Context, model any, opt *enum.CreateOption, in CreateMode) error {
-	return in(ctx, model, opt)
+	if err := orm.SetCreateDefaults(ctx, model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("Create: SetCreateDefaults failed")
+		return err
+	}
+	if err := orm.NormalizeValues(model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("Create: NormalizeValues failed")
+		return err
+	}
+	if err := orm.CheckAllowedValues(model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("Create: CheckAllowedValues failed")
+		return err
+	}
+	var policy *enum.RetryPolicy
+	if opt != nil {
+		policy = opt.Retry
+	}
+	return retry(ctx, "Create", policy, func() error {
+		return in(ctx, model, opt)
+	})
 }
 
 // CreateMode is the way to create a model:
@@ -60,26 +93,46 @@ type CreateMode func(ctx context.Context, modelToCreate any, opt *enum.CreateOpt
 //	INSERT INTO user_profiles (user_id, profile_id)
 //
 // This is useful to handle POSTs like /api/users/{user_id}/profile
+//
+// The Session of opt (or, if opt is nil, of the option given to Create) is
+// applied to the append.
 func NestInto(parent any, field string, opt *enum.CreateOption) CreateMode {
-	return func(ctx context.Context, modelToCreate any, opt *enum.CreateOption) error {
+	return func(ctx context.Context, modelToCreate any, createOpt *enum.CreateOption) error {
 		logger.WithContext(ctx).
 			WithField("parent", parent).
 			WithField("field", field).
 			WithField("modelToCreate", modelToCreate).
 			Trace("Create Nested")
 
-		return orm.DB.WithContext(ctx).Session(&gorm.Session{FullSaveAssociations: true}).
-			Model(parent).Association(field).Append(modelToCreate)
+		nestOpt := opt
+		if nestOpt == nil {
+			nestOpt = createOpt
+		}
+		db := newDB(ctx).Session(&gorm.Session{FullSaveAssociations: true})
+		if nestOpt != nil {
+			db = withSession(db, nestOpt.Session)
+		}
+		return db.Model(parent).Association(field).Append(modelToCreate)
 	}
 }
 
 // IfNotExist creates a model if it does not exist.
+//
+// With the CreateOption.UniqueBy columns, or the unique keys of an
+// orm.UniqueKeyer model, a model with the same values of them is looked
+// up before the insert, in its transaction: if one exists, it fails with
+// a *DuplicateError of the existing model. An insert losing
+// the race to a concurrent one (rejected by the unique index of the
+// columns) is reported by the DuplicateError as well.
 func IfNotExist() CreateMode {
 	return func(ctx context.Context, modelToCreate any, opt *enum.CreateOption) error {
 		logger.WithContext(ctx).
 			WithField("modelToCreate", modelToCreate).
 			Trace("Create IfNotExist")
-		db := orm.DB.WithContext(ctx)
+		db := withSession(newDB(ctx), opt.Session)
+		if opt.FullSaveAssociations {
+			db = db.Session(&gorm.Session{FullSaveAssociations: true})
+		}
 		//if opt.QueryOptionClosure != nil {
 		//	db = opt.QueryOptionClosure(db)
 		//}
@@ -89,6 +142,344 @@ func IfNotExist() CreateMode {
 			db = Omit(opt.Omit)(db)
 		}
 
-		return db.Create(modelToCreate).Error
+		keys, err := uniqueKeys(modelToCreate, opt.UniqueBy)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return db.Create(modelToCreate).Error
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := checkDuplicates(tx.Session(&gorm.Session{NewDB: true}), modelToCreate, keys, false); err != nil {
+				return err
+			}
+			return tx.Create(modelToCreate).Error
+		})
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			// the insert may be rejected for a duplicate created meanwhile
+			if dup := checkDuplicates(withSession(newDB(ctx), opt.Session), modelToCreate, keys, false); errors.Is(dup, ErrDuplicate) {
+				return dup
+			}
+		}
+		return err
+	}
+}
+
+// uniqueKeys returns the unique keys to check for the model: the columns
+// of uniqueBy (e.g. the CreateOption.UniqueBy, if any) and the ones of
+// its orm.UniqueKeyer.
+func uniqueKeys(model any, uniqueBy []string) ([][]string, error) {
+	keys, err := orm.UniqueKeys(model)
+	if err != nil {
+		return nil, err
+	}
+	if len(uniqueBy) > 0 {
+		keys = append([][]string{uniqueBy}, keys...)
+	}
+	return keys, nil
+}
+
+// checkDuplicates checks the model by checkDuplicate of each key, returning
+// the first *DuplicateError if any. Nothing is checked in the DryRun mode,
+// where the lookups would not be executed.
+func checkDuplicates(db *gorm.DB, model any, keys [][]string, excludeSelf bool) error {
+	if db.DryRun {
+		return nil
+	}
+	for _, key := range keys {
+		if err := checkDuplicate(db, model, key, excludeSelf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicate looks up the model with the same values of the columns
+// as model (other than the model itself by its primary keys, if
+// excludeSelf, for updates), returning a *DuplicateError of it if found.
+// Keys with a NULL value are not checked: NULLs are not equal to each
+// other in the unique indexes.
+func checkDuplicate(db *gorm.DB, model any, columns []string, excludeSelf bool) error {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return err
+	}
+	ctx := db.Statement.Context
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	existing := reflect.New(s.ModelType).Interface()
+	query := db.Model(existing)
+	values := make(map[string]any, len(columns))
+	for _, column := range columns {
+		field, err := orm.LookUpField(model, column)
+		if err != nil {
+			return err
+		}
+		value, _ := field.ValueOf(ctx, rv)
+		if isNull(value) {
+			return nil
+		}
+		values[field.DBName] = value
+		query = query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+	}
+	if excludeSelf {
+		for _, field := range s.PrimaryFields {
+			if value, zero := field.ValueOf(ctx, rv); !zero {
+				query = query.Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+			}
+		}
+	}
+	err = query.Take(existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DuplicateError{Columns: columns, Values: values, Existing: existing}
+}
+
+// isNull reports whether the field value is a NULL of the database: a nil
+// (pointer), or a driver.Valuer of nil (e.g. an invalid sql.NullString).
+func isNull(value any) bool {
+	if value == nil {
+		return true
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return true
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		return err == nil && v == nil
+	}
+	return false
+}
+
+// DuplicateError is the error of creating (or updating) a model with the
+// values of a unique key (the CreateOption.UniqueBy columns, or a key of
+// the orm.UniqueKeyer) of an existing one. It matches ErrDuplicate by
+// errors.Is.
+type DuplicateError struct {
+	Columns  []string
+	Values   map[string]any // column name => value, of the Columns
+	Existing any            // a pointer to the existing model
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s: by %s", ErrDuplicate, strings.Join(e.Columns, ", "))
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+var ErrDuplicate = errors.New("duplicate record")
+
+// GetOrCreateMany ensures the models exist by their natural keys (columns
+// with a unique index, e.g. "code"), creating the missing ones, in a
+// transaction:
+//
+//	INSERT INTO T ... ON CONFLICT (code) DO NOTHING
+//	SELECT * FROM T WHERE code IN (...) AND ...  // options
+//
+// The models already in the database are left as they are, and the
+// associations of the models are not saved. It returns the full set,
+// existing and created, in the order of models (with their ids), and
+// the number of models created.
+//
+// The options scope the lookup: models conflicting with ones out of the
+// scope are neither created nor found, which fails with ErrNoRecord.
+func GetOrCreateMany[T any](ctx context.Context, models []*T, keys []string, opt *enum.GetOrCreateOption, options ...enum.QueryOption) (result []*T, created int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("keys", keys).
+		WithField("count", len(models))
+	logger.Trace("GetOrCreateMany")
+
+	if len(keys) == 0 {
+		return nil, 0, ErrNoKeys
+	}
+	if len(models) == 0 {
+		return []*T{}, 0, nil
+	}
+	fields := make([]*schema.Field, len(keys))
+	columns := make([]clause.Column, len(keys))
+	for i, key := range keys {
+		if fields[i], err = orm.LookUpField(new(T), key); err != nil {
+			return nil, 0, err
+		}
+		columns[i] = clause.Column{Name: fields[i].DBName}
+	}
+	for _, model := range models {
+		if err := orm.SetCreateDefaults(ctx, model); err != nil {
+			logger.WithError(err).Warn("GetOrCreateMany: SetCreateDefaults failed")
+			return nil, 0, err
+		}
+		if err := orm.NormalizeValues(model); err != nil {
+			logger.WithError(err).Warn("GetOrCreateMany: NormalizeValues failed")
+			return nil, 0, err
+		}
+		if err := orm.CheckAllowedValues(model); err != nil {
+			logger.WithError(err).Warn("GetOrCreateMany: CheckAllowedValues failed")
+			return nil, 0, err
+		}
+	}
+	// keyOf returns the natural key of the model (a pointer to T).
+	keyOf := func(model any) (string, []any) {
+		rv := reflect.ValueOf(model).Elem()
+		values := make([]any, len(fields))
+		parts := make([]string, len(fields))
+		for i, field := range fields {
+			values[i], _ = field.ValueOf(ctx, rv)
+			parts[i] = fmt.Sprint(values[i])
+		}
+		return strings.Join(parts, "\x00"), values
+	}
+
+	db := newDB(ctx)
+	var policy *enum.RetryPolicy
+	if opt != nil {
+		db = withSession(db, opt.Session)
+		policy = opt.Retry
+	}
+	getOrCreate := func(tx *gorm.DB) error {
+		// the ids of the models are not reliable after DO NOTHING (some
+		// drivers return the ids of the inserted rows only): all the models
+		// are loaded by the keys afterwards.
+		insert := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{Columns: columns, DoNothing: true}).
+			Create(&models)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		created = insert.RowsAffected
+
+		found := map[string]*T{}
+		for start := 0; start < len(models); start += getOrCreateLookupBatch {
+			end := start + getOrCreateLookupBatch
+			if end > len(models) {
+				end = len(models)
+			}
+			batch := models[start:end]
+			conditions := make([]clause.Expression, 0, len(batch))
+			for _, model := range batch {
+				_, values := keyOf(model)
+				and := make([]clause.Expression, len(fields))
+				for i, field := range fields {
+					and[i] = clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: values[i]}
+				}
+				conditions = append(conditions, clause.And(and...))
+			}
+			query := tx.Model(new(T)).Where(clause.Or(conditions...))
+			for _, option := range options {
+				query = option(query)
+			}
+			var records []*T
+			if err := query.Find(&records).Error; err != nil {
+				return err
+			}
+			for _, record := range records {
+				key, _ := keyOf(record)
+				found[key] = record
+			}
+		}
+
+		result = make([]*T, 0, len(models))
+		for _, model := range models {
+			key, _ := keyOf(model)
+			record, ok := found[key]
+			if !ok {
+				return fmt.Errorf("%w: %q neither created nor found", ErrNoRecord, key)
+			}
+			result = append(result, record)
+		}
+		return nil
+	}
+	err = retry(ctx, "GetOrCreateMany", policy, func() error {
+		return db.Transaction(getOrCreate)
+	})
+	if err != nil {
+		logger.WithError(err).Warn("GetOrCreateMany: failed")
+		return nil, 0, err
+	}
+	return result, created, nil
+}
+
+// getOrCreateLookupBatch is the number of models looked up by a query in
+// GetOrCreateMany, bounding the size of its WHERE.
+const getOrCreateLookupBatch = 100
+
+var ErrNoKeys = errors.New("no key columns")
+
+// Upsert creates the models, or updates the ones conflicting with existing
+// rows on the keys (the columns of a unique index, which may be composite,
+// e.g. "tenant_id", "external_id"):
+//
+//	INSERT INTO T ... ON CONFLICT (tenant_id, external_id) DO UPDATE SET name = excluded.name
+//
+// Only the updates columns are updated on conflict, or all the columns
+// except the primary keys and the create times if updates is empty. The
+// dialect of the statement (e.g. ON DUPLICATE KEY UPDATE for MySQL) is
+// built by GORM. The associations of the models are not saved.
+//
+// It returns the rows affected, as reported by the driver (e.g. MySQL
+// counts 2 for an updated row).
+func Upsert[T any](ctx context.Context, models []*T, keys []string, updates []string, options ...enum.QueryOption) (int64, error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("keys", keys).
+		WithField("count", len(models))
+	logger.Trace("Upsert")
+
+	if len(keys) == 0 {
+		return 0, ErrNoKeys
+	}
+	if len(models) == 0 {
+		return 0, nil
+	}
+	onConflict := clause.OnConflict{}
+	for _, key := range keys {
+		field, err := orm.LookUpField(new(T), key)
+		if err != nil {
+			return 0, err
+		}
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+	}
+	if len(updates) == 0 {
+		onConflict.UpdateAll = true
+	} else {
+		columns := make([]string, len(updates))
+		for i, update := range updates {
+			field, err := orm.LookUpField(new(T), update)
+			if err != nil {
+				return 0, err
+			}
+			columns[i] = field.DBName
+		}
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+	}
+	for _, model := range models {
+		if err := orm.SetCreateDefaults(ctx, model); err != nil {
+			logger.WithError(err).Warn("Upsert: SetCreateDefaults failed")
+			return 0, err
+		}
+		if err := orm.NormalizeValues(model); err != nil {
+			logger.WithError(err).Warn("Upsert: NormalizeValues failed")
+			return 0, err
+		}
+		if err := orm.CheckAllowedValues(model); err != nil {
+			logger.WithError(err).Warn("Upsert: CheckAllowedValues failed")
+			return 0, err
+		}
+	}
+
+	db := newDB(ctx).Omit(clause.Associations).Clauses(onConflict)
+	for _, option := range options {
+		db = option(db)
+	}
+	result := db.Create(&models)
+	if result.Error != nil {
+		logger.WithError(result.Error).Warn("Upsert: failed")
+		return 0, result.Error
 	}
+	return result.RowsAffected, nil
 }
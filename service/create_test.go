@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+)
+
+type account struct {
+	orm.BasicModel
+	TenantID   uint   `gorm:"uniqueIndex:idx_tenant_external"`
+	ExternalID string `gorm:"uniqueIndex:idx_tenant_external"`
+	Name       string
+	Note       string
+}
+
+func TestUpsert_CompositeKeys(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"tenant_id", "external_id"}
+
+	if _, err := Upsert(context.Background(), []*account{
+		{TenantID: 1, ExternalID: "x", Name: "a", Note: "kept"},
+		{TenantID: 2, ExternalID: "x", Name: "b", Note: "kept"},
+	}, keys, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	// conflicts with (1, x) only: (1, y) is a new row
+	if _, err := Upsert(context.Background(), []*account{
+		{TenantID: 1, ExternalID: "x", Name: "a2", Note: "overwritten"},
+		{TenantID: 1, ExternalID: "y", Name: "c"},
+	}, keys, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var accounts []*account
+	if err := orm.DB.Order("id").Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		tenantID         uint
+		externalID, name string
+		note             string
+	}{
+		{1, "x", "a2", "kept"},
+		{2, "x", "b", "kept"},
+		{1, "y", "c", ""},
+	}
+	if len(accounts) != len(want) {
+		t.Fatalf("got %d accounts, want %d", len(accounts), len(want))
+	}
+	for i, w := range want {
+		a := accounts[i]
+		if a.TenantID != w.tenantID || a.ExternalID != w.externalID || a.Name != w.name || a.Note != w.note {
+			t.Errorf("accounts[%d] = (%d, %s, %s, %s), want (%d, %s, %s, %s)",
+				i, a.TenantID, a.ExternalID, a.Name, a.Note, w.tenantID, w.externalID, w.name, w.note)
+		}
+	}
+}
+
+type contact struct {
+	orm.BasicModel
+	Name  string
+	Email *string
+}
+
+func (contact) Normalizations() map[string]orm.Normalization {
+	return map[string]orm.Normalization{
+		"name":  orm.NormalizeTrim,
+		"email": orm.NormalizeTrim | orm.NormalizeLower,
+	}
+}
+
+func TestCreate_Normalizations(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&contact{}); err != nil {
+		t.Fatal(err)
+	}
+
+	email := " Foo@Example.com\n"
+	model := &contact{Name: " Foo ", Email: &email}
+	if err := Create(context.Background(), model, &enum.CreateOption{}, IfNotExist()); err != nil {
+		t.Fatal(err)
+	}
+	var got contact
+	if err := orm.DB.First(&got, model.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Foo" {
+		t.Errorf("name = %q, want %q", got.Name, "Foo")
+	}
+	if got.Email == nil || *got.Email != "foo@example.com" {
+		t.Errorf("email = %v, want %q", got.Email, "foo@example.com")
+	}
+
+	if _, err := UpdateColumns(context.Background(), &got, map[string]any{"name": "  Bar\t"}, &enum.UpdateOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.DB.First(&got, model.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Bar" {
+		t.Errorf("updated name = %q, want %q", got.Name, "Bar")
+	}
+}
@@ -2,15 +2,22 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"time"
 )
 
 // Delete a model from database.
 func Delete(ctx context.Context, model any) (rowsAffected int64, err error) {
 	logger.WithContext(ctx).
 		WithField("model", model).Trace("Delete model")
-	result := orm.DB.WithContext(ctx).Delete(model)
+	result := newDB(ctx).Delete(model)
 	return result.RowsAffected, result.Error
 }
 
@@ -27,18 +34,306 @@ func DeleteByID[T orm.Model](ctx context.Context, id any, opt *enum.DelOption) (
 			Warn("DeleteByID: GetByID failed")
 		return 0, err
 	}
-	db := orm.DB.WithContext(ctx)
-	result := db.Delete(&model)
-	if result.Error != nil {
+	var session *gorm.Session
+	var policy *enum.RetryPolicy
+	if opt != nil {
+		session, policy = opt.Session, opt.Retry
+	}
+	var result *gorm.DB
+	err = retry(ctx, "DeleteByID", policy, func() error {
+		result = withSession(newDB(ctx), session).Delete(&model)
+		return result.Error
+	})
+	if err != nil {
 		logger.WithContext(ctx).
-			WithError(result.Error).Warn("DeleteByID: failed")
+			WithError(err).Warn("DeleteByID: failed")
+		return 0, err
 	}
-	return result.RowsAffected, result.Error
+	return result.RowsAffected, nil
+}
+
+// RestoreMany restores (un-soft-deletes) all the soft-deleted models T
+// matching the options, which are required to bound the restore:
+//
+//	UPDATE T SET deleted_at = NULL WHERE deleted_at IS NOT NULL AND ...
+//
+// It returns the number of models restored, whose ids are collected into
+// the AffectedIDs of ctx, if any.
+func RestoreMany[T any](ctx context.Context, options ...enum.QueryOption) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T)))
+	logger.Trace("RestoreMany: Restore soft-deleted models")
+
+	if len(options) == 0 {
+		logger.Warn("RestoreMany skipped: no filter to bound the restore")
+		return 0, ErrNoFilter
+	}
+	deletedAt, err := deletedAtColumn[T]()
+	if err != nil {
+		logger.WithError(err).Warn("RestoreMany: not soft deletable")
+		return 0, err
+	}
+
+	query := func(db *gorm.DB) *gorm.DB {
+		query := db.Unscoped().Model(new(T)).
+			Where(clause.Neq{Column: deletedAt, Value: nil})
+		for _, option := range options {
+			query = option(query)
+		}
+		return query
+	}
+	rowsAffected, err = writeAffected[T](ctx, "RestoreMany", newDB(ctx), query, func(query *gorm.DB) *gorm.DB {
+		return query.Update(deletedAt.Name, nil)
+	})
+	if err != nil {
+		logger.WithError(err).Warn("RestoreMany: failed")
+	} else {
+		logger.WithField("rowsAffected", rowsAffected).
+			Info("RestoreMany: done")
+	}
+	return rowsAffected, err
 }
 
+// ArchiveMany soft-deletes all the models T matching the options, which
+// are required to bound the operation, recording the reason and the actor
+// (orm.AuditActor of ctx) of the deletion:
+//
+//	UPDATE T SET deleted_at = now, reason_column = reason, actor_column = actor
+//	WHERE deleted_at IS NULL AND ...
+//
+// into the ReasonColumn and ActorColumn of the opt (if set), and into the
+// audit sink of an orm.Audited model T: an AuditDelete record (with the
+// Reason) for each model archived, written in the same transaction, in
+// batches of ArchiveBatchSize. The models are restorable by RestoreMany.
+// It returns the number of models archived, whose ids are collected into
+// the AffectedIDs of ctx, if any.
+func ArchiveMany[T any](ctx context.Context, reason string, opt *enum.ArchiveOption, options ...enum.QueryOption) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("reason", reason)
+	logger.Trace("ArchiveMany: Soft-delete models with the reason")
+
+	if len(options) == 0 {
+		logger.Warn("ArchiveMany skipped: no filter to bound the archive")
+		return 0, ErrNoFilter
+	}
+	deletedAt, err := deletedAtColumn[T]()
+	if err != nil {
+		logger.WithError(err).Warn("ArchiveMany: not soft deletable")
+		return 0, err
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	actor := orm.AuditActor(ctx)
+	values := map[string]any{deletedAt.Name: now}
+	for column, value := range map[string]string{opt.ReasonColumn: reason, opt.ActorColumn: actor} {
+		if column == "" {
+			continue
+		}
+		field, err := orm.LookUpField(new(T), column)
+		if err != nil {
+			logger.WithError(err).Warn("ArchiveMany: LookUpField failed")
+			return 0, err
+		}
+		values[field.DBName] = value
+	}
+
+	err = newDB(ctx).Transaction(func(tx *gorm.DB) error {
+		scoped := func(db *gorm.DB) *gorm.DB {
+			query := db.Model(new(T))
+			for _, option := range options {
+				query = option(query)
+			}
+			return query
+		}
+		audited, ok := any(new(T)).(orm.Audited)
+		if !ok || audited.AuditSink() == nil || s.PrioritizedPrimaryField == nil {
+			n, err := writeAffected[T](ctx, "ArchiveMany", tx, scoped, func(query *gorm.DB) *gorm.DB {
+				return query.Updates(values)
+			})
+			rowsAffected = n
+			return err
+		}
+		// the models are loaded (in batches of ArchiveBatchSize) for their
+		// audit records, and archived by their primary keys, exactly the
+		// ones recorded.
+		pk := s.PrioritizedPrimaryField
+		sink := audited.AuditSink()
+		var models []*T
+		return scoped(tx).FindInBatches(&models, ArchiveBatchSize, func(_ *gorm.DB, _ int) error {
+			ids := make([]any, len(models))
+			for i, model := range models {
+				ids[i], _ = pk.ValueOf(ctx, reflect.ValueOf(model).Elem())
+			}
+			result := tx.Session(&gorm.Session{NewDB: true}).Model(new(T)).
+				Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Values: ids}).
+				Updates(values)
+			if result.Error != nil {
+				return result.Error
+			}
+			rowsAffected += result.RowsAffected
+			if affected := affectedIDs(ctx); affected != nil {
+				affected.add(ids...)
+			}
+
+			for i, model := range models {
+				diff := map[string][2]any{}
+				for column, value := range values {
+					var before any
+					if field := s.LookUpField(column); field != nil {
+						before, _ = field.ValueOf(ctx, reflect.ValueOf(model).Elem())
+					}
+					diff[column] = [2]any{before, value}
+				}
+				diffJSON, err := json.Marshal(diff)
+				if err != nil {
+					return err
+				}
+				record := &orm.AuditRecord{
+					Actor:     actor,
+					Model:     s.Table,
+					ModelID:   fmt.Sprint(ids[i]),
+					Operation: orm.AuditDelete,
+					Diff:      string(diffJSON),
+					Reason:    reason,
+				}
+				if err := sink.Record(tx.Session(&gorm.Session{NewDB: true}), record); err != nil {
+					return fmt.Errorf("audit: %w", err)
+				}
+			}
+			return nil
+		}).Error
+	})
+	if err != nil {
+		logger.WithError(err).Warn("ArchiveMany: failed")
+		return 0, err
+	}
+	logger.WithField("rowsAffected", rowsAffected).
+		Info("ArchiveMany: done")
+	return rowsAffected, nil
+}
+
+// ArchiveBatchSize is the max number of the models of an orm.Audited T
+// loaded (for their audit records) and archived by one UPDATE statement
+// of ArchiveMany, in its transaction.
+var ArchiveBatchSize = 1000
+
+// PurgeBatchSize is the max number of rows hard-deleted by one DELETE
+// statement of PurgeDeleted, to avoid long locks on the table.
+var PurgeBatchSize = 1000
+
+// PurgeDeleted hard-deletes the models T that have been soft-deleted for
+// longer than olderThan (e.g. 30 * 24 * time.Hour), in batches of
+// PurgeBatchSize rows:
+//
+//	DELETE FROM T WHERE id IN (
+//	    SELECT id FROM T WHERE deleted_at < now - olderThan LIMIT batch)
+//
+// It returns the number of models purged, until an error or ctx is done.
+// It is meant to be run by a retention job, e.g. a daily cron.
+func PurgeDeleted[T any](ctx context.Context, olderThan time.Duration) (purged int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("olderThan", olderThan)
+	logger.Trace("PurgeDeleted: Purge soft-deleted models")
+
+	deletedAt, err := deletedAtColumn[T]()
+	if err != nil {
+		logger.WithError(err).Warn("PurgeDeleted: not soft deletable")
+		return 0, err
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return 0, err
+	}
+	if s.PrioritizedPrimaryField == nil {
+		logger.Warn("PurgeDeleted: no primary key")
+		return 0, ErrNoIdentityField
+	}
+	pk := clause.Column{Table: s.Table, Name: s.PrioritizedPrimaryField.DBName}
+	expired := clause.Lt{Column: deletedAt, Value: time.Now().Add(-olderThan)}
+
+	for ctx.Err() == nil {
+		var ids []any
+		err = newDB(ctx).Unscoped().Model(new(T)).
+			Where(expired).Limit(PurgeBatchSize).
+			Pluck(pk.Name, &ids).Error
+		if err != nil || len(ids) == 0 {
+			break
+		}
+		// expired again: in case of restored in between
+		result := newDB(ctx).Unscoped().
+			Where(clause.IN{Column: pk, Values: ids}).Where(expired).
+			Delete(new(T))
+		if err = result.Error; err != nil {
+			break
+		}
+		purged += result.RowsAffected
+		if len(ids) < PurgeBatchSize {
+			break
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		logger.WithError(err).WithField("purged", purged).
+			Warn("PurgeDeleted: failed")
+	} else {
+		logger.WithField("purged", purged).Info("PurgeDeleted: done")
+	}
+	return purged, err
+}
+
+// DeletedBetween is a query option that sets
+// WHERE deleted_at BETWEEN from AND to condition on soft-deleted models,
+// by the soft delete column of the model of the query (see gorm's Model).
+// It works with Unscoped queries like RestoreMany.
+func DeletedBetween(from, to any) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		if tx.Statement.Model == nil {
+			_ = tx.AddError(fmt.Errorf("DeletedBetween: %w: no model", ErrNotSoftDeletable))
+			return tx
+		}
+		deletedAt, err := softDeleteColumn(tx.Statement.Model)
+		if err != nil {
+			_ = tx.AddError(err)
+			return tx
+		}
+		return tx.Where("? BETWEEN ? AND ?", deletedAt, from, to)
+	}
+}
+
+// deletedAtColumn returns the soft delete column (a gorm.DeletedAt field)
+// of model T.
+func deletedAtColumn[T any]() (clause.Column, error) {
+	return softDeleteColumn(new(T))
+}
+
+// softDeleteColumn returns the soft delete column of the model.
+func softDeleteColumn(model any) (clause.Column, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return clause.Column{}, err
+	}
+	for _, field := range s.Fields {
+		if field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			return clause.Column{Table: s.Table, Name: field.DBName}, nil
+		}
+	}
+	return clause.Column{}, fmt.Errorf("%w: %s", ErrNotSoftDeletable, s.Name)
+}
+
+var ErrNotSoftDeletable = errors.New("model is not soft deletable")
+
 // DeleteNested remove the association between parent and child.
 func DeleteNested[P orm.Model, T any](ctx context.Context, parent *P, field string, child *T) error {
-	err := orm.DB.WithContext(ctx).Model(parent).Association(field).Delete(child)
+	err := newDB(ctx).Model(parent).Association(field).Delete(child)
 	if err != nil {
 		logger.WithContext(ctx).
 			WithError(err).Warn("DeleteNested: failed")
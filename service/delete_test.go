@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+)
+
+type memo struct {
+	ID        uint `gorm:"primaryKey"`
+	Title     string
+	RemovedAt gorm.DeletedAt `gorm:"column:removed_at;index"`
+}
+
+func TestRestoreMany_DeletedBetween(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&memo{}); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	notes := []*memo{
+		{Title: "old", RemovedAt: gorm.DeletedAt{Time: day.AddDate(0, 0, -5), Valid: true}},
+		{Title: "recent", RemovedAt: gorm.DeletedAt{Time: day, Valid: true}},
+		{Title: "kept"},
+	}
+	if err := orm.DB.Create(notes).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := RestoreMany[memo](context.Background(), DeletedBetween(day.AddDate(0, 0, -1), day.AddDate(0, 0, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Errorf("restored = %d, want 1", restored)
+	}
+	var titles []string
+	if err := orm.DB.Model(&memo{}).Order("id").Pluck("title", &titles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 2 || titles[0] != "recent" || titles[1] != "kept" {
+		t.Errorf("not deleted = %v, want [recent kept]", titles)
+	}
+
+	if err := orm.DB.Model(&tally{}).Scopes(DeletedBetween(day, day)).Find(&[]tally{}).Error; err == nil {
+		t.Error("DeletedBetween of a model not soft deletable: no error")
+	}
+}
+
+type tally struct {
+	ID uint `gorm:"primaryKey"`
+	N  int
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&memo{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int) { PurgeBatchSize = size }(PurgeBatchSize)
+	PurgeBatchSize = 2
+
+	expired := gorm.DeletedAt{Time: time.Now().AddDate(0, 0, -40), Valid: true}
+	notes := []*memo{
+		{Title: "kept"},
+		{Title: "recent", RemovedAt: gorm.DeletedAt{Time: time.Now().AddDate(0, 0, -1), Valid: true}},
+	}
+	for i := 0; i < 5; i++ { // 3 batches
+		notes = append(notes, &memo{Title: "expired", RemovedAt: expired})
+	}
+	if err := orm.DB.Create(notes).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := PurgeDeleted[memo](context.Background(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 5 {
+		t.Errorf("purged = %d, want 5", purged)
+	}
+	var titles []string
+	if err := orm.DB.Unscoped().Model(&memo{}).Order("id").Pluck("title", &titles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 2 || titles[0] != "kept" || titles[1] != "recent" {
+		t.Errorf("left = %v, want [kept recent]", titles)
+	}
+
+	if _, err := PurgeDeleted[tally](context.Background(), time.Hour); err == nil {
+		t.Error("PurgeDeleted of a model not soft deletable: no error")
+	}
+}
+
+type ledger struct {
+	orm.BasicModel
+	Owner  string
+	Reason string
+}
+
+func (ledger) AuditSink() orm.AuditSink { return orm.DBAuditSink{} }
+
+func TestArchiveMany_Audited(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ledger{}, &orm.AuditRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int) { ArchiveBatchSize = size }(ArchiveBatchSize)
+	ArchiveBatchSize = 2
+
+	ledgers := []*ledger{{Owner: "kept"}}
+	for i := 0; i < 5; i++ { // 3 batches
+		ledgers = append(ledgers, &ledger{Owner: "closed"})
+	}
+	if err := orm.DB.Create(ledgers).Error; err != nil {
+		t.Fatal(err)
+	}
+	var updates int
+	if err := orm.DB.Callback().Update().Before("gorm:update").Register("test:count_updates", func(*gorm.DB) { updates++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	affected := new(AffectedIDs)
+	ctx := context.WithValue(context.Background(), KeyAffectedIDs, affected)
+	archived, err := ArchiveMany[ledger](ctx, "closed", &enum.ArchiveOption{ReasonColumn: "reason"}, FilterBy("owner", "closed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 5 || updates != 3 {
+		t.Errorf("archived = %d by %d updates, want 5 by 3", archived, updates)
+	}
+	if ids := affected.IDs(); len(ids) != 5 {
+		t.Errorf("affected ids = %v, want 5 ids", ids)
+	}
+	var records []orm.AuditRecord
+	if err := orm.DB.Where("operation = ?", orm.AuditDelete).Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("audit records = %d, want 5", len(records))
+	}
+	for _, record := range records {
+		if record.Reason != "closed" || record.Model != "ledgers" {
+			t.Errorf("audit record = %+v, want of ledgers by the reason", record)
+		}
+	}
+	var left []string
+	if err := orm.DB.Model(&ledger{}).Pluck("owner", &left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0] != "kept" {
+		t.Errorf("not archived = %v, want [kept]", left)
+	}
+}
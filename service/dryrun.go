@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Statement is a SQL statement with its vars (args).
+type Statement struct {
+	SQL  string `json:"sql"`
+	Vars []any  `json:"vars,omitempty"`
+}
+
+// SQLRecorder is a gorm logger recording the statements, instead of
+// logging them. With DryRunSession, it captures the statements of the
+// writes without executing them:
+//
+//	recorder := new(SQLRecorder)
+//	opt.Session = DryRunSession(opt.Session, recorder)
+//	Update(ctx, &user, opt)
+//	recorder.Statements()  // => [{SQL: "UPDATE `users` SET ... WHERE `id` = ?", Vars: [...]}]
+type SQLRecorder struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+func (r *SQLRecorder) Statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Statement(nil), r.statements...)
+}
+
+func (r *SQLRecorder) LogMode(gormlogger.LogLevel) gormlogger.Interface { return r }
+
+func (r *SQLRecorder) Info(context.Context, string, ...any) {}
+
+func (r *SQLRecorder) Warn(context.Context, string, ...any) {}
+
+func (r *SQLRecorder) Error(context.Context, string, ...any) {}
+
+// Trace records the statement by ParamsFilter, called by fc.
+func (r *SQLRecorder) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	fc()
+}
+
+// ParamsFilter implements gorm.ParamsFilter, which is given the SQL with
+// the placeholders and the vars.
+func (r *SQLRecorder) ParamsFilter(_ context.Context, sql string, params ...any) (string, []any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, Statement{SQL: sql, Vars: params})
+	return sql, params
+}
+
+// DryRunSession returns a copy of the session config (nil for none) in the
+// DryRun mode: the statements are built (and recorded by the recorder) but
+// not executed. Queries of the other sessions (e.g. the reads of the
+// models before updates) are executed as usual.
+func DryRunSession(session *gorm.Session, recorder *SQLRecorder) *gorm.Session {
+	var dryRun gorm.Session
+	if session != nil {
+		dryRun = *session
+	}
+	dryRun.DryRun = true
+	dryRun.Logger = recorder
+	return &dryRun
+}
@@ -2,12 +2,18 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // Get fetch a single model T into dest.
@@ -43,7 +49,7 @@ func Get[T any](ctx context.Context, dest any, options ...enum.QueryOption) erro
 
 	logger.Trace("Get model into dest")
 
-	query := orm.DB.WithContext(ctx).Model(new(T))
+	query := newDB(ctx).Model(new(T))
 	for _, option := range options {
 		query = option(query)
 	}
@@ -113,7 +119,7 @@ func GetMany[T any](ctx context.Context, dest any, options ...enum.QueryOption)
 		WithField("dest", fmt.Sprintf("%T", dest))
 	logger.Trace("GetMany: Get models into dest")
 
-	query := orm.DB.WithContext(ctx).Model(new(T))
+	query := newDB(ctx).Model(new(T))
 	for _, option := range options {
 		query = option(query)
 	}
@@ -125,13 +131,164 @@ func GetMany[T any](ctx context.Context, dest any, options ...enum.QueryOption)
 	return ret.Error
 }
 
+// PluckIDs returns the primary keys of the models T matching the options
+// (filters, orders, pagination...), as a slice of the type of the primary
+// key (e.g. []uint), without loading the rows:
+//
+//	ids, err := PluckIDs[User](ctx, FilterBy("status", "open"), OrderBy("name", false))
+//	// => SELECT `users`.`id` FROM `users` WHERE status = "open" ORDER BY name
+//
+// The options must not select (e.g. Select) nor preload.
+func PluckIDs[T any](ctx context.Context, options ...enum.QueryOption) (ids any, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T)))
+	logger.Trace("PluckIDs: Pluck the primary keys")
+
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return nil, err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, ErrNoIdentityField
+	}
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	dest := reflect.New(reflect.SliceOf(pk.FieldType))
+	dest.Elem().Set(reflect.MakeSlice(dest.Elem().Type(), 0, 0)) // [] instead of null if none
+	if err = query.Pluck(s.Table+"."+pk.DBName, dest.Interface()).Error; err != nil {
+		logger.WithError(err).Warn("PluckIDs: Pluck failed")
+		return nil, err
+	}
+	return dest.Elem().Interface(), nil
+}
+
+// EachBatch iterates the models T (filtered by the options) in batches of
+// batchSize, calling fn with each batch, for server-side processing (e.g.
+// recomputing a derived column of all the rows) with bounded memory. It
+// is built on gorm's FindInBatches:
+//
+//	processed, err := EachBatch[User](ctx, 500, func(tx *gorm.DB, users []*User, batch int) error {
+//	    for _, user := range users {
+//	        if err := tx.Model(user).Update("slug", slugify(user.Name)).Error; err != nil {
+//	            return err
+//	        }
+//	    }
+//	    return nil
+//	}, FilterBy("slug", ""))
+//
+// The models are iterated in the order of the primary key (by keyset
+// pagination, so OrderBy and WithPage options are not applicable), and fn
+// is given a tx to write the batch with. The iteration stops at the first
+// error of fn or of the queries (e.g. ctx is cancelled).
+//
+// It returns the number of models processed, including the ones of the
+// failed batch, if any.
+func EachBatch[T any](ctx context.Context, batchSize int, fn func(tx *gorm.DB, batch []*T, batchNo int) error, options ...enum.QueryOption) (processed int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("batchSize", batchSize)
+	logger.Trace("EachBatch: Iterate models in batches")
+
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidBatchSize, batchSize)
+	}
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	var batch []*T
+	ret := query.FindInBatches(&batch, batchSize, func(tx *gorm.DB, batchNo int) error {
+		processed += int64(len(batch))
+		return fn(tx.Session(&gorm.Session{NewDB: true}), batch, batchNo)
+	})
+	if ret.Error != nil {
+		logger.WithError(ret.Error).WithField("processed", processed).
+			Warn("EachBatch: failed")
+	}
+	return processed, ret.Error
+}
+
+// Export iterates the models T (filtered by the options) in batches of
+// batchSize for exporting them, like EachBatch (without the tx for
+// writes), with the consistency of the snapshot (see enum.Snapshot):
+//
+//	exported, err := Export[User](ctx, 500, enum.SnapshotTransaction, func(users []*User) error {
+//	    return encoder.Encode(users)
+//	})
+//
+// A SnapshotTransaction keeps its transaction open until the last batch
+// is done by fn: fn should not be slow (e.g. writing to a slow client)
+// on a busy database.
+func Export[T any](ctx context.Context, batchSize int, snapshot enum.Snapshot, fn func(batch []*T) error, options ...enum.QueryOption) (exported int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("batchSize", batchSize).
+		WithField("snapshot", snapshot)
+	logger.Trace("Export: Export models in batches")
+
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidBatchSize, batchSize)
+	}
+	export := func(db *gorm.DB) error {
+		query := db.Model(new(T))
+		if snapshot == enum.SnapshotBoundary {
+			column, boundary, err := maxPrimaryKey[T](db)
+			if err != nil {
+				return err
+			}
+			if boundary == nil { // no rows
+				return nil
+			}
+			query = query.Where(clause.Lte{Column: column, Value: boundary})
+		}
+		for _, option := range options {
+			query = option(query)
+		}
+		var batch []*T
+		return query.FindInBatches(&batch, batchSize, func(tx *gorm.DB, batchNo int) error {
+			exported += int64(len(batch))
+			return fn(batch)
+		}).Error
+	}
+
+	if snapshot == enum.SnapshotTransaction {
+		err = newDB(ctx).Transaction(export, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	} else {
+		err = export(newDB(ctx))
+	}
+	if err != nil {
+		logger.WithError(err).WithField("exported", exported).
+			Warn("Export: failed")
+	}
+	return exported, err
+}
+
+// maxPrimaryKey returns the column of the primary key of T and its max
+// value (nil for no rows).
+func maxPrimaryKey[T any](db *gorm.DB) (clause.Column, any, error) {
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return clause.Column{}, nil, err
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return clause.Column{}, nil, gorm.ErrPrimaryKeyRequired
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: s.PrioritizedPrimaryField.DBName}
+	var boundary any
+	err = db.Model(new(T)).Select("MAX(?)", column).Row().Scan(&boundary)
+	return column, boundary, err
+}
+
 // Count returns the number of models.
 func Count[T any](ctx context.Context, options ...enum.QueryOption) (count int64, err error) {
 	logger := logger.WithContext(ctx).
 		WithField("model", fmt.Sprintf("%T", *new(T)))
 	logger.Trace("Count: Count models")
 
-	query := orm.DB.WithContext(ctx).Model(new(T))
+	query := newDB(ctx).Model(new(T))
 	for _, option := range options {
 		query = option(query)
 	}
@@ -143,6 +300,261 @@ func Count[T any](ctx context.Context, options ...enum.QueryOption) (count int64
 	return count, ret.Error
 }
 
+// CountDistinct counts the distinct values of the column (or field) among
+// the models T matching the options, instead of the models, e.g. the
+// number of unique customers of the orders this month:
+//
+//	SELECT COUNT(DISTINCT(customer_id)) FROM orders WHERE ...
+//
+// NULLs are not counted. It fails with orm.ErrUnknownColumn for an unknown
+// column.
+func CountDistinct[T any](ctx context.Context, column string, options ...enum.QueryOption) (count int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("column", column)
+	logger.Trace("CountDistinct: Count distinct values")
+
+	field, err := orm.LookUpField(new(T), column)
+	if err != nil {
+		return 0, err
+	}
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	if err = query.Distinct(field.DBName).Count(&count).Error; err != nil {
+		logger.WithError(err).Warn("CountDistinct: Count failed")
+	}
+	return count, err
+}
+
+// EstimateCountLimit bounds the rows counted by EstimateCount.
+var EstimateCountLimit int64 = 10000
+
+// EstimateCount is a cheap Count of the models T matching the options, for
+// the big tables, where an exact COUNT(*) scans all the matches. It counts
+// up to EstimateCountLimit rows:
+//
+//	SELECT COUNT(*) FROM (SELECT 1 FROM T WHERE ... LIMIT limit + 1) t
+//
+// which is exact (exact is true) if there are not more. Beyond the limit,
+// the count is the estimate of the statistics of the table (the reltuples
+// of pg_class, including the soft-deleted rows) in PostgreSQL without
+// options, or else just a lower bound: limit + 1.
+func EstimateCount[T any](ctx context.Context, options ...enum.QueryOption) (count int64, exact bool, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T)))
+	logger.Trace("EstimateCount: Estimate the count of models")
+
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	bounded := query.Select("1").Limit(int(EstimateCountLimit + 1))
+	if err = newDB(ctx).Table("(?) AS t", bounded).Count(&count).Error; err != nil {
+		logger.WithError(err).Warn("EstimateCount: bounded count failed")
+		return 0, false, err
+	}
+	if count <= EstimateCountLimit {
+		return count, true, nil
+	}
+
+	db := newDB(ctx)
+	if len(options) == 0 && db.Dialector.Name() == "postgres" {
+		s, err := orm.ParseSchema(new(T))
+		if err != nil {
+			return count, false, nil
+		}
+		var reltuples float64
+		err = db.Raw("SELECT reltuples FROM pg_class WHERE oid = to_regclass(?)", s.Table).
+			Scan(&reltuples).Error
+		if err != nil {
+			logger.WithError(err).Warn("EstimateCount: reltuples failed")
+		} else if int64(reltuples) > count { // -1 if never analyzed
+			count = int64(reltuples)
+		}
+	}
+	return count, false, nil
+}
+
+// GroupCount is the count of models with the value of a column.
+type GroupCount struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// CountBy counts the models T matching the options by the values of the
+// column (i.e. facets), from the most counted ones:
+//
+//	SELECT status AS value, COUNT(*) AS count FROM T WHERE ...
+//	    GROUP BY status ORDER BY count DESC, value LIMIT limit
+//
+// No limit if limit <= 0. Values are in the type of the column (pointers,
+// nil for NULL).
+func CountBy[T any](ctx context.Context, column string, limit int, options ...enum.QueryOption) ([]GroupCount, error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("column", column)
+	logger.Trace("CountBy: Count models by column")
+
+	field, err := orm.LookUpField(new(T), column)
+	if err != nil {
+		return nil, err
+	}
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	col := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	query = query.Select("? AS value, COUNT(*) AS count", col).
+		Group(field.DBName).
+		Order("count DESC").Order(clause.OrderByColumn{Column: clause.Column{Name: "value", Raw: true}})
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		logger.WithError(err).Warn("CountBy: query failed")
+		return nil, err
+	}
+	defer rows.Close()
+
+	valueType := field.FieldType
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	counts := []GroupCount{}
+	for rows.Next() {
+		value := reflect.New(reflect.PointerTo(valueType))
+		var count int64
+		if err := rows.Scan(value.Interface(), &count); err != nil {
+			logger.WithError(err).Warn("CountBy: scan failed")
+			return nil, err
+		}
+		counts = append(counts, GroupCount{Value: value.Elem().Interface(), Count: count})
+	}
+	return counts, rows.Err()
+}
+
+// LastModified returns the latest update time (UpdatedAt, or other
+// autoUpdateTime field) of the models T matching the options:
+//
+//	SELECT updated_at FROM T WHERE ... ORDER BY updated_at DESC LIMIT 1
+//
+// which is cheap with an index on the update time. (It is not a MAX(),
+// whose result loses the column type on some drivers, e.g. sqlite.)
+// Unix time fields (autoUpdateTime:milli, ...) are converted to time.Time.
+//
+// The zero time is returned if nothing matches, and ErrNotTouchable if T
+// has no update time field.
+func LastModified[T any](ctx context.Context, options ...enum.QueryOption) (lastModified time.Time, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T)))
+	logger.Trace("LastModified: Get the latest update time")
+
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return lastModified, err
+	}
+	field := updateTimeField(s)
+	if field == nil {
+		logger.Warn("LastModified: no update time field")
+		return lastModified, ErrNotTouchable
+	}
+
+	query := newDB(ctx).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: field.DBName}, Desc: true}).Limit(1)
+
+	if field.DataType == schema.Time {
+		var times []time.Time
+		err = query.Pluck(field.DBName, &times).Error
+		if len(times) > 0 {
+			lastModified = times[0]
+		}
+	} else {
+		var units []int64
+		err = query.Pluck(field.DBName, &units).Error
+		if len(units) > 0 {
+			switch field.AutoUpdateTime {
+			case schema.UnixNanosecond:
+				lastModified = time.Unix(0, units[0])
+			case schema.UnixMillisecond:
+				lastModified = time.UnixMilli(units[0])
+			default:
+				lastModified = time.Unix(units[0], 0)
+			}
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Warn("LastModified: failed")
+	}
+	return lastModified, err
+}
+
+// Explain builds the GetMany query of model T with the options (without
+// executing it) and returns the query plan given by the database:
+//
+//	EXPLAIN SELECT * FROM T WHERE ... ;  // "EXPLAIN QUERY PLAN" for sqlite
+//
+// The sql returned is the explained query with vars inlined, for debugging
+// only: never expose it to clients in production.
+func Explain[T any](ctx context.Context, options ...enum.QueryOption) (plan []map[string]any, sql string, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T)))
+	logger.Trace("Explain: Explain GetMany query")
+
+	query := newDB(ctx).Session(&gorm.Session{DryRun: true}).Model(new(T))
+	for _, option := range options {
+		query = option(query)
+	}
+	var dest []*T
+	stmt := query.Find(&dest).Statement
+	if stmt.Error != nil {
+		logger.WithError(stmt.Error).Warn("Explain: build query failed")
+		return nil, "", stmt.Error
+	}
+	sql = stmt.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+
+	explain := "EXPLAIN "
+	if stmt.Dialector.Name() == "sqlite" {
+		explain = "EXPLAIN QUERY PLAN "
+	}
+	rows, err := newDB(ctx).Statement.ConnPool.QueryContext(ctx, explain+stmt.SQL.String(), stmt.Vars...)
+	if err != nil {
+		logger.WithError(err).Warn("Explain: query plan failed")
+		return nil, sql, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, sql, err
+	}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			logger.WithError(err).Warn("Explain: scan query plan failed")
+			return nil, sql, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		plan = append(plan, row)
+	}
+	return plan, sql, rows.Err()
+}
+
 // GetAssociations find matched associations (model.field) into dest.
 func GetAssociations(ctx context.Context, model any, field string, dest any, options ...enum.QueryOption) error {
 	logger := logger.WithContext(ctx).
@@ -171,9 +583,142 @@ func CountAssociations(ctx context.Context, model any, field string, options ...
 	return count, err
 }
 
+// CountAssociationsIn counts the associations (field) of each model T in the
+// given primary keys, with a single grouped query rather than one query per
+// model:
+//
+//	SELECT orders.user_id, COUNT(*) FROM orders
+//	    WHERE orders.user_id IN (ids...) GROUP BY orders.user_id
+//
+// Many-to-many associations are counted in the join table. Only has-one,
+// has-many and many-to-many associations can be counted.
+//
+// The counts are keyed by fmt.Sprint(id). Ids without any association are
+// absent from the result.
+func CountAssociationsIn[T any](ctx context.Context, field string, ids []any) (counts map[string]int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("field", field)
+	logger.Trace("CountAssociationsIn: Count associations grouped by owner")
+
+	counts = map[string]int64{}
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	rel, err := relationshipOf(new(T), field)
+	if err != nil {
+		logger.WithError(err).Warn("CountAssociationsIn: relationshipOf failed")
+		return nil, err
+	}
+
+	db := newDB(ctx)
+	child := reflect.New(rel.FieldSchema.ModelType).Interface()
+	query := db.Model(child)
+	var owner clause.Column
+
+	switch rel.Type {
+	case schema.HasOne, schema.HasMany:
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				owner = clause.Column{Table: rel.FieldSchema.Table, Name: ref.ForeignKey.DBName}
+			} else if ref.PrimaryValue != "" { // polymorphic type
+				query = query.Where(clause.Eq{
+					Column: clause.Column{Table: rel.FieldSchema.Table, Name: ref.ForeignKey.DBName},
+					Value:  ref.PrimaryValue,
+				})
+			}
+		}
+	case schema.Many2Many:
+		joinTable := rel.JoinTable.Table
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				owner = clause.Column{Table: joinTable, Name: ref.ForeignKey.DBName}
+			} else {
+				query = query.Joins("JOIN ? ON ? = ?", clause.Table{Name: joinTable},
+					clause.Column{Table: joinTable, Name: ref.ForeignKey.DBName},
+					clause.Column{Table: rel.FieldSchema.Table, Name: ref.PrimaryKey.DBName})
+			}
+		}
+	default:
+		err = fmt.Errorf("%w: %s is a %s association", ErrNotCountable, field, rel.Type)
+		logger.WithError(err).Warn("CountAssociationsIn: not countable")
+		return nil, err
+	}
+
+	rows, err := query.
+		Select("?, COUNT(*)", owner).
+		Where(clause.IN{Column: owner, Values: ids}).
+		Group(db.Statement.Quote(owner)).
+		Rows()
+	if err != nil {
+		logger.WithError(err).Warn("CountAssociationsIn: query failed")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id any
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			logger.WithError(err).Warn("CountAssociationsIn: scan failed")
+			return nil, err
+		}
+		if b, ok := id.([]byte); ok {
+			id = string(b)
+		}
+		counts[fmt.Sprint(id)] = count
+	}
+	return counts, rows.Err()
+}
+
+// relationshipOf returns the relationship of model by the field name.
+func relationshipOf(model any, field string) (*schema.Relationship, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	rel, ok := s.Relationships.Relations[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q of %s", ErrUnknownAssociation, field, s.Name)
+	}
+	if err := checkPolymorphic(rel); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// LookUpAssociation returns the relationship of the association field of
+// model (e.g. "Comments"), for the routes to be validated at setup.
+//
+// Polymorphic associations (`gorm:"polymorphic:Owner"`) are validated to
+// have the type and id columns (OwnerType and OwnerID) on the associated
+// model, and the type value of model, by which the associated models of
+// different owners (e.g. the comments of posts and of photos) sharing the
+// same ids are told apart.
+func LookUpAssociation(model any, field string) (*schema.Relationship, error) {
+	return relationshipOf(model, field)
+}
+
+// checkPolymorphic checks the metadata of rel if it is polymorphic.
+func checkPolymorphic(rel *schema.Relationship) error {
+	p := rel.Polymorphic
+	if p == nil {
+		return nil
+	}
+	if p.PolymorphicType == nil || p.PolymorphicID == nil || p.Value == "" {
+		return fmt.Errorf("%w: %s of %s: missing type or id column, or type value", ErrInvalidPolymorphic, rel.Name, rel.Schema.Name)
+	}
+	for _, ref := range rel.References {
+		if ref.ForeignKey == p.PolymorphicType && ref.PrimaryValue == p.Value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s of %s: no condition on %s", ErrInvalidPolymorphic, rel.Name, rel.Schema.Name, p.PolymorphicType.DBName)
+}
+
 // associationQuery builds a gorm association query
 func associationQuery(ctx context.Context, model any, field string, options ...enum.QueryOption) *gorm.Association {
-	query := orm.DB.WithContext(ctx).Model(model)
+	query := newDB(ctx).Model(model)
 	for _, option := range options {
 		query = option(query)
 	}
@@ -197,6 +742,27 @@ func Preload(field string, options ...enum.QueryOption) enum.QueryOption {
 	}
 }
 
+// Joins is a query option that loads the to-one (belongs-to or has-one)
+// association field by a LEFT JOIN, instead of a separate query like
+// Preload:
+//
+//	GetMany[Order](&orders, Joins("Customer"))
+//	// SELECT orders.*, Customer.id AS Customer__id, ... FROM orders
+//	//     LEFT JOIN customers Customer ON orders.customer_id = Customer.id
+func Joins(field string) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Joins(field)
+	}
+}
+
+// Unscoped is a query option that includes the soft-deleted models,
+// e.g. Preload("Orders", Unscoped()) preloads the deleted orders as well.
+func Unscoped() enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped()
+	}
+}
+
 // PreloadAll to Preload all associations.
 // clause.Associations won’t preload nested associations!
 func PreloadAll() enum.QueryOption {
@@ -205,6 +771,53 @@ func PreloadAll() enum.QueryOption {
 	}
 }
 
+// Select is a query option that selects only the columns (a projection).
+func Select(columns ...string) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Select(columns)
+	}
+}
+
+// SelectAssociation is a Select option for the preload (or association
+// query) of the field of model, with the columns of the associated model.
+// The columns are checked against the associated model, and its primary
+// keys and foreign keys to the model are always selected, which are
+// required to assign the associated models back to the model:
+//
+//	Preload("Orders", SelectAssociation(&user, "Orders", []string{"total"}))
+//	// => SELECT id, user_id, total FROM orders WHERE user_id = ?
+func SelectAssociation(model any, field string, columns []string) (enum.QueryOption, error) {
+	rel, err := relationshipOf(model, field)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	var selects []string
+	add := func(column string) {
+		if !selected[column] {
+			selected[column] = true
+			selects = append(selects, column)
+		}
+	}
+	for _, column := range rel.FieldSchema.PrimaryFieldDBNames {
+		add(column)
+	}
+	for _, ref := range rel.References {
+		if ref.ForeignKey.Schema == rel.FieldSchema { // has one/many (or polymorphic type)
+			add(ref.ForeignKey.DBName)
+		}
+	}
+	for _, column := range columns {
+		f := rel.FieldSchema.LookUpField(column)
+		if f == nil || f.DBName == "" {
+			return nil, fmt.Errorf("%w: %q of %s", orm.ErrUnknownColumn, column, rel.FieldSchema.Name)
+		}
+		add(f.DBName)
+	}
+	return Select(selects...), nil
+}
+
 // WithPage is a query option that sets pagination for GetMany.
 func WithPage(limit int, offset int) enum.QueryOption {
 	return func(tx *gorm.DB) *gorm.DB {
@@ -221,6 +834,11 @@ func Omit(omit []string) enum.QueryOption {
 // OrderBy is a query option that sets ordering for GetMany.
 // It can be applied multiple times (for multiple orders).
 func OrderBy(field string, descending bool) enum.QueryOption {
+	if isIdentifier(field) {
+		return func(tx *gorm.DB) *gorm.DB {
+			return tx.Order(clause.OrderByColumn{Column: columnOf(field), Desc: descending})
+		}
+	}
 	order := field
 	if descending {
 		order += " desc"
@@ -230,6 +848,85 @@ func OrderBy(field string, descending bool) enum.QueryOption {
 	}
 }
 
+// OrderByNulls is OrderBy with the NULLs placed first or last, which
+// otherwise differs across databases. It is NULLS FIRST / LAST on postgres,
+// and emulated by ordering on `column IS NULL` first on the others:
+//
+//	OrderByNulls("due_at", false, false)
+//	// postgres: ORDER BY due_at NULLS LAST
+//	// others:   ORDER BY due_at IS NULL, due_at
+func OrderByNulls(field string, descending bool, nullsFirst bool) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		for _, part := range strings.Split(field, ".") { // quoted as raw SQL below
+			if !isIdentifier(part) {
+				_ = tx.AddError(fmt.Errorf("%w: %q", orm.ErrUnknownColumn, field))
+				return tx
+			}
+		}
+		stmt := tx.Statement
+		if stmt.Table == "" && stmt.Model != nil {
+			if err := stmt.Parse(stmt.Model); err != nil {
+				_ = tx.AddError(err)
+				return tx
+			}
+		}
+		column := stmt.Quote(columnOf(field))
+		if descending {
+			column += " DESC"
+		}
+		if stmt.Dialector.Name() == "postgres" {
+			nulls := " NULLS LAST"
+			if nullsFirst {
+				nulls = " NULLS FIRST"
+			}
+			return tx.Order(clause.OrderByColumn{Column: clause.Column{Name: column + nulls, Raw: true}})
+		}
+		return tx.Order(clause.OrderByColumn{
+			Column: clause.Column{Name: stmt.Quote(columnOf(field)) + " IS NULL", Raw: true},
+			Desc:   nullsFirst,
+		}).Order(clause.OrderByColumn{Column: clause.Column{Name: column, Raw: true}})
+	}
+}
+
+// columnOf returns the column of the field, qualified by the table of the
+// query (e.g. `users`.`id`) if it is a bare identifier, so that it is not
+// ambiguous with the columns of the joined tables (see Joins).
+func columnOf(field string) clause.Column {
+	if isIdentifier(field) {
+		return clause.Column{Table: clause.CurrentTable, Name: field}
+	}
+	return clause.Column{Name: field}
+}
+
+// isIdentifier reports whether s is a bare identifier: letters, digits
+// and underscores only.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrderByExpr is a query option that orders by a computed expression,
+// with the args bound to its placeholders, for example:
+//
+//	OrderByExpr("(lat-?)*(lat-?)+(lng-?)*(lng-?)", lat, lat, lng, lng)
+//
+// The expr is raw SQL: never build it from the user input.
+// It replaces the orders by columns (OrderBy) of the query.
+func OrderByExpr(expr string, args ...any) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(clause.OrderBy{
+			Expression: clause.Expr{SQL: expr, Vars: args, WithoutParentheses: true},
+		})
+	}
+}
+
 // FilterBy is a query option that sets WHERE field=value condition for GetMany.
 // It can be applied multiple times (for multiple conditions).
 //
@@ -242,10 +939,306 @@ func OrderBy(field string, descending bool) enum.QueryOption {
 //	SELECT * FROM users WHERE name = "John" AND age = 10 ;  // into users
 func FilterBy(field string, value any) enum.QueryOption {
 	return func(tx *gorm.DB) *gorm.DB {
-		return tx.Where(map[string]any{field: value})
+		return tx.Where(clause.Eq{Column: columnOf(field), Value: value})
 	}
 }
 
+// FilterContains, FilterStartsWith and FilterEndsWith are query options
+// that set WHERE field LIKE pattern conditions, with the pattern built of
+// the literal value: its LIKE wildcards (% and _) are escaped.
+//
+//	GetMany[User](&users, FilterContains("name", "50%"))
+//	// => WHERE name LIKE '%50!%%' ESCAPE '!'
+//
+// Notice that LIKE is case-insensitive on some databases (e.g. SQLite,
+// MySQL with the default collations), but not on others (PostgreSQL).
+func FilterContains(field string, value string) enum.QueryOption {
+	return filterLike(field, "%"+EscapeLike(value)+"%")
+}
+
+func FilterStartsWith(field string, value string) enum.QueryOption {
+	return filterLike(field, EscapeLike(value)+"%")
+}
+
+func FilterEndsWith(field string, value string) enum.QueryOption {
+	return filterLike(field, "%"+EscapeLike(value))
+}
+
+// likeEscape is the ESCAPE character of the LIKE patterns: not a backslash,
+// which is an escape of the string literals on MySQL as well.
+const likeEscape = "!"
+
+// EscapeLike escapes the LIKE wildcards (% and _) in s, to match them
+// literally in a pattern with ESCAPE '!'.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(
+		likeEscape, likeEscape+likeEscape,
+		"%", likeEscape+"%",
+		"_", likeEscape+"_",
+	).Replace(s)
+}
+
+func filterLike(field string, pattern string) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(likeExpr(field, pattern))
+	}
+}
+
+func likeExpr(field string, pattern string) clause.Expression {
+	return clause.Expr{
+		SQL:  "? LIKE ? ESCAPE '" + likeEscape + "'",
+		Vars: []any{columnOf(field), pattern},
+	}
+}
+
+// Search is a query option that filters the models matching the query q
+// on any of the fields, by their enum.SearchMatch:
+//
+//	Search("ab", []enum.SearchField{{Column: "code", Match: enum.SearchExact}, {Column: "name"}})
+//	// => WHERE (code = 'ab' OR name LIKE '%ab%' ESCAPE '!')
+//
+// It filters nothing for an empty q or no fields. See OrderBySearch for
+// the relevance of the matches.
+func Search(q string, fields []enum.SearchField) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		if q == "" || len(fields) == 0 {
+			return tx
+		}
+		matches := make([]clause.Expression, 0, len(fields))
+		for _, field := range fields {
+			matches = append(matches, searchMatch(field, q))
+		}
+		return tx.Where(clause.Or(matches...))
+	}
+}
+
+// OrderBySearch is a query option that orders the models by the relevance
+// of their matches of q (see Search): the sum of the weights of the fields
+// matched, descending:
+//
+//	ORDER BY (CASE WHEN code = 'ab' THEN 10 ELSE 0 END + CASE WHEN ... END) DESC
+//
+// Fields without weights are not counted, it orders nothing if none has.
+// The models of the same relevance are ordered by their primary key, for
+// a stable order across the pages. It replaces the orders by columns of
+// the query, like OrderByExpr.
+func OrderBySearch(q string, fields []enum.SearchField) enum.QueryOption {
+	var terms []string
+	var matches []any
+	for _, field := range fields {
+		if field.Weight > 0 {
+			terms = append(terms, fmt.Sprintf("CASE WHEN ? THEN %d ELSE 0 END", field.Weight))
+			matches = append(matches, searchMatch(field, q))
+		}
+	}
+	if q == "" || len(terms) == 0 {
+		return func(tx *gorm.DB) *gorm.DB { return tx }
+	}
+	relevance := "(" + strings.Join(terms, " + ") + ") DESC"
+	return func(tx *gorm.DB) *gorm.DB {
+		expr, vars := relevance, matches
+		if s, err := orm.ParseSchema(tx.Statement.Model); err == nil && s.PrioritizedPrimaryField != nil {
+			expr += ", ?"
+			vars = append(vars[:len(vars):len(vars)], clause.Column{Table: clause.CurrentTable, Name: s.PrioritizedPrimaryField.DBName})
+		}
+		return OrderByExpr(expr, vars...)(tx)
+	}
+}
+
+// searchMatch is the condition of q matching the field.
+func searchMatch(field enum.SearchField, q string) clause.Expression {
+	switch field.Match {
+	case enum.SearchPrefix:
+		return likeExpr(field.Column, EscapeLike(q)+"%")
+	case enum.SearchExact:
+		return clause.Eq{Column: columnOf(field.Column), Value: q}
+	}
+	return likeExpr(field.Column, "%"+EscapeLike(q)+"%")
+}
+
+// FilterCompare is a query option that sets WHERE field op value condition,
+// where op is one of "=", "<>", ">", ">=", "<", "<=".
+//
+//	GetMany[User](&users, FilterCompare("age", ">=", 18))
+func FilterCompare(field string, op string, value any) enum.QueryOption {
+	column := columnOf(field)
+	var expr clause.Expression
+	switch op {
+	case "=":
+		expr = clause.Eq{Column: column, Value: value}
+	case "<>":
+		expr = clause.Neq{Column: column, Value: value}
+	case ">":
+		expr = clause.Gt{Column: column, Value: value}
+	case ">=":
+		expr = clause.Gte{Column: column, Value: value}
+	case "<":
+		expr = clause.Lt{Column: column, Value: value}
+	case "<=":
+		expr = clause.Lte{Column: column, Value: value}
+	}
+	return func(tx *gorm.DB) *gorm.DB {
+		if expr == nil {
+			_ = tx.AddError(fmt.Errorf("%w: %q", ErrUnknownOperator, op))
+			return tx
+		}
+		return tx.Where(expr)
+	}
+}
+
+// FilterIn is a query option that sets WHERE field IN (values...) condition.
+func FilterIn[V any](field string, values []V) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(clause.IN{Column: columnOf(field), Values: toAnys(values)})
+	}
+}
+
+// FilterHas is a query option that filters models whose native array
+// column (e.g. a PostgreSQL text[]) has any of the values:
+//
+//	GetMany[Product](&products, FilterHas("tags", []string{"gold"}))
+//	// => WHERE 'gold' = ANY("products"."tags")
+//
+// Which is different from FilterAll on a to-many association: the values
+// are elements of the column itself.
+//
+// The column must be an array: of a slice (not []byte) field, or of a
+// type:xxx[] tag, else it is an ErrNotArray. Only PostgreSQL is supported,
+// the query fails with an ErrUnsupportedDialect on the other databases.
+func FilterHas[V any](field string, values []V) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		stmt := tx.Statement
+		if name := stmt.Dialector.Name(); name != "postgres" {
+			_ = tx.AddError(fmt.Errorf("%w: array filter on %s", ErrUnsupportedDialect, name))
+			return tx
+		}
+		if stmt.Schema == nil && stmt.Model != nil {
+			if err := stmt.Parse(stmt.Model); err != nil {
+				_ = tx.AddError(err)
+				return tx
+			}
+		}
+		if stmt.Schema == nil {
+			_ = tx.AddError(fmt.Errorf("%w: %q", orm.ErrUnknownColumn, field))
+			return tx
+		}
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			_ = tx.AddError(fmt.Errorf("%w: %q of %s", orm.ErrUnknownColumn, field, stmt.Schema.Name))
+			return tx
+		}
+		if !IsArrayField(f) {
+			_ = tx.AddError(fmt.Errorf("%w: %q of %s", ErrNotArray, field, stmt.Schema.Name))
+			return tx
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: f.DBName}
+		exprs := make([]clause.Expression, 0, len(values))
+		for _, value := range values {
+			exprs = append(exprs, clause.Expr{SQL: "? = ANY(?)", Vars: []any{value, column}})
+		}
+		return tx.Where(clause.Or(exprs...))
+	}
+}
+
+// IsArrayField reports whether the field is of a native array column: a
+// slice or array field (other than []byte) without a serializer, or of a
+// type:xxx[] tag.
+func IsArrayField(field *schema.Field) bool {
+	if strings.HasSuffix(string(field.DataType), "[]") {
+		return true
+	}
+	if field.Serializer != nil { // e.g. serializer:json, stored as text
+		return false
+	}
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+func toAnys[V any](values []V) []any {
+	anys := make([]any, len(values))
+	for i, v := range values {
+		anys[i] = v
+	}
+	return anys
+}
+
+// FilterAll is a query option that filters models associated (by the
+// to-many association field) with ALL the values, by grouping the
+// associations and counting the matches:
+//
+//	FilterAll("Tags", "name", []string{"a", "b"})
+//
+// means:
+//
+//	SELECT * FROM users WHERE users.id IN (
+//	    SELECT user_tags.user_id FROM tags
+//	        JOIN user_tags ON user_tags.tag_id = tags.id
+//	        WHERE tags.name IN ("a", "b")
+//	        GROUP BY user_tags.user_id
+//	        HAVING COUNT(DISTINCT tags.name) = 2
+//	)
+//
+// The column is of the associated model, the primary key if empty.
+func FilterAll[V any](field string, column string, values []V) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		rel, err := relationshipOf(tx.Statement.Model, field)
+		if err != nil {
+			_ = tx.AddError(err)
+			return tx
+		}
+		associated := rel.FieldSchema
+		target := associated.PrioritizedPrimaryField
+		if column != "" {
+			target = associated.LookUpField(column)
+		}
+		if target == nil {
+			_ = tx.AddError(fmt.Errorf("%w: %q of %s", orm.ErrUnknownColumn, column, associated.Name))
+			return tx
+		}
+		targetColumn := clause.Column{Table: associated.Table, Name: target.DBName}
+
+		sub := tx.Session(&gorm.Session{NewDB: true}).
+			Model(reflect.New(associated.ModelType).Interface())
+		var owner, ownerKey clause.Column
+		for _, ref := range rel.References {
+			switch {
+			case ref.OwnPrimaryKey && rel.Type == schema.Many2Many:
+				owner = clause.Column{Table: rel.JoinTable.Table, Name: ref.ForeignKey.DBName}
+				ownerKey = clause.Column{Table: rel.Schema.Table, Name: ref.PrimaryKey.DBName}
+			case ref.OwnPrimaryKey:
+				owner = clause.Column{Table: associated.Table, Name: ref.ForeignKey.DBName}
+				ownerKey = clause.Column{Table: rel.Schema.Table, Name: ref.PrimaryKey.DBName}
+			case rel.Type == schema.Many2Many:
+				sub = sub.Joins("JOIN ? ON ? = ?", clause.Table{Name: rel.JoinTable.Table},
+					clause.Column{Table: rel.JoinTable.Table, Name: ref.ForeignKey.DBName},
+					clause.Column{Table: associated.Table, Name: ref.PrimaryKey.DBName})
+			case ref.PrimaryValue != "": // polymorphic type
+				sub = sub.Where(clause.Eq{
+					Column: clause.Column{Table: associated.Table, Name: ref.ForeignKey.DBName},
+					Value:  ref.PrimaryValue,
+				})
+			}
+		}
+
+		sub = sub.Select("?", owner).
+			Where(clause.IN{Column: targetColumn, Values: toAnySlice(values)}).
+			Group(tx.Statement.Quote(owner)).
+			Having("COUNT(DISTINCT ?) = ?", targetColumn, len(values))
+		return tx.Where("? IN (?)", ownerKey, sub)
+	}
+}
+
+func toAnySlice[V any](values []V) []any {
+	result := make([]any, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
 func FilterAt(ats []string) enum.QueryOption {
 
 	return func(tx *gorm.DB) *gorm.DB {
@@ -275,4 +1268,108 @@ func Where(query any, args ...any) enum.QueryOption {
 var (
 	ErrNoIdentityField = errors.New("no identity field found")
 	ErrNilID           = errors.New("id is nil")
+
+	ErrUnknownAssociation = errors.New("unknown association")
+	ErrUnknownOperator    = errors.New("unknown operator")
+	ErrNotCountable       = errors.New("association is not countable")
+	ErrInvalidPolymorphic = errors.New("invalid polymorphic association")
+	ErrNotArray           = errors.New("not an array column")
+	ErrUnsupportedDialect = errors.New("not supported by the database")
+
+	ErrInvalidBatchSize = errors.New("invalid batch size")
 )
+
+// ErrNoJoinModel is the error of a many-to-many association whose join
+// table is not set up with a join model by gorm.DB.SetupJoinTable.
+var ErrNoJoinModel = errors.New("join model not set up")
+
+// LookUpJoinModel returns the relationship of the many-to-many association
+// field of model, whose join table is set up with a join model (carrying
+// extra columns, e.g. the role of the user_teams of users and teams):
+//
+//	orm.DB.SetupJoinTable(&User{}, "Teams", &UserTeam{})
+//
+// It fails with ErrNotToMany for the other associations, and with
+// ErrNoJoinModel for the join tables generated by gorm.
+func LookUpJoinModel(model any, field string) (*schema.Relationship, error) {
+	rel, err := relationshipOf(model, field)
+	if err != nil {
+		return nil, err
+	}
+	if rel.Type != schema.Many2Many {
+		return nil, fmt.Errorf("%w: %q of %T is not many-to-many", ErrNotToMany, field, model)
+	}
+	if rel.JoinTable == nil || rel.JoinTable.ModelType.Name() == "" { // generated by gorm
+		return nil, fmt.Errorf("%w: %q of %T, see gorm.DB.SetupJoinTable", ErrNoJoinModel, field, model)
+	}
+	return rel, nil
+}
+
+// JoinRows returns the rows (join models, see LookUpJoinModel) of the join
+// table of the many-to-many association field, between the model and the
+// associated models (a slice of them, e.g. the loaded model.Teams): the
+// row of each associated model, in order (nil for none).
+//
+//	SELECT * FROM user_teams WHERE user_id = 1 AND team_id IN (teams...)
+func JoinRows(ctx context.Context, model any, field string, associated any) (rows []any, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", model)).
+		WithField("field", field)
+	logger.Trace("JoinRows: Get join table rows")
+
+	rel, err := LookUpJoinModel(model, field)
+	if err != nil {
+		return nil, err
+	}
+	owner := reflect.Indirect(reflect.ValueOf(model))
+	associations := reflect.Indirect(reflect.ValueOf(associated))
+	if associations.Kind() != reflect.Slice || associations.Len() == 0 {
+		return nil, nil
+	}
+
+	query := newDB(ctx).Table(rel.JoinTable.Table)
+	var joinFields []*schema.Field // the join fields of the associated keys
+	var associatedKeys []*schema.Field
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			value, _ := ref.PrimaryKey.ValueOf(ctx, owner)
+			query = query.Where(clause.Eq{Column: clause.Column{Name: ref.ForeignKey.DBName}, Value: value})
+			continue
+		}
+		joinFields = append(joinFields, ref.ForeignKey)
+		associatedKeys = append(associatedKeys, ref.PrimaryKey)
+	}
+	names := make([]string, len(joinFields))
+	for i, f := range joinFields {
+		names[i] = f.DBName
+	}
+	keys := make([][]any, associations.Len())
+	for i := range keys {
+		keys[i] = make([]any, len(associatedKeys))
+		for j, f := range associatedKeys {
+			keys[i][j], _ = f.ValueOf(ctx, reflect.Indirect(associations.Index(i)))
+		}
+	}
+	column, values := schema.ToQueryValues(rel.JoinTable.Table, names, keys)
+	query = query.Where(clause.IN{Column: column, Values: values})
+
+	dest := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.JoinTable.ModelType)))
+	if err := query.Find(dest.Interface()).Error; err != nil {
+		logger.WithError(err).Warn("JoinRows: query failed")
+		return nil, err
+	}
+	byKey := make(map[string]any, dest.Elem().Len())
+	for i := 0; i < dest.Elem().Len(); i++ {
+		row := dest.Elem().Index(i)
+		key := make([]any, len(joinFields))
+		for j, f := range joinFields {
+			key[j], _ = f.ValueOf(ctx, row.Elem())
+		}
+		byKey[fmt.Sprint(key...)] = row.Interface()
+	}
+	rows = make([]any, len(keys))
+	for i, key := range keys {
+		rows[i] = byKey[fmt.Sprint(key...)]
+	}
+	return rows, nil
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+)
+
+func TestOrderBySearch(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"a printer", "printer", "the printer", "printer jam", "printer"} {
+		if err := orm.DB.Create(&ticket{Title: title}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := []enum.SearchField{
+		{Column: "title", Match: enum.SearchExact, Weight: 10},
+		{Column: "title", Match: enum.SearchContains, Weight: 1},
+	}
+
+	sql := orm.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return OrderBySearch("printer", fields)(tx.Model(&ticket{})).Find(&[]ticket{})
+	})
+	if !strings.HasSuffix(sql, "END) DESC, `tickets`.`id`") {
+		t.Errorf("SQL = %s, want ordered by the id last", sql)
+	}
+
+	var tickets []ticket
+	err := GetMany[ticket](context.Background(), &tickets, OrderBySearch("printer", fields), WithPage(3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for _, ticket := range tickets {
+		ids = append(ids, ticket.ID)
+	}
+	if len(ids) != 3 || ids[0] != 5 || ids[1] != 1 || ids[2] != 3 {
+		t.Errorf("ids of the page = %v, want [5 1 3]: by relevance, then id", ids)
+	}
+}
+
+func TestPluckIDs(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"b", "c", "a"} {
+		if err := orm.DB.Create(&ticket{Title: title}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := PluckIDs[ticket](context.Background(), OrderBy("title", false), WithPage(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ids.([]uint); !ok || len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("ids = %#v, want []uint{3, 1}", ids)
+	}
+
+	ids, err = PluckIDs[ticket](context.Background(), FilterBy("title", "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ids.([]uint); !ok || got == nil || len(got) != 0 {
+		t.Errorf("ids = %#v, want an empty []uint", ids)
+	}
+}
+
+func TestFilterLike(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"50%", "50", "5050", "a_b", "axb", "1!2", "1!!2", "12"} {
+		if err := orm.DB.Create(&ticket{Title: title}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		option enum.QueryOption
+		want   string
+	}{
+		{"contains %", FilterContains("title", "0%"), "[50%]"},
+		{"contains _", FilterContains("title", "_"), "[a_b]"},
+		{"contains !", FilterContains("title", "!"), "[1!2 1!!2]"},
+		{"contains !!", FilterContains("title", "!!"), "[1!!2]"},
+		{"starts with _", FilterStartsWith("title", "a_"), "[a_b]"},
+		{"starts with 50", FilterStartsWith("title", "50"), "[50% 50 5050]"},
+		{"ends with %", FilterEndsWith("title", "%"), "[50%]"},
+		{"ends with !2", FilterEndsWith("title", "!2"), "[1!2 1!!2]"},
+		{"ends with _b", FilterEndsWith("title", "_b"), "[a_b]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tickets []*ticket
+			if err := GetMany[ticket](context.Background(), &tickets, tt.option, OrderBy("id", false)); err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, tk := range tickets {
+				titles = append(titles, tk.Title)
+			}
+			if got := fmt.Sprint(titles); got != tt.want {
+				t.Errorf("titles = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderByNulls_SQL(t *testing.T) {
+	tests := []struct {
+		dialect    string
+		descending bool
+		nullsFirst bool
+		want       string
+	}{
+		{"postgres", false, false, `ORDER BY "tickets"."title" NULLS LAST`},
+		{"postgres", true, true, `ORDER BY "tickets"."title" DESC NULLS FIRST`},
+		{"mysql", false, false, "ORDER BY `tickets`.`title` IS NULL,`tickets`.`title`"},
+		{"mysql", true, true, "ORDER BY `tickets`.`title` IS NULL DESC,`tickets`.`title` DESC"},
+		{"sqlite", false, true, "ORDER BY `tickets`.`title` IS NULL DESC,`tickets`.`title`"},
+	}
+	for _, tt := range tests {
+		db := dryRunDB(t, tt.dialect)
+		var tickets []*ticket
+		stmt := OrderByNulls("title", tt.descending, tt.nullsFirst)(db.Model(&ticket{})).Find(&tickets).Statement
+		if stmt.Error != nil {
+			t.Fatal(stmt.Error)
+		}
+		if sql := stmt.SQL.String(); !strings.HasSuffix(sql, tt.want) {
+			t.Errorf("%s: SQL = %s, want ... %s", tt.dialect, sql, tt.want)
+		}
+	}
+
+	var tickets []*ticket
+	err := OrderByNulls("title; --", false, false)(dryRunDB(t, "sqlite").Model(&ticket{})).Find(&tickets).Error
+	if !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("not a column: err = %v, want ErrUnknownColumn", err)
+	}
+}
+
+func TestOrderByNulls(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&todo{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, due := range []*int{intPtr(2), nil, intPtr(1), nil, intPtr(3)} {
+		if err := orm.DB.Create(&todo{Due: due}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		descending bool
+		nullsFirst bool
+		want       string
+	}{
+		{"nulls last", false, false, "[1 2 3 nil nil]"},
+		{"nulls first", false, true, "[nil nil 1 2 3]"},
+		{"descending nulls last", true, false, "[3 2 1 nil nil]"},
+		{"descending nulls first", true, true, "[nil nil 3 2 1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var todos []*todo
+			if err := GetMany[todo](context.Background(), &todos, OrderByNulls("due", tt.descending, tt.nullsFirst)); err != nil {
+				t.Fatal(err)
+			}
+			var dues []string
+			for _, td := range todos {
+				if td.Due == nil {
+					dues = append(dues, "nil")
+				} else {
+					dues = append(dues, fmt.Sprint(*td.Due))
+				}
+			}
+			if got := fmt.Sprint(dues); got != tt.want {
+				t.Errorf("dues = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type todo struct {
+	ID  uint `gorm:"primaryKey"`
+	Due *int
+}
+
+func intPtr(i int) *int { return &i }
+
+func TestOrderByExpr_SQL(t *testing.T) {
+	var tickets []*ticket
+	stmt := OrderByExpr("abs(length(title) - ?)", 3)(dryRunDB(t, "sqlite").Model(&ticket{})).Find(&tickets).Statement
+	if stmt.Error != nil {
+		t.Fatal(stmt.Error)
+	}
+	if sql := stmt.SQL.String(); !strings.HasSuffix(sql, "ORDER BY abs(length(title) - ?)") {
+		t.Errorf("SQL = %s, want ... ORDER BY abs(length(title) - ?)", sql)
+	}
+	if fmt.Sprint(stmt.Vars) != "[3]" {
+		t.Errorf("vars = %v, want [3]", stmt.Vars)
+	}
+}
+
+type product struct {
+	ID    uint     `gorm:"primaryKey"`
+	Tags  []string `gorm:"type:text[]"`
+	Codes []int    `gorm:"serializer:json"`
+	Name  string
+}
+
+func TestFilterHas_SQL(t *testing.T) {
+	var products []*product
+	stmt := FilterHas("tags", []string{"gold", "new"})(dryRunDB(t, "postgres").Model(&product{})).Find(&products).Statement
+	if stmt.Error != nil {
+		t.Fatal(stmt.Error)
+	}
+	want := `WHERE ($1 = ANY("products"."tags") OR $2 = ANY("products"."tags"))`
+	if sql := stmt.SQL.String(); !strings.HasSuffix(sql, want) {
+		t.Errorf("SQL = %s, want ... %s", sql, want)
+	}
+	if fmt.Sprint(stmt.Vars) != "[gold new]" {
+		t.Errorf("vars = %v, want [gold new]", stmt.Vars)
+	}
+
+	tests := []struct {
+		dialect string
+		field   string
+		wantErr error
+	}{
+		{"sqlite", "tags", ErrUnsupportedDialect},
+		{"mysql", "tags", ErrUnsupportedDialect},
+		{"postgres", "name", ErrNotArray},
+		{"postgres", "codes", ErrNotArray},
+		{"postgres", "missing", orm.ErrUnknownColumn},
+	}
+	for _, tt := range tests {
+		var products []*product
+		err := FilterHas(tt.field, []string{"gold"})(dryRunDB(t, tt.dialect).Model(&product{})).Find(&products).Error
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s %s: err = %v, want %v", tt.dialect, tt.field, err, tt.wantErr)
+		}
+	}
+}
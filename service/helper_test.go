@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// dryRunDB opens a DryRun gorm.DB of the dialect (postgres, mysql or
+// sqlite), which builds the SQL of the queries without connecting to a
+// database.
+func dryRunDB(t *testing.T, dialect string) *gorm.DB {
+	t.Helper()
+	var dialector gorm.Dialector
+	switch dialect {
+	case "postgres":
+		dialector = postgres.New(postgres.Config{DSN: "host=localhost"})
+	case "mysql":
+		dialector = mysql.New(mysql.Config{DSN: "root@/test", SkipInitializeWithVersion: true})
+	default:
+		dialector = sqlite.Open("file::memory:")
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tqrj/cd/reqctx"
+)
+
+// KeyLoaders is the reqctx key of the Loaders of a request.
+const KeyLoaders = "crud/loaders"
+
+// Loader coalesces the loads by id of a request (e.g. of the Mapper of a
+// list, one model at a time) into batches: a Load of an id not loaded yet
+// loads it along with all the pending ids (primed by Prime) in one call of
+// the batch load, and caches the values of all of them for the next Loads:
+//
+//	loader := NewLoader(func(ctx context.Context, ids []any) (map[string]int64, error) {
+//	    return CountAssociationsIn[User](ctx, "Orders", ids)
+//	})
+//	loader.Prime(1, 2, 3)
+//	loader.Load(ctx, 1)  // => SELECT orders.user_id, COUNT(*) ... WHERE orders.user_id IN (1, 2, 3) ...
+//	loader.Load(ctx, 2)  // => cached
+//
+// The values are keyed by fmt.Sprint(id). The ids absent from the result
+// of the batch load get the zero value.
+type Loader[V any] struct {
+	load func(ctx context.Context, ids []any) (map[string]V, error)
+
+	mu      sync.Mutex
+	pending []any
+	loaded  map[string]V
+}
+
+// NewLoader returns a Loader of the values V batch loaded by load, which
+// returns the values of the ids given keyed by fmt.Sprint(id).
+func NewLoader[V any](load func(ctx context.Context, ids []any) (map[string]V, error)) *Loader[V] {
+	return &Loader[V]{load: load, loaded: map[string]V{}}
+}
+
+// Prime queues the ids into the next batch.
+func (l *Loader[V]) Prime(ids ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, ids...)
+}
+
+// Load returns the value of the id, loaded with the pending ids if not
+// loaded yet.
+func (l *Loader[V]) Load(ctx context.Context, id any) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := fmt.Sprint(id)
+	if value, ok := l.loaded[key]; ok {
+		return value, nil
+	}
+
+	batch := []any{id}
+	seen := map[string]bool{key: true}
+	for _, pending := range l.pending {
+		k := fmt.Sprint(pending)
+		if _, loaded := l.loaded[k]; loaded || seen[k] {
+			continue
+		}
+		seen[k] = true
+		batch = append(batch, pending)
+	}
+	values, err := l.load(ctx, batch)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	l.pending = nil
+	for k := range seen {
+		l.loaded[k] = values[k]
+	}
+	return l.loaded[key], nil
+}
+
+// Loaders are the Loaders of a request by name, primed with the ids of
+// the models of the request (e.g. the page of a list, see
+// ListOption.BatchLoads):
+//
+//	reqctx.Set(c, service.KeyLoaders, service.NewLoaders(ids))
+type Loaders struct {
+	mu      sync.Mutex
+	ids     []any
+	loaders map[string]any
+}
+
+// NewLoaders returns the Loaders of a request, whose Loaders are primed
+// with the ids at their creation by RequestLoader.
+func NewLoaders(ids []any) *Loaders {
+	return &Loaders{ids: ids, loaders: map[string]any{}}
+}
+
+// RequestLoader returns the Loader of the name of the Loaders of the
+// request ctx, created by the load (and primed with the ids of the
+// request) at the first call. Without Loaders in ctx, it returns a new
+// Loader each call, which batches nothing.
+//
+// The name is of a single V: if a Loader of another V is registered under
+// the name, the Loads of the Loader returned fail with ErrLoaderType.
+func RequestLoader[V any](ctx context.Context, name string, load func(ctx context.Context, ids []any) (map[string]V, error)) *Loader[V] {
+	loaders, ok := reqctx.Get[*Loaders](ctx, KeyLoaders)
+	if !ok {
+		return NewLoader(load)
+	}
+	loaders.mu.Lock()
+	defer loaders.mu.Unlock()
+	if registered, ok := loaders.loaders[name]; ok {
+		if loader, ok := registered.(*Loader[V]); ok {
+			return loader
+		}
+		err := fmt.Errorf("%w: %q is a %T, not a %T", ErrLoaderType, name, registered, (*Loader[V])(nil))
+		return NewLoader(func(ctx context.Context, ids []any) (map[string]V, error) {
+			return nil, err
+		})
+	}
+	loader := NewLoader(load)
+	loader.Prime(loaders.ids...)
+	loaders.loaders[name] = loader
+	return loader
+}
+
+// ErrLoaderType is the error of the Loads of a RequestLoader whose name is
+// registered with a Loader of another type of values.
+var ErrLoaderType = errors.New("loader registered with another type")
+
+// CountLoader is the RequestLoader of the counts of the associations
+// (field) of the models T by their ids, see CountAssociationsIn:
+//
+//	Mapper: func(c *gin.Context, u *User) any {
+//	    orders, _ := service.CountLoader[User](c, "Orders").Load(c, u.ID)
+//	    return UserDTO{ID: u.ID, Name: u.Name, Orders: orders}
+//	}
+func CountLoader[T any](ctx context.Context, field string) *Loader[int64] {
+	name := fmt.Sprintf("count:%T.%s", *new(T), field)
+	return RequestLoader(ctx, name, func(ctx context.Context, ids []any) (map[string]int64, error) {
+		return CountAssociationsIn[T](ctx, field, ids)
+	})
+}
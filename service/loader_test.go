@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/reqctx"
+)
+
+func TestLoader(t *testing.T) {
+	var batches [][]any
+	loader := NewLoader(func(ctx context.Context, ids []any) (map[string]string, error) {
+		batches = append(batches, ids)
+		values := map[string]string{}
+		for _, id := range ids {
+			if id != 3 {
+				values[fmt.Sprint(id)] = fmt.Sprint("v", id)
+			}
+		}
+		return values, nil
+	})
+	loader.Prime(1, 2, 2, 3)
+
+	for _, tt := range []struct {
+		id   any
+		want string
+	}{
+		{2, "v2"},
+		{1, "v1"},
+		{3, ""}, // absent from the batch: the zero value
+		{4, "v4"},
+		{1, "v1"},
+	} {
+		got, err := loader.Load(context.Background(), tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Load(%v) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+	if want := [][]any{{2, 1, 3}, {4}}; fmt.Sprint(batches) != fmt.Sprint(want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+}
+
+func TestLoader_Error(t *testing.T) {
+	errLoad := errors.New("load failed")
+	fail := true
+	loader := NewLoader(func(ctx context.Context, ids []any) (map[string]int, error) {
+		if fail {
+			return nil, errLoad
+		}
+		return map[string]int{"1": len(ids)}, nil
+	})
+	loader.Prime(1, 2)
+	if _, err := loader.Load(context.Background(), 1); !errors.Is(err, errLoad) {
+		t.Errorf("err = %v, want errLoad", err)
+	}
+	fail = false
+	// the pending ids are kept for the retry
+	if got, err := loader.Load(context.Background(), 1); err != nil || got != 2 {
+		t.Errorf("Load(1) = %d, %v, want 2, nil", got, err)
+	}
+}
+
+func TestRequestLoader(t *testing.T) {
+	newContext := func(loaders *Loaders) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if loaders != nil {
+			reqctx.Set(c, KeyLoaders, loaders)
+		}
+		return c
+	}
+	var loads int
+	load := func(ctx context.Context, ids []any) (map[string]int, error) {
+		loads++
+		values := map[string]int{}
+		for _, id := range ids {
+			values[fmt.Sprint(id)] = id.(int) * 10
+		}
+		return values, nil
+	}
+	ids := []any{1, 2, 3}
+
+	tests := []struct {
+		name      string
+		loaders   *Loaders
+		wantLoads int
+	}{
+		{"one load by the Loaders of the request", NewLoaders(ids), 1},
+		{"one load by id without Loaders", nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loads = 0
+			c := newContext(tt.loaders)
+			for _, id := range ids {
+				got, err := RequestLoader(c, "tens", load).Load(c, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := id.(int) * 10; got != want {
+					t.Errorf("Load(%v) = %d, want %d", id, got, want)
+				}
+			}
+			if loads != tt.wantLoads {
+				t.Errorf("loads = %d, want %d", loads, tt.wantLoads)
+			}
+		})
+	}
+
+	t.Run("another type under the name", func(t *testing.T) {
+		c := newContext(NewLoaders(ids))
+		if _, err := RequestLoader(c, "tens", load).Load(c, 1); err != nil {
+			t.Fatal(err)
+		}
+		other := RequestLoader(c, "tens", func(ctx context.Context, ids []any) (map[string]string, error) {
+			return map[string]string{}, nil
+		})
+		if _, err := other.Load(c, 1); !errors.Is(err, ErrLoaderType) {
+			t.Errorf("err = %v, want ErrLoaderType", err)
+		}
+		if got, err := RequestLoader(c, "tens", load).Load(c, 2); err != nil || got != 20 {
+			t.Errorf("Load(2) = %d, %v, want 20, nil: the loader registered is kept", got, err)
+		}
+	})
+}
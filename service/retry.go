@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/tqrj/cd/enum"
+	"gorm.io/gorm"
+)
+
+// RetryPolicy configures the retries of RetryTransaction, see
+// enum.RetryPolicy.
+type RetryPolicy = enum.RetryPolicy
+
+// DefaultRetryPolicy is used by RetryTransaction for a nil policy.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    20 * time.Millisecond,
+	MaxBackoff: time.Second,
+}
+
+// RetryTransaction runs fc in a transaction like Transaction, retrying it
+// in a fresh transaction on the transient errors (deadlocks, serialization
+// failures, ...) of the policy (nil for DefaultRetryPolicy). The other
+// errors are returned at once, as well as the last one if the attempts
+// are exhausted.
+//
+//	err := service.RetryTransaction(ctx, nil, func(tx *gorm.DB) error {
+//		if err := tx.Model(&from).Update("balance", gorm.Expr("balance - ?", 10)).Error; err != nil {
+//			return err
+//		}
+//		return tx.Model(&to).Update("balance", gorm.Expr("balance + ?", 10)).Error
+//	})
+//
+// fc may be called several times: it should not have side effects out
+// of tx (or ones safe to repeat).
+func RetryTransaction(ctx context.Context, policy *RetryPolicy, fc func(tx *gorm.DB) error) error {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	return retry(ctx, "RetryTransaction", policy, func() error {
+		return Transaction(ctx, fc)
+	})
+}
+
+// retry runs the write fc, which is run in a (fresh) transaction of its
+// own, again on the transient errors of the policy: see RetryTransaction.
+// A nil policy (e.g. no Retry in the options of the route) means no retry.
+func retry(ctx context.Context, op string, policy *RetryPolicy, fc func() error) error {
+	if policy == nil {
+		return fc()
+	}
+	isTransient := policy.IsTransient
+	if isTransient == nil {
+		isTransient = IsTransientError
+	}
+
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fc()
+		if err == nil || attempt >= policy.Attempts || !isTransient(err) {
+			return err
+		}
+		logger.WithContext(ctx).WithError(err).
+			Warnf("%s: transient error, retrying (attempt %d of %d)", op, attempt+1, policy.Attempts)
+
+		wait := backoff
+		if wait > 1 {
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// IsTransientError reports whether err is a transient error of the
+// database drivers, which a retry of the transaction may get through:
+//
+//   - MySQL: 1213 (deadlock), 1205 (lock wait timeout)
+//   - PostgreSQL: 40001 (serialization failure), 40P01 (deadlock detected)
+//   - SQLite: SQLITE_BUSY, SQLITE_LOCKED
+func IsTransientError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
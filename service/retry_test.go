@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+)
+
+// failWrites fails the first n writes (creates, updates and deletes) of
+// orm.DB with err, counting the attempts.
+func failWrites(t *testing.T, n int, err error) *int {
+	t.Helper()
+	attempts := new(int)
+	fail := func(db *gorm.DB) {
+		if *attempts++; *attempts <= n {
+			db.AddError(err)
+		}
+	}
+	callback := orm.DB.Callback()
+	for _, e := range []error{
+		callback.Create().Before("gorm:create").Register("test:fail_writes", fail),
+		callback.Update().Before("gorm:update").Register("test:fail_writes", fail),
+		callback.Delete().Before("gorm:delete").Register("test:fail_writes", fail),
+	} {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	return attempts
+}
+
+func TestRetry_Options(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	policy := &enum.RetryPolicy{Attempts: 3}
+	ctx := context.Background()
+	connect := func() {
+		if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+			t.Fatal(err)
+		}
+		if err := orm.RegisterModel(&ticket{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		connect()
+		attempts := failWrites(t, 2, busy)
+		err := Create(ctx, &ticket{Title: "busy"}, &enum.CreateOption{Retry: policy}, IfNotExist())
+		if err != nil || *attempts != 3 {
+			t.Errorf("Create with Retry: err = %v, attempts = %d, want nil, 3", err, *attempts)
+		}
+
+		*attempts = 0
+		err = Create(ctx, &ticket{Title: "busy"}, &enum.CreateOption{}, IfNotExist())
+		if !errors.Is(err, busy) || *attempts != 1 {
+			t.Errorf("Create without Retry: err = %v, attempts = %d, want %v, 1", err, *attempts, busy)
+		}
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		connect()
+		model := &ticket{Title: "saved"}
+		if err := orm.DB.Create(model).Error; err != nil {
+			t.Fatal(err)
+		}
+		attempts := failWrites(t, 2, busy)
+		model.Title = "updated"
+		if _, err := Update(ctx, model, &enum.UpdateOption{Retry: policy}); err != nil || *attempts != 3 {
+			t.Errorf("Update with Retry: err = %v, attempts = %d, want nil, 3", err, *attempts)
+		}
+
+		*attempts = 0
+		if _, err := DeleteByID[ticket](ctx, model.ID, &enum.DelOption{Retry: policy}); err != nil || *attempts != 3 {
+			t.Errorf("DeleteByID with Retry: err = %v, attempts = %d, want nil, 3", err, *attempts)
+		}
+	})
+
+	t.Run("not transient", func(t *testing.T) {
+		connect()
+		failed := errors.New("failed")
+		attempts := failWrites(t, 1, failed)
+		err := Create(ctx, &ticket{Title: "failed"}, &enum.CreateOption{Retry: policy}, IfNotExist())
+		if !errors.Is(err, failed) || *attempts != 1 {
+			t.Errorf("Create with Retry: err = %v, attempts = %d, want %v, 1 (no retry)", err, *attempts, failed)
+		}
+	})
+}
@@ -4,8 +4,105 @@
 // your own services with the orm.DB (a *gorm.DB) instance.
 package service
 
-import "github.com/tqrj/cd/log"
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/log"
+	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+)
 
 // TODO: use orm.Model instead of any
 
 var logger = log.ZoneLogger("crud/service")
+
+// SetDB sets the DB of the services: the global orm.DB (see orm.UseDB),
+// e.g. to the database or the transaction of a test, and returns the
+// function resetting the previous one:
+//
+//	reset := service.SetDB(testDB)
+//	defer reset()
+//
+// The DB is global: the tests setting it can not run in parallel. See
+// the servicetest package for the helpers of the tests.
+func SetDB(db *gorm.DB) (reset func()) {
+	previous := orm.DB
+	orm.UseDB(db)
+	return func() { orm.DB = previous }
+}
+
+// newDB returns a new session of the global orm.DB with the context ctx,
+// and the SQLComment if enabled. All queries of the service start from it,
+// so that their reads are scoped by the registered orm.GlobalScope (see
+// orm.RegisterGlobalScope), from ctx.
+//
+// A *gin.Context is cancelled with its http request (e.g. the client
+// disconnects), so that its queries are cancelled by the driver, whether
+// the gin.Engine's ContextWithFallback is set or not.
+func newDB(ctx context.Context) *gorm.DB {
+	db := orm.DB.WithContext(withRequestContext(ctx))
+	if SQLComment != nil {
+		db = withComment(db, SQLComment(ctx))
+	}
+	return db
+}
+
+// requestContext is a *gin.Context with the deadline and cancellation of
+// its http request, which gin.Context only forwards with the engine's
+// ContextWithFallback.
+type requestContext struct {
+	context.Context // of the http request
+	c               *gin.Context
+}
+
+func (ctx requestContext) Value(key any) any {
+	if value := ctx.c.Value(key); value != nil {
+		return value
+	}
+	return ctx.Context.Value(key)
+}
+
+// withRequestContext returns the requestContext of ctx if it is a
+// *gin.Context with a http request, else ctx itself.
+func withRequestContext(ctx context.Context) context.Context {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		return requestContext{Context: c.Request.Context(), c: c}
+	}
+	return ctx
+}
+
+// withSession applies the session config to db, if it is not nil.
+func withSession(db *gorm.DB, session *gorm.Session) *gorm.DB {
+	if session == nil {
+		return db
+	}
+	return db.Session(session)
+}
+
+// WithSession is a query option that applies the GORM session config to
+// the query, for example:
+//
+//	GetMany[User](&users, WithSession(&gorm.Session{PrepareStmt: true}))
+//
+// The *gorm.Session is a config struct: it is read but never modified, and
+// thus safe to be shared by all requests (like the Session fields of
+// enum.ListOption, ...). What is NOT safe to share is the *gorm.DB returned
+// by db.Session(...), which may carry conditions of a query.
+//
+// To apply a session globally, use:
+//
+//	orm.UseDB(orm.DB.Session(&gorm.Session{PrepareStmt: true}))
+func WithSession(session *gorm.Session) enum.QueryOption {
+	return func(tx *gorm.DB) *gorm.DB {
+		return withSession(tx, session)
+	}
+}
+
+// Transaction runs fc in a transaction of the global orm.DB with the
+// context ctx: it is committed if fc returns nil, else rolled back.
+// See RetryTransaction for the retries on deadlocks.
+func Transaction(ctx context.Context, fc func(tx *gorm.DB) error) error {
+	return newDB(ctx).Transaction(fc)
+}
@@ -0,0 +1,73 @@
+// Package servicetest provides the helpers of the integration tests of
+// the handlers and services of crud against a database:
+//
+//	func TestTodos(t *testing.T) {
+//	    servicetest.Open(t, &Todo{})  // an in-memory SQLite of the models
+//	    servicetest.Tx(t)             // rolled back at the end of the test
+//
+//	    r := gin.New()
+//	    r.POST("/todos", controller.CreateHandler[Todo](&enum.CreateOption{}))
+//	    ...
+//	}
+//
+// The DB of the services is global (orm.DB): the tests using the helpers
+// can not run in parallel.
+package servicetest
+
+import (
+	"testing"
+
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+	"gorm.io/gorm"
+)
+
+// Open opens an in-memory SQLite database of the models (migrated by
+// orm.RegisterModel) as the DB of the services for the test. The previous
+// DB is reset and the database is closed at the end of the test.
+func Open(t testing.TB, models ...any) *gorm.DB {
+	t.Helper()
+	previous := orm.DB
+	db, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:")
+	if err != nil {
+		orm.DB = previous
+		t.Fatalf("servicetest: open: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		orm.DB = previous
+		t.Fatalf("servicetest: open: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1) // an in-memory database is of its connection
+	t.Cleanup(func() {
+		orm.DB = previous
+		_ = sqlDB.Close()
+	})
+	if err := orm.RegisterModel(models...); err != nil {
+		t.Fatalf("servicetest: register models: %v", err)
+	}
+	return db
+}
+
+// Tx begins a transaction of the current DB of the services, and sets it
+// as their DB for the test: all the writes of the test are rolled back at
+// its end, isolating the tests of a shared database (e.g. of TestMain).
+// The transactions of the services are nested into it by savepoints.
+func Tx(t testing.TB) *gorm.DB {
+	t.Helper()
+	if orm.DB == nil {
+		t.Fatal("servicetest: Tx: no DB, see Open or orm.ConnectDB")
+	}
+	tx := orm.DB.Begin()
+	if tx.Error != nil {
+		t.Fatalf("servicetest: begin: %v", tx.Error)
+	}
+	reset := service.SetDB(tx)
+	t.Cleanup(func() {
+		reset()
+		if err := tx.Rollback().Error; err != nil {
+			t.Errorf("servicetest: rollback: %v", err)
+		}
+	})
+	return tx
+}
@@ -0,0 +1,41 @@
+package servicetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+	"github.com/tqrj/cd/service"
+)
+
+type item struct {
+	orm.BasicModel
+	Name string `gorm:"uniqueIndex"`
+}
+
+func TestTx_RolledBack(t *testing.T) {
+	db := Open(t, &item{})
+
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			Tx(t)
+			// UniqueBy creates in a transaction, nested into the test's one
+			opt := &enum.CreateOption{UniqueBy: []string{"name"}}
+			if err := service.Create(context.Background(), &item{Name: "x"}, opt, service.IfNotExist()); err != nil {
+				t.Fatal(err)
+			}
+			var count int64
+			if err := orm.DB.Model(&item{}).Count(&count).Error; err != nil || count != 1 {
+				t.Fatalf("count = %d, %v; want 1 in the transaction", count, err)
+			}
+		})
+		if orm.DB != db {
+			t.Fatal("the DB of the test is not reset after the transaction")
+		}
+		var count int64
+		if err := db.Model(&item{}).Count(&count).Error; err != nil || count != 0 {
+			t.Fatalf("count = %d, %v; want 0 after the rollback", count, err)
+		}
+	}
+}
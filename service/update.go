@@ -2,13 +2,24 @@ package service
 
 import (
 	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"github.com/spf13/cast"
 	"github.com/tqrj/cd/enum"
 	"github.com/tqrj/cd/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strconv"
+	"time"
 )
 
 // Update all fields of an existing model in database.
+//
+// The unique keys of an orm.UniqueKeyer model are checked before the
+// write: a key of another model fails it with a *DuplicateError.
 func Update(ctx context.Context, model any, opt *enum.UpdateOption) (rowsAffected int64, err error) {
 	logger.WithContext(ctx).
 		WithField("model", model).Trace("Update model")
@@ -18,21 +29,447 @@ func Update(ctx context.Context, model any, opt *enum.UpdateOption) (rowsAffecte
 			Warn("Update: model is nil, nothing to update")
 		return 0, ErrNoRecord
 	}
-	db := orm.DB.WithContext(ctx)
-	db = Omit(opt.Omit)(db)
-	result := db.Save(model)
-	if result.Error != nil {
+	if err := orm.NormalizeValues(model); err != nil {
 		logger.WithContext(ctx).
-			WithError(result.Error).Warn("Update: failed")
+			WithError(err).Warn("Update: NormalizeValues failed")
+		return 0, err
 	}
-	return result.RowsAffected, result.Error
+	if err := orm.CheckAllowedValues(model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("Update: CheckAllowedValues failed")
+		return 0, err
+	}
+	if skip, err := skipUnchanged(ctx, "Update", model, nil, nil, opt); skip || err != nil {
+		return 0, err
+	}
+	if err := checkUpdateDuplicates(ctx, "Update", model, nil, opt); err != nil {
+		return 0, err
+	}
+	var result *gorm.DB
+	err = retry(ctx, "Update", opt.Retry, func() error {
+		db := withSession(newDB(ctx), opt.Session)
+		result = Omit(opt.Omit)(db).Save(model)
+		return result.Error
+	})
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("Update: failed")
+		return 0, duplicateOr(ctx, model, nil, opt, err)
+	}
+	return result.RowsAffected, nil
+}
+
+// UpdateIfUnmodified is Update with optimistic concurrency by the update
+// time field (e.g. UpdatedAt), for models without a version column:
+//
+//	UPDATE T SET ... WHERE id = model.id AND updated_at = lastSeen
+//
+// lastSeen is the update time the client has last seen: a time.Time, a
+// string (RFC 3339, or an integer for unix time fields), or nil for the
+// update time in model (e.g. bound from the request body).
+// It returns ErrConflict if no row matched, i.e. the record has been
+// modified since.
+func UpdateIfUnmodified(ctx context.Context, model any, lastSeen any, opt *enum.UpdateOption) (rowsAffected int64, err error) {
+	logger.WithContext(ctx).
+		WithField("model", model).
+		WithField("lastSeen", lastSeen).Trace("UpdateIfUnmodified model")
+
+	if model == nil {
+		logger.WithContext(ctx).
+			Warn("UpdateIfUnmodified: model is nil, nothing to update")
+		return 0, ErrNoRecord
+	}
+	if err := orm.NormalizeValues(model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateIfUnmodified: NormalizeValues failed")
+		return 0, err
+	}
+	if err := orm.CheckAllowedValues(model); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateIfUnmodified: CheckAllowedValues failed")
+		return 0, err
+	}
+	unmodified, err := unmodifiedSince(model, lastSeen)
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateIfUnmodified: unmodifiedSince failed")
+		return 0, err
+	}
+	if skip, err := skipUnchanged(ctx, "UpdateIfUnmodified", model, nil, unmodified, opt); skip || err != nil {
+		return 0, err
+	}
+	if err := checkUpdateDuplicates(ctx, "UpdateIfUnmodified", model, nil, opt); err != nil {
+		return 0, err
+	}
+	var result *gorm.DB
+	err = retry(ctx, "UpdateIfUnmodified", opt.Retry, func() error {
+		db := withSession(newDB(ctx), opt.Session)
+		// not Save, which would insert the record if no row matched
+		result = Omit(opt.Omit)(db).Model(model).Where(unmodified).Select("*").Updates(model)
+		return result.Error
+	})
+	if err != nil {
+		result.Error = duplicateOr(ctx, model, nil, opt, err)
+	}
+	return conflictOf(ctx, "UpdateIfUnmodified", result)
 }
 
 var (
 	ErrNoRecord        = errors.New("no record found")
 	ErrMultipleRecords = errors.New("multiple records found")
+	ErrNoFilter        = errors.New("no filter to bound the operation")
+	ErrConflict        = errors.New("record has been modified since last seen")
+	ErrInvalidLastSeen = errors.New("invalid last seen update time")
 )
 
+// UpdateColumns updates only the given columns (column name => value) of
+// an existing model in database, zero values included:
+//
+//	UpdateColumns(ctx, &user, map[string]any{"count": 0}, opt)
+//	// UPDATE users SET count = 0, updated_at = now WHERE id = user.id
+//
+// Unlike Update, the other columns are not written, and only the unique
+// keys (see orm.UniqueKeyer) with any of the columns are checked.
+func UpdateColumns(ctx context.Context, model any, columns map[string]any, opt *enum.UpdateOption) (rowsAffected int64, err error) {
+	logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", model)).
+		WithField("columns", columns).Trace("UpdateColumns")
+
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	if err := orm.NormalizeColumnValues(model, columns); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumns: NormalizeColumnValues failed")
+		return 0, err
+	}
+	if err := orm.CheckAllowedColumnValues(model, columns); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumns: CheckAllowedColumnValues failed")
+		return 0, err
+	}
+	if skip, err := skipUnchanged(ctx, "UpdateColumns", model, columns, nil, opt); skip || err != nil {
+		return 0, err
+	}
+	if err := checkUpdateDuplicates(ctx, "UpdateColumns", model, columns, opt); err != nil {
+		return 0, err
+	}
+	var result *gorm.DB
+	err = retry(ctx, "UpdateColumns", opt.Retry, func() error {
+		result = withSession(newDB(ctx), opt.Session).Model(model).Updates(columns)
+		return result.Error
+	})
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumns: failed")
+		return 0, duplicateOr(ctx, model, columns, opt, err)
+	}
+	return result.RowsAffected, nil
+}
+
+// UpdateColumnsIfUnmodified is UpdateColumns with optimistic concurrency
+// by the update time field, see UpdateIfUnmodified.
+func UpdateColumnsIfUnmodified(ctx context.Context, model any, columns map[string]any, lastSeen any, opt *enum.UpdateOption) (rowsAffected int64, err error) {
+	logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", model)).
+		WithField("columns", columns).
+		WithField("lastSeen", lastSeen).Trace("UpdateColumnsIfUnmodified")
+
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	if err := orm.NormalizeColumnValues(model, columns); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumnsIfUnmodified: NormalizeColumnValues failed")
+		return 0, err
+	}
+	if err := orm.CheckAllowedColumnValues(model, columns); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumnsIfUnmodified: CheckAllowedColumnValues failed")
+		return 0, err
+	}
+	unmodified, err := unmodifiedSince(model, lastSeen)
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateColumnsIfUnmodified: unmodifiedSince failed")
+		return 0, err
+	}
+	if skip, err := skipUnchanged(ctx, "UpdateColumnsIfUnmodified", model, columns, unmodified, opt); skip || err != nil {
+		return 0, err
+	}
+	if err := checkUpdateDuplicates(ctx, "UpdateColumnsIfUnmodified", model, columns, opt); err != nil {
+		return 0, err
+	}
+	var result *gorm.DB
+	err = retry(ctx, "UpdateColumnsIfUnmodified", opt.Retry, func() error {
+		result = withSession(newDB(ctx), opt.Session).Model(model).Where(unmodified).Updates(columns)
+		return result.Error
+	})
+	if err != nil {
+		result.Error = duplicateOr(ctx, model, columns, opt, err)
+	}
+	return conflictOf(ctx, "UpdateColumnsIfUnmodified", result)
+}
+
+// skipUnchanged reports whether the update of the model (with the columns,
+// or all of its columns if nil) is to be skipped by opt.SkipUnchanged: the
+// values are the same as the ones of the record in the database. The
+// record is looked up (in the session of the write) under the condition
+// of the update, if any, e.g. the unmodified since of UpdateIfUnmodified:
+// a record not matching it is changed, for the write to report the
+// conflict. Nothing is skipped in the DryRun mode.
+func skipUnchanged(ctx context.Context, op string, model any, columns map[string]any, condition clause.Expression, opt *enum.UpdateOption) (bool, error) {
+	if !opt.SkipUnchanged {
+		return false, nil
+	}
+	db := withSession(newDB(ctx), opt.Session)
+	if db.DryRun {
+		return false, nil
+	}
+	if condition != nil {
+		db = db.Where(condition)
+	}
+	same, err := unchanged(ctx, db, model, columns, opt.Omit...)
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn(op + ": Unchanged failed")
+		return false, err
+	}
+	if same {
+		logger.WithContext(ctx).Trace(op + ": unchanged, skipped")
+	}
+	return same, nil
+}
+
+// Unchanged reports whether the update of the model would change nothing:
+// the values of its columns (other than the omitted ones, the primary keys
+// and the auto create / update time fields) are equal to the ones of the
+// record (by the primary keys of the model) in the database. With the
+// columns (column name => value, see UpdateColumns), only these columns
+// are compared, by their values set onto the record.
+//
+// A record not found is changed (false), for the update to report it.
+func Unchanged(ctx context.Context, model any, columns map[string]any, omit ...string) (bool, error) {
+	return unchanged(ctx, newDB(ctx), model, columns, omit...)
+}
+
+// unchanged is Unchanged, looking up the record by the query of db.
+func unchanged(ctx context.Context, db *gorm.DB, model any, columns map[string]any, omit ...string) (bool, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return false, err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	query := db.Model(model)
+	for _, field := range s.PrimaryFields {
+		value, zero := field.ValueOf(ctx, rv)
+		if zero {
+			return false, nil
+		}
+		query = query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+	}
+	current := reflect.New(s.ModelType)
+	if err := query.Take(current.Interface()).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	omitted := make(map[string]bool, len(omit))
+	for _, name := range omit {
+		omitted[name] = true
+	}
+	updated := rv
+	if columns != nil {
+		withValues, err := withColumns(ctx, current.Interface(), columns)
+		if err != nil {
+			return false, err
+		}
+		updated = reflect.ValueOf(withValues).Elem()
+	}
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey || field.AutoCreateTime > 0 || field.AutoUpdateTime > 0 {
+			continue
+		}
+		if columns != nil {
+			if _, ok := columns[field.DBName]; !ok {
+				continue
+			}
+		}
+		if omitted[field.Name] || omitted[field.DBName] {
+			continue
+		}
+		a, _ := field.ValueOf(ctx, current.Elem())
+		b, _ := field.ValueOf(ctx, updated)
+		if !EqualValues(a, b) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// withColumns returns a copy of the model with the values of the columns
+// (column name => value) set onto it, as a pointer.
+func withColumns(ctx context.Context, model any, columns map[string]any) (any, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	updated := reflect.New(s.ModelType)
+	updated.Elem().Set(reflect.Indirect(reflect.ValueOf(model)))
+	for column, value := range columns {
+		field := s.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("%w: %q of %s", orm.ErrUnknownColumn, column, s.Name)
+		}
+		if err := field.Set(ctx, updated.Elem(), value); err != nil {
+			return nil, err
+		}
+	}
+	return updated.Interface(), nil
+}
+
+// checkUpdateDuplicates checks the unique keys of the orm.UniqueKeyer model
+// for its update with the columns (nil for all of them): the keys with any
+// of the columns are checked on the model with their values, excluding the
+// model itself, failing with a *DuplicateError of the existing model. The
+// keys are checked over all the rows, as the unique indexes: the existing
+// model may be out of the scope of the update.
+func checkUpdateDuplicates(ctx context.Context, op string, model any, columns map[string]any, opt *enum.UpdateOption) error {
+	keys, err := orm.UniqueKeys(model)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	if columns != nil {
+		var updated [][]string
+		for _, key := range keys {
+			for _, column := range key {
+				if _, ok := columns[column]; ok {
+					updated = append(updated, key)
+					break
+				}
+			}
+		}
+		if len(updated) == 0 {
+			return nil
+		}
+		keys = updated
+		if model, err = withColumns(ctx, model, columns); err != nil {
+			return err
+		}
+	}
+	err = checkDuplicates(withSession(newDB(ctx), opt.Session), model, keys, true)
+	if err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn(op + ": checkDuplicates failed")
+	}
+	return err
+}
+
+// duplicateOr returns the *DuplicateError of the failed update of the model
+// (see checkUpdateDuplicates) if any: the write may be rejected by a unique
+// index for a duplicate written meanwhile. Else it returns err.
+func duplicateOr(ctx context.Context, model any, columns map[string]any, opt *enum.UpdateOption, err error) error {
+	if dup := checkUpdateDuplicates(ctx, "duplicateOr", model, columns, opt); errors.Is(dup, ErrDuplicate) {
+		return dup
+	}
+	return err
+}
+
+// EqualValues compares the field values, with times by their instants
+// (the locations differ after a round trip to the database).
+func EqualValues(a, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for va.Kind() == reflect.Ptr && vb.Kind() == reflect.Ptr {
+		if va.IsNil() || vb.IsNil() {
+			return va.IsNil() == vb.IsNil()
+		}
+		va, vb = va.Elem(), vb.Elem()
+	}
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	a, b = va.Interface(), vb.Interface()
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	if va, ok := a.(driver.Valuer); ok { // e.g. gorm.DeletedAt, sql.NullTime
+		if vb, ok := b.(driver.Valuer); ok {
+			da, errA := va.Value()
+			db, errB := vb.Value()
+			if errA == nil && errB == nil {
+				return EqualValues(da, db)
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// unmodifiedSince returns the condition of the update time field of model
+// being lastSeen (see UpdateIfUnmodified).
+func unmodifiedSince(model any, lastSeen any) (clause.Expression, error) {
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	field := updateTimeField(s)
+	if field == nil {
+		return nil, ErrNotTouchable
+	}
+
+	var value any
+	switch v := lastSeen.(type) {
+	case nil:
+		value, _ = field.ValueOf(context.Background(), reflect.Indirect(reflect.ValueOf(model)))
+	case string:
+		if field.DataType == schema.Time {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidLastSeen, v)
+			}
+			value = t.Local() // as gorm's default NowFunc
+		} else if value, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLastSeen, v)
+		}
+	case time.Time:
+		switch {
+		case field.DataType == schema.Time:
+			value = v.Local()
+		case field.AutoUpdateTime == schema.UnixNanosecond:
+			value = v.UnixNano()
+		case field.AutoUpdateTime == schema.UnixMillisecond:
+			value = v.UnixMilli()
+		default:
+			value = v.Unix()
+		}
+	default: // e.g. float64 of JSON numbers
+		if field.DataType == schema.Time {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLastSeen, v)
+		}
+		if value, err = cast.ToInt64E(v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLastSeen, v)
+		}
+	}
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value}, nil
+}
+
+// conflictOf returns the result of a conditional update, with ErrConflict
+// if no row matched. Nothing is matched in the DryRun mode, where no
+// statement is run: the result is returned as is.
+func conflictOf(ctx context.Context, op string, result *gorm.DB) (int64, error) {
+	if result.Error != nil {
+		logger.WithContext(ctx).
+			WithError(result.Error).Warn(op + ": failed")
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 && !result.Statement.DryRun {
+		logger.WithContext(ctx).Warn(op + ": conflict")
+		return 0, ErrConflict
+	}
+	return result.RowsAffected, nil
+}
+
 // UpdateField updates a single fields of an existing model in database.
 // It will try to GetByID first, to make sure the model exists, before updating.
 func UpdateField[T orm.Model](ctx context.Context, id any, field string, value interface{}) (rowsAffected int64, err error) {
@@ -41,6 +478,16 @@ func UpdateField[T orm.Model](ctx context.Context, id any, field string, value i
 		WithField("id", id).WithField("field", field).
 		WithField("value", value).Trace("UpdateField")
 
+	if value, err = orm.NormalizeValue(new(T), field, value); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateField: NormalizeValue failed")
+		return 0, err
+	}
+	if err := orm.CheckAllowedValue(new(T), field, value); err != nil {
+		logger.WithContext(ctx).
+			WithError(err).Warn("UpdateField: CheckAllowedValue failed")
+		return 0, err
+	}
 	var record T
 	if err := GetByID[T](ctx, id, &record); err != nil {
 		logger.WithContext(ctx).
@@ -48,10 +495,378 @@ func UpdateField[T orm.Model](ctx context.Context, id any, field string, value i
 			Warn("UpdateField: GetByID failed")
 		return 0, err
 	}
-	result := orm.DB.WithContext(ctx).Model(&record).Update(field, value)
+	result := newDB(ctx).Model(&record).Update(field, value)
 	if result.Error != nil {
 		logger.WithContext(ctx).
 			WithError(result.Error).Warn("UpdateField: failed")
 	}
 	return result.RowsAffected, result.Error
 }
+
+// ReplaceColumn is a search-and-replace update across the column of all
+// models T matching the options (which are required to bound the update):
+//
+//	UPDATE T SET column = to WHERE column = from AND ...
+//
+// If substring is true, occurrences of from inside column are replaced:
+//
+//	UPDATE T SET column = REPLACE(column, from, to)
+//	    WHERE column <> REPLACE(column, from, to) AND ...
+//
+// It returns the number of rows actually changed, whose ids are collected
+// into the AffectedIDs of ctx, if any.
+func ReplaceColumn[T any](ctx context.Context, column string, from, to any, substring bool, options ...enum.QueryOption) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("column", column).
+		WithField("from", from).WithField("to", to).
+		WithField("substring", substring)
+	logger.Trace("ReplaceColumn")
+
+	if len(options) == 0 {
+		logger.Warn("ReplaceColumn skipped: no filter to bound the update")
+		return 0, ErrNoFilter
+	}
+	field, err := orm.LookUpField(new(T), column)
+	if err != nil {
+		logger.WithError(err).Warn("ReplaceColumn: LookUpField failed")
+		return 0, err
+	}
+
+	if !substring { // substring replacements are not checked
+		if to, err = orm.NormalizeValue(new(T), column, to); err != nil {
+			logger.WithError(err).Warn("ReplaceColumn: NormalizeValue failed")
+			return 0, err
+		}
+		if err := orm.CheckAllowedValue(new(T), column, to); err != nil {
+			logger.WithError(err).Warn("ReplaceColumn: CheckAllowedValue failed")
+			return 0, err
+		}
+	}
+
+	var value any = to
+	if substring {
+		value = gorm.Expr("REPLACE(?, ?, ?)", clause.Column{Name: field.DBName}, from, to)
+	}
+	query := func(db *gorm.DB) *gorm.DB {
+		query := db.Model(new(T))
+		for _, option := range options {
+			query = option(query)
+		}
+		if substring {
+			return query.Where(clause.Neq{Column: clause.Column{Name: field.DBName}, Value: value})
+		}
+		return query.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: from})
+	}
+
+	rowsAffected, err = writeAffected[T](ctx, "ReplaceColumn", newDB(ctx), query, func(query *gorm.DB) *gorm.DB {
+		return query.Update(field.DBName, value)
+	})
+	if err != nil {
+		logger.WithError(err).Warn("ReplaceColumn: failed")
+	} else {
+		logger.WithField("rowsAffected", rowsAffected).
+			Info("ReplaceColumn: done")
+	}
+	return rowsAffected, err
+}
+
+// ReplaceAssociations replaces the to-many associations (field) of the
+// parent with exactly the children (a slice of models), adding and
+// removing associations as needed, in a transaction:
+//
+//	ReplaceAssociations(ctx, &user, "Roles", []*Role{{ID: 1}, {ID: 2}}, opt)
+//
+// Children without primary keys are created. For many-to-many associations,
+// the removed ones are deleted from the join table; for has-many, the
+// foreign keys of the removed ones are set to NULL (they are not deleted).
+// The rowsAffected is the number of the associations changed: the children
+// linked and created, and the ones unlinked.
+func ReplaceAssociations(ctx context.Context, parent any, field string, children any, opt *enum.UpdateOption) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("parent", fmt.Sprintf("%T", parent)).
+		WithField("field", field)
+	logger.Trace("ReplaceAssociations")
+
+	rel, err := relationshipOf(parent, field)
+	if err != nil {
+		logger.WithError(err).Warn("ReplaceAssociations: relationshipOf failed")
+		return 0, err
+	}
+	if rel.Type != schema.HasMany && rel.Type != schema.Many2Many {
+		logger.Warn("ReplaceAssociations: not a to-many association")
+		return 0, fmt.Errorf("%w: %q", ErrNotToMany, field)
+	}
+	pk := rel.FieldSchema.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("ReplaceAssociations: %w", ErrNoIdentityField)
+	}
+
+	db := newDB(ctx)
+	var policy *enum.RetryPolicy
+	if opt != nil {
+		db = withSession(db, opt.Session)
+		policy = opt.Retry
+	}
+	err = retry(ctx, "ReplaceAssociations", policy, func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			// counted before the replace, which sets the ids of the created
+			n, err := replacedCount(tx, parent, field, pk, children)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(parent).Association(field).Replace(children); err != nil {
+				return err
+			}
+			rowsAffected = n
+			return nil
+		})
+	})
+	if err != nil {
+		logger.WithError(err).Warn("ReplaceAssociations: failed")
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// replacedCount counts the associations (field) of the parent changed by
+// their replace with the children: the children without ids (created),
+// the ones not associated yet (linked), and the associated ones which are
+// not children (unlinked). pk is the primary key of the children.
+func replacedCount(tx *gorm.DB, parent any, field string, pk *schema.Field, children any) (int64, error) {
+	ctx := tx.Statement.Context
+	current := reflect.New(reflect.SliceOf(reflect.PtrTo(pk.Schema.ModelType)))
+	if err := tx.Model(parent).Association(field).Find(current.Interface()); err != nil {
+		return 0, err
+	}
+	associated := map[string]bool{}
+	for i := 0; i < current.Elem().Len(); i++ {
+		id, _ := pk.ValueOf(ctx, current.Elem().Index(i).Elem())
+		associated[fmt.Sprint(id)] = true
+	}
+
+	var n int64
+	kept := map[string]bool{}
+	values := reflect.Indirect(reflect.ValueOf(children))
+	for i := 0; i < values.Len(); i++ {
+		child := reflect.Indirect(values.Index(i))
+		id, zero := pk.ValueOf(ctx, child)
+		if zero {
+			n++ // created
+			continue
+		}
+		key := fmt.Sprint(id)
+		if kept[key] {
+			continue
+		}
+		kept[key] = true
+		if !associated[key] {
+			n++
+		}
+	}
+	for key := range associated {
+		if !kept[key] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+var ErrNotToMany = errors.New("not a to-many association")
+
+// Touch bumps the update time (UpdatedAt, or other autoUpdateTime field)
+// of the model to now, without changing any other column:
+//
+//	UPDATE T SET updated_at = now WHERE id = model.id
+//
+// The model should be loaded (i.e. with its primary key), and its update
+// time field is set to the new value as well.
+func Touch(ctx context.Context, model any) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", model))
+	logger.Trace("Touch: bump the update time")
+
+	s, err := orm.ParseSchema(model)
+	if err != nil {
+		return 0, err
+	}
+	field := updateTimeField(s)
+	if field == nil {
+		logger.Warn("Touch: no update time field")
+		return 0, ErrNotTouchable
+	}
+	updatedAt := field.DBName
+
+	// gorm sets the autoUpdateTime field to now, in the type of the field
+	// (time or unix seconds/milli/nano), when updating it from the struct.
+	result := newDB(ctx).Model(model).Select(updatedAt).Updates(model)
+	if result.Error != nil {
+		logger.WithError(result.Error).Warn("Touch: failed")
+	}
+	return result.RowsAffected, result.Error
+}
+
+var ErrNotTouchable = errors.New("model has no update time field")
+
+// updateTimeField returns the autoUpdateTime field (e.g. UpdatedAt) of the
+// schema, or nil if there is none.
+func updateTimeField(s *schema.Schema) *schema.Field {
+	for _, field := range s.Fields {
+		if field.AutoUpdateTime > 0 {
+			return field
+		}
+	}
+	return nil
+}
+
+// Reorder sets the position column of the models T in the order of ids
+// (drag-to-reorder of a sortable list), in a transaction:
+//
+//	id => position: 1=>1, 2=>2, 3=>4 (a gap), 4=>4 (a tie)
+//	ids: [3, 1]  => 3=>1, 2=>2, 1=>3, 4=>4
+//
+// The models of the list are the ones of the options, and with the same
+// parentColumn (if any) of the models of the ids, e.g. the cards of the
+// same board: ids of different parents fail with ErrMultipleParents. The
+// list is ordered by the positions (ties by the primary keys), the models
+// of the ids are placed in the slots they occupy in the order of the ids,
+// and all the models are renumbered from 1, compactly (the ids may be a
+// part of the list, e.g. the page of a UI). Only the changed positions are
+// updated. An id not found in the scope fails with ErrNoRecord.
+//
+// The positions are updated one by one, which conflicts with a unique
+// index on the position column.
+func Reorder[T any](ctx context.Context, column string, parentColumn string, ids []any, options ...enum.QueryOption) (rowsAffected int64, err error) {
+	logger := logger.WithContext(ctx).
+		WithField("model", fmt.Sprintf("%T", *new(T))).
+		WithField("column", column).
+		WithField("ids", ids)
+	logger.Trace("Reorder")
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	s, err := orm.ParseSchema(new(T))
+	if err != nil {
+		return 0, err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, ErrNoIdentityField
+	}
+	position, err := orm.LookUpField(new(T), column)
+	if err != nil {
+		logger.WithError(err).Warn("Reorder: LookUpField failed")
+		return 0, err
+	}
+	var parent *schema.Field
+	if parentColumn != "" {
+		if parent, err = orm.LookUpField(new(T), parentColumn); err != nil {
+			logger.WithError(err).Warn("Reorder: LookUpField failed")
+			return 0, err
+		}
+	}
+	keyOf := func(model *T) string {
+		id, _ := pk.ValueOf(ctx, reflect.ValueOf(model).Elem())
+		return fmt.Sprint(reflect.Indirect(reflect.ValueOf(id)).Interface())
+	}
+
+	err = newDB(ctx).Transaction(func(tx *gorm.DB) error {
+		scope := func() *gorm.DB {
+			query := tx.Model(new(T))
+			for _, option := range options {
+				query = option(query)
+			}
+			return query
+		}
+
+		var listed []*T
+		if err := scope().Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Values: ids}).
+			Find(&listed).Error; err != nil {
+			return err
+		}
+		if len(listed) != len(ids) {
+			return fmt.Errorf("%w: %d of %d ids found", ErrNoRecord, len(listed), len(ids))
+		}
+		moved := make(map[string]bool, len(listed))
+		for _, model := range listed {
+			moved[keyOf(model)] = true
+		}
+
+		list := scope()
+		if parent != nil {
+			value, _ := parent.ValueOf(ctx, reflect.ValueOf(listed[0]).Elem())
+			for _, model := range listed[1:] {
+				other, _ := parent.ValueOf(ctx, reflect.ValueOf(model).Elem())
+				if !EqualValues(value, other) {
+					return fmt.Errorf("%w: %s", ErrMultipleParents, parent.DBName)
+				}
+			}
+			if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+				value = nil // IS NULL
+			}
+			list = list.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: parent.DBName}, Value: value})
+		}
+		if tx.Dialector.Name() != "sqlite" { // no FOR UPDATE in SQLite, which locks the database on write
+			list = list.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var models []*T
+		if err := list.Select(pk.DBName, position.DBName).
+			Order(clause.OrderBy{Columns: []clause.OrderByColumn{
+				{Column: clause.Column{Table: clause.CurrentTable, Name: position.DBName}},
+				{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}},
+			}}).
+			Find(&models).Error; err != nil {
+			return err
+		}
+
+		// the slots of the moved models, filled in the order of the ids
+		slot := 0
+		order := map[string]int{}
+		for i, id := range ids {
+			order[fmt.Sprint(reflect.Indirect(reflect.ValueOf(id)).Interface())] = i
+		}
+		sorted := make([]*T, len(listed))
+		for _, model := range listed {
+			i, ok := order[keyOf(model)]
+			if !ok || sorted[i] != nil { // e.g. ids of another type than the primary key
+				return fmt.Errorf("%w: %s", ErrUnmatchedID, keyOf(model))
+			}
+			sorted[i] = model
+		}
+		for i, model := range models {
+			if moved[keyOf(model)] {
+				models[i] = sorted[slot]
+				slot++
+			}
+		}
+
+		for i, model := range models {
+			current, _ := position.ValueOf(ctx, reflect.ValueOf(model).Elem())
+			if n, err := cast.ToInt64E(reflect.Indirect(reflect.ValueOf(current)).Interface()); err == nil && n == int64(i+1) {
+				continue
+			}
+			id, _ := pk.ValueOf(ctx, reflect.ValueOf(model).Elem())
+			result := tx.Model(new(T)).
+				Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: id}).
+				Update(position.DBName, i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			rowsAffected += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Reorder: failed")
+		return 0, err
+	}
+	logger.WithField("rowsAffected", rowsAffected).Info("Reorder: done")
+	return rowsAffected, nil
+}
+
+var ErrMultipleParents = errors.New("models of multiple parents")
+
+// ErrUnmatchedID is the error of Reorder for a model found by the ids
+// whose primary key matches none of them by value, e.g. of another type.
+var ErrUnmatchedID = errors.New("model not matched by ids")
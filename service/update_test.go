@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tqrj/cd/enum"
+	"github.com/tqrj/cd/orm"
+)
+
+type ticket struct {
+	orm.BasicModel
+	Title string
+}
+
+func TestUpdateIfUnmodified_DryRun(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	saved := &ticket{Title: "saved"}
+	if err := orm.DB.Create(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	recorder := new(SQLRecorder)
+	opt := &enum.UpdateOption{Session: DryRunSession(nil, recorder)}
+
+	model := *saved
+	model.Title = "dry"
+	if _, err := UpdateIfUnmodified(ctx, &model, saved.UpdatedAt, opt); err != nil {
+		t.Errorf("UpdateIfUnmodified: %v, want no conflict in the DryRun mode", err)
+	}
+	if _, err := UpdateColumnsIfUnmodified(ctx, &model, map[string]any{"title": "dry"}, saved.UpdatedAt, opt); err != nil {
+		t.Errorf("UpdateColumnsIfUnmodified: %v, want no conflict in the DryRun mode", err)
+	}
+	if n := len(recorder.Statements()); n != 2 {
+		t.Errorf("statements recorded = %d, want 2", n)
+	}
+
+	var got ticket
+	if err := orm.DB.First(&got, saved.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "saved" {
+		t.Errorf("title = %q, want %q: written in the DryRun mode", got.Title, "saved")
+	}
+}
+
+func TestUpdateIfUnmodified_SkipUnchanged(t *testing.T) {
+	if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterModel(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	saved := &ticket{Title: "saved"}
+	if err := orm.DB.Create(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	opt := &enum.UpdateOption{SkipUnchanged: true}
+	stale := saved.UpdatedAt.Add(-time.Hour)
+
+	model := *saved
+	if _, err := UpdateIfUnmodified(ctx, &model, stale, opt); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateIfUnmodified stale and unchanged: err = %v, want ErrConflict", err)
+	}
+	columns := map[string]any{"title": "saved"}
+	if _, err := UpdateColumnsIfUnmodified(ctx, &model, columns, stale, opt); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateColumnsIfUnmodified stale and unchanged: err = %v, want ErrConflict", err)
+	}
+
+	if n, err := UpdateIfUnmodified(ctx, &model, saved.UpdatedAt, opt); err != nil || n != 0 {
+		t.Errorf("UpdateIfUnmodified unchanged: rowsAffected, err = %d, %v, want 0 (skipped), nil", n, err)
+	}
+	if n, err := UpdateColumnsIfUnmodified(ctx, &model, columns, saved.UpdatedAt, opt); err != nil || n != 0 {
+		t.Errorf("UpdateColumnsIfUnmodified unchanged: rowsAffected, err = %d, %v, want 0 (skipped), nil", n, err)
+	}
+
+	// the lookup runs in the session of the write: not in the DryRun mode
+	recorder := new(SQLRecorder)
+	dryRun := &enum.UpdateOption{SkipUnchanged: true, Session: DryRunSession(nil, recorder)}
+	if _, err := UpdateColumnsIfUnmodified(ctx, &model, columns, saved.UpdatedAt, dryRun); err != nil {
+		t.Fatal(err)
+	}
+	if statements := recorder.Statements(); len(statements) != 1 || !strings.HasPrefix(statements[0].SQL, "UPDATE") {
+		t.Errorf("statements = %+v, want the UPDATE only", statements)
+	}
+}
+
+type card struct {
+	ID       uint `gorm:"primaryKey"`
+	Board    uint
+	Position int
+}
+
+func TestReorder(t *testing.T) {
+	connect := func(t *testing.T, cards ...*card) {
+		t.Helper()
+		if _, err := orm.ConnectDB(orm.DBDriverSqlite, "file::memory:"); err != nil {
+			t.Fatal(err)
+		}
+		if err := orm.RegisterModel(&card{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := orm.DB.Create(cards).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	positions := func(t *testing.T) map[uint]int {
+		t.Helper()
+		var cards []card
+		if err := orm.DB.Find(&cards).Error; err != nil {
+			t.Fatal(err)
+		}
+		got := map[uint]int{}
+		for _, c := range cards {
+			got[c.ID] = c.Position
+		}
+		return got
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		cards        []*card
+		ids          []any
+		want         map[uint]int
+		rowsAffected int64
+	}{
+		{
+			"moves", []*card{{ID: 1, Position: 1}, {ID: 2, Position: 2}, {ID: 3, Position: 3}, {ID: 4, Position: 4}},
+			[]any{uint(3), uint(1)}, map[uint]int{1: 3, 2: 2, 3: 1, 4: 4}, 2,
+		},
+		{
+			"gaps and ties", []*card{{ID: 1, Position: 1}, {ID: 2, Position: 2}, {ID: 3, Position: 4}, {ID: 4, Position: 4}},
+			[]any{uint(3), uint(1)}, map[uint]int{1: 3, 2: 2, 3: 1, 4: 4}, 2,
+		},
+		{
+			"renumbered", []*card{{ID: 1, Position: 10}, {ID: 2, Position: 20}, {ID: 3, Position: 30}},
+			[]any{uint(2)}, map[uint]int{1: 1, 2: 2, 3: 3}, 3,
+		},
+		{
+			"parents", []*card{{ID: 1, Board: 1, Position: 1}, {ID: 2, Board: 2, Position: 1}, {ID: 3, Board: 2, Position: 2}, {ID: 4, Board: 1, Position: 2}},
+			[]any{uint(3), uint(2)}, map[uint]int{1: 1, 2: 2, 3: 1, 4: 2}, 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connect(t, tt.cards...)
+			rowsAffected, err := Reorder[card](ctx, "position", "board", tt.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rowsAffected != tt.rowsAffected {
+				t.Errorf("rowsAffected = %d, want %d", rowsAffected, tt.rowsAffected)
+			}
+			if got := positions(t); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("positions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		connect(t, &card{ID: 1, Board: 1, Position: 1}, &card{ID: 2, Board: 2, Position: 1})
+		errorTests := []struct {
+			ids  []any
+			want error
+		}{
+			{[]any{uint(1), uint(2)}, ErrMultipleParents},
+			{[]any{uint(1), uint(9)}, ErrNoRecord},
+			{[]any{"01"}, ErrUnmatchedID}, // found by the database, not by value
+		}
+		for _, tt := range errorTests {
+			if _, err := Reorder[card](ctx, "position", "board", tt.ids); !errors.Is(err, tt.want) {
+				t.Errorf("Reorder %v: err = %v, want %v", tt.ids, err, tt.want)
+			}
+		}
+		if got := positions(t); got[1] != 1 || got[2] != 1 {
+			t.Errorf("positions = %v, want unchanged", got)
+		}
+	})
+}